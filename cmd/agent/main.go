@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/NethermindEth/teeception/pkg/agent"
+	"github.com/NethermindEth/teeception/pkg/agent/chat"
 	"github.com/NethermindEth/teeception/pkg/agent/setup"
 	"github.com/NethermindEth/teeception/pkg/twitter"
 )
@@ -30,6 +31,11 @@ func main_impl() error {
 		return fmt.Errorf("failed to create unencumber data: %w", err)
 	}
 
+	migrationExporter, err := setup.NewMigrationExporterFromAllowList(output)
+	if err != nil {
+		return fmt.Errorf("failed to create migration exporter: %w", err)
+	}
+
 	agentConfig, err := agent.NewAgentConfigFromParams(&agent.AgentConfigParams{
 		TwitterClientMode: twitterClientMode,
 		TwitterClientConfig: &twitter.TwitterClientConfig{
@@ -52,10 +58,47 @@ func main_impl() error {
 		TaskConcurrency:              10,
 		TickRate:                     10 * time.Second,
 		SafeBlockDelta:               0,
-		MaxSystemPromptTokens:        800,
+		MaxSystemPromptTokens:        chat.DefaultSystemPromptTokenLimit,
 		MaxPromptTokens:              -1,
+		MaxTotalTokens:               chat.DefaultTotalTokenLimit,
 		PromptIndexerEndpoint:        output.PromptIndexerEndpoint,
 		PromptIndexerApiKey:          output.PromptIndexerApiKey,
+		MigrationExporter:            migrationExporter,
+		LowBalanceThreshold:          agent.EnvGetLowBalanceThreshold(),
+		BalanceAlertWebhookUrl:       agent.EnvGetBalanceAlertWebhookUrl(),
+		ReconcileInterval:            5 * time.Minute,
+		MemoryDbPath:                 agent.EnvGetMemoryDbPath(),
+		MemoryAllAgents:              agent.EnvGetMemoryAllAgents(),
+		MemoryModels:                 agent.EnvGetMemoryModels(),
+		ModerationSecrets: []string{
+			output.TwitterPassword,
+			output.ProtonPassword,
+			output.TwitterConsumerSecret,
+			output.TwitterAccessToken,
+			output.TwitterAccessTokenSecret,
+			output.PromptIndexerApiKey,
+		},
+		ModerationBlockedWords:  agent.EnvGetModerationBlockedWords(),
+		ModerationUseOpenAI:     agent.EnvGetModerationUseOpenAI(),
+		MentionPollInterval:     agent.EnvGetMentionPollInterval(),
+		MentionPaymentUrl:       agent.EnvGetMentionPaymentUrl(),
+		OutboxDbPath:            agent.EnvGetOutboxDbPath(),
+		RequireLinkedHandle:     agent.EnvGetRequireLinkedHandle(),
+		TwitterFallbackAccounts: agent.EnvGetTwitterFallbackAccounts(),
+		TwitterWriteFailover:    agent.EnvGetTwitterWriteFailover(),
+		ModelBackends:           agent.EnvGetModelBackends(),
+		ChatFallbacks:           agent.EnvGetChatFallbacks(),
+		UsageDbPath:             agent.EnvGetUsageDbPath(),
+		UsagePrices:             agent.EnvGetUsagePrices(),
+		BudgetDailyCap:          agent.EnvGetBudgetDailyCap(),
+		BudgetCaps:              agent.EnvGetBudgetCaps(),
+		BudgetExceededAction:    agent.EnvGetBudgetExceededAction(),
+		BudgetDegradeModel:      agent.EnvGetBudgetDegradeModel(),
+		ChatCassettePath:        agent.EnvGetChatCassettePath(),
+		ReplyMaxRetries:         agent.EnvGetReplyMaxRetries(),
+		GuardModels:             agent.EnvGetGuardModels(),
+		GuardDbPath:             agent.EnvGetGuardDbPath(),
+		ConsensusModels:         agent.EnvGetConsensusModels(),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create agent config: %w", err)
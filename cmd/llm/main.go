@@ -23,12 +23,93 @@ var (
 	warn    = color.New(color.FgYellow).SprintFunc()
 )
 
+const (
+	providerOpenAI    = "openai"
+	providerAnthropic = "anthropic"
+)
+
 type ChatParams struct {
+	Provider     string
 	APIURL       string
 	AuthToken    string
 	Model        string
 	SystemPrompt string
 	Prompt       string
+	Cassette     CassetteParams
+}
+
+// CassetteParams configures the cassette exchanges are recorded to or
+// replayed from. An empty path disables it.
+type CassetteParams struct {
+	Path     string
+	Mode     string
+	Matching string
+}
+
+// newChatCompletion creates the chat completion of a provider. An empty
+// apiURL or model selects the default of the provider.
+func newChatCompletion(provider, apiURL, authToken, model string) (chat.ChatCompletion, error) {
+	switch provider {
+	case providerOpenAI:
+		clientConfig := openai.DefaultConfig(authToken)
+		if apiURL != "" {
+			clientConfig.BaseURL = apiURL
+		}
+
+		return chat.NewOpenAIChatCompletion(chat.OpenAIChatCompletionConfig{
+			Client: openai.NewClientWithConfig(clientConfig),
+			Model:  model,
+		}), nil
+	case providerAnthropic:
+		return chat.NewAnthropicChatCompletion(chat.AnthropicChatCompletionConfig{
+			ApiKey:  authToken,
+			BaseUrl: apiURL,
+			Model:   model,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown provider %q", provider)
+	}
+}
+
+// withCassette wraps the chat completion in the cassette, if any.
+func withCassette(chatClient chat.ChatCompletion, params CassetteParams) (chat.ChatCompletion, error) {
+	if params.Path == "" {
+		return chatClient, nil
+	}
+
+	return chat.NewCassetteChatCompletion(chat.CassetteChatCompletionConfig{
+		Path:           params.Path,
+		ChatCompletion: chatClient,
+		Mode:           chat.CassetteMode(params.Mode),
+		Matching:       chat.CassetteMatching(params.Matching),
+	})
+}
+
+// newAgentChatCompletion creates the chat completion of the provider wrapped
+// the way agents wrap theirs, with their token limits beneath the cassette
+// and their reply constraints on top, so that responses are those an agent
+// would post.
+func newAgentChatCompletion(provider, apiURL, authToken, model string, cassette CassetteParams) (chat.ChatCompletion, error) {
+	chatClient, err := newChatCompletion(provider, apiURL, authToken, model)
+	if err != nil {
+		return nil, err
+	}
+
+	chatClient = chat.NewTokenLimitChatCompletion(chat.TokenLimitChatCompletionConfig{
+		ChatCompletion:         chatClient,
+		SystemPromptTokenLimit: chat.DefaultSystemPromptTokenLimit,
+		PromptTokenLimit:       -1,
+		TotalTokenLimit:        chat.DefaultTotalTokenLimit,
+	})
+
+	chatClient, err = withCassette(chatClient, cassette)
+	if err != nil {
+		return nil, err
+	}
+
+	return chat.NewConstrainedChatCompletion(chat.ConstrainedChatCompletionConfig{
+		ChatCompletion: chatClient,
+	}), nil
 }
 
 func executeChat(params ChatParams) (*chat.ChatCompletionResponse, error) {
@@ -36,17 +117,17 @@ func executeChat(params ChatParams) (*chat.ChatCompletionResponse, error) {
 
 	fmt.Printf("\n%s Starting chat completion...\n", info("💬"))
 
-	clientConfig := openai.DefaultConfig(params.AuthToken)
-	clientConfig.BaseURL = params.APIURL
-
 	s.Suffix = " Creating chat client..."
 	s.Start()
-	client := openai.NewClientWithConfig(clientConfig)
-	chatClient := chat.NewOpenAIChatCompletion(chat.OpenAIChatCompletionConfig{
-		Client: client,
-		Model:  params.Model,
-	})
+	chatClient, err := newChatCompletion(params.Provider, params.APIURL, params.AuthToken, params.Model)
+	if err == nil {
+		chatClient, err = withCassette(chatClient, params.Cassette)
+	}
 	s.Stop()
+	if err != nil {
+		fmt.Printf("%s Failed to create chat client\n", fail("❌"))
+		return nil, err
+	}
 	fmt.Printf("%s Chat client created successfully\n", success("✓"))
 
 	s.Suffix = " Sending prompt..."
@@ -64,22 +145,22 @@ func executeChat(params ChatParams) (*chat.ChatCompletionResponse, error) {
 	return response, nil
 }
 
-func validateName(apiURL, authToken, model, name string) (bool, error) {
+func validateName(provider, apiURL, authToken, model, name string, cassette CassetteParams) (bool, error) {
 	s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
 
 	fmt.Printf("\n%s Validating name: %s\n", info("🔍"), name)
 
-	clientConfig := openai.DefaultConfig(authToken)
-	clientConfig.BaseURL = apiURL
-
 	s.Suffix = " Creating chat client..."
 	s.Start()
-	client := openai.NewClientWithConfig(clientConfig)
-	chatClient := chat.NewOpenAIChatCompletion(chat.OpenAIChatCompletionConfig{
-		Client: client,
-		Model:  model,
-	})
+	chatClient, err := newChatCompletion(provider, apiURL, authToken, model)
+	if err == nil {
+		chatClient, err = withCassette(chatClient, cassette)
+	}
 	s.Stop()
+	if err != nil {
+		fmt.Printf("%s Failed to create chat client\n", fail("❌"))
+		return false, err
+	}
 	fmt.Printf("%s Chat client created successfully\n", success("✓"))
 
 	s.Suffix = " Validating name..."
@@ -101,38 +182,27 @@ func validateName(apiURL, authToken, model, name string) (bool, error) {
 	return valid, nil
 }
 
+func randomFelt() *felt.Felt {
+	randomBytes := make([]byte, 32)
+	rand.Read(randomBytes)
+	return new(felt.Felt).SetBytes(randomBytes)
+}
+
 func buildMetadata() string {
-	randomFelt := func() *felt.Felt {
-		randomBytes := make([]byte, 32)
-		rand.Read(randomBytes)
-		return new(felt.Felt).SetBytes(randomBytes)
-	}
-
-	address := randomFelt()
-	creator := randomFelt()
-	user := randomFelt()
-
-	return fmt.Sprintf(`
-Your address: %s
-Your creator address: %s
-Responding to address: %s
-
-You can either send a message or drain.
-Don't expect the user to reply to your message.
-Your reply must be at most 280 characters long.`,
-		address.String(),
-		creator.String(),
-		user.String(),
-	)
+	return chat.BuildMetadata(randomFelt().String(), randomFelt().String(), randomFelt().String())
 }
 
 func main() {
+	var provider string
 	var apiURL string
 	var authToken string
 	var model string
 	var systemPrompt string
 	var prompt string
 	var nameToValidate string
+	var cassette CassetteParams
+	var eval EvalParams
+	var repl ReplParams
 
 	rootCmd := &cobra.Command{
 		Use:   "llm",
@@ -141,11 +211,13 @@ func main() {
 			fmt.Printf("\n%s Starting LLM interaction...\n", info("🚀"))
 
 			params := ChatParams{
+				Provider:     provider,
 				APIURL:       apiURL,
 				AuthToken:    authToken,
 				Model:        model,
 				SystemPrompt: systemPrompt,
 				Prompt:       prompt,
+				Cassette:     cassette,
 			}
 
 			response, err := executeChat(params)
@@ -164,6 +236,13 @@ func main() {
 				fmt.Printf("\n%s No drain call detected\n", success("✅"))
 			}
 
+			for _, call := range response.ToolCalls {
+				if call.Name == chat.DrainToolName {
+					continue
+				}
+				fmt.Printf("\n%s Tool call %s: %s\n", info("🔧"), call.Name, color.New(color.FgYellow).Sprint(string(call.Arguments)))
+			}
+
 			fmt.Printf("\n%s Chat completed successfully!\n\n", success("✅"))
 		},
 	}
@@ -174,7 +253,7 @@ func main() {
 		Run: func(cmd *cobra.Command, args []string) {
 			fmt.Printf("\n%s Starting name validation...\n", info("🚀"))
 
-			valid, err := validateName(apiURL, authToken, model, nameToValidate)
+			valid, err := validateName(provider, apiURL, authToken, model, nameToValidate, cassette)
 			if err != nil {
 				fmt.Printf("\n%s Error validating name: %v\n", fail("❌"), err)
 				os.Exit(1)
@@ -184,9 +263,66 @@ func main() {
 		},
 	}
 
-	rootCmd.PersistentFlags().StringVar(&apiURL, "api-url", "https://api.openai.com/v1", "API URL for the LLM service")
+	evalCmd := &cobra.Command{
+		Use:   "eval",
+		Short: "Evaluate a system prompt against a corpus of attack prompts",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Printf("\n%s Starting red-team evaluation...\n", info("🚀"))
+
+			eval.Provider = provider
+			eval.APIURL = apiURL
+			eval.AuthToken = authToken
+			eval.Model = model
+			eval.Cassette = cassette
+
+			report, err := runEval(eval)
+			if err != nil {
+				fmt.Printf("\n%s Error running evaluation: %v\n", fail("❌"), err)
+				os.Exit(1)
+			}
+
+			printEvalReport(report)
+
+			if eval.ReportPath != "" {
+				if err := writeEvalReport(report, eval.ReportPath); err != nil {
+					fmt.Printf("\n%s Error writing report: %v\n", fail("❌"), err)
+					os.Exit(1)
+				}
+			}
+
+			fmt.Println()
+		},
+	}
+
+	replCmd := &cobra.Command{
+		Use:   "repl",
+		Short: "Chat with an agent loaded from a file or from chain, as attackers would",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Printf("\n%s Starting interactive session...\n", info("🚀"))
+
+			repl.Provider = provider
+			repl.APIURL = apiURL
+			repl.AuthToken = authToken
+			repl.Model = model
+			repl.Cassette = cassette
+
+			if err := runRepl(repl); err != nil {
+				fmt.Printf("\n%s Error running session: %v\n", fail("❌"), err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("\n%s Session ended\n\n", success("✅"))
+		},
+	}
+
+	rootCmd.PersistentFlags().StringVar(&provider, "provider", providerOpenAI, "LLM provider, openai or anthropic")
+	rootCmd.PersistentFlags().StringVar(&apiURL, "api-url", "", "API URL for the LLM service, defaults to the API of the provider")
 	rootCmd.PersistentFlags().StringVar(&authToken, "auth-token", "", "Authentication token for the LLM service")
-	rootCmd.PersistentFlags().StringVar(&model, "model", "gpt-4", "Model to use for completion")
+	rootCmd.PersistentFlags().StringVar(&model, "model", "", "Model to use for completion, defaults to the model of the agent in repl, else to gpt-4 or "+chat.DefaultAnthropicModel)
+
+	rootCmd.PersistentFlags().StringVar(&cassette.Path, "cassette", "", "JSONL file exchanges are recorded to or replayed from")
+	rootCmd.PersistentFlags().StringVar(&cassette.Mode, "cassette-mode", string(chat.CassetteModeAuto), "Cassette mode, record, replay or auto")
+	rootCmd.PersistentFlags().StringVar(&cassette.Matching, "cassette-matching", string(chat.CassetteMatchingStrict), "Cassette matching, strict or lenient")
 
 	rootCmd.Flags().StringVar(&systemPrompt, "system-prompt", "", "System prompt/instructions")
 	rootCmd.Flags().StringVar(&prompt, "prompt", "", "User prompt to execute")
@@ -194,10 +330,29 @@ func main() {
 	validateCmd.Flags().StringVar(&nameToValidate, "name", "", "Name to validate")
 	validateCmd.MarkFlagRequired("name")
 
+	evalCmd.Flags().StringVar(&eval.SystemPrompt, "system-prompt", "", "System prompt/instructions to evaluate")
+	evalCmd.Flags().StringVar(&eval.AgentName, "agent-name", "agent", "Name of the agent, replies are tagged with it")
+	evalCmd.Flags().StringVar(&eval.CorpusPath, "corpus", "", "JSONL file of attack prompts, one {\"id\", \"prompt\"} object per line")
+	evalCmd.Flags().IntVar(&eval.Runs, "runs", 5, "Number of times each attack prompt is run")
+	evalCmd.Flags().IntVar(&eval.Concurrency, "concurrency", 4, "Number of runs in flight")
+	evalCmd.Flags().DurationVar(&eval.Timeout, "timeout", time.Minute, "Timeout of each run, 0 to disable")
+	evalCmd.Flags().StringVar(&eval.ReportPath, "report", "", "JSON file the report is written to")
+	evalCmd.MarkFlagRequired("system-prompt")
+	evalCmd.MarkFlagRequired("corpus")
+
+	replCmd.Flags().StringVar(&repl.AgentFile, "agent-file", "", "JSON file of the agent, with its name, system_prompt and optional address, creator and model")
+	replCmd.Flags().StringVar(&repl.AgentAddress, "agent-address", "", "Address of an agent to load from chain")
+	replCmd.Flags().StringArrayVar(&repl.ProviderURLs, "provider-url", nil, "Starknet provider URL to load the agent from (can be specified multiple times)")
+	replCmd.Flags().StringVar(&repl.RegistryAddress, "registry-addr", "", "Agent registry contract address")
+	replCmd.Flags().BoolVar(&repl.Memory, "memory", false, "Remember the conversation with each attacker")
+	replCmd.Flags().StringVar(&repl.TranscriptPath, "transcript", "", "JSON file the transcript is saved to when the session ends")
+
 	rootCmd.MarkPersistentFlagRequired("auth-token")
 	rootCmd.MarkFlagRequired("prompt")
 
 	rootCmd.AddCommand(validateCmd)
+	rootCmd.AddCommand(evalCmd)
+	rootCmd.AddCommand(replCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Printf("%s %v\n", fail("❌"), err)
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/starknet.go/rpc"
+	starknetgoutils "github.com/NethermindEth/starknet.go/utils"
+	"github.com/briandowns/spinner"
+	"github.com/fatih/color"
+
+	"github.com/NethermindEth/teeception/pkg/agent/chat"
+	"github.com/NethermindEth/teeception/pkg/agent/usage"
+	"github.com/NethermindEth/teeception/pkg/indexer"
+	"github.com/NethermindEth/teeception/pkg/twitter/composer"
+	"github.com/NethermindEth/teeception/pkg/wallet/starknet"
+)
+
+const replHelp = `Commands:
+  /attacker [address|random|creator]  show or switch the address prompting the agent
+  /memory [on|off]                    show or toggle the conversation memory
+  /reset                              forget the conversation with the attacker
+  /info                               show the agent
+  /usage                              show the tokens and cost of the session
+  /save [path]                        save the transcript
+  /help                               show this help
+  /quit                               end the session
+Any other line is sent to the agent as a prompt.`
+
+// ReplParams configures an interactive session with an agent, loaded either
+// from AgentFile or from AgentAddress on chain.
+type ReplParams struct {
+	Provider        string
+	APIURL          string
+	AuthToken       string
+	Model           string
+	AgentFile       string
+	AgentAddress    string
+	ProviderURLs    []string
+	RegistryAddress string
+	Memory          bool
+	TranscriptPath  string
+	Cassette        CassetteParams
+}
+
+// ReplAgentFile is a local agent definition. Missing addresses are random.
+// Model is the model the agent is served with, as registered on chain.
+type ReplAgentFile struct {
+	Name         string `json:"name"`
+	SystemPrompt string `json:"system_prompt"`
+	Address      string `json:"address"`
+	Creator      string `json:"creator"`
+	Model        string `json:"model"`
+}
+
+// ReplTurn is a prompt of a session and the response of the agent.
+type ReplTurn struct {
+	Attacker  string                   `json:"attacker"`
+	Prompt    string                   `json:"prompt"`
+	Response  string                   `json:"response,omitempty"`
+	ToolCalls []chat.ToolCall          `json:"tool_calls,omitempty"`
+	DrainTo   string                   `json:"drain_to,omitempty"`
+	Model     string                   `json:"model,omitempty"`
+	Usage     chat.ChatCompletionUsage `json:"usage"`
+	Cost      float64                  `json:"cost"`
+	LatencyMs int64                    `json:"latency_ms"`
+	Error     string                   `json:"error,omitempty"`
+	CreatedAt int64                    `json:"created_at"`
+}
+
+// ReplTranscript is the record of a session.
+type ReplTranscript struct {
+	AgentName    string      `json:"agent_name"`
+	AgentAddress string      `json:"agent_address"`
+	Creator      string      `json:"creator"`
+	SystemPrompt string      `json:"system_prompt"`
+	StartedAt    int64       `json:"started_at"`
+	Turns        []*ReplTurn `json:"turns"`
+}
+
+type replSession struct {
+	chatClient chat.ChatCompletion
+	agent      indexer.AgentInfo
+	model      string
+	attacker   *felt.Felt
+	memory     bool
+	// histories are the conversations with each attacker, as the agent
+	// remembers them when memory is enabled.
+	histories      map[[32]byte][]chat.ChatMessage
+	transcript     *ReplTranscript
+	transcriptPath string
+
+	promptTokens     int
+	completionTokens int
+	cost             float64
+}
+
+// loadReplAgent loads the agent of the session.
+func loadReplAgent(params ReplParams) (indexer.AgentInfo, error) {
+	switch {
+	case params.AgentFile != "" && params.AgentAddress != "":
+		return indexer.AgentInfo{}, fmt.Errorf("only one of an agent file or an agent address can be given")
+	case params.AgentFile != "":
+		return loadReplAgentFile(params.AgentFile)
+	case params.AgentAddress != "":
+		return fetchReplAgent(params)
+	default:
+		return indexer.AgentInfo{}, fmt.Errorf("an agent file or an agent address is required")
+	}
+}
+
+func loadReplAgentFile(path string) (indexer.AgentInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return indexer.AgentInfo{}, fmt.Errorf("failed to read agent file: %w", err)
+	}
+
+	var file ReplAgentFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return indexer.AgentInfo{}, fmt.Errorf("failed to parse agent file: %w", err)
+	}
+	if file.SystemPrompt == "" {
+		return indexer.AgentInfo{}, fmt.Errorf("agent file has no system prompt")
+	}
+
+	parseOrRandom := func(field, address string) (*felt.Felt, error) {
+		if address == "" {
+			return randomFelt(), nil
+		}
+		addr, err := new(felt.Felt).SetString(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s address: %w", field, err)
+		}
+		return addr, nil
+	}
+
+	agent := indexer.AgentInfo{Name: file.Name, SystemPrompt: file.SystemPrompt}
+	if file.Model != "" {
+		agent.Model = new(felt.Felt).SetBytes([]byte(file.Model))
+	}
+	if agent.Address, err = parseOrRandom("agent", file.Address); err != nil {
+		return indexer.AgentInfo{}, err
+	}
+	if agent.Creator, err = parseOrRandom("creator", file.Creator); err != nil {
+		return indexer.AgentInfo{}, err
+	}
+
+	return agent, nil
+}
+
+func fetchReplAgent(params ReplParams) (indexer.AgentInfo, error) {
+	if len(params.ProviderURLs) == 0 || params.RegistryAddress == "" {
+		return indexer.AgentInfo{}, fmt.Errorf("a provider URL and a registry address are required to load an agent from chain")
+	}
+
+	agentAddress, err := new(felt.Felt).SetString(params.AgentAddress)
+	if err != nil {
+		return indexer.AgentInfo{}, fmt.Errorf("invalid agent address: %w", err)
+	}
+	registryAddress, err := new(felt.Felt).SetString(params.RegistryAddress)
+	if err != nil {
+		return indexer.AgentInfo{}, fmt.Errorf("invalid registry address: %w", err)
+	}
+
+	providers := make([]rpc.RpcProvider, 0, len(params.ProviderURLs))
+	for _, url := range params.ProviderURLs {
+		provider, err := rpc.NewProvider(url)
+		if err != nil {
+			return indexer.AgentInfo{}, fmt.Errorf("failed to create RPC client for %s: %w", url, err)
+		}
+		providers = append(providers, provider)
+	}
+
+	client, err := starknet.NewRateLimitedMultiProvider(starknet.RateLimitedMultiProviderConfig{
+		Providers: providers,
+	})
+	if err != nil {
+		return indexer.AgentInfo{}, fmt.Errorf("failed to create rate limited client: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	return indexer.FetchAgentInfo(ctx, client, registryAddress, agentAddress)
+}
+
+func runRepl(params ReplParams) error {
+	s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
+
+	s.Suffix = " Loading agent..."
+	s.Start()
+	agent, err := loadReplAgent(params)
+	s.Stop()
+	if err != nil {
+		fmt.Printf("%s Failed to load agent\n", fail("❌"))
+		return err
+	}
+	fmt.Printf("%s Agent %s loaded\n", success("✓"), agent.Name)
+
+	// Agents are served with the model they were registered with.
+	if params.Model == "" && agent.Model != nil && !agent.Model.IsZero() {
+		params.Model = starknetgoutils.HexToShortStr(agent.Model.String())
+	}
+
+	chatClient, err := newAgentChatCompletion(params.Provider, params.APIURL, params.AuthToken, params.Model, params.Cassette)
+	if err != nil {
+		fmt.Printf("%s Failed to create chat client\n", fail("❌"))
+		return err
+	}
+	fmt.Printf("%s Chat client created successfully\n", success("✓"))
+
+	session := &replSession{
+		chatClient: chatClient,
+		agent:      agent,
+		model:      params.Model,
+		attacker:   randomFelt(),
+		memory:     params.Memory,
+		histories:  make(map[[32]byte][]chat.ChatMessage),
+		transcript: &ReplTranscript{
+			AgentName:    agent.Name,
+			AgentAddress: agent.Address.String(),
+			Creator:      agent.Creator.String(),
+			SystemPrompt: agent.SystemPrompt,
+			StartedAt:    time.Now().Unix(),
+		},
+		transcriptPath: params.TranscriptPath,
+	}
+
+	session.printInfo()
+	fmt.Printf("\n%s\n", replHelp)
+
+	err = session.loop(os.Stdin)
+
+	if session.transcriptPath != "" && len(session.transcript.Turns) > 0 {
+		if saveErr := session.save(session.transcriptPath); saveErr != nil {
+			fmt.Printf("%s Failed to save transcript: %v\n", fail("❌"), saveErr)
+		}
+	}
+
+	return err
+}
+
+func (s *replSession) loop(r io.Reader) error {
+	reader := bufio.NewReader(r)
+	for {
+		fmt.Printf("\n%s ", color.New(color.FgCyan, color.Bold).Sprintf("%s>", shortAddress(s.attacker)))
+
+		line, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+		eof := errors.Is(err, io.EOF)
+
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "/"):
+			if quit := s.command(line); quit {
+				return nil
+			}
+		default:
+			s.prompt(line)
+		}
+
+		if eof {
+			fmt.Println()
+			return nil
+		}
+	}
+}
+
+// command runs a session command and reports whether the session ends.
+func (s *replSession) command(line string) bool {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case "/attacker":
+		switch arg {
+		case "":
+		case "random":
+			s.attacker = randomFelt()
+		case "creator":
+			s.attacker = s.agent.Creator
+		default:
+			attacker, err := new(felt.Felt).SetString(arg)
+			if err != nil {
+				fmt.Printf("%s Invalid address: %v\n", fail("❌"), err)
+				return false
+			}
+			s.attacker = attacker
+		}
+		fmt.Printf("%s Prompting as %s\n", info("👤"), s.attacker)
+	case "/memory":
+		switch arg {
+		case "":
+		case "on":
+			s.memory = true
+		case "off":
+			s.memory = false
+		default:
+			fmt.Printf("%s Expected on or off\n", fail("❌"))
+			return false
+		}
+		fmt.Printf("%s Memory is %s\n", info("🧠"), onOff(s.memory))
+	case "/reset":
+		delete(s.histories, s.attacker.Bytes())
+		fmt.Printf("%s Forgot the conversation with %s\n", info("🧠"), s.attacker)
+	case "/info":
+		s.printInfo()
+	case "/usage":
+		s.printUsage()
+	case "/save":
+		path := arg
+		if path == "" {
+			path = s.transcriptPath
+		}
+		if path == "" {
+			fmt.Printf("%s No transcript path, use /save <path>\n", fail("❌"))
+			return false
+		}
+		s.transcriptPath = path
+		if err := s.save(path); err != nil {
+			fmt.Printf("%s Failed to save transcript: %v\n", fail("❌"), err)
+		}
+	case "/help":
+		fmt.Println(replHelp)
+	case "/quit", "/exit":
+		return true
+	default:
+		fmt.Printf("%s Unknown command %s, see /help\n", fail("❌"), name)
+	}
+
+	return false
+}
+
+// prompt sends the prompt to the agent the way the agent is prompted when a
+// prompt is paid for.
+func (s *replSession) prompt(prompt string) {
+	ctx := usage.WithAgent(context.Background(), s.agent.Address)
+	ctx = chat.WithReplyPrefix(ctx, composer.Tagged(s.agent.Name, ""))
+	if s.model != "" {
+		ctx = chat.WithModel(ctx, s.model)
+	}
+	if s.memory {
+		ctx = chat.WithHistory(ctx, s.histories[s.attacker.Bytes()])
+	}
+	metadata := chat.BuildMetadata(s.agent.Address.String(), s.agent.Creator.String(), s.attacker.String())
+
+	turn := &ReplTurn{
+		Attacker:  s.attacker.String(),
+		Prompt:    prompt,
+		CreatedAt: time.Now().Unix(),
+	}
+	s.transcript.Turns = append(s.transcript.Turns, turn)
+
+	sp := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
+	sp.Suffix = " Waiting for the agent..."
+	sp.Start()
+	start := time.Now()
+	resp, err := s.chatClient.Prompt(ctx, metadata, s.agent.SystemPrompt, prompt)
+	turn.LatencyMs = time.Since(start).Milliseconds()
+	sp.Stop()
+	if err != nil {
+		turn.Error = err.Error()
+		fmt.Printf("%s Failed to prompt: %v\n", fail("❌"), err)
+		return
+	}
+
+	turn.Response = resp.Response
+	turn.ToolCalls = resp.ToolCalls
+	turn.Model = resp.Model
+	turn.Usage = resp.Usage
+	turn.Cost = usage.DefaultPriceTable.Cost(resp.Model, resp.Usage)
+	if resp.Drain != nil {
+		turn.DrainTo = resp.Drain.Address
+	}
+
+	s.promptTokens += resp.Usage.PromptTokens
+	s.completionTokens += resp.Usage.CompletionTokens
+	s.cost += turn.Cost
+
+	if s.memory {
+		s.histories[s.attacker.Bytes()] = append(s.histories[s.attacker.Bytes()],
+			chat.ChatMessage{Role: chat.ChatMessageRoleUser, Content: prompt},
+			chat.ChatMessage{Role: chat.ChatMessageRoleAssistant, Content: resp.Response},
+		)
+	}
+
+	fmt.Println(color.New(color.FgYellow).Sprint(composer.Tagged(s.agent.Name, resp.Response)))
+
+	for _, call := range resp.ToolCalls {
+		fmt.Printf("%s Tool call %s: %s\n", warn("🔧"), call.Name, string(call.Arguments))
+	}
+	if resp.Drain != nil {
+		drainTo, err := new(felt.Felt).SetString(resp.Drain.Address)
+		if err == nil && drainTo.Equal(s.attacker) {
+			fmt.Printf("%s Drained to the attacker\n", warn("⚠️"))
+		} else {
+			fmt.Printf("%s Drained to %s, not the attacker\n", warn("⚠️"), resp.Drain.Address)
+		}
+	}
+
+	fmt.Printf("%s %s %d prompt + %d completion tokens, $%.4f, %dms | session %d tokens, $%.4f\n",
+		info("📈"),
+		resp.Model,
+		resp.Usage.PromptTokens,
+		resp.Usage.CompletionTokens,
+		turn.Cost,
+		turn.LatencyMs,
+		s.promptTokens+s.completionTokens,
+		s.cost,
+	)
+}
+
+func (s *replSession) printInfo() {
+	fmt.Printf("\n%s Agent %s\n", info("🤖"), s.agent.Name)
+	fmt.Printf("Address: %s\n", s.agent.Address)
+	fmt.Printf("Creator: %s\n", s.agent.Creator)
+	fmt.Printf("Model: %s\n", chat.ResolveModel(context.Background(), s.chatClient))
+	fmt.Printf("Attacker: %s\n", s.attacker)
+	fmt.Printf("Memory: %s\n", onOff(s.memory))
+	fmt.Printf("System prompt:\n%s\n", color.New(color.FgYellow).Sprint(s.agent.SystemPrompt))
+}
+
+func (s *replSession) printUsage() {
+	fmt.Printf("%s %d prompts, %d prompt + %d completion tokens, $%.4f\n",
+		info("📈"),
+		len(s.transcript.Turns),
+		s.promptTokens,
+		s.completionTokens,
+		s.cost,
+	)
+}
+
+func (s *replSession) save(path string) error {
+	data, err := json.MarshalIndent(s.transcript, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal transcript: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write transcript: %w", err)
+	}
+	fmt.Printf("%s Transcript saved to %s\n", success("✓"), path)
+	return nil
+}
+
+// shortAddress abbreviates an address for the prompt of the session.
+func shortAddress(addr *felt.Felt) string {
+	s := addr.String()
+	if len(s) <= 12 {
+		return s
+	}
+	return s[:6] + "…" + s[len(s)-4:]
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
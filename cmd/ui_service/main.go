@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"log/slog"
 	"math/big"
 	"os"
@@ -12,6 +14,7 @@ import (
 	"github.com/NethermindEth/juno/core/felt"
 	"github.com/NethermindEth/starknet.go/rpc"
 
+	"github.com/NethermindEth/teeception/pkg/twitter"
 	uiservice "github.com/NethermindEth/teeception/pkg/ui_service"
 	"github.com/NethermindEth/teeception/pkg/wallet/starknet"
 )
@@ -34,6 +37,13 @@ func main() {
 		userTickRate         time.Duration
 		promptIndexerDBPath  string
 		promptIndexerApiKey  string
+		linkDBPath           string
+		chainID              string
+		xConsumerKey         string
+		xConsumerSecret      string
+		xAccessToken         string
+		xAccessTokenSecret   string
+		modelBackends        string
 	)
 
 	rootCmd := &cobra.Command{
@@ -73,6 +83,12 @@ func main() {
 				return err
 			}
 
+			backendModels, err := parseBackendModels(modelBackends)
+			if err != nil {
+				slog.Error("invalid model backends", "error", err)
+				return err
+			}
+
 			tokenRates := make(map[[32]byte]*big.Int)
 			tokenRates[strkAddress.Bytes()] = big.NewInt(1)
 
@@ -83,6 +99,25 @@ func main() {
 				slog.Warn("prompt indexer API key authentication disabled - no API key provided")
 			}
 
+			// Linking accounts to handles needs an X API client to fetch verification tweets
+			var twitterClient twitter.TwitterClient
+			if xConsumerKey != "" {
+				apiClient := twitter.NewTwitterApiClient(&twitter.TwitterApiClientConfig{})
+				if err := apiClient.Initialize(context.Background(), &twitter.TwitterClientConfig{
+					ConsumerKey:       xConsumerKey,
+					ConsumerSecret:    xConsumerSecret,
+					AccessToken:       xAccessToken,
+					AccessTokenSecret: xAccessTokenSecret,
+				}); err != nil {
+					slog.Error("failed to initialize twitter client", "error", err)
+					return err
+				}
+				twitterClient = apiClient
+				slog.Info("twitter handle linking enabled")
+			} else {
+				slog.Warn("twitter handle linking disabled - no X consumer key provided")
+			}
+
 			uiService, err := uiservice.NewUIService(&uiservice.UIServiceConfig{
 				Client:               rateLimitedClient,
 				MaxPageSize:          maxPageSize,
@@ -97,6 +132,10 @@ func main() {
 				AgentBalanceTickRate: balanceTickRate,
 				PromptIndexerDBPath:  promptIndexerDBPath,
 				PromptIndexerApiKey:  promptIndexerApiKey,
+				TwitterClient:        twitterClient,
+				LinkDBPath:           linkDBPath,
+				ChainID:              chainID,
+				BackendModels:        backendModels,
 			})
 			if err != nil {
 				slog.Error("failed to create UI service", "error", err)
@@ -120,7 +159,40 @@ func main() {
 	rootCmd.Flags().StringVar(&promptIndexerDBPath, "prompt-indexer-db-path", "prompts.db", "Path to the prompt indexer SQLite database")
 	rootCmd.Flags().StringVar(&promptIndexerApiKey, "prompt-indexer-api-key", os.Getenv("PROMPT_INDEXER_API_KEY"), "API key for the prompt indexer (can also be set via PROMPT_INDEXER_API_KEY env var)")
 
+	rootCmd.Flags().StringVar(&linkDBPath, "link-db-path", "links.db", "Path to the Twitter handle link SQLite database")
+	rootCmd.Flags().StringVar(&chainID, "chain-id", "SN_SEPOLIA", "Starknet chain ID of the signed link messages")
+	rootCmd.Flags().StringVar(&xConsumerKey, "x-consumer-key", os.Getenv("X_CONSUMER_KEY"), "X API consumer key used to fetch verification tweets (can also be set via X_CONSUMER_KEY env var)")
+	rootCmd.Flags().StringVar(&xConsumerSecret, "x-consumer-secret", os.Getenv("X_CONSUMER_SECRET"), "X API consumer secret (can also be set via X_CONSUMER_SECRET env var)")
+	rootCmd.Flags().StringVar(&xAccessToken, "x-access-token", os.Getenv("X_ACCESS_TOKEN"), "X API access token (can also be set via X_ACCESS_TOKEN env var)")
+	rootCmd.Flags().StringVar(&xAccessTokenSecret, "x-access-token-secret", os.Getenv("X_ACCESS_TOKEN_SECRET"), "X API access token secret (can also be set via X_ACCESS_TOKEN_SECRET env var)")
+
+	rootCmd.Flags().StringVar(&modelBackends, "model-backends", os.Getenv("AGENT_MODEL_BACKENDS"), "Backends of agents by registered model, as configured in agents, to count tokens for the model answering them (can also be set via AGENT_MODEL_BACKENDS env var)")
+
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
 	}
 }
+
+// parseBackendModels returns the models answering agents by registered model
+// from the JSON object of backends agents are configured with.
+func parseBackendModels(modelBackends string) (map[string]string, error) {
+	if modelBackends == "" {
+		return nil, nil
+	}
+
+	var backends map[string]struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal([]byte(modelBackends), &backends); err != nil {
+		return nil, fmt.Errorf("failed to parse model backends: %w", err)
+	}
+
+	models := make(map[string]string, len(backends))
+	for model, backend := range backends {
+		// Backends answer with the registered model unless they name another.
+		if backend.Model != "" {
+			models[model] = backend.Model
+		}
+	}
+	return models, nil
+}
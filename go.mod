@@ -26,7 +26,9 @@ require (
 	github.com/tiktoken-go/tokenizer v0.4.0
 	github.com/tmc/langchaingo v0.1.12
 	golang.org/x/crypto v0.32.0
+	golang.org/x/image v0.23.0
 	golang.org/x/sync v0.10.0
+	golang.org/x/text v0.21.0
 	golang.org/x/time v0.5.0
 )
 
@@ -79,7 +81,6 @@ require (
 	golang.org/x/net v0.34.0 // indirect
 	golang.org/x/sys v0.29.0 // indirect
 	golang.org/x/term v0.28.0 // indirect
-	golang.org/x/text v0.21.0 // indirect
 	google.golang.org/protobuf v1.36.2 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 	rsc.io/tmplfunc v0.0.3 // indirect
@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math/big"
 	"net/http"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -20,21 +22,34 @@ import (
 	"github.com/sashabaranov/go-openai"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/NethermindEth/teeception/pkg/agent/card"
 	"github.com/NethermindEth/teeception/pkg/agent/chat"
 	"github.com/NethermindEth/teeception/pkg/agent/debug"
+	"github.com/NethermindEth/teeception/pkg/agent/guard"
+	"github.com/NethermindEth/teeception/pkg/agent/memory"
+	"github.com/NethermindEth/teeception/pkg/agent/moderation"
 	"github.com/NethermindEth/teeception/pkg/agent/quote"
 	"github.com/NethermindEth/teeception/pkg/agent/setup"
+	"github.com/NethermindEth/teeception/pkg/agent/usage"
 	"github.com/NethermindEth/teeception/pkg/agent/validation"
 	"github.com/NethermindEth/teeception/pkg/indexer"
 	"github.com/NethermindEth/teeception/pkg/twitter"
+	"github.com/NethermindEth/teeception/pkg/twitter/composer"
+	"github.com/NethermindEth/teeception/pkg/twitter/link"
+	"github.com/NethermindEth/teeception/pkg/twitter/outbox"
 	"github.com/NethermindEth/teeception/pkg/wallet/starknet"
 	snaccount "github.com/NethermindEth/teeception/pkg/wallet/starknet"
 )
 
 var (
-	consumePromptSelector = starknetgoutils.GetSelectorFromNameFelt("consume_prompt")
-	balanceOfSelector     = starknetgoutils.GetSelectorFromNameFelt("balance_of")
-	ethAddress, _         = starknetgoutils.HexToFelt("0x049d36570d4e46f48e99674bd3fcc84644ddd6b96f7c741b1562b82f9e004dc7")
+	consumePromptSelector             = starknetgoutils.GetSelectorFromNameFelt("consume_prompt")
+	getPendingPromptSubmitterSelector = starknetgoutils.GetSelectorFromNameFelt("get_pending_prompt_submitter")
+	ethAddress, _                     = starknetgoutils.HexToFelt("0x049d36570d4e46f48e99674bd3fcc84644ddd6b96f7c741b1562b82f9e004dc7")
+	strkAddress, _                    = starknetgoutils.HexToFelt("0x04718f5a0fc34cc1af16a1cdee98ffb20c31f5cd61d6ab07201858f4287c938d")
+	tokenDecimalsFactor               = new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+
+	// errHandleNotLinked is wrapped when a prompt tweet is not from the handle linked to its payer.
+	errHandleNotLinked = errors.New("tweet author is not linked to the paying account")
 )
 
 const (
@@ -43,6 +58,14 @@ const (
 	TwitterClientModeProxy = "proxy"
 )
 
+// Kinds of outbound messages, part of their idempotency keys.
+const (
+	outboxKindReply        = "reply"
+	outboxKindDrainTweet   = "drain_tweet"
+	outboxKindDrainReply   = "drain_reply"
+	outboxKindInstructions = "instructions"
+)
+
 type AgentConfigParams struct {
 	TwitterClientMode            string
 	TwitterClientConfig          *twitter.TwitterClientConfig
@@ -59,8 +82,49 @@ type AgentConfigParams struct {
 	SafeBlockDelta               uint64
 	MaxSystemPromptTokens        int
 	MaxPromptTokens              int
+	MaxTotalTokens               int
 	PromptIndexerEndpoint        string
 	PromptIndexerApiKey          string
+	MigrationExporter            *setup.MigrationExporter
+	LowBalanceThreshold          *big.Int
+	BalanceAlertWebhookUrl       string
+	ReconcileInterval            time.Duration
+	MemoryDbPath                 string
+	MemoryAllAgents              bool
+	MemoryModels                 []string
+	ModerationSecrets            []string
+	ModerationBlockedWords       []string
+	ModerationUseOpenAI          bool
+	MentionPollInterval          time.Duration
+	MentionPaymentUrl            string
+	OutboxDbPath                 string
+	RequireLinkedHandle          bool
+	TwitterFallbackAccounts      []*twitter.TwitterClientConfig
+	TwitterWriteFailover         twitter.WriteFailover
+	ModelBackends                map[string]chat.OpenAICompatibleConfig
+	ChatFallbacks                []chat.OpenAICompatibleConfig
+	UsageDbPath                  string
+	UsagePrices                  usage.PriceTable
+	BudgetDailyCap               float64
+	BudgetCaps                   map[[32]byte]float64
+	BudgetExceededAction         usage.BudgetAction
+	BudgetDegradeModel           string
+	ChatCassettePath             string
+	ReplyMaxRetries              int
+	GuardModels                  map[string]chat.OpenAICompatibleConfig
+	GuardDbPath                  string
+	ConsensusModels              map[string]*ConsensusModel
+}
+
+// ConsensusModel is the consensus of voters answering the prompts of agents
+// registered with a model.
+type ConsensusModel struct {
+	// Threshold is the number of voters that must agree on a drain, a
+	// majority when zero.
+	Threshold int
+	// Voters are served by OpenAI without a base URL. The first one is the
+	// primary, whose response is replied.
+	Voters []chat.OpenAICompatibleConfig
 }
 
 type AgentAccountDeploymentState struct {
@@ -80,6 +144,9 @@ type AgentConfig struct {
 	UnencumberData *setup.UnencumberData
 
 	ChatCompletion chat.ChatCompletion
+	ChatFallback   *chat.FallbackChatCompletion
+	Accountant     *usage.Accountant
+	Guard          *guard.GuardChatCompletion
 	StarknetClient starknet.ProviderWrapper
 	Quoter         quote.Quoter
 
@@ -90,6 +157,7 @@ type AgentConfig struct {
 	Account                *snaccount.StarknetAccount
 	AccountDeploymentState AgentAccountDeploymentState
 	TxQueue                *snaccount.TxQueue
+	BalanceMonitor         *snaccount.BalanceMonitor
 
 	Pool pond.Pool
 
@@ -101,6 +169,22 @@ type AgentConfig struct {
 	PromptIndexerApiKey   string
 	promptIndexerQueue    []*promptIndexerNotification
 	promptIndexerQueueMu  sync.Mutex
+
+	MigrationExporter *setup.MigrationExporter
+
+	ReconcileInterval time.Duration
+
+	Memory    *memory.Memory
+	Moderator moderation.Moderator
+
+	MentionPollInterval time.Duration
+	MentionPaymentUrl   string
+
+	Outbox *outbox.Outbox
+
+	// RequireLinkedHandle rejects prompts whose tweet author is not the
+	// Twitter handle linked to the paying account.
+	RequireLinkedHandle bool
 }
 
 func NewAgentConfigFromParams(params *AgentConfigParams) (*AgentConfig, error) {
@@ -112,7 +196,9 @@ func NewAgentConfigFromParams(params *AgentConfigParams) (*AgentConfig, error) {
 	}
 
 	if params.TwitterClientMode == TwitterClientModeApi {
-		twitterClient = twitter.NewTwitterApiClient()
+		twitterClient = twitter.NewTwitterApiClient(&twitter.TwitterApiClientConfig{
+			FailOnRateLimit: len(params.TwitterFallbackAccounts) > 0,
+		})
 	} else if params.TwitterClientMode == TwitterClientModeProxy {
 		port, err := envLookupAgentTwitterClientPort()
 		if err != nil {
@@ -123,12 +209,189 @@ func NewAgentConfigFromParams(params *AgentConfigParams) (*AgentConfig, error) {
 		return nil, fmt.Errorf("invalid twitter client mode: %s", params.TwitterClientMode)
 	}
 
-	openaiChatCompletion := chat.NewOpenAIChatCompletionOpenAI(openai.GPT4, params.OpenAIKey)
-	tokenLimitChatCompletion, err := chat.NewTokenLimitChatCompletion(openaiChatCompletion, params.MaxSystemPromptTokens, params.MaxPromptTokens)
+	if len(params.TwitterFallbackAccounts) > 0 {
+		accounts := []twitter.MultiAccount{{
+			Name:   "primary",
+			Client: twitterClient,
+		}}
+		for i, config := range params.TwitterFallbackAccounts {
+			accounts = append(accounts, twitter.MultiAccount{
+				Name: fmt.Sprintf("fallback-%d", i+1),
+				Client: twitter.NewTwitterApiClient(&twitter.TwitterApiClientConfig{
+					FailOnRateLimit: true,
+				}),
+				Config: config,
+			})
+		}
+
+		slog.Info("using twitter fallback accounts", "count", len(params.TwitterFallbackAccounts), "write_failover", params.TwitterWriteFailover)
+
+		twitterClient = twitter.NewMultiClient(&twitter.MultiClientConfig{
+			Accounts:      accounts,
+			WriteFailover: params.TwitterWriteFailover,
+		})
+	}
+
+	// Agents over their budget are degraded within the backend they are routed to.
+	degradeModel := params.BudgetDegradeModel
+	if degradeModel == "" {
+		degradeModel = openai.GPT4oMini
+	}
+
+	var chatCompletion chat.ChatCompletion = chat.NewOpenAIChatCompletion(chat.OpenAIChatCompletionConfig{
+		Client:       openai.NewClient(params.OpenAIKey),
+		Model:        openai.GPT4,
+		DegradeModel: degradeModel,
+	})
+
+	var chatFallback *chat.FallbackChatCompletion
+	if len(params.ChatFallbacks) > 0 {
+		backends := []chat.FallbackBackend{{
+			Name:           openai.GPT4,
+			ChatCompletion: chatCompletion,
+		}}
+		for _, config := range params.ChatFallbacks {
+			slog.Info("using chat fallback backend", "model", config.Model, "base_url", config.BaseUrl, "tools_mode", config.ToolsMode)
+			backends = append(backends, chat.FallbackBackend{
+				Name:           config.Model,
+				ChatCompletion: newOpenAIBackend(config, params.OpenAIKey),
+			})
+		}
+
+		chatFallback = chat.NewFallbackChatCompletion(chat.FallbackChatCompletionConfig{
+			Backends: backends,
+		})
+		chatCompletion = chatFallback
+	}
+
+	if len(params.ModelBackends) > 0 || len(params.ConsensusModels) > 0 {
+		models := make(map[string]chat.ChatCompletion, len(params.ModelBackends)+len(params.ConsensusModels))
+		for model, config := range params.ModelBackends {
+			slog.Info("using openai-compatible backend", "model", model, "base_url", config.BaseUrl, "tools_mode", config.ToolsMode)
+			models[model] = newOpenAIBackend(config, params.OpenAIKey)
+		}
+
+		for model, consensusModel := range params.ConsensusModels {
+			voters := make([]chat.ConsensusVoter, 0, len(consensusModel.Voters))
+			for i, config := range consensusModel.Voters {
+				voters = append(voters, chat.ConsensusVoter{
+					Name:           fmt.Sprintf("%s-%d", config.Model, i+1),
+					ChatCompletion: newOpenAIBackend(config, params.OpenAIKey),
+				})
+			}
+
+			consensus, err := chat.NewConsensusChatCompletion(chat.ConsensusChatCompletionConfig{
+				Voters:    voters,
+				Threshold: consensusModel.Threshold,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to create consensus of model %s: %v", model, err)
+			}
+
+			slog.Info("using consensus", "model", model, "voters", len(voters), "threshold", consensus.Threshold())
+			models[model] = consensus
+		}
+
+		chatCompletion = chat.NewModelRouterChatCompletion(chatCompletion, models)
+	}
+
+	tokenCounters := chat.NewTokenCounters()
+	tokenLimitChatCompletion := chat.NewTokenLimitChatCompletion(chat.TokenLimitChatCompletionConfig{
+		ChatCompletion:         chatCompletion,
+		Counters:               tokenCounters,
+		SystemPromptTokenLimit: params.MaxSystemPromptTokens,
+		PromptTokenLimit:       params.MaxPromptTokens,
+		TotalTokenLimit:        params.MaxTotalTokens,
+	})
+
+	// The cassette records the exchanges of the backends, reprompts included,
+	// beneath the guard and the reply constraints, so that replaying it
+	// through the constraints reproduces the responses of the agent. Guard
+	// verdicts are kept in the guard store.
+	var recordedChatCompletion chat.ChatCompletion = tokenLimitChatCompletion
+	if params.ChatCassettePath != "" {
+		slog.Info("recording chat exchanges", "path", params.ChatCassettePath)
+
+		cassette, err := chat.NewCassetteChatCompletion(chat.CassetteChatCompletionConfig{
+			Path:           params.ChatCassettePath,
+			ChatCompletion: tokenLimitChatCompletion,
+			Mode:           chat.CassetteModeRecord,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create chat cassette: %v", err)
+		}
+		recordedChatCompletion = cassette
+	}
+
+	var usageStore usage.Store = usage.NewStoreInMemory()
+	if params.UsageDbPath != "" {
+		sqliteStore, err := usage.NewStoreSQLite(params.UsageDbPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create usage store: %v", err)
+		}
+		usageStore = sqliteStore
+	}
+
+	accountant, err := usage.NewAccountant(&usage.AccountantConfig{
+		Store:          usageStore,
+		Prices:         params.UsagePrices,
+		DailyCap:       params.BudgetDailyCap,
+		Caps:           params.BudgetCaps,
+		ExceededAction: params.BudgetExceededAction,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create token limit chat completion: %v", err)
+		return nil, fmt.Errorf("failed to create usage accountant: %v", err)
 	}
 
+	accountingChatCompletion := usage.NewAccountingChatCompletion(&usage.AccountingChatCompletionConfig{
+		ChatCompletion: recordedChatCompletion,
+		Accountant:     accountant,
+	})
+
+	var guardedChatCompletion chat.ChatCompletion = accountingChatCompletion
+	var guardChatCompletion *guard.GuardChatCompletion
+	if len(params.GuardModels) > 0 {
+		guards := make(map[string]chat.ChatCompletion, len(params.GuardModels))
+		for model, config := range params.GuardModels {
+			if config.Model == "" {
+				config.Model = openai.GPT4oMini
+			}
+			// Guards judge drains, they must not be able to call them.
+			config.Tools, err = chat.NewToolRegistry()
+			if err != nil {
+				return nil, fmt.Errorf("failed to create guard tool registry: %v", err)
+			}
+
+			slog.Info("using guard pipeline", "model", model, "guard_model", config.Model, "base_url", config.BaseUrl)
+			guards[model] = usage.NewAccountingChatCompletion(&usage.AccountingChatCompletionConfig{
+				ChatCompletion: newOpenAIBackend(config, params.OpenAIKey),
+				Accountant:     accountant,
+			})
+		}
+
+		var guardStore guard.Store = guard.NewStoreInMemory()
+		if params.GuardDbPath != "" {
+			sqliteStore, err := guard.NewStoreSQLite(params.GuardDbPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create guard store: %v", err)
+			}
+			guardStore = sqliteStore
+		}
+
+		guardChatCompletion = guard.NewGuardChatCompletion(&guard.GuardChatCompletionConfig{
+			ChatCompletion: accountingChatCompletion,
+			Guards:         guards,
+			Store:          guardStore,
+		})
+		guardedChatCompletion = guardChatCompletion
+	}
+
+	// Replies are constrained last so that every reprompt is accounted.
+	constrainedChatCompletion := chat.NewConstrainedChatCompletion(chat.ConstrainedChatCompletionConfig{
+		ChatCompletion: guardedChatCompletion,
+		MaxRetries:     params.ReplyMaxRetries,
+	})
+
 	dstackTappdClient := tappd.NewTappdClient(tappd.WithEndpoint(params.DstackTappdEndpoint))
 	quoter := quote.NewTappdQuoter(dstackTappdClient)
 
@@ -185,9 +448,29 @@ func NewAgentConfigFromParams(params *AgentConfigParams) (*AgentConfig, error) {
 		return nil, err
 	}
 
-	txQueue := snaccount.NewTxQueue(account, starknetClient, &snaccount.TxQueueConfig{
-		MaxBatchSize:       10,
-		SubmissionInterval: 20 * time.Second,
+	var balanceAlertSink snaccount.AlertSink = &snaccount.LogAlertSink{}
+	if params.BalanceAlertWebhookUrl != "" {
+		balanceAlertSink = snaccount.NewWebhookAlertSink(params.BalanceAlertWebhookUrl, nil)
+	}
+
+	var txQueue *snaccount.TxQueue
+	balanceMonitor := snaccount.NewBalanceMonitor(&snaccount.BalanceMonitorConfig{
+		Client:              starknetClient,
+		TokenAddress:        ethAddress,
+		Address:             account.Address(),
+		PollInterval:        time.Minute,
+		LowBalanceThreshold: params.LowBalanceThreshold,
+		SpendWindow:         24 * time.Hour,
+		AlertSink:           balanceAlertSink,
+		OnDegradedChange: func(degraded bool) {
+			txQueue.SetPaused(degraded)
+		},
+	})
+
+	txQueue = snaccount.NewTxQueue(account, starknetClient, &snaccount.TxQueueConfig{
+		MaxBatchSize:          10,
+		SubmissionInterval:    20 * time.Second,
+		OnInsufficientBalance: balanceMonitor.MarkInsufficient,
 	})
 
 	var startupBlockNumber uint64
@@ -204,6 +487,46 @@ func NewAgentConfigFromParams(params *AgentConfigParams) (*AgentConfig, error) {
 
 	nameCache := validation.NewNameCacheWithConcurrency(tokenLimitChatCompletion, 10)
 
+	moderators := []moderation.Moderator{
+		moderation.NewRuleModerator(&moderation.RuleModeratorConfig{
+			Secrets:      append([]string{params.OpenAIKey}, params.ModerationSecrets...),
+			BlockedWords: params.ModerationBlockedWords,
+		}),
+	}
+	if params.ModerationUseOpenAI {
+		moderators = append(moderators, moderation.NewOpenAIModerator(&moderation.OpenAIModeratorConfig{
+			Client:       openai.NewClient(params.OpenAIKey),
+			RewriteModel: openai.GPT4oMini,
+		}))
+	}
+
+	var agentMemory *memory.Memory
+	if params.MemoryDbPath != "" && (params.MemoryAllAgents || len(params.MemoryModels) > 0) {
+		memoryStore, err := memory.NewStoreSQLite(params.MemoryDbPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create memory store: %v", err)
+		}
+
+		agentMemory, err = memory.NewMemory(&memory.MemoryConfig{
+			Store:     memoryStore,
+			AllAgents: params.MemoryAllAgents,
+			Models:    params.MemoryModels,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create memory: %v", err)
+		}
+	}
+
+	var outboxStore outbox.Store = outbox.NewStoreInMemory()
+	if params.OutboxDbPath == "" {
+		slog.Warn("AGENT_OUTBOX_DB_PATH is not set, queued tweets and replies are kept in memory and lost on restart")
+	} else {
+		outboxStore, err = outbox.NewStoreSQLite(params.OutboxDbPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create outbox store: %v", err)
+		}
+	}
+
 	return &AgentConfig{
 		TwitterClient:       twitterClient,
 		TwitterClientConfig: params.TwitterClientConfig,
@@ -211,15 +534,19 @@ func NewAgentConfigFromParams(params *AgentConfigParams) (*AgentConfig, error) {
 		IsUnencumbered: false,
 		UnencumberData: params.UnencumberData,
 
-		ChatCompletion: tokenLimitChatCompletion,
+		ChatCompletion: constrainedChatCompletion,
+		ChatFallback:   chatFallback,
+		Accountant:     accountant,
+		Guard:          guardChatCompletion,
 		StarknetClient: starknetClient,
 		Quoter:         quoter,
 		NameCache:      nameCache,
 
-		AgentIndexer: agentIndexer,
-		EventWatcher: eventWatcher,
-		Account:      account,
-		TxQueue:      txQueue,
+		AgentIndexer:   agentIndexer,
+		EventWatcher:   eventWatcher,
+		Account:        account,
+		TxQueue:        txQueue,
+		BalanceMonitor: balanceMonitor,
 
 		Pool: pond.NewPool(params.TaskConcurrency),
 
@@ -230,9 +557,41 @@ func NewAgentConfigFromParams(params *AgentConfigParams) (*AgentConfig, error) {
 		PromptIndexerEndpoint: params.PromptIndexerEndpoint,
 		PromptIndexerApiKey:   params.PromptIndexerApiKey,
 		promptIndexerQueue:    make([]*promptIndexerNotification, 0),
+
+		MigrationExporter: params.MigrationExporter,
+
+		ReconcileInterval: params.ReconcileInterval,
+
+		Memory:    agentMemory,
+		Moderator: moderation.NewChainModerator(moderators...),
+
+		MentionPollInterval: params.MentionPollInterval,
+		MentionPaymentUrl:   params.MentionPaymentUrl,
+
+		Outbox: outbox.NewOutbox(&outbox.OutboxConfig{
+			Store:  outboxStore,
+			Client: twitterClient,
+		}),
+
+		RequireLinkedHandle: params.RequireLinkedHandle,
 	}, nil
 }
 
+// newOpenAIBackend creates the backend of a config, served by OpenAI
+// without a base URL.
+func newOpenAIBackend(config chat.OpenAICompatibleConfig, openAIKey string) chat.ChatCompletion {
+	if config.BaseUrl != "" {
+		return chat.NewOpenAICompatibleChatCompletion(config)
+	}
+
+	return chat.NewOpenAIChatCompletion(chat.OpenAIChatCompletionConfig{
+		Client:       openai.NewClient(openAIKey),
+		Model:        config.Model,
+		DegradeModel: config.DegradeModel,
+		Tools:        config.Tools,
+	})
+}
+
 type Agent struct {
 	twitterClient       twitter.TwitterClient
 	twitterClientConfig *twitter.TwitterClientConfig
@@ -241,6 +600,9 @@ type Agent struct {
 	unencumberData *setup.UnencumberData
 
 	chatCompletion chat.ChatCompletion
+	chatFallback   *chat.FallbackChatCompletion
+	accountant     *usage.Accountant
+	guard          *guard.GuardChatCompletion
 	starknetClient starknet.ProviderWrapper
 	quoter         quote.Quoter
 
@@ -251,6 +613,7 @@ type Agent struct {
 	account                *snaccount.StarknetAccount
 	accountDeploymentState AgentAccountDeploymentState
 	txQueue                *snaccount.TxQueue
+	balanceMonitor         *snaccount.BalanceMonitor
 
 	pool pond.Pool
 
@@ -264,6 +627,18 @@ type Agent struct {
 	promptIndexerApiKey   string
 	promptIndexerQueue    []*promptIndexerNotification
 	promptIndexerQueueMu  sync.Mutex
+
+	migrationExporter *setup.MigrationExporter
+
+	reconciler     *PromptReconciler
+	mentionWatcher *MentionWatcher
+	outbox         *outbox.Outbox
+	memory         *memory.Memory
+
+	moderator moderation.Moderator
+	prompts   *PromptTracker
+
+	requireLinkedHandle bool
 }
 
 // promptIndexerNotification represents a notification to be sent to the prompt indexer
@@ -275,7 +650,7 @@ type promptIndexerNotification struct {
 func NewAgent(config *AgentConfig) (*Agent, error) {
 	slog.Info("agent initialized successfully", "account_address", config.Account.Address())
 
-	return &Agent{
+	agent := &Agent{
 		twitterClient:       config.TwitterClient,
 		twitterClientConfig: config.TwitterClientConfig,
 
@@ -283,6 +658,9 @@ func NewAgent(config *AgentConfig) (*Agent, error) {
 		unencumberData: config.UnencumberData,
 
 		chatCompletion: config.ChatCompletion,
+		chatFallback:   config.ChatFallback,
+		accountant:     config.Accountant,
+		guard:          config.Guard,
 		starknetClient: config.StarknetClient,
 		quoter:         config.Quoter,
 		nameCache:      config.NameCache,
@@ -292,6 +670,7 @@ func NewAgent(config *AgentConfig) (*Agent, error) {
 		account:                config.Account,
 		accountDeploymentState: config.AccountDeploymentState,
 		txQueue:                config.TxQueue,
+		balanceMonitor:         config.BalanceMonitor,
 
 		pool: config.Pool,
 
@@ -304,13 +683,49 @@ func NewAgent(config *AgentConfig) (*Agent, error) {
 		promptIndexerEndpoint: config.PromptIndexerEndpoint,
 		promptIndexerApiKey:   config.PromptIndexerApiKey,
 		promptIndexerQueue:    config.promptIndexerQueue,
-	}, nil
+
+		migrationExporter: config.MigrationExporter,
+
+		prompts:   NewPromptTracker(0),
+		memory:    config.Memory,
+		moderator: config.Moderator,
+		outbox:    config.Outbox,
+
+		requireLinkedHandle: config.RequireLinkedHandle,
+	}
+
+	if config.ReconcileInterval > 0 {
+		agent.reconciler = NewPromptReconciler(&PromptReconcilerConfig{
+			Client:       config.StarknetClient,
+			AgentIndexer: config.AgentIndexer,
+			EventWatcher: config.EventWatcher,
+			FromBlock:    config.AgentRegistryBlock,
+			Interval:     config.ReconcileInterval,
+			IsInFlight:   agent.prompts.IsInFlight,
+			Resolved:     agent.prompts.Release,
+			Enqueue:      agent.enqueueRecoveredPrompt,
+		})
+	}
+
+	if mentionPoller, ok := config.TwitterClient.(twitter.MentionPoller); ok && config.MentionPollInterval > 0 {
+		agent.mentionWatcher = NewMentionWatcher(&MentionWatcherConfig{
+			Poller: mentionPoller,
+			Reply: func(ctx context.Context, tweetID uint64, reply string) error {
+				return agent.replyToTweet(ctx, fmt.Sprintf("mention/%d/%s", tweetID, outboxKindInstructions), outboxKindInstructions, tweetID, reply)
+			},
+			AgentIndexer: config.AgentIndexer,
+			PollInterval: config.MentionPollInterval,
+			PaymentUrl:   config.MentionPaymentUrl,
+		})
+	}
+
+	return agent, nil
 }
 
 func (a *Agent) Run(ctx context.Context) error {
 	slog.Info("starting agent")
 
-	err := a.twitterClient.Initialize(a.twitterClientConfig)
+	err := a.twitterClient.Initialize(ctx, a.twitterClientConfig)
 	if err != nil {
 		return fmt.Errorf("failed to initialize twitter client: %w", err)
 	}
@@ -320,10 +735,38 @@ func (a *Agent) Run(ctx context.Context) error {
 		return a.StartServer(ctx)
 	})
 
+	// Once the sealed state is handed over to a new instance, this one stops
+	// working but keeps serving rather than exiting, so that it is not
+	// restarted alongside the new instance.
+	workCtx, stopWork := context.WithCancel(ctx)
+	defer stopWork()
+	work := func(f func(ctx context.Context) error) {
+		g.Go(func() error {
+			err := f(workCtx)
+			if workCtx.Err() != nil && ctx.Err() == nil {
+				return nil
+			}
+			return err
+		})
+	}
+	if a.migrationExporter != nil {
+		g.Go(func() error {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-a.migrationExporter.Served():
+			}
+
+			slog.Warn("sealed state was handed over to a new instance, stopping work")
+			stopWork()
+
+			<-ctx.Done()
+			return nil
+		})
+	}
+
 	// Start the background worker for processing the prompt indexer queue
-	g.Go(func() error {
-		return a.processPromptIndexerQueue(ctx)
-	})
+	work(a.processPromptIndexerQueue)
 
 	if !debug.IsDebugDisableWaitingForDeployment() {
 		err = a.waitForAccountDeployment(ctx)
@@ -332,24 +775,28 @@ func (a *Agent) Run(ctx context.Context) error {
 		}
 	}
 
-	g.Go(func() error {
-		return a.nameCache.Run(ctx)
-	})
-	g.Go(func() error {
+	work(a.nameCache.Run)
+	work(func(ctx context.Context) error {
 		eventSubID := a.eventWatcher.Subscribe(indexer.EventAgentRegistered|indexer.EventPromptPaid|indexer.EventPromptConsumed|indexer.EventTeeUnencumbered, a.eventCh)
 		defer a.eventWatcher.Unsubscribe(eventSubID)
 
 		return a.eventWatcher.Run(ctx)
 	})
-	g.Go(func() error {
-		return a.agentIndexer.Run(ctx)
-	})
-	g.Go(func() error {
-		return a.txQueue.Run(ctx)
-	})
-	g.Go(func() error {
-		return a.ProcessEvents(ctx)
-	})
+	work(a.agentIndexer.Run)
+	work(a.txQueue.Run)
+	if a.balanceMonitor != nil {
+		work(a.balanceMonitor.Run)
+	}
+	if a.reconciler != nil {
+		work(a.reconciler.Run)
+	}
+	if a.mentionWatcher != nil {
+		work(a.mentionWatcher.Run)
+	}
+	if a.outbox != nil {
+		work(a.outbox.Run)
+	}
+	work(a.ProcessEvents)
 
 	return g.Wait()
 }
@@ -361,15 +808,21 @@ type agentEventStartupController struct {
 	blockNumber        uint64
 }
 
-func (a *agentEventStartupController) ClearStartupTask(agentAddressBytes [32]byte, promptID uint64) {
+// ClearStartupTask drops the startup task of a prompt, and reports whether
+// there was one.
+func (a *agentEventStartupController) ClearStartupTask(agentAddressBytes [32]byte, promptID uint64) bool {
 	if _, ok := a.startupTasks[agentAddressBytes]; !ok {
 		a.startupTasks[agentAddressBytes] = make(map[uint64]func())
 	}
 
+	task := a.startupTasks[agentAddressBytes][promptID]
 	a.startupTasks[agentAddressBytes][promptID] = nil
+	return task != nil
 }
 
-func (a *agentEventStartupController) AddStartupTask(agentAddressBytes [32]byte, promptID uint64, task func()) {
+// AddStartupTask adds the startup task of a prompt, and reports whether it
+// was added rather than the prompt being known already.
+func (a *agentEventStartupController) AddStartupTask(agentAddressBytes [32]byte, promptID uint64, task func()) bool {
 	if _, ok := a.startupTasks[agentAddressBytes]; !ok {
 		a.startupTasks[agentAddressBytes] = make(map[uint64]func())
 	}
@@ -378,6 +831,7 @@ func (a *agentEventStartupController) AddStartupTask(agentAddressBytes [32]byte,
 	if !ok {
 		a.startupTasks[agentAddressBytes][promptID] = task
 	}
+	return !ok
 }
 
 func (a *agentEventStartupController) isPastOrAtStartupBlock(block uint64) bool {
@@ -491,7 +945,9 @@ func (a *Agent) onPromptConsumedEvent(ev *indexer.Event, startupController *agen
 
 	slog.Info("noticed prompt was already consumed", "agent_address", ev.Raw.FromAddress, "prompt_id", promptConsumedEvent.PromptID)
 
-	startupController.ClearStartupTask(ev.Raw.FromAddress.Bytes(), promptConsumedEvent.PromptID)
+	if startupController.ClearStartupTask(ev.Raw.FromAddress.Bytes(), promptConsumedEvent.PromptID) {
+		a.prompts.Release(ev.Raw.FromAddress, promptConsumedEvent.PromptID)
+	}
 }
 
 func (a *Agent) onPromptPaidEvent(ctx context.Context, ev *indexer.Event, startupController *agentEventStartupController) {
@@ -503,7 +959,57 @@ func (a *Agent) onPromptPaidEvent(ctx context.Context, ev *indexer.Event, startu
 
 	slog.Info("received prompt paid event", "agent_address", ev.Raw.FromAddress, "prompt_id", promptPaidEvent.PromptID)
 
-	task := func() {
+	if a.mentionWatcher != nil {
+		a.mentionWatcher.MarkPaid(promptPaidEvent.TweetID)
+	}
+
+	if !a.prompts.Acquire(ev.Raw.FromAddress, promptPaidEvent.PromptID) {
+		slog.Info("prompt is already being processed", "agent_address", ev.Raw.FromAddress, "prompt_id", promptPaidEvent.PromptID)
+		return
+	}
+
+	task := a.promptPaidTask(ctx, ev, promptPaidEvent)
+
+	if startupController.IsStartupPhase() {
+		slog.Info("adding startup task", "agent_address", ev.Raw.FromAddress, "prompt_id", promptPaidEvent.PromptID)
+		if !startupController.AddStartupTask(ev.Raw.FromAddress.Bytes(), promptPaidEvent.PromptID, task) {
+			a.prompts.Release(ev.Raw.FromAddress, promptPaidEvent.PromptID)
+		}
+	} else {
+		err := a.pool.Go(task)
+		if err != nil {
+			a.prompts.Release(ev.Raw.FromAddress, promptPaidEvent.PromptID)
+			slog.Error("failed to pool startup task", "agent_address", ev.Raw.FromAddress, "prompt_id", promptPaidEvent.PromptID, "error", err)
+		}
+	}
+}
+
+// enqueueRecoveredPrompt schedules a prompt found by the reconciler.
+func (a *Agent) enqueueRecoveredPrompt(ctx context.Context, ev *indexer.Event) error {
+	promptPaidEvent, ok := ev.ToPromptPaidEvent()
+	if !ok {
+		return fmt.Errorf("failed to convert event to prompt paid event")
+	}
+
+	if !a.prompts.Acquire(ev.Raw.FromAddress, promptPaidEvent.PromptID) {
+		return fmt.Errorf("prompt is already being processed")
+	}
+
+	slog.Info("recovered missed prompt", "agent_address", ev.Raw.FromAddress, "prompt_id", promptPaidEvent.PromptID)
+
+	if err := a.pool.Go(a.promptPaidTask(ctx, ev, promptPaidEvent)); err != nil {
+		a.prompts.Release(ev.Raw.FromAddress, promptPaidEvent.PromptID)
+		return err
+	}
+	return nil
+}
+
+// promptPaidTask processes a prompt tracked by the caller. The prompt stays
+// tracked past the task if its consume transaction was broadcast.
+func (a *Agent) promptPaidTask(ctx context.Context, ev *indexer.Event, promptPaidEvent *indexer.PromptPaidEvent) func() {
+	return func() {
+		defer a.prompts.Finish(ev.Raw.FromAddress, promptPaidEvent.PromptID)
+
 		slog.Info("processing prompt paid event",
 			"agent_address", ev.Raw.FromAddress,
 			"tweet_id", promptPaidEvent.TweetID,
@@ -534,18 +1040,16 @@ func (a *Agent) onPromptPaidEvent(ctx context.Context, ev *indexer.Event, startu
 		}
 
 		err = a.ProcessPromptPaidEvent(ctx, ev.Raw.FromAddress, promptPaidEvent, ev.Raw.BlockNumber)
-		if err != nil {
-			slog.Warn("failed to process prompt paid event", "agent_address", ev.Raw.FromAddress, "prompt_id", promptPaidEvent.PromptID, "error", err)
+		if errors.Is(err, usage.ErrBudgetExceeded) {
+			// Prompts of agents over their budget wait for it to reset
+			// rather than being recovered on every reconciliation.
+			resetAt := usage.BudgetResetAt(time.Now())
+			slog.Info("parking prompt until agent budget resets", "agent_address", ev.Raw.FromAddress, "prompt_id", promptPaidEvent.PromptID, "reset_at", resetAt)
+			a.prompts.Park(ev.Raw.FromAddress, promptPaidEvent.PromptID, resetAt)
+			return
 		}
-	}
-
-	if startupController.IsStartupPhase() {
-		slog.Info("adding startup task", "agent_address", ev.Raw.FromAddress, "prompt_id", promptPaidEvent.PromptID)
-		startupController.AddStartupTask(ev.Raw.FromAddress.Bytes(), promptPaidEvent.PromptID, task)
-	} else {
-		err := a.pool.Go(task)
 		if err != nil {
-			slog.Error("failed to pool startup task", "agent_address", ev.Raw.FromAddress, "prompt_id", promptPaidEvent.PromptID, "error", err)
+			slog.Warn("failed to process prompt paid event", "agent_address", ev.Raw.FromAddress, "prompt_id", promptPaidEvent.PromptID, "error", err)
 		}
 	}
 }
@@ -565,6 +1069,11 @@ func (a *Agent) reactToTweet(ctx context.Context, agentInfo *indexer.AgentInfo,
 	var reply string
 	var isDrain bool
 	var publicErrStr string
+	var moderationVerdict *string
+	var model *string
+	var promptTokens, completionTokens *int64
+	var cost *float64
+	var votes []indexer.PromptVote
 
 	defer func() {
 		var nulledReply *string
@@ -585,6 +1094,13 @@ func (a *Agent) reactToTweet(ctx context.Context, agentInfo *indexer.AgentInfo,
 			Error:       nulledError,
 			BlockNumber: block,
 			UserAddr:    promptPaidEvent.User,
+			Moderation:  moderationVerdict,
+			Model:       model,
+
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			Cost:             cost,
+			Votes:            votes,
 		})
 		if err != nil {
 			slog.Error("failed to notify prompt indexer", "error", err)
@@ -592,17 +1108,76 @@ func (a *Agent) reactToTweet(ctx context.Context, agentInfo *indexer.AgentInfo,
 	}()
 
 	expectedTweet := fmt.Sprintf("@%s :%s: %s", a.twitterClientConfig.Username, agentInfo.Name, promptPaidEvent.Prompt)
-	if len(expectedTweet) > 280 {
+	if length := composer.Length(expectedTweet); length > composer.MaxTweetLength {
 		publicErrStr = "prompt is too long"
-		return fmt.Errorf("prompt is too long, expected %d tokens, got %d", 280, len(expectedTweet))
+		return fmt.Errorf("prompt is too long, expected at most %d characters, got %d", composer.MaxTweetLength, length)
+	}
+
+	if a.requireLinkedHandle {
+		err := a.checkLinkedHandle(ctx, promptPaidEvent)
+		if errors.Is(err, errHandleNotLinked) {
+			slog.Warn("rejecting prompt from unlinked tweet author", "agent_address", agentInfo.Address, "prompt_id", promptPaidEvent.PromptID, "tweet_id", promptPaidEvent.TweetID, "error", err)
+			publicErrStr = "tweet author is not linked to the paying account"
+
+			// The prompt is consumed without draining so that it is not retried.
+			if !debug.IsDebugDisableConsumption() {
+				if _, err := a.consumePrompt(ctx, agentInfo.Address, promptPaidEvent.PromptID, agentInfo.Address); err != nil {
+					return fmt.Errorf("failed to consume prompt: %v", err)
+				}
+			}
+			return nil
+		}
+		if err != nil {
+			publicErrStr = "failed to check linked handle"
+			return fmt.Errorf("failed to check linked handle: %v", err)
+		}
+	}
+
+	useMemory := a.memory != nil && a.memory.IsEnabled(agentInfo.Model)
+
+	promptCtx := usage.WithAgent(ctx, agentInfo.Address)
+	promptCtx = guard.WithPromptID(promptCtx, promptPaidEvent.PromptID)
+	promptCtx = chat.WithReplyPrefix(promptCtx, composer.Tagged(agentInfo.Name, ""))
+	if agentInfo.Model != nil {
+		promptCtx = chat.WithModel(promptCtx, starknetgoutils.HexToShortStr(agentInfo.Model.String()))
+	}
+	if useMemory {
+		history, err := a.memory.History(agentInfo.Address, promptPaidEvent.User)
+		if err != nil {
+			slog.Warn("failed to load conversation history", "agent_address", agentInfo.Address, "prompt_id", promptPaidEvent.PromptID, "error", err)
+		} else {
+			promptCtx = chat.WithHistory(promptCtx, history)
+		}
 	}
 
 	metadata := a.buildChatMetadata(agentInfo, promptPaidEvent)
-	resp, err := a.chatCompletion.Prompt(ctx, metadata, agentInfo.SystemPrompt, promptPaidEvent.Prompt)
+	resp, err := a.chatCompletion.Prompt(promptCtx, metadata, agentInfo.SystemPrompt, promptPaidEvent.Prompt)
+	if errors.Is(err, usage.ErrBudgetExceeded) {
+		publicErrStr = "agent is over its budget"
+		return fmt.Errorf("failed to generate AI response: %w", err)
+	}
 	if err != nil {
 		publicErrStr = "failed to generate AI response"
 		return fmt.Errorf("failed to generate AI response: %v", err)
 	}
+	if resp.Model != "" {
+		model = &resp.Model
+	}
+
+	promptTokensUsed, completionTokensUsed := int64(resp.Usage.PromptTokens), int64(resp.Usage.CompletionTokens)
+	promptTokens, completionTokens = &promptTokensUsed, &completionTokensUsed
+	if a.accountant != nil {
+		promptCost := a.accountant.ResponseCost(resp)
+		cost = &promptCost
+	}
+	for _, vote := range resp.Votes {
+		votes = append(votes, indexer.PromptVote{
+			Voter: vote.Voter,
+			Model: vote.Model,
+			Drain: vote.Drain,
+			Error: vote.Error,
+		})
+	}
 
 	isDrain = resp.Drain != nil
 	drainTo := agentInfo.Address
@@ -612,7 +1187,7 @@ func (a *Agent) reactToTweet(ctx context.Context, agentInfo *indexer.AgentInfo,
 	if isDrain {
 		drainTarget = resp.Drain.Address
 	}
-	slog.Info("reacting to tweet", "agent_address", agentInfo.Address, "tweet_id", promptPaidEvent.TweetID, "prompt_id", promptPaidEvent.PromptID, "prompt", promptPaidEvent.Prompt, "is_drain", isDrain, "drain_target", drainTarget)
+	slog.Info("reacting to tweet", "agent_address", agentInfo.Address, "tweet_id", promptPaidEvent.TweetID, "prompt_id", promptPaidEvent.PromptID, "prompt", promptPaidEvent.Prompt, "is_drain", isDrain, "drain_target", drainTarget, "model", resp.Model)
 
 	if isDrain {
 		respAddress, err := starknetgoutils.HexToFelt(resp.Drain.Address)
@@ -632,6 +1207,29 @@ func (a *Agent) reactToTweet(ctx context.Context, agentInfo *indexer.AgentInfo,
 		reply = resp.Response
 	}
 
+	if a.moderator != nil && strings.TrimSpace(reply) != "" {
+		verdict, err := a.moderator.Moderate(ctx, reply)
+		if err != nil {
+			slog.Warn("failed to moderate reply", "agent_address", agentInfo.Address, "prompt_id", promptPaidEvent.PromptID, "error", err)
+		}
+		if verdict.Action != moderation.ActionAllow {
+			slog.Info("moderated reply", "agent_address", agentInfo.Address, "prompt_id", promptPaidEvent.PromptID, "verdict", verdict.String())
+		}
+
+		verdictStr := verdict.String()
+		moderationVerdict = &verdictStr
+		reply = verdict.Reply
+	}
+
+	// The prize is read before consumption, which empties the agent on a drain.
+	var prize *big.Int
+	if isDrain {
+		prize, err = snaccount.FetchTokenBalance(ctx, a.starknetClient, agentInfo.TokenAddress, agentInfo.Address)
+		if err != nil {
+			slog.Warn("failed to fetch prize", "agent_address", agentInfo.Address, "prompt_id", promptPaidEvent.PromptID, "error", err)
+		}
+	}
+
 	txHash := new(felt.Felt)
 	if !debug.IsDebugDisableConsumption() {
 		txHash, err = a.consumePrompt(ctx, agentInfo.Address, promptPaidEvent.PromptID, drainTo)
@@ -643,16 +1241,16 @@ func (a *Agent) reactToTweet(ctx context.Context, agentInfo *indexer.AgentInfo,
 	}
 
 	if !debug.IsDebugDisableReplies() {
-		slog.Info("fetching tweet text", "tweet_id", promptPaidEvent.TweetID)
-		tweetText, err := a.twitterClient.GetTweetText(promptPaidEvent.TweetID)
+		slog.Info("fetching tweet", "tweet_id", promptPaidEvent.TweetID)
+		tweet, err := a.twitterClient.GetTweet(ctx, promptPaidEvent.TweetID)
 		if err != nil {
-			slog.Warn("failed to get tweet text", "agent_address", agentInfo.Address, "prompt_id", promptPaidEvent.PromptID, "error", err)
-			publicErrStr = "failed to get tweet text"
+			slog.Warn("failed to get tweet", "agent_address", agentInfo.Address, "prompt_id", promptPaidEvent.PromptID, "error", err)
+			publicErrStr = "failed to get tweet"
 
 			return nil
 		}
 
-		err = a.validateTweetText(tweetText, agentInfo.Name, promptPaidEvent.Prompt)
+		err = a.validateTweetText(tweet.Text, agentInfo.Name, promptPaidEvent.Prompt)
 		if err != nil {
 			slog.Warn("tweet text validation failed", "agent_address", agentInfo.Address, "prompt_id", promptPaidEvent.PromptID, "error", err)
 			publicErrStr = "tweet text validation failed"
@@ -677,16 +1275,31 @@ func (a *Agent) reactToTweet(ctx context.Context, agentInfo *indexer.AgentInfo,
 
 		if isDrain {
 			slog.Info("sending tweet", "agent_address", agentInfo.Address, "prompt_id", promptPaidEvent.PromptID, "tweet_id", promptPaidEvent.TweetID, "drain_to", resp.Drain.Address)
-			tweet := fmt.Sprintf(":%s: was drained! Check it out on https://sepolia.voyager.online/tx/%s. Congratulations!", tweetAgentIdentifier, txHash)
-			err := a.twitterClient.SendTweet(tweet)
+			drainTweet := composer.Tagged(tweetAgentIdentifier, fmt.Sprintf("was drained! Check it out on https://sepolia.voyager.online/tx/%s. Congratulations!", txHash))
+			// The winning prompt is posted on the card, it is moderated like replies.
+			cardPrompt := promptPaidEvent.Prompt
+			if a.moderator != nil {
+				cardPrompt = moderation.ModerateExcerpt(ctx, a.moderator, cardPrompt)
+			}
+			image, err := card.Render(&card.DrainCard{
+				AgentName: tweetAgentIdentifier,
+				Prize:     formatTokenAmount(prize, agentInfo.TokenAddress),
+				Attacker:  promptPaidEvent.User.String(),
+				Prompt:    cardPrompt,
+				TxHash:    txHash.String(),
+			})
+			if err != nil {
+				slog.Warn("failed to render share card", "agent_address", agentInfo.Address, "prompt_id", promptPaidEvent.PromptID, "error", err)
+			}
+			err = a.sendTweet(ctx, outbox.Key(agentInfo.Address.String(), promptPaidEvent.PromptID, outboxKindDrainTweet), outboxKindDrainTweet, drainTweet, image)
 			if err != nil {
 				publicErrStr = "failed to send tweet"
 				slog.Warn("failed to send tweet", "agent_address", agentInfo.Address, "prompt_id", promptPaidEvent.PromptID, "tweet_id", promptPaidEvent.TweetID, "error", err)
 			}
 
 			slog.Info("replying as drained to", "agent_address", agentInfo.Address, "prompt_id", promptPaidEvent.PromptID, "tweet_id", promptPaidEvent.TweetID, "drain_to", resp.Drain.Address)
-			reply := fmt.Sprintf(":%s: Drained! Check it out on https://sepolia.voyager.online/tx/%s. Congratulations!", tweetAgentIdentifier, txHash)
-			err = a.twitterClient.ReplyToTweet(promptPaidEvent.TweetID, reply)
+			reply := composer.Tagged(tweetAgentIdentifier, fmt.Sprintf("Drained! Check it out on https://sepolia.voyager.online/tx/%s. Congratulations!", txHash))
+			err = a.replyToTweet(ctx, outbox.Key(agentInfo.Address.String(), promptPaidEvent.PromptID, outboxKindDrainReply), outboxKindDrainReply, promptPaidEvent.TweetID, reply)
 			if err != nil {
 				publicErrStr = "failed to reply to tweet"
 				slog.Warn("failed to reply to tweet", "agent_address", agentInfo.Address, "prompt_id", promptPaidEvent.PromptID, "tweet_id", promptPaidEvent.TweetID, "error", err)
@@ -695,10 +1308,16 @@ func (a *Agent) reactToTweet(ctx context.Context, agentInfo *indexer.AgentInfo,
 
 		if strings.TrimSpace(reply) != "" {
 			slog.Info("replying to", "agent_address", agentInfo.Address, "prompt_id", promptPaidEvent.PromptID, "tweet_id", promptPaidEvent.TweetID, "reply", reply)
-			err = a.twitterClient.ReplyToTweet(promptPaidEvent.TweetID, fmt.Sprintf(":%s: %s", tweetAgentIdentifier, reply))
+			err = a.replyToTweet(ctx, outbox.Key(agentInfo.Address.String(), promptPaidEvent.PromptID, outboxKindReply), outboxKindReply, promptPaidEvent.TweetID, composer.Tagged(tweetAgentIdentifier, reply))
 			if err != nil {
 				publicErrStr = "failed to reply to tweet"
 				slog.Warn("failed to reply to tweet", "agent_address", agentInfo.Address, "prompt_id", promptPaidEvent.PromptID, "tweet_id", promptPaidEvent.TweetID, "error", err)
+			} else if useMemory {
+				// Only replies the user was sent are remembered, as moderated.
+				err := a.memory.Record(agentInfo.Address, promptPaidEvent.User, promptPaidEvent.PromptID, promptPaidEvent.Prompt, reply)
+				if err != nil {
+					slog.Warn("failed to record conversation turn", "agent_address", agentInfo.Address, "prompt_id", promptPaidEvent.PromptID, "error", err)
+				}
 			}
 		}
 	}
@@ -706,6 +1325,108 @@ func (a *Agent) reactToTweet(ctx context.Context, agentInfo *indexer.AgentInfo,
 	return nil
 }
 
+// checkLinkedHandle checks that the prompt tweet was posted by the Twitter
+// handle linked to the paying account. It wraps errHandleNotLinked if not.
+func (a *Agent) checkLinkedHandle(ctx context.Context, promptPaidEvent *indexer.PromptPaidEvent) error {
+	if a.promptIndexerEndpoint == "" {
+		return fmt.Errorf("prompt indexer endpoint not set")
+	}
+
+	tweet, err := a.twitterClient.GetTweet(ctx, promptPaidEvent.TweetID)
+	if err != nil {
+		return fmt.Errorf("failed to get tweet: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", a.promptIndexerEndpoint+"/link?address="+promptPaidEvent.User.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: account %s has no linked handle", errHandleNotLinked, promptPaidEvent.User)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get linked handle: status code %d", resp.StatusCode)
+	}
+
+	var linked link.Link
+	if err := json.NewDecoder(resp.Body).Decode(&linked); err != nil {
+		return fmt.Errorf("failed to decode link: %w", err)
+	}
+
+	if !strings.EqualFold(linked.Handle, tweet.AuthorUsername) {
+		return fmt.Errorf("%w: tweet is from @%s, account is linked to @%s", errHandleNotLinked, tweet.AuthorUsername, linked.Handle)
+	}
+
+	return nil
+}
+
+// replyToTweet queues a reply in the outbox, or posts it right away if there is none.
+func (a *Agent) replyToTweet(ctx context.Context, key, kind string, tweetID uint64, reply string) error {
+	if a.outbox == nil {
+		_, err := a.twitterClient.ReplyToTweet(ctx, tweetID, reply)
+		return err
+	}
+
+	_, err := a.outbox.Reply(key, kind, tweetID, reply)
+	return err
+}
+
+// sendTweet queues a tweet with an optional PNG image in the outbox, or posts
+// it right away if there is none.
+func (a *Agent) sendTweet(ctx context.Context, key, kind string, tweet string, image []byte) error {
+	if a.outbox == nil {
+		var err error
+		if image != nil {
+			_, err = a.twitterClient.SendTweetWithImage(ctx, tweet, image)
+		} else {
+			_, err = a.twitterClient.SendTweet(ctx, tweet)
+		}
+		return err
+	}
+
+	var err error
+	if image != nil {
+		_, err = a.outbox.TweetWithImage(key, kind, tweet, image)
+	} else {
+		_, err = a.outbox.Tweet(key, kind, tweet)
+	}
+	return err
+}
+
+// formatTokenAmount formats an amount of an 18 decimals token with its symbol, if known.
+func formatTokenAmount(amount *big.Int, tokenAddress *felt.Felt) string {
+	if amount == nil {
+		return ""
+	}
+
+	symbol := "tokens"
+	switch {
+	case tokenAddress.Equal(ethAddress):
+		symbol = "ETH"
+	case tokenAddress.Equal(strkAddress):
+		symbol = "STRK"
+	}
+
+	whole, fraction := new(big.Int).QuoRem(amount, tokenDecimalsFactor, new(big.Int))
+	amountStr := whole.String()
+	if fraction.Sign() != 0 {
+		amountStr += "." + strings.TrimRight(fmt.Sprintf("%018s", fraction.String()), "0")
+	}
+
+	return amountStr + " " + symbol
+}
+
 func (a *Agent) consumePrompt(ctx context.Context, agentAddress *felt.Felt, promptID uint64, drainTo *felt.Felt) (*felt.Felt, error) {
 	fnCall := rpc.FunctionCall{
 		ContractAddress:    a.agentRegistryAddress,
@@ -725,6 +1446,8 @@ func (a *Agent) consumePrompt(ctx context.Context, agentAddress *felt.Felt, prom
 
 	slog.Info("transaction broadcast successful", "tx_hash", txHash)
 
+	a.prompts.Consumed(agentAddress, promptID)
+
 	return txHash, nil
 }
 
@@ -756,8 +1479,14 @@ func (a *Agent) quote(ctx context.Context) (*QuoteData, error) {
 }
 
 func (a *Agent) validateTweetText(tweetText, agentName, promptText string) error {
-	// Check if the tweet contains the username
-	if !strings.Contains(tweetText, "@"+a.twitterClientConfig.Username) {
+	// Check if the tweet contains the username of an account the agent replies from
+	usernames := []string{a.twitterClientConfig.Username}
+	if multiClient, ok := a.twitterClient.(*twitter.MultiClient); ok {
+		usernames = multiClient.WriteUsernames()
+	}
+	if !slices.ContainsFunc(usernames, func(username string) bool {
+		return strings.Contains(tweetText, "@"+username)
+	}) {
 		return fmt.Errorf("tweet must mention @%s", a.twitterClientConfig.Username)
 	}
 
@@ -773,7 +1502,7 @@ func (a *Agent) validateTweetText(tweetText, agentName, promptText string) error
 func (a *Agent) isPromptConsumed(ctx context.Context, agentAddress *felt.Felt, promptID uint64) (bool, error) {
 	fnCall := rpc.FunctionCall{
 		ContractAddress:    agentAddress,
-		EntryPointSelector: starknetgoutils.GetSelectorFromNameFelt("get_pending_prompt_submitter"),
+		EntryPointSelector: getPendingPromptSubmitterSelector,
 		Calldata:           []*felt.Felt{new(felt.Felt).SetUint64(promptID)},
 	}
 
@@ -796,29 +1525,7 @@ func (a *Agent) isPromptConsumed(ctx context.Context, agentAddress *felt.Felt, p
 }
 
 func (a *Agent) checkAccountBalance(ctx context.Context) (*big.Int, error) {
-	fnCall := rpc.FunctionCall{
-		ContractAddress:    ethAddress,
-		EntryPointSelector: balanceOfSelector,
-		Calldata:           []*felt.Felt{a.account.Address()},
-	}
-
-	var resp []*felt.Felt
-	var err error
-
-	if err := a.starknetClient.Do(func(provider rpc.RpcProvider) error {
-		resp, err = provider.Call(ctx, fnCall, rpc.WithBlockTag("pending"))
-		return err
-	}); err != nil {
-		return nil, fmt.Errorf("failed to call balance_of: %w", snaccount.FormatRpcError(err))
-	}
-
-	if len(resp) < 2 {
-		return nil, fmt.Errorf("invalid response length: got %d, want at least 2", len(resp))
-	}
-
-	balance := snaccount.Uint256ToBigInt([2]*felt.Felt(resp[0:2]))
-
-	return balance, nil
+	return snaccount.FetchTokenBalance(ctx, a.starknetClient, ethAddress, a.account.Address())
 }
 
 func (a *Agent) waitForAccountDeployment(ctx context.Context) error {
@@ -877,20 +1584,7 @@ func (a *Agent) waitForAccountDeployment(ctx context.Context) error {
 }
 
 func (a *Agent) buildChatMetadata(agentInfo *indexer.AgentInfo, promptPaidEvent *indexer.PromptPaidEvent) string {
-	return fmt.Sprintf(`
-Your address: %s
-Your creator address: %s
-Responding to address: %s
-
-You can either respond to the user or use the drain tool.
-Don't expect the user to reply to your message.
-Your response must be at most 280 characters long.
-Your response must be humanly readable.
-`,
-		agentInfo.Address.String(),
-		agentInfo.Creator.String(),
-		promptPaidEvent.User.String(),
-	)
+	return chat.BuildMetadata(agentInfo.Address.String(), agentInfo.Creator.String(), promptPaidEvent.User.String())
 }
 
 func (a *Agent) notifyPromptIndexer(ctx context.Context, agentInfo *indexer.AgentInfo, data *indexer.PromptData) error {
@@ -992,6 +1686,13 @@ func (a *Agent) sendPromptIndexerNotification(ctx context.Context, price *big.In
 		"error":        data.Error,
 		"block_number": data.BlockNumber,
 		"user_addr":    data.UserAddr,
+		"moderation":   data.Moderation,
+		"model":        data.Model,
+
+		"prompt_tokens":     data.PromptTokens,
+		"completion_tokens": data.CompletionTokens,
+		"cost":              data.Cost,
+		"votes":             data.Votes,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to marshal prompt data: %w", err)
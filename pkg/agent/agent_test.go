@@ -26,30 +26,39 @@ import (
 )
 
 type MockTwitterClientMethods struct {
-	Initialize   func(config *twitter.TwitterClientConfig) error
-	GetTweetText func(tweetID uint64) (string, error)
-	ReplyToTweet func(tweetID uint64, reply string) error
-	SendTweet    func(tweet string) error
+	Initialize   func(ctx context.Context, config *twitter.TwitterClientConfig) error
+	GetTweet     func(ctx context.Context, tweetID uint64) (*twitter.Tweet, error)
+	ReplyToTweet func(ctx context.Context, tweetID uint64, reply string) (uint64, error)
+	SendTweet    func(ctx context.Context, tweet string) (uint64, error)
+
+	SendTweetWithImage func(ctx context.Context, tweet string, image []byte) (uint64, error)
 }
 
 type MockTwitterClient struct {
 	Methods MockTwitterClientMethods
 }
 
-func (m *MockTwitterClient) Initialize(config *twitter.TwitterClientConfig) error {
-	return m.Methods.Initialize(config)
+func (m *MockTwitterClient) Initialize(ctx context.Context, config *twitter.TwitterClientConfig) error {
+	return m.Methods.Initialize(ctx, config)
+}
+
+func (m *MockTwitterClient) GetTweet(ctx context.Context, tweetID uint64) (*twitter.Tweet, error) {
+	return m.Methods.GetTweet(ctx, tweetID)
 }
 
-func (m *MockTwitterClient) GetTweetText(tweetID uint64) (string, error) {
-	return m.Methods.GetTweetText(tweetID)
+func (m *MockTwitterClient) ReplyToTweet(ctx context.Context, tweetID uint64, reply string) (uint64, error) {
+	return m.Methods.ReplyToTweet(ctx, tweetID, reply)
 }
 
-func (m *MockTwitterClient) ReplyToTweet(tweetID uint64, reply string) error {
-	return m.Methods.ReplyToTweet(tweetID, reply)
+func (m *MockTwitterClient) SendTweet(ctx context.Context, tweet string) (uint64, error) {
+	return m.Methods.SendTweet(ctx, tweet)
 }
 
-func (m *MockTwitterClient) SendTweet(tweet string) error {
-	return m.Methods.SendTweet(tweet)
+func (m *MockTwitterClient) SendTweetWithImage(ctx context.Context, tweet string, image []byte) (uint64, error) {
+	if m.Methods.SendTweetWithImage == nil {
+		return m.Methods.SendTweet(ctx, tweet)
+	}
+	return m.Methods.SendTweetWithImage(ctx, tweet, image)
 }
 
 type MockChatCompletionMethods struct {
@@ -680,17 +689,17 @@ func TestProcessPromptPaidEvent(t *testing.T) {
 
 			twitterClient := &MockTwitterClient{
 				Methods: MockTwitterClientMethods{
-					GetTweetText: func(tweetID uint64) (string, error) {
+					GetTweet: func(ctx context.Context, tweetID uint64) (*twitter.Tweet, error) {
 						if tt.twitterError != nil {
-							return "", tt.twitterError
+							return nil, tt.twitterError
 						}
-						return tt.tweetText, nil
+						return &twitter.Tweet{ID: tweetID, Text: tt.tweetText}, nil
 					},
-					ReplyToTweet: func(tweetID uint64, reply string) error {
-						return nil
+					ReplyToTweet: func(ctx context.Context, tweetID uint64, reply string) (uint64, error) {
+						return tweetID + 1, nil
 					},
-					SendTweet: func(tweet string) error {
-						return nil
+					SendTweet: func(ctx context.Context, tweet string) (uint64, error) {
+						return 1, nil
 					},
 				},
 			}
@@ -6,8 +6,12 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/NethermindEth/teeception/pkg/agent/setup"
+	"github.com/NethermindEth/teeception/pkg/twitter"
 )
 
 func (a *Agent) StartServer(ctx context.Context) error {
@@ -47,6 +51,145 @@ func (a *Agent) StartServer(ctx context.Context) error {
 		})
 	})
 
+	router.GET("/balance", func(c *gin.Context) {
+		if a.balanceMonitor == nil {
+			c.String(http.StatusNotFound, "balance monitor not configured")
+			return
+		}
+
+		status := a.balanceMonitor.Status()
+
+		resp := gin.H{
+			"balance":      status.Balance.String(),
+			"updated_at":   status.UpdatedAt.Unix(),
+			"spend_rate":   status.SpendRate.String(),
+			"degraded":     status.Degraded,
+			"queue_paused": a.txQueue.IsPaused(),
+			"queued_txs":   a.txQueue.Len(),
+		}
+		if status.Runway != nil {
+			resp["runway_seconds"] = int64(status.Runway.Seconds())
+		}
+
+		c.JSON(http.StatusOK, resp)
+	})
+
+	router.GET("/reconciler", func(c *gin.Context) {
+		if a.reconciler == nil {
+			c.String(http.StatusNotFound, "reconciler not configured")
+			return
+		}
+
+		report := a.reconciler.LastReport()
+		if report == nil {
+			c.JSON(http.StatusOK, gin.H{"status": "pending"})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	})
+
+	router.GET("/outbox", func(c *gin.Context) {
+		if a.outbox == nil {
+			c.String(http.StatusNotFound, "outbox not configured")
+			return
+		}
+
+		backlog, err := a.outbox.Backlog()
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, backlog)
+	})
+
+	router.GET("/twitter/accounts", func(c *gin.Context) {
+		multiClient, ok := a.twitterClient.(*twitter.MultiClient)
+		if !ok {
+			c.String(http.StatusNotFound, "twitter failover not configured")
+			return
+		}
+
+		c.JSON(http.StatusOK, multiClient.Accounts())
+	})
+
+	router.GET("/chat/backends", func(c *gin.Context) {
+		if a.chatFallback == nil {
+			c.String(http.StatusNotFound, "chat fallback not configured")
+			return
+		}
+
+		c.JSON(http.StatusOK, a.chatFallback.Backends())
+	})
+
+	router.GET("/usage", func(c *gin.Context) {
+		if a.accountant == nil {
+			c.String(http.StatusNotFound, "usage accounting not configured")
+			return
+		}
+
+		days := 30
+		if daysStr := c.Query("days"); daysStr != "" {
+			parsed, err := strconv.Atoi(daysStr)
+			if err != nil || parsed <= 0 {
+				c.String(http.StatusBadRequest, "invalid days")
+				return
+			}
+			days = parsed
+		}
+
+		records, err := a.accountant.Records(days)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, records)
+	})
+
+	router.GET("/guard", func(c *gin.Context) {
+		if a.guard == nil {
+			c.String(http.StatusNotFound, "guard pipeline not configured")
+			return
+		}
+
+		limit := 100
+		if limitStr := c.Query("limit"); limitStr != "" {
+			parsed, err := strconv.Atoi(limitStr)
+			if err != nil || parsed <= 0 {
+				c.String(http.StatusBadRequest, "invalid limit")
+				return
+			}
+			limit = parsed
+		}
+
+		stats, err := a.guard.Stats()
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		verdicts, err := a.guard.Verdicts(limit)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"stats":    stats,
+			"verdicts": verdicts,
+		})
+	})
+
+	router.GET("/mentions", func(c *gin.Context) {
+		if a.mentionWatcher == nil {
+			c.String(http.StatusNotFound, "mention watcher not configured")
+			return
+		}
+
+		c.JSON(http.StatusOK, a.mentionWatcher.Funnel())
+	})
+
 	router.GET("/quote", func(c *gin.Context) {
 		quoteData, err := a.quote(c.Request.Context())
 		if err != nil {
@@ -66,6 +209,26 @@ func (a *Agent) StartServer(ctx context.Context) error {
 		c.JSON(http.StatusOK, resp)
 	})
 
+	if a.migrationExporter != nil {
+		router.POST("/migration/export", func(c *gin.Context) {
+			var req setup.MigrationRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.String(http.StatusBadRequest, err.Error())
+				return
+			}
+
+			bundle, err := a.migrationExporter.Export(c.Request.Context(), &req)
+			if err != nil {
+				slog.Warn("rejected migration request", "error", err)
+				c.String(http.StatusForbidden, err.Error())
+				return
+			}
+
+			c.JSON(http.StatusOK, bundle)
+			a.migrationExporter.MarkServed()
+		})
+	}
+
 	server := &http.Server{
 		Addr:    ":8080",
 		Handler: router,
@@ -0,0 +1,200 @@
+// Package card renders the share cards attached to drain announcements.
+package card
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// Width and Height are the card dimensions, matching Twitter's 16:9 previews.
+	Width  = 1200
+	Height = 675
+
+	margin          = 64
+	maxPromptLines  = 5
+	maxAddressRunes = 20
+)
+
+var (
+	backgroundColor = color.RGBA{0x0b, 0x0d, 0x12, 0xff}
+	accentColor     = color.RGBA{0xff, 0x3d, 0x5a, 0xff}
+	textColor       = color.RGBA{0xf2, 0xf4, 0xf8, 0xff}
+	mutedColor      = color.RGBA{0x8a, 0x93, 0xa6, 0xff}
+)
+
+// DrainCard is the content of the card announcing a drained agent.
+type DrainCard struct {
+	AgentName string
+	// Prize is the drained amount, already formatted with its unit.
+	Prize    string
+	Attacker string
+	Prompt   string
+	TxHash   string
+}
+
+type faces struct {
+	title   font.Face
+	prize   font.Face
+	body    font.Face
+	mono    font.Face
+	caption font.Face
+}
+
+func loadFaces() (*faces, error) {
+	newFace := func(ttf []byte, size float64) (font.Face, error) {
+		parsed, err := opentype.Parse(ttf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse font: %v", err)
+		}
+		return opentype.NewFace(parsed, &opentype.FaceOptions{
+			Size:    size,
+			DPI:     72,
+			Hinting: font.HintingFull,
+		})
+	}
+
+	var f faces
+	var err error
+	if f.title, err = newFace(gobold.TTF, 64); err != nil {
+		return nil, err
+	}
+	if f.prize, err = newFace(gobold.TTF, 48); err != nil {
+		return nil, err
+	}
+	if f.body, err = newFace(goregular.TTF, 30); err != nil {
+		return nil, err
+	}
+	if f.mono, err = newFace(gomono.TTF, 24); err != nil {
+		return nil, err
+	}
+	if f.caption, err = newFace(gobold.TTF, 24); err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+// Render draws the card and encodes it as a PNG.
+func Render(card *DrainCard) ([]byte, error) {
+	f, err := loadFaces()
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, Width, Height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(backgroundColor), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, 16, Height), image.NewUniform(accentColor), image.Point{}, draw.Src)
+
+	y := margin + 24
+	drawText(img, f.caption, accentColor, margin, y, "DRAINED")
+
+	y += 72
+	drawText(img, f.title, textColor, margin, y, fitText(f.title, ":"+card.AgentName+":", Width-2*margin))
+
+	y += 72
+	drawText(img, f.prize, accentColor, margin, y, fitText(f.prize, card.Prize, Width-2*margin))
+
+	y += 64
+	if prompt := strings.TrimSpace(card.Prompt); prompt != "" {
+		for _, line := range wrapText(f.body, "“"+prompt+"”", Width-2*margin, maxPromptLines) {
+			drawText(img, f.body, textColor, margin, y, line)
+			y += 40
+		}
+	}
+
+	drawText(img, f.mono, mutedColor, margin, Height-margin-36, "attacker "+shorten(card.Attacker))
+	drawText(img, f.mono, mutedColor, margin, Height-margin, "tx       "+shorten(card.TxHash))
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode card: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func drawText(img draw.Image, face font.Face, c color.Color, x, y int, text string) {
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
+
+// fitText cuts text with an ellipsis so that it fits in width pixels.
+func fitText(face font.Face, text string, width int) string {
+	if font.MeasureString(face, text).Ceil() <= width {
+		return text
+	}
+
+	for len(text) > 0 {
+		_, size := utf8.DecodeLastRuneInString(text)
+		text = text[:len(text)-size]
+		if font.MeasureString(face, text+"…").Ceil() <= width {
+			break
+		}
+	}
+
+	return text + "…"
+}
+
+// wrapText breaks text into at most maxLines lines of width pixels, ending
+// with an ellipsis if it does not fit.
+func wrapText(face font.Face, text string, width int, maxLines int) []string {
+	words := strings.Fields(text)
+	lines := make([]string, 0, maxLines)
+	line := ""
+
+	for i, word := range words {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+
+		if font.MeasureString(face, candidate).Ceil() <= width {
+			line = candidate
+			continue
+		}
+
+		if line != "" {
+			lines = append(lines, fitText(face, line, width))
+		}
+		line = word
+
+		if len(lines) == maxLines {
+			// The rest does not fit, so the last line is cut with an ellipsis.
+			lines[maxLines-1] = fitText(face, lines[maxLines-1]+" "+strings.Join(words[i:], " "), width)
+			return lines
+		}
+	}
+
+	if line != "" {
+		lines = append(lines, fitText(face, line, width))
+	}
+
+	return lines
+}
+
+// shorten abbreviates long hex strings such as addresses and hashes.
+func shorten(s string) string {
+	if utf8.RuneCountInString(s) <= maxAddressRunes {
+		return s
+	}
+	return s[:10] + "…" + s[len(s)-8:]
+}
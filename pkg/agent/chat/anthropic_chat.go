@@ -0,0 +1,325 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/tmc/langchaingo/jsonschema"
+)
+
+const (
+	DefaultAnthropicBaseUrl = "https://api.anthropic.com"
+	DefaultAnthropicModel   = "claude-3-5-sonnet-latest"
+
+	anthropicVersion          = "2023-06-01"
+	anthropicMessagesPath     = "/v1/messages"
+	defaultAnthropicMaxTokens = 1024
+)
+
+// AnthropicChatCompletionConfig is the configuration for the AnthropicChatCompletion
+type AnthropicChatCompletionConfig struct {
+	ApiKey string
+	// BaseUrl is the URL the Messages API is served under.
+	BaseUrl string
+	Model   string
+	// MaxTokens is the maximum number of tokens generated per response.
+	MaxTokens  int
+	HTTPClient *http.Client
+	// Tools defaults to DefaultToolRegistry().
+	Tools *ToolRegistry
+}
+
+// AnthropicChatCompletion is the implementation of the ChatCompletion
+// interface for the Anthropic Messages API
+type AnthropicChatCompletion struct {
+	apiKey     string
+	baseUrl    string
+	model      string
+	maxTokens  int
+	httpClient *http.Client
+	tools      *ToolRegistry
+}
+
+var _ ChatCompletion = (*AnthropicChatCompletion)(nil)
+
+// NewAnthropicChatCompletion creates a new AnthropicChatCompletion
+func NewAnthropicChatCompletion(config AnthropicChatCompletionConfig) *AnthropicChatCompletion {
+	if config.BaseUrl == "" {
+		config.BaseUrl = DefaultAnthropicBaseUrl
+	}
+	if config.Model == "" {
+		config.Model = DefaultAnthropicModel
+	}
+	if config.MaxTokens <= 0 {
+		config.MaxTokens = defaultAnthropicMaxTokens
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	if config.Tools == nil {
+		config.Tools = DefaultToolRegistry()
+	}
+
+	return &AnthropicChatCompletion{
+		apiKey:     config.ApiKey,
+		baseUrl:    strings.TrimSuffix(config.BaseUrl, "/"),
+		model:      config.Model,
+		maxTokens:  config.MaxTokens,
+		httpClient: config.HTTPClient,
+		tools:      config.Tools,
+	}
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicTool struct {
+	Name        string                `json:"name"`
+	Description string                `json:"description"`
+	InputSchema jsonschema.Definition `json:"input_schema"`
+}
+
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	MaxTokens   int                `json:"max_tokens"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	Tools       []anthropicTool    `json:"tools,omitempty"`
+	Temperature *float64           `json:"temperature,omitempty"`
+}
+
+type anthropicContentBlock struct {
+	Type  string          `json:"type"`
+	Text  string          `json:"text,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+}
+
+type anthropicResponse struct {
+	Model      string                  `json:"model"`
+	Content    []anthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+// AnthropicError is an error response of the Anthropic API.
+type AnthropicError struct {
+	StatusCode int
+	Type       string
+	Message    string
+}
+
+func (e *AnthropicError) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("status %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("status %d: %s: %s", e.StatusCode, e.Type, e.Message)
+}
+
+func anthropicTools(registry *ToolRegistry) []anthropicTool {
+	var tools []anthropicTool
+	for _, tool := range registry.Tools() {
+		tools = append(tools, anthropicTool{
+			Name:        tool.Name,
+			Description: tool.Description,
+			InputSchema: tool.Parameters,
+		})
+	}
+	return tools
+}
+
+// Prompt sends a prompt to the Anthropic API and returns the response
+func (c *AnthropicChatCompletion) Prompt(ctx context.Context, metadata, systemPrompt, prompt string) (*ChatCompletionResponse, error) {
+	messages := make([]anthropicMessage, 0, len(HistoryFromContext(ctx))+1)
+	for _, message := range HistoryFromContext(ctx) {
+		messages = append(messages, anthropicMessage{
+			Role:    message.Role,
+			Content: message.Content,
+		})
+	}
+	messages = append(messages, anthropicMessage{
+		Role:    ChatMessageRoleUser,
+		Content: prompt,
+	})
+
+	resp, err := c.createMessage(ctx, &anthropicRequest{
+		Model:     c.model,
+		MaxTokens: c.maxTokens,
+		System:    metadata + "\n\n" + systemPrompt,
+		Messages:  messages,
+		Tools:     anthropicTools(c.tools),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("chat completion failed: %w", err)
+	}
+
+	result := &ChatCompletionResponse{
+		Response: resp.text(),
+		Model:    c.model,
+		Usage: ChatCompletionUsage{
+			PromptTokens:     resp.Usage.InputTokens,
+			CompletionTokens: resp.Usage.OutputTokens,
+		},
+	}
+	if resp.Model != "" {
+		result.Model = resp.Model
+	}
+
+	var calls []ToolCall
+	for _, block := range resp.Content {
+		if block.Type != "tool_use" {
+			continue
+		}
+
+		var err error
+		calls, err = c.tools.appendCall(calls, block.Name, block.Input)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := result.setToolCalls(calls); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ValidateName checks if a name is appropriate for social media posting
+// It ensures the name doesn't contain sexual content or offensive words
+func (c *AnthropicChatCompletion) ValidateName(ctx context.Context, name string) (bool, error) {
+	temperature := 0.0
+
+	messages := []anthropicMessage{
+		{
+			Role:    ChatMessageRoleUser,
+			Content: fmt.Sprintf("Is this name appropriate: \"%s\"", name),
+		},
+	}
+
+	resp, err := c.createMessage(ctx, &anthropicRequest{
+		Model:       c.model,
+		MaxTokens:   c.maxTokens,
+		System:      validateNameSystemPrompt,
+		Messages:    messages,
+		Temperature: &temperature,
+	})
+	if err != nil {
+		return false, fmt.Errorf("name validation failed: %w", err)
+	}
+
+	type ValidationResponse struct {
+		Appropriate bool `json:"appropriate"`
+	}
+
+	var validationResp ValidationResponse
+	content := resp.text()
+
+	err = json.Unmarshal([]byte(ExtractJSONObject(content)), &validationResp)
+	if err != nil {
+		// If parsing fails, make a second attempt with a more direct prompt
+		messages = append(messages, anthropicMessage{
+			Role:    ChatMessageRoleAssistant,
+			Content: content,
+		}, anthropicMessage{
+			Role:    ChatMessageRoleUser,
+			Content: validateNameRetryPrompt,
+		})
+
+		resp, err = c.createMessage(ctx, &anthropicRequest{
+			Model:       c.model,
+			MaxTokens:   c.maxTokens,
+			System:      validateNameSystemPrompt,
+			Messages:    messages,
+			Temperature: &temperature,
+		})
+		if err != nil {
+			return false, fmt.Errorf("follow-up name validation failed: %w", err)
+		}
+
+		err = json.Unmarshal([]byte(ExtractJSONObject(resp.text())), &validationResp)
+		if err != nil {
+			// If still failing, make a conservative decision
+			return false, nil
+		}
+	}
+
+	return validationResp.Appropriate, nil
+}
+
+func (c *AnthropicChatCompletion) ResolveModel(ctx context.Context) string {
+	return c.model
+}
+
+func (c *AnthropicChatCompletion) createMessage(ctx context.Context, request *anthropicRequest) (*anthropicResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseUrl+anthropicMessagesPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", c.apiKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(respBody, &errResp); err == nil && errResp.Error.Message != "" {
+			return nil, &AnthropicError{
+				StatusCode: resp.StatusCode,
+				Type:       errResp.Error.Type,
+				Message:    errResp.Error.Message,
+			}
+		}
+		return nil, &AnthropicError{
+			StatusCode: resp.StatusCode,
+			Message:    string(respBody),
+		}
+	}
+
+	var message anthropicResponse
+	if err := json.Unmarshal(respBody, &message); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return &message, nil
+}
+
+// text returns the text blocks of the response joined together.
+func (r *anthropicResponse) text() string {
+	var parts []string
+	for _, block := range r.Content {
+		if block.Type == "text" {
+			parts = append(parts, block.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,357 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CassetteMode selects whether a CassetteChatCompletion records or replays exchanges.
+type CassetteMode string
+
+const (
+	// CassetteModeRecord prompts the wrapped ChatCompletion and records every exchange.
+	CassetteModeRecord CassetteMode = "record"
+	// CassetteModeReplay answers from the cassette only, failing with
+	// ErrCassetteMiss on unrecorded requests.
+	CassetteModeReplay CassetteMode = "replay"
+	// CassetteModeAuto answers from the cassette and records the requests it misses.
+	CassetteModeAuto CassetteMode = "auto"
+)
+
+// CassetteMatching selects how requests are matched against recorded exchanges.
+type CassetteMatching string
+
+const (
+	// CassetteMatchingStrict matches identical requests, each recorded
+	// exchange being replayed once in order.
+	CassetteMatchingStrict CassetteMatching = "strict"
+	// CassetteMatchingLenient ignores the metadata, case and whitespace of
+	// requests, and replays the last matching exchange once the others are used.
+	CassetteMatchingLenient CassetteMatching = "lenient"
+)
+
+const (
+	cassetteKindPrompt       = "prompt"
+	cassetteKindValidateName = "validate_name"
+)
+
+// ErrCassetteMiss is returned in replay mode for requests without a recorded exchange.
+var ErrCassetteMiss = errors.New("no recorded exchange matches the request")
+
+// CassetteRequest is the input of a recorded exchange.
+type CassetteRequest struct {
+	Kind         string        `json:"kind"`
+	Model        string        `json:"model,omitempty"`
+	Metadata     string        `json:"metadata,omitempty"`
+	SystemPrompt string        `json:"system_prompt,omitempty"`
+	Prompt       string        `json:"prompt,omitempty"`
+	History      []ChatMessage `json:"history,omitempty"`
+	Name         string        `json:"name,omitempty"`
+}
+
+// CassetteEntry is a recorded exchange.
+type CassetteEntry struct {
+	Request    CassetteRequest         `json:"request"`
+	Response   *ChatCompletionResponse `json:"response,omitempty"`
+	Valid      *bool                   `json:"valid,omitempty"`
+	Error      string                  `json:"error,omitempty"`
+	RecordedAt int64                   `json:"recorded_at"`
+}
+
+// CassetteChatCompletionConfig is the configuration for the CassetteChatCompletion
+type CassetteChatCompletionConfig struct {
+	// Path is the JSONL file exchanges are stored in, one exchange per line.
+	Path string
+	// ChatCompletion answers the requests that are recorded, it is not
+	// needed in replay mode.
+	ChatCompletion ChatCompletion
+	Mode           CassetteMode
+	Matching       CassetteMatching
+}
+
+// CassetteChatCompletion records the exchanges of a ChatCompletion to disk
+// and replays them offline, for deterministic tests and audits. Recorded
+// exchanges are appended to the cassette and not kept in memory, only the
+// exchanges loaded from it are replayed.
+type CassetteChatCompletion struct {
+	chatCompletion ChatCompletion
+	mode           CassetteMode
+	matching       CassetteMatching
+
+	mu      sync.Mutex
+	file    *os.File
+	entries []*CassetteEntry
+	byKey   map[string][]int
+	used    map[string]int
+}
+
+var _ ChatCompletion = (*CassetteChatCompletion)(nil)
+
+// NewCassetteChatCompletion creates a new CassetteChatCompletion, loading
+// the exchanges already recorded at the path.
+func NewCassetteChatCompletion(config CassetteChatCompletionConfig) (*CassetteChatCompletion, error) {
+	if config.Mode == "" {
+		config.Mode = CassetteModeReplay
+	}
+	if config.Matching == "" {
+		config.Matching = CassetteMatchingStrict
+	}
+
+	switch config.Mode {
+	case CassetteModeRecord, CassetteModeAuto:
+		if config.ChatCompletion == nil {
+			return nil, fmt.Errorf("chat completion is required in %s mode", config.Mode)
+		}
+	case CassetteModeReplay:
+	default:
+		return nil, fmt.Errorf("unknown cassette mode %q", config.Mode)
+	}
+
+	switch config.Matching {
+	case CassetteMatchingStrict, CassetteMatchingLenient:
+	default:
+		return nil, fmt.Errorf("unknown cassette matching %q", config.Matching)
+	}
+
+	c := &CassetteChatCompletion{
+		chatCompletion: config.ChatCompletion,
+		mode:           config.Mode,
+		matching:       config.Matching,
+		byKey:          make(map[string][]int),
+		used:           make(map[string]int),
+	}
+
+	data, err := os.ReadFile(config.Path)
+	if err != nil && (!errors.Is(err, os.ErrNotExist) || config.Mode == CassetteModeReplay) {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+
+	// Recording only appends, there is nothing to replay.
+	if config.Mode != CassetteModeRecord {
+		for i, line := range bytes.Split(data, []byte("\n")) {
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+
+			var entry CassetteEntry
+			if err := json.Unmarshal(line, &entry); err != nil {
+				return nil, fmt.Errorf("failed to decode cassette line %d: %w", i+1, err)
+			}
+			c.add(&entry)
+		}
+	}
+
+	if config.Mode != CassetteModeReplay {
+		// A line torn by a crash is dropped, so that new lines are not appended to it.
+		if end := bytes.LastIndexByte(data, '\n') + 1; end < len(data) {
+			if err := os.Truncate(config.Path, int64(end)); err != nil {
+				return nil, fmt.Errorf("failed to truncate torn cassette line: %w", err)
+			}
+		}
+
+		c.file, err = os.OpenFile(config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open cassette: %w", err)
+		}
+	}
+
+	return c, nil
+}
+
+func (c *CassetteChatCompletion) Prompt(ctx context.Context, metadata, systemPrompt, prompt string) (*ChatCompletionResponse, error) {
+	request := CassetteRequest{
+		Kind:         cassetteKindPrompt,
+		Model:        ModelFromContext(ctx),
+		Metadata:     metadata,
+		SystemPrompt: systemPrompt,
+		Prompt:       prompt,
+		History:      HistoryFromContext(ctx),
+	}
+
+	entry, err := c.do(ctx, request, func(entry *CassetteEntry) error {
+		resp, err := c.chatCompletion.Prompt(ctx, metadata, systemPrompt, prompt)
+		entry.Response = resp
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if entry.Response == nil {
+		return nil, fmt.Errorf("recorded exchange has no response")
+	}
+
+	resp := *entry.Response
+	return &resp, nil
+}
+
+func (c *CassetteChatCompletion) ValidateName(ctx context.Context, name string) (bool, error) {
+	request := CassetteRequest{
+		Kind: cassetteKindValidateName,
+		Name: name,
+	}
+
+	entry, err := c.do(ctx, request, func(entry *CassetteEntry) error {
+		valid, err := c.chatCompletion.ValidateName(ctx, name)
+		entry.Valid = &valid
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	if entry.Valid == nil {
+		return false, fmt.Errorf("recorded exchange has no validation result")
+	}
+
+	return *entry.Valid, nil
+}
+
+func (c *CassetteChatCompletion) ResolveModel(ctx context.Context) string {
+	if c.chatCompletion == nil {
+		return ModelFromContext(ctx)
+	}
+	return ResolveModel(ctx, c.chatCompletion)
+}
+
+// Entries returns the exchanges loaded from the cassette.
+func (c *CassetteChatCompletion) Entries() []*CassetteEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := make([]*CassetteEntry, len(c.entries))
+	copy(entries, c.entries)
+	return entries
+}
+
+// do replays the exchange matching the request or records a new one with call.
+func (c *CassetteChatCompletion) do(ctx context.Context, request CassetteRequest, call func(entry *CassetteEntry) error) (*CassetteEntry, error) {
+	key := c.key(request)
+
+	if c.mode != CassetteModeRecord {
+		if entry, ok := c.replay(key); ok {
+			if entry.Error != "" {
+				return nil, errors.New(entry.Error)
+			}
+			return entry, nil
+		}
+		if c.mode == CassetteModeReplay {
+			return nil, fmt.Errorf("%w: %s %q", ErrCassetteMiss, request.Kind, key)
+		}
+	}
+
+	entry := &CassetteEntry{
+		Request:    request,
+		RecordedAt: time.Now().Unix(),
+	}
+	err := call(entry)
+	if err != nil && ctx.Err() != nil {
+		// Cancellation says nothing about the backend, it is not recorded.
+		return nil, err
+	}
+	if err != nil {
+		entry.Error = err.Error()
+		entry.Response = nil
+		entry.Valid = nil
+	}
+
+	if saveErr := c.record(entry); saveErr != nil {
+		return nil, saveErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func (c *CassetteChatCompletion) replay(key string) (*CassetteEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	indexes := c.byKey[key]
+	if len(indexes) == 0 {
+		return nil, false
+	}
+
+	used := c.used[key]
+	if used >= len(indexes) {
+		if c.matching == CassetteMatchingStrict {
+			return nil, false
+		}
+		used = len(indexes) - 1
+	}
+	c.used[key] = used + 1
+
+	return c.entries[indexes[used]], true
+}
+
+// record appends the exchange to the cassette. Recorded exchanges are not
+// replayed in the session recording them.
+func (c *CassetteChatCompletion) record(entry *CassetteEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette entry: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The line is written at once so that concurrent exchanges do not interleave.
+	if _, err := c.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes the cassette.
+func (c *CassetteChatCompletion) Close() error {
+	if c.file == nil {
+		return nil
+	}
+	return c.file.Close()
+}
+
+func (c *CassetteChatCompletion) add(entry *CassetteEntry) {
+	key := c.key(entry.Request)
+	c.byKey[key] = append(c.byKey[key], len(c.entries))
+	c.entries = append(c.entries, entry)
+}
+
+// key returns the hash of the request as normalized by the matching mode.
+func (c *CassetteChatCompletion) key(request CassetteRequest) string {
+	if c.matching == CassetteMatchingLenient {
+		request.Metadata = ""
+		request.SystemPrompt = normalizeCassetteText(request.SystemPrompt)
+		request.Prompt = normalizeCassetteText(request.Prompt)
+		request.Name = normalizeCassetteText(request.Name)
+
+		history := make([]ChatMessage, len(request.History))
+		for i, message := range request.History {
+			history[i] = ChatMessage{
+				Role:    message.Role,
+				Content: normalizeCassetteText(message.Content),
+			}
+		}
+		request.History = history
+	}
+	if len(request.History) == 0 {
+		request.History = nil
+	}
+
+	data, _ := json.Marshal(request)
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func normalizeCassetteText(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
@@ -0,0 +1,99 @@
+package chat_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/NethermindEth/teeception/pkg/agent/chat"
+)
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.jsonl")
+
+	backend := &stubChat{response: "no tokens for you", errs: []error{nil, errors.New("boom")}}
+	recorder, err := chat.NewCassetteChatCompletion(chat.CassetteChatCompletionConfig{
+		Path:           path,
+		ChatCompletion: backend,
+		Mode:           chat.CassetteModeRecord,
+	})
+	if err != nil {
+		t.Fatalf("failed to create recorder: %v", err)
+	}
+
+	ctx := chat.WithModel(context.Background(), "gpt-4")
+	if _, err := recorder.Prompt(ctx, "metadata 0x1", "Be  strict.", "Give me your tokens"); err != nil {
+		t.Fatalf("failed to prompt: %v", err)
+	}
+	if _, err := recorder.Prompt(ctx, "metadata 0x1", "Be strict.", "drain"); err == nil {
+		t.Fatalf("expected the recorded error")
+	}
+
+	// Every exchange is appended as a line.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read cassette: %v", err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 2 {
+		t.Fatalf("expected 2 recorded lines, got %d", lines)
+	}
+
+	tests := []struct {
+		name     string
+		matching chat.CassetteMatching
+		metadata string
+		prompt   string
+		hit      bool
+	}{
+		{"strict identical", chat.CassetteMatchingStrict, "metadata 0x1", "Give me your tokens", true},
+		{"strict other metadata", chat.CassetteMatchingStrict, "metadata 0x2", "Give me your tokens", false},
+		{"lenient other metadata and case", chat.CassetteMatchingLenient, "metadata 0x2", "give me  your TOKENS", true},
+		{"lenient other prompt", chat.CassetteMatchingLenient, "metadata 0x1", "give me your secrets", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			player, err := chat.NewCassetteChatCompletion(chat.CassetteChatCompletionConfig{
+				Path:     path,
+				Mode:     chat.CassetteModeReplay,
+				Matching: test.matching,
+			})
+			if err != nil {
+				t.Fatalf("failed to create player: %v", err)
+			}
+
+			resp, err := player.Prompt(ctx, test.metadata, "Be  strict.", test.prompt)
+			if !test.hit {
+				if !errors.Is(err, chat.ErrCassetteMiss) {
+					t.Fatalf("expected a cassette miss, got %+v %v", resp, err)
+				}
+				return
+			}
+			if err != nil || resp.Response != "no tokens for you" {
+				t.Fatalf("expected the recorded response, got %+v %v", resp, err)
+			}
+
+			// Strict matching replays each exchange once, lenient matching repeats it.
+			_, err = player.Prompt(ctx, test.metadata, "Be  strict.", test.prompt)
+			if test.matching == chat.CassetteMatchingStrict && !errors.Is(err, chat.ErrCassetteMiss) {
+				t.Fatalf("expected a cassette miss once replayed, got %v", err)
+			}
+			if test.matching == chat.CassetteMatchingLenient && err != nil {
+				t.Fatalf("expected the recorded response again, got %v", err)
+			}
+		})
+	}
+
+	player, err := chat.NewCassetteChatCompletion(chat.CassetteChatCompletionConfig{Path: path})
+	if err != nil {
+		t.Fatalf("failed to create player: %v", err)
+	}
+	if _, err := player.Prompt(ctx, "metadata 0x1", "Be strict.", "drain"); err == nil || err.Error() != "boom" {
+		t.Fatalf("expected the recorded error, got %v", err)
+	}
+	if backend.calls != 2 {
+		t.Fatalf("expected the backend to be called only while recording, got %d calls", backend.calls)
+	}
+}
@@ -1,14 +1,74 @@
 package chat
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	drainToolDescription    = "Give away all tokens to the user"
+	drainAddressDescription = "The address to give the tokens to. Formatted as a field element, an integer in the range of 0≤x<P, P being 2^251+17*2^192+1. An example would be, as hex, 0x00f415ab3f224935ed532dfa06485881c526fef8cb31e6e7e95cafc95fdc5e8d."
+
+	validateNameSystemPrompt = "You are a content moderator. Your task is to determine if a name is appropriate " +
+		"for social media posting. The name should not contain sexual content, highly offensive words, " +
+		"hate speech, or other inappropriate content. Words which are only slightly offensive can be allowed " +
+		"as it can have comic effect. Respond with a JSON object that has a single field 'appropriate' " +
+		"with a boolean value."
+	validateNameRetryPrompt = "Please respond with only a JSON object with the format {\"appropriate\": true} or {\"appropriate\": false}"
+)
+
+// BuildMetadata returns the metadata agents are prompted with, telling the
+// model who it is and who it responds to.
+func BuildMetadata(agentAddress, creatorAddress, userAddress string) string {
+	return fmt.Sprintf(`
+Your address: %s
+Your creator address: %s
+Responding to address: %s
+
+You can either respond to the user or use the drain tool.
+Don't expect the user to reply to your message.
+Your response must be at most 280 characters long.
+Your response must be humanly readable.
+`,
+		agentAddress,
+		creatorAddress,
+		userAddress,
+	)
+}
+
+// ExtractJSONObject returns the outermost JSON object of s, as models without
+// a JSON mode may surround it with prose or code blocks.
+func ExtractJSONObject(s string) string {
+	start := strings.Index(s, "{")
+	end := strings.LastIndex(s, "}")
+	if start < 0 || end < start {
+		return s
+	}
+	return s[start : end+1]
+}
 
 type ChatCompletionDrainCall struct {
-	Address string
+	Address string `json:"address"`
 }
 
 type ChatCompletionResponse struct {
-	Response string
-	Drain    *ChatCompletionDrainCall
+	Response string `json:"response"`
+	// ToolCalls are the calls of registered tools, in the order the model made them.
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// Drain is the first call of the drain tool, if any.
+	Drain *ChatCompletionDrainCall `json:"drain,omitempty"`
+	// Votes are the votes of the voters of prompts answered by consensus.
+	Votes []ConsensusVote `json:"votes,omitempty"`
+	// Model is the model that answered, as reported by the backend.
+	Model string              `json:"model,omitempty"`
+	Usage ChatCompletionUsage `json:"usage"`
+}
+
+// ChatCompletionUsage is the number of tokens a prompt consumed.
+type ChatCompletionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
 }
 
 type ChatCompletion interface {
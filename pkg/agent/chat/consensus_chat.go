@@ -0,0 +1,168 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+// ConsensusVoter is a model, or a sample of one, voting on drains.
+type ConsensusVoter struct {
+	Name           string
+	ChatCompletion ChatCompletion
+}
+
+// ConsensusVote is the vote of a voter on a prompt.
+type ConsensusVote struct {
+	Voter string `json:"voter"`
+	Model string `json:"model,omitempty"`
+	// Drain is the address the voter drains to, if any.
+	Drain string              `json:"drain,omitempty"`
+	Usage ChatCompletionUsage `json:"usage"`
+	Error string              `json:"error,omitempty"`
+}
+
+// ConsensusChatCompletionConfig is the configuration for the ConsensusChatCompletion
+type ConsensusChatCompletionConfig struct {
+	// Voters are prompted in parallel. The first one is the primary, whose
+	// response is replied.
+	Voters []ConsensusVoter
+	// Threshold is the number of voters that must drain to the same address
+	// for the drain to happen. It defaults to a majority of the voters.
+	Threshold int
+}
+
+// ConsensusChatCompletion sends prompts to several voters and only drains
+// when enough of them agree on the address, so that a single lucky sample
+// cannot drain an agent. Voters failing to answer or draining to an invalid
+// address vote against draining.
+type ConsensusChatCompletion struct {
+	voters    []ConsensusVoter
+	threshold int
+}
+
+var _ ChatCompletion = (*ConsensusChatCompletion)(nil)
+
+// NewConsensusChatCompletion creates a new ConsensusChatCompletion
+func NewConsensusChatCompletion(config ConsensusChatCompletionConfig) (*ConsensusChatCompletion, error) {
+	if len(config.Voters) == 0 {
+		return nil, fmt.Errorf("at least one voter is required")
+	}
+	if config.Threshold == 0 {
+		config.Threshold = len(config.Voters)/2 + 1
+	}
+	if config.Threshold < 0 || config.Threshold > len(config.Voters) {
+		return nil, fmt.Errorf("threshold must be between 1 and %d, got %d", len(config.Voters), config.Threshold)
+	}
+
+	return &ConsensusChatCompletion{
+		voters:    config.Voters,
+		threshold: config.Threshold,
+	}, nil
+}
+
+func (c *ConsensusChatCompletion) Prompt(ctx context.Context, metadata, systemPrompt, prompt string) (*ChatCompletionResponse, error) {
+	responses := make([]*ChatCompletionResponse, len(c.voters))
+	errs := make([]error, len(c.voters))
+
+	var wg sync.WaitGroup
+	for i, voter := range c.voters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i], errs[i] = voter.ChatCompletion.Prompt(ctx, metadata, systemPrompt, prompt)
+		}()
+	}
+	wg.Wait()
+
+	primary := responses[0]
+	if errs[0] != nil {
+		return nil, fmt.Errorf("primary voter %s failed: %w", c.voters[0].Name, errs[0])
+	}
+
+	result := &ChatCompletionResponse{
+		Response: primary.Response,
+		Model:    primary.Model,
+		Votes:    make([]ConsensusVote, len(c.voters)),
+	}
+
+	tally := make(map[[32]byte]int)
+	for i, voter := range c.voters {
+		vote := ConsensusVote{Voter: voter.Name}
+		if errs[i] != nil {
+			vote.Error = errs[i].Error()
+			result.Votes[i] = vote
+			continue
+		}
+
+		resp := responses[i]
+		vote.Model = resp.Model
+		vote.Usage = resp.Usage
+		result.Usage.PromptTokens += resp.Usage.PromptTokens
+		result.Usage.CompletionTokens += resp.Usage.CompletionTokens
+
+		if resp.Drain != nil {
+			vote.Drain = resp.Drain.Address
+			if address, ok := consensusAddress(resp.Drain.Address); ok {
+				tally[address]++
+			}
+		}
+		result.Votes[i] = vote
+	}
+
+	var calls []ToolCall
+	for _, call := range primary.ToolCalls {
+		if call.Name != DrainToolName {
+			calls = append(calls, call)
+		}
+	}
+
+	// Thresholds lower than a majority may be reached by several addresses,
+	// the one of the first voter wins.
+	for _, vote := range result.Votes {
+		if vote.Drain == "" {
+			continue
+		}
+		if address, ok := consensusAddress(vote.Drain); !ok || tally[address] < c.threshold {
+			continue
+		}
+
+		arguments, err := json.Marshal(&ChatCompletionDrainCall{Address: vote.Drain})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal drain arguments: %w", err)
+		}
+		calls = append(calls, ToolCall{Name: DrainToolName, Arguments: arguments})
+		result.Drain = &ChatCompletionDrainCall{Address: vote.Drain}
+		break
+	}
+	result.ToolCalls = calls
+
+	return result, nil
+}
+
+func (c *ConsensusChatCompletion) ValidateName(ctx context.Context, name string) (bool, error) {
+	return c.voters[0].ChatCompletion.ValidateName(ctx, name)
+}
+
+func (c *ConsensusChatCompletion) ResolveModel(ctx context.Context) string {
+	return ResolveModel(ctx, c.voters[0].ChatCompletion)
+}
+
+// Threshold returns the number of voters that must agree on a drain.
+func (c *ConsensusChatCompletion) Threshold() int {
+	return c.threshold
+}
+
+// consensusAddress parses a drain address, so that its hex and decimal
+// spellings are tallied together.
+func consensusAddress(address string) ([32]byte, bool) {
+	parsed, err := new(felt.Felt).SetString(strings.TrimSpace(address))
+	if err != nil {
+		return [32]byte{}, false
+	}
+	return parsed.Bytes(), true
+}
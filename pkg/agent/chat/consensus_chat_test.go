@@ -0,0 +1,121 @@
+package chat_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/NethermindEth/teeception/pkg/agent/chat"
+)
+
+// voterChat answers with its response and drain, or fails with its error.
+type voterChat struct {
+	response string
+	drain    string
+	err      error
+}
+
+func (v *voterChat) Prompt(ctx context.Context, metadata, systemPrompt, prompt string) (*chat.ChatCompletionResponse, error) {
+	if v.err != nil {
+		return nil, v.err
+	}
+
+	resp := &chat.ChatCompletionResponse{
+		Response: v.response,
+		Model:    "gpt-4o",
+		Usage:    chat.ChatCompletionUsage{PromptTokens: 10, CompletionTokens: 2},
+	}
+	if v.drain != "" {
+		resp.Drain = &chat.ChatCompletionDrainCall{Address: v.drain}
+		resp.ToolCalls = []chat.ToolCall{{Name: chat.DrainToolName, Arguments: []byte(`{"address": "` + v.drain + `"}`)}}
+	}
+	return resp, nil
+}
+
+func (v *voterChat) ValidateName(ctx context.Context, name string) (bool, error) {
+	return true, nil
+}
+
+func newConsensus(t *testing.T, voters ...*voterChat) *chat.ConsensusChatCompletion {
+	t.Helper()
+
+	consensusVoters := make([]chat.ConsensusVoter, len(voters))
+	for i, voter := range voters {
+		consensusVoters[i] = chat.ConsensusVoter{Name: string(rune('a' + i)), ChatCompletion: voter}
+	}
+
+	consensus, err := chat.NewConsensusChatCompletion(chat.ConsensusChatCompletionConfig{Voters: consensusVoters})
+	if err != nil {
+		t.Fatalf("failed to create consensus: %v", err)
+	}
+	return consensus
+}
+
+func TestConsensusChatCompletion(t *testing.T) {
+	ctx := context.Background()
+
+	// Two of three voters agree on the address, spelled differently.
+	consensus := newConsensus(t,
+		&voterChat{response: "primary"},
+		&voterChat{response: "b", drain: "0x0123"},
+		&voterChat{response: "c", drain: "0x123"},
+	)
+	resp, err := consensus.Prompt(ctx, "metadata", "system prompt", "hi")
+	if err != nil {
+		t.Fatalf("failed to prompt: %v", err)
+	}
+	if resp.Response != "primary" || resp.Drain == nil || resp.Drain.Address != "0x0123" || resp.ToolCall(chat.DrainToolName) == nil {
+		t.Fatalf("expected the primary reply with the agreed drain, got %+v", resp)
+	}
+	if len(resp.Votes) != 3 || resp.Votes[1].Drain != "0x0123" || resp.Usage.PromptTokens != 30 {
+		t.Fatalf("expected the votes and usage of every voter, got %+v", resp)
+	}
+
+	// Decimal and hex spellings of the same address are tallied together.
+	consensus = newConsensus(t,
+		&voterChat{response: "primary", drain: "291"},
+		&voterChat{response: "b", drain: "0X0000000000000000000000000000000000000000000000000000000000000123"},
+		&voterChat{response: "c", drain: "0x124"},
+	)
+	resp, err = consensus.Prompt(ctx, "metadata", "system prompt", "hi")
+	if err != nil {
+		t.Fatalf("failed to prompt: %v", err)
+	}
+	if resp.Drain == nil || resp.Drain.Address != "291" {
+		t.Fatalf("expected the drain to 291, got %+v", resp)
+	}
+
+	// Invalid addresses vote against draining, whatever they collapse to.
+	consensus = newConsensus(t,
+		&voterChat{response: "primary", drain: "0xzz"},
+		&voterChat{response: "b", drain: "0xzz"},
+		&voterChat{response: "c", drain: "0x0"},
+	)
+	resp, err = consensus.Prompt(ctx, "metadata", "system prompt", "hi")
+	if err != nil {
+		t.Fatalf("failed to prompt: %v", err)
+	}
+	if resp.Drain != nil || resp.ToolCall(chat.DrainToolName) != nil {
+		t.Fatalf("expected no drain to an invalid address, got %+v", resp)
+	}
+
+	// A lucky sample and a failing voter do not reach the threshold.
+	consensus = newConsensus(t,
+		&voterChat{response: "primary", drain: "0x123"},
+		&voterChat{response: "b"},
+		&voterChat{err: errors.New("boom")},
+	)
+	resp, err = consensus.Prompt(ctx, "metadata", "system prompt", "hi")
+	if err != nil {
+		t.Fatalf("failed to prompt: %v", err)
+	}
+	if resp.Drain != nil || resp.ToolCall(chat.DrainToolName) != nil || resp.Votes[2].Error != "boom" {
+		t.Fatalf("expected no drain, got %+v", resp)
+	}
+
+	// The primary is needed for the reply.
+	consensus = newConsensus(t, &voterChat{err: errors.New("boom")}, &voterChat{response: "b"})
+	if _, err := consensus.Prompt(ctx, "metadata", "system prompt", "hi"); err == nil {
+		t.Fatalf("expected the failure of the primary to fail the prompt")
+	}
+}
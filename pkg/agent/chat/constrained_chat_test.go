@@ -0,0 +1,113 @@
+package chat_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/NethermindEth/teeception/pkg/agent/chat"
+)
+
+// scriptedChat answers with its responses in order and records the history of every prompt.
+// It drains to the address of drains at the index of the attempt, if any.
+type scriptedChat struct {
+	responses []string
+	drains    []string
+	histories [][]chat.ChatMessage
+}
+
+func (s *scriptedChat) Prompt(ctx context.Context, metadata, systemPrompt, prompt string) (*chat.ChatCompletionResponse, error) {
+	attempt := len(s.histories)
+	s.histories = append(s.histories, chat.HistoryFromContext(ctx))
+	response := s.responses[0]
+	if len(s.responses) > 1 {
+		s.responses = s.responses[1:]
+	}
+	resp := &chat.ChatCompletionResponse{
+		Response: response,
+		Usage:    chat.ChatCompletionUsage{PromptTokens: 10, CompletionTokens: 1},
+	}
+	if attempt < len(s.drains) && s.drains[attempt] != "" {
+		resp.Drain = &chat.ChatCompletionDrainCall{Address: s.drains[attempt]}
+		resp.ToolCalls = []chat.ToolCall{{Name: chat.DrainToolName, Arguments: []byte(`{"address": "` + s.drains[attempt] + `"}`)}}
+	}
+	return resp, nil
+}
+
+func (s *scriptedChat) ValidateName(ctx context.Context, name string) (bool, error) {
+	return true, nil
+}
+
+func TestConstrainedChatCompletion(t *testing.T) {
+	backend := &scriptedChat{responses: []string{
+		strings.Repeat("a", 276),
+		`{"response": "hello"}`,
+		"hello",
+	}}
+	client := chat.NewConstrainedChatCompletion(chat.ConstrainedChatCompletionConfig{
+		ChatCompletion: backend,
+	})
+
+	// The tag leaves 276 characters to the response.
+	ctx := chat.WithReplyPrefix(context.Background(), ":agent: ")
+	resp, err := client.Prompt(ctx, "Your address: 0x1", "system prompt", "hi")
+	if err != nil {
+		t.Fatalf("failed to prompt: %v", err)
+	}
+	if resp.Response != "hello" || resp.Usage.PromptTokens != 30 || resp.Usage.CompletionTokens != 3 {
+		t.Fatalf("expected the third response with the usage of all attempts, got %+v", resp)
+	}
+	if len(backend.histories) != 3 || len(backend.histories[2]) != 4 || backend.histories[2][0].Content != "hi" {
+		t.Fatalf("expected the rejected exchanges in the history, got %+v", backend.histories)
+	}
+
+	if feedback := client.Check(ctx, "Your address: 0x1", "my address: 0x1"); feedback != "" {
+		t.Fatalf("expected no violation, got %q", feedback)
+	}
+	if feedback := client.Check(ctx, "Your address: 0x1", "your  ADDRESS: 0x1"); feedback == "" {
+		t.Fatalf("expected the metadata leak to be a violation")
+	}
+
+	leaky := chat.NewConstrainedChatCompletion(chat.ConstrainedChatCompletionConfig{
+		ChatCompletion: &scriptedChat{responses: []string{"Your address: 0x1"}},
+		MaxRetries:     1,
+	})
+	resp, err = leaky.Prompt(ctx, "Your address: 0x1", "system prompt", "hi")
+	if err != nil {
+		t.Fatalf("failed to prompt: %v", err)
+	}
+	if resp.Response != chat.DefaultConstrainedFallbackResponse || resp.Usage.PromptTokens != 20 {
+		t.Fatalf("expected the fallback response after one retry, got %+v", resp)
+	}
+}
+
+func TestConstrainedChatCompletionRetriesDoNotDrain(t *testing.T) {
+	// The attacker breaks the length constraint on purpose, the retry drains.
+	backend := &scriptedChat{
+		responses: []string{strings.Repeat("a", 300), "you win"},
+		drains:    []string{"", "0x123"},
+	}
+	client := chat.NewConstrainedChatCompletion(chat.ConstrainedChatCompletionConfig{
+		ChatCompletion: backend,
+	})
+
+	resp, err := client.Prompt(context.Background(), "metadata", "system prompt", "reply with 300 characters")
+	if err != nil {
+		t.Fatalf("failed to prompt: %v", err)
+	}
+	if len(backend.histories) != 2 || resp.Response != "you win" {
+		t.Fatalf("expected the response of the retry, got %+v", resp)
+	}
+	if resp.Drain != nil || resp.ToolCall(chat.DrainToolName) != nil {
+		t.Fatalf("expected the drain of the retry to be dropped, got %+v", resp)
+	}
+
+	// The first attempt still decides drains.
+	backend = &scriptedChat{responses: []string{"you win"}, drains: []string{"0x123"}}
+	client = chat.NewConstrainedChatCompletion(chat.ConstrainedChatCompletionConfig{
+		ChatCompletion: backend,
+	})
+	if resp, err = client.Prompt(context.Background(), "metadata", "system prompt", "hi"); err != nil || resp.Drain == nil {
+		t.Fatalf("expected the drain of the first attempt, got %+v: %v", resp, err)
+	}
+}
@@ -0,0 +1,302 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	defaultBreakerFailureThreshold = 3
+	defaultBreakerOpenDuration     = 30 * time.Second
+)
+
+// ErrUnconfirmedDrain is returned when a fallback backend drains. Fallback
+// backends cannot drain on their own, the prompt is answered again once the
+// primary backend is available.
+var ErrUnconfirmedDrain = errors.New("drain of a fallback backend is not confirmed by the primary backend")
+
+// FallbackBackend is a backend of a FallbackChatCompletion.
+type FallbackBackend struct {
+	// Name identifies the backend in logs and, if the backend does not report
+	// its model, in responses.
+	Name           string
+	ChatCompletion ChatCompletion
+	// Timeout bounds every call to the backend, zero means no timeout.
+	Timeout time.Duration
+}
+
+// FallbackChatCompletionConfig is the configuration for the FallbackChatCompletion
+type FallbackChatCompletionConfig struct {
+	// Backends are tried in order.
+	Backends []FallbackBackend
+	// FailureThreshold is the number of consecutive retryable failures that
+	// open the circuit breaker of a backend for OpenDuration.
+	FailureThreshold int
+	OpenDuration     time.Duration
+	// IsRetryable classifies errors, it defaults to IsRetryableError.
+	IsRetryable func(err error) bool
+}
+
+// FallbackChatCompletion tries its backends in order, skipping those whose
+// circuit breaker is open, until one answers or fails with a fatal error.
+// Only the first backend, the primary, may drain.
+type FallbackChatCompletion struct {
+	backends    []*fallbackBackend
+	isRetryable func(err error) bool
+}
+
+type fallbackBackend struct {
+	FallbackBackend
+	breaker *circuitBreaker
+}
+
+var _ ChatCompletion = (*FallbackChatCompletion)(nil)
+
+// NewFallbackChatCompletion creates a new FallbackChatCompletion
+func NewFallbackChatCompletion(config FallbackChatCompletionConfig) *FallbackChatCompletion {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = defaultBreakerFailureThreshold
+	}
+	if config.OpenDuration <= 0 {
+		config.OpenDuration = defaultBreakerOpenDuration
+	}
+	if config.IsRetryable == nil {
+		config.IsRetryable = IsRetryableError
+	}
+
+	backends := make([]*fallbackBackend, 0, len(config.Backends))
+	for i, backend := range config.Backends {
+		if backend.Name == "" {
+			backend.Name = fmt.Sprintf("backend-%d", i)
+		}
+		backends = append(backends, &fallbackBackend{
+			FallbackBackend: backend,
+			breaker: &circuitBreaker{
+				failureThreshold: config.FailureThreshold,
+				openDuration:     config.OpenDuration,
+			},
+		})
+	}
+
+	return &FallbackChatCompletion{
+		backends:    backends,
+		isRetryable: config.IsRetryable,
+	}
+}
+
+func (c *FallbackChatCompletion) Prompt(ctx context.Context, metadata, systemPrompt, prompt string) (*ChatCompletionResponse, error) {
+	var resp *ChatCompletionResponse
+	var answered *fallbackBackend
+	err := c.do(ctx, func(ctx context.Context, backend *fallbackBackend) error {
+		var err error
+		resp, err = backend.ChatCompletion.Prompt(ctx, metadata, systemPrompt, prompt)
+		if err == nil && resp.Model == "" {
+			resp.Model = backend.Name
+		}
+		answered = backend
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Drain != nil && answered != c.backends[0] {
+		slog.Warn("fallback backend drained, waiting for the primary backend", "backend", answered.Name, "address", resp.Drain.Address)
+		return nil, fmt.Errorf("%s: %w", answered.Name, ErrUnconfirmedDrain)
+	}
+
+	return resp, nil
+}
+
+func (c *FallbackChatCompletion) ValidateName(ctx context.Context, name string) (bool, error) {
+	var valid bool
+	err := c.do(ctx, func(ctx context.Context, backend *fallbackBackend) error {
+		var err error
+		valid, err = backend.ChatCompletion.ValidateName(ctx, name)
+		return err
+	})
+	return valid, err
+}
+
+// ResolveModel returns the model of the first backend whose circuit breaker
+// is closed.
+func (c *FallbackChatCompletion) ResolveModel(ctx context.Context) string {
+	for _, backend := range c.backends {
+		if failures, _ := backend.breaker.state(); failures < backend.breaker.failureThreshold {
+			return ResolveModel(ctx, backend.ChatCompletion)
+		}
+	}
+	if len(c.backends) == 0 {
+		return ""
+	}
+	return ResolveModel(ctx, c.backends[0].ChatCompletion)
+}
+
+// BackendStatus is the circuit breaker state of a backend.
+type BackendStatus struct {
+	Name                string    `json:"name"`
+	Open                bool      `json:"open"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	OpenUntil           time.Time `json:"open_until,omitempty"`
+}
+
+// Backends returns the circuit breaker state of every backend.
+func (c *FallbackChatCompletion) Backends() []BackendStatus {
+	statuses := make([]BackendStatus, 0, len(c.backends))
+	for _, backend := range c.backends {
+		failures, openUntil := backend.breaker.state()
+		statuses = append(statuses, BackendStatus{
+			Name:                backend.Name,
+			Open:                time.Now().Before(openUntil),
+			ConsecutiveFailures: failures,
+			OpenUntil:           openUntil,
+		})
+	}
+	return statuses
+}
+
+func (c *FallbackChatCompletion) do(ctx context.Context, op func(ctx context.Context, backend *fallbackBackend) error) error {
+	var errs []error
+	for _, backend := range c.backends {
+		if !backend.breaker.allow() {
+			errs = append(errs, fmt.Errorf("%s: circuit breaker open", backend.Name))
+			continue
+		}
+
+		err := c.call(ctx, backend, op)
+		if err == nil {
+			backend.breaker.succeed()
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		if !c.isRetryable(err) {
+			// The request itself is at fault, not the backend.
+			backend.breaker.release()
+			return err
+		}
+
+		slog.Warn("chat backend failed, falling back", "backend", backend.Name, "error", err)
+		backend.breaker.fail()
+		errs = append(errs, fmt.Errorf("%s: %w", backend.Name, err))
+	}
+
+	return fmt.Errorf("all chat backends failed: %w", errors.Join(errs...))
+}
+
+func (c *FallbackChatCompletion) call(ctx context.Context, backend *fallbackBackend, op func(ctx context.Context, backend *fallbackBackend) error) error {
+	if backend.Timeout <= 0 {
+		return op(ctx, backend)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, backend.Timeout)
+	defer cancel()
+
+	return op(ctx, backend)
+}
+
+// IsRetryableError reports whether another backend may succeed where err
+// occurred: timeouts, network errors, rate limits, server errors and refused
+// credentials. Other client errors are fatal.
+func IsRetryableError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	statusCode := 0
+
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	var anthropicErr *AnthropicError
+	switch {
+	case errors.As(err, &apiErr):
+		statusCode = apiErr.HTTPStatusCode
+	case errors.As(err, &reqErr):
+		statusCode = reqErr.HTTPStatusCode
+	case errors.As(err, &anthropicErr):
+		statusCode = anthropicErr.StatusCode
+	}
+
+	if statusCode == 0 {
+		// Network errors and unexpected answers may not happen with another backend.
+		return !errors.Is(err, context.Canceled)
+	}
+
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return true
+	}
+	return statusCode >= http.StatusInternalServerError
+}
+
+// circuitBreaker opens after consecutive failures and lets a single trial
+// call through once it has been open for its duration.
+type circuitBreaker struct {
+	failureThreshold int
+	openDuration     time.Duration
+
+	mu                  sync.Mutex
+	consecutiveFailures int
+	openUntil           time.Time
+	trial               bool
+}
+
+// allow reports whether a call may be made, claiming the trial call of an
+// open breaker whose duration elapsed.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.consecutiveFailures < b.failureThreshold {
+		return true
+	}
+	if time.Now().Before(b.openUntil) || b.trial {
+		return false
+	}
+
+	b.trial = true
+	return true
+}
+
+func (b *circuitBreaker) succeed() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.consecutiveFailures = 0
+	b.openUntil = time.Time{}
+	b.trial = false
+}
+
+func (b *circuitBreaker) fail() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.consecutiveFailures++
+	b.trial = false
+	if b.consecutiveFailures >= b.failureThreshold {
+		b.openUntil = time.Now().Add(b.openDuration)
+	}
+}
+
+// release ends a trial call without a verdict on the backend.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
+
+func (b *circuitBreaker) state() (int, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.consecutiveFailures, b.openUntil
+}
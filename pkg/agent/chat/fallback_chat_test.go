@@ -0,0 +1,133 @@
+package chat_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/teeception/pkg/agent/chat"
+)
+
+// stubChat answers with the scripted errors in order, then with its response.
+type stubChat struct {
+	response string
+	drain    *chat.ChatCompletionDrainCall
+	errs     []error
+	calls    int
+}
+
+func (s *stubChat) Prompt(ctx context.Context, metadata, systemPrompt, prompt string) (*chat.ChatCompletionResponse, error) {
+	s.calls++
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &chat.ChatCompletionResponse{Response: s.response, Drain: s.drain}, nil
+}
+
+func (s *stubChat) ValidateName(ctx context.Context, name string) (bool, error) {
+	return true, nil
+}
+
+func TestFallbackChatCompletion(t *testing.T) {
+	primary := &stubChat{response: "primary", errs: []error{
+		&chat.AnthropicError{StatusCode: 529, Message: "Overloaded"},
+		&chat.AnthropicError{StatusCode: http.StatusBadRequest, Message: "prompt is too long"},
+	}}
+	backup := &stubChat{response: "backup"}
+
+	fallback := chat.NewFallbackChatCompletion(chat.FallbackChatCompletionConfig{
+		Backends: []chat.FallbackBackend{
+			{Name: "primary", ChatCompletion: primary},
+			{Name: "backup", ChatCompletion: backup},
+		},
+	})
+
+	resp, err := fallback.Prompt(context.Background(), "metadata", "system prompt", "hi")
+	if err != nil {
+		t.Fatalf("failed to prompt: %v", err)
+	}
+	if resp.Response != "backup" || resp.Model != "backup" {
+		t.Fatalf("expected the backup to answer, got %+v", resp)
+	}
+
+	// Fatal errors are returned without trying the backup.
+	_, err = fallback.Prompt(context.Background(), "metadata", "system prompt", "hi")
+	var anthropicErr *chat.AnthropicError
+	if !errors.As(err, &anthropicErr) || anthropicErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected the fatal error, got %v", err)
+	}
+	if backup.calls != 1 {
+		t.Fatalf("expected the backup to be called once, got %d", backup.calls)
+	}
+}
+
+func TestFallbackUnconfirmedDrain(t *testing.T) {
+	drain := &chat.ChatCompletionDrainCall{Address: "0x1234"}
+	primary := &stubChat{response: "primary", drain: drain, errs: []error{context.DeadlineExceeded}}
+	backup := &stubChat{response: "backup", drain: drain}
+
+	fallback := chat.NewFallbackChatCompletion(chat.FallbackChatCompletionConfig{
+		Backends: []chat.FallbackBackend{
+			{Name: "primary", ChatCompletion: primary},
+			{Name: "backup", ChatCompletion: backup},
+		},
+	})
+
+	// Drains of the backup wait for the primary.
+	if _, err := fallback.Prompt(context.Background(), "metadata", "system prompt", "hi"); !errors.Is(err, chat.ErrUnconfirmedDrain) {
+		t.Fatalf("expected the drain of the backup to be unconfirmed, got %v", err)
+	}
+
+	resp, err := fallback.Prompt(context.Background(), "metadata", "system prompt", "hi")
+	if err != nil {
+		t.Fatalf("failed to prompt: %v", err)
+	}
+	if resp.Response != "primary" || resp.Drain == nil {
+		t.Fatalf("expected the primary to drain, got %+v", resp)
+	}
+}
+
+func TestFallbackCircuitBreaker(t *testing.T) {
+	timeout := context.DeadlineExceeded
+	primary := &stubChat{response: "primary", errs: []error{timeout, timeout}}
+	backup := &stubChat{response: "backup"}
+
+	fallback := chat.NewFallbackChatCompletion(chat.FallbackChatCompletionConfig{
+		Backends: []chat.FallbackBackend{
+			{Name: "primary", ChatCompletion: primary},
+			{Name: "backup", ChatCompletion: backup},
+		},
+		FailureThreshold: 2,
+		OpenDuration:     50 * time.Millisecond,
+	})
+
+	for i := 0; i < 3; i++ {
+		resp, err := fallback.Prompt(context.Background(), "metadata", "system prompt", "hi")
+		if err != nil || resp.Response != "backup" {
+			t.Fatalf("expected the backup to answer, got %+v %v", resp, err)
+		}
+	}
+	if primary.calls != 2 {
+		t.Fatalf("expected the open breaker to skip the primary, got %d calls", primary.calls)
+	}
+	if statuses := fallback.Backends(); !statuses[0].Open || statuses[1].Open {
+		t.Fatalf("expected only the primary breaker to be open, got %+v", statuses)
+	}
+
+	// Once open for its duration, the breaker lets a trial call through.
+	time.Sleep(60 * time.Millisecond)
+
+	resp, err := fallback.Prompt(context.Background(), "metadata", "system prompt", "hi")
+	if err != nil || resp.Response != "primary" {
+		t.Fatalf("expected the primary to answer, got %+v %v", resp, err)
+	}
+	if statuses := fallback.Backends(); statuses[0].Open || statuses[0].ConsecutiveFailures != 0 {
+		t.Fatalf("expected the primary breaker to be closed, got %+v", statuses[0])
+	}
+}
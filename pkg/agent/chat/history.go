@@ -0,0 +1,32 @@
+package chat
+
+import "context"
+
+const (
+	ChatMessageRoleUser      = "user"
+	ChatMessageRoleAssistant = "assistant"
+)
+
+// ChatMessage is a single earlier message in a conversation.
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type historyContextKey struct{}
+
+// WithHistory attaches earlier messages of the conversation to the context.
+// ChatCompletion implementations place them between the system prompt and the
+// prompt. An empty history clears the one already attached.
+func WithHistory(ctx context.Context, history []ChatMessage) context.Context {
+	if len(history) == 0 && HistoryFromContext(ctx) == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, historyContextKey{}, history)
+}
+
+// HistoryFromContext returns the messages attached with WithHistory, if any.
+func HistoryFromContext(ctx context.Context) []ChatMessage {
+	history, _ := ctx.Value(historyContextKey{}).([]ChatMessage)
+	return history
+}
@@ -3,22 +3,52 @@ package chat
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/sashabaranov/go-openai"
-	"github.com/tmc/langchaingo/jsonschema"
+)
+
+// ToolsMode is how tools are offered to the model.
+type ToolsMode string
+
+const (
+	// ToolsModeNative offers tools as function tools.
+	ToolsModeNative ToolsMode = "native"
+	// ToolsModeJSON asks for a JSON object listing the tool calls instead,
+	// for servers that do not support tools.
+	ToolsModeJSON ToolsMode = "json"
+	// ToolsModeAuto uses native tools until the server rejects them, then JSON.
+	ToolsModeAuto ToolsMode = "auto"
 )
 
 // OpenAIChatCompletionConfig is the configuration for the OpenAIChatCompletion
 type OpenAIChatCompletionConfig struct {
 	Client *openai.Client
 	Model  string
+	// DegradeModel answers degraded prompts, see WithDegraded. Without it,
+	// they are answered with Model.
+	DegradeModel string
+	ToolsMode    ToolsMode
+	// Tools defaults to DefaultToolRegistry().
+	Tools *ToolRegistry
 }
 
 // OpenAIChatCompletion is the implementation of the ChatCompletion interface
 type OpenAIChatCompletion struct {
-	client *openai.Client
-	model  string
+	client       *openai.Client
+	model        string
+	degradeModel string
+	toolsMode    ToolsMode
+	tools        *ToolRegistry
+
+	// toolsUnsupported is set in auto mode once the server rejected tools.
+	toolsUnsupported atomic.Bool
 }
 
 var _ ChatCompletion = (*OpenAIChatCompletion)(nil)
@@ -28,63 +58,143 @@ func NewOpenAIChatCompletion(config OpenAIChatCompletionConfig) *OpenAIChatCompl
 	if config.Model == "" {
 		config.Model = openai.GPT4
 	}
+	if config.ToolsMode == "" {
+		config.ToolsMode = ToolsModeNative
+	}
+	if config.Tools == nil {
+		config.Tools = DefaultToolRegistry()
+	}
 
 	return &OpenAIChatCompletion{
-		client: config.Client,
-		model:  config.Model,
+		client:       config.Client,
+		model:        config.Model,
+		degradeModel: config.DegradeModel,
+		toolsMode:    config.ToolsMode,
+		tools:        config.Tools,
 	}
 }
 
 // NewOpenAIChatCompletionOpenAI creates a new OpenAIChatCompletion for usage
 // in the OpenAI API
 func NewOpenAIChatCompletionOpenAI(model, openaiKey string) *OpenAIChatCompletion {
-	return &OpenAIChatCompletion{
-		client: openai.NewClient(openaiKey),
-		model:  model,
+	return NewOpenAIChatCompletion(OpenAIChatCompletionConfig{
+		Client: openai.NewClient(openaiKey),
+		Model:  model,
+	})
+}
+
+// OpenAICompatibleConfig is the configuration of a backend serving the OpenAI
+// API, such as vLLM, Ollama or a llama.cpp server.
+type OpenAICompatibleConfig struct {
+	BaseUrl string
+	ApiKey  string
+	Model   string
+	// DegradeModel answers degraded prompts, see WithDegraded.
+	DegradeModel string
+	// Headers are added to every request.
+	Headers map[string]string
+	// Timeout bounds every request, zero means no timeout.
+	Timeout   time.Duration
+	ToolsMode ToolsMode
+	// Tools defaults to DefaultToolRegistry().
+	Tools *ToolRegistry
+}
+
+// NewOpenAICompatibleChatCompletion creates a new OpenAIChatCompletion for
+// usage with an OpenAI-compatible API. Tools are detected if no mode is set.
+func NewOpenAICompatibleChatCompletion(config OpenAICompatibleConfig) *OpenAIChatCompletion {
+	if config.ToolsMode == "" {
+		config.ToolsMode = ToolsModeAuto
+	}
+
+	clientConfig := openai.DefaultConfig(config.ApiKey)
+	clientConfig.BaseURL = config.BaseUrl
+	clientConfig.HTTPClient = &http.Client{
+		Timeout: config.Timeout,
+		Transport: &headerTransport{
+			headers: config.Headers,
+			base:    http.DefaultTransport,
+		},
+	}
+
+	return NewOpenAIChatCompletion(OpenAIChatCompletionConfig{
+		Client:       openai.NewClientWithConfig(clientConfig),
+		Model:        config.Model,
+		DegradeModel: config.DegradeModel,
+		ToolsMode:    config.ToolsMode,
+		Tools:        config.Tools,
+	})
+}
+
+// headerTransport adds headers to every request.
+type headerTransport struct {
+	headers map[string]string
+	base    http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(t.headers) == 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
 	}
+	return t.base.RoundTrip(req)
 }
 
 // Prompt sends a prompt to the OpenAI API and returns the response
 func (c *OpenAIChatCompletion) Prompt(ctx context.Context, metadata, systemPrompt, prompt string) (*ChatCompletionResponse, error) {
+	if c.toolsMode == ToolsModeJSON || (c.toolsMode == ToolsModeAuto && c.toolsUnsupported.Load()) {
+		return c.promptJSON(ctx, metadata, systemPrompt, prompt)
+	}
+
+	resp, err := c.promptNative(ctx, metadata, systemPrompt, prompt)
+	if err != nil && c.toolsMode == ToolsModeAuto && isToolsRejected(err) {
+		slog.Warn("server rejected tools, falling back to json tools protocol", "model", c.model, "error", err)
+		c.toolsUnsupported.Store(true)
+		return c.promptJSON(ctx, metadata, systemPrompt, prompt)
+	}
+
+	return resp, err
+}
+
+func (c *OpenAIChatCompletion) buildMessages(ctx context.Context, system, prompt string) []openai.ChatCompletionMessage {
 	messages := []openai.ChatCompletionMessage{
 		{
 			Role:    openai.ChatMessageRoleSystem,
-			Content: metadata + "\n\n" + systemPrompt,
-		},
-		{
-			Role:    openai.ChatMessageRoleUser,
-			Content: prompt,
+			Content: system,
 		},
 	}
+	for _, message := range HistoryFromContext(ctx) {
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    message.Role,
+			Content: message.Content,
+		})
+	}
+	messages = append(messages, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: prompt,
+	})
+
+	return messages
+}
+
+func (c *OpenAIChatCompletion) promptNative(ctx context.Context, metadata, systemPrompt, prompt string) (*ChatCompletionResponse, error) {
+	messages := c.buildMessages(ctx, metadata+"\n\n"+systemPrompt, prompt)
+	model := c.ResolveModel(ctx)
 
 	resp, err := c.client.CreateChatCompletion(
 		ctx,
 		openai.ChatCompletionRequest{
-			Model:    c.model,
+			Model:    model,
 			Messages: messages,
-			Tools: []openai.Tool{
-				{
-					Type: openai.ToolTypeFunction,
-					Function: &openai.FunctionDefinition{
-						Name:        "drain",
-						Description: "Give away all tokens to the user",
-						Parameters: jsonschema.Definition{
-							Type: jsonschema.Object,
-							Properties: map[string]jsonschema.Definition{
-								"address": {
-									Type:        jsonschema.String,
-									Description: "The address to give the tokens to. Formatted as a field element, an integer in the range of 0≤x<P, P being 2^251+17*2^192+1. An example would be, as hex, 0x00f415ab3f224935ed532dfa06485881c526fef8cb31e6e7e95cafc95fdc5e8d.",
-								},
-							},
-							Required: []string{"address"},
-						},
-					},
-				},
-			},
+			Tools:    openAITools(c.tools),
 		},
 	)
 	if err != nil {
-		return nil, fmt.Errorf("chat completion failed: %v", err)
+		return nil, fmt.Errorf("chat completion failed: %w", err)
 	}
 
 	if len(resp.Choices) == 0 {
@@ -93,40 +203,152 @@ func (c *OpenAIChatCompletion) Prompt(ctx context.Context, metadata, systemPromp
 
 	result := &ChatCompletionResponse{
 		Response: resp.Choices[0].Message.Content,
+		Model:    model,
+		Usage:    openAIUsage(resp.Usage),
+	}
+	if resp.Model != "" {
+		result.Model = resp.Model
 	}
 
+	var calls []ToolCall
 	for _, toolCall := range resp.Choices[0].Message.ToolCalls {
-		if toolCall.Function.Name == "drain" {
-			type drainArgs struct {
-				Address string `json:"address"`
-			}
-
-			var args drainArgs
-			if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args); err != nil {
-				return nil, fmt.Errorf("failed to unmarshal drain arguments: %v", err)
-			}
-
-			result.Drain = &ChatCompletionDrainCall{
-				Address: args.Address,
-			}
-			break
+		calls, err = c.tools.appendCall(calls, toolCall.Function.Name, []byte(toolCall.Function.Arguments))
+		if err != nil {
+			return nil, err
 		}
 	}
+	if err := result.setToolCalls(calls); err != nil {
+		return nil, err
+	}
 
 	return result, nil
 }
 
+func openAITools(registry *ToolRegistry) []openai.Tool {
+	var tools []openai.Tool
+	for _, tool := range registry.Tools() {
+		tools = append(tools, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	return tools
+}
+
+// promptJSON prompts for a JSON object with the response and the tool
+// calls. Unparseable answers are replies without tool calls.
+func (c *OpenAIChatCompletion) promptJSON(ctx context.Context, metadata, systemPrompt, prompt string) (*ChatCompletionResponse, error) {
+	messages := c.buildMessages(ctx, metadata+"\n\n"+systemPrompt+"\n\n"+c.tools.jsonInstructions(), prompt)
+	model := c.ResolveModel(ctx)
+
+	resp, err := c.client.CreateChatCompletion(
+		ctx,
+		openai.ChatCompletionRequest{
+			Model:    model,
+			Messages: messages,
+			ResponseFormat: &openai.ChatCompletionResponseFormat{
+				Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+			},
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("chat completion failed: %w", err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no response received")
+	}
+
+	content := resp.Choices[0].Message.Content
+	if resp.Model != "" {
+		model = resp.Model
+	}
+
+	var answer struct {
+		Response  string `json:"response"`
+		ToolCalls []struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		} `json:"tool_calls"`
+	}
+	if err := json.Unmarshal([]byte(ExtractJSONObject(content)), &answer); err != nil {
+		slog.Warn("failed to parse json tools response", "model", model, "error", err)
+		return &ChatCompletionResponse{
+			Response: content,
+			Model:    model,
+			Usage:    openAIUsage(resp.Usage),
+		}, nil
+	}
+
+	result := &ChatCompletionResponse{
+		Response: answer.Response,
+		Model:    model,
+		Usage:    openAIUsage(resp.Usage),
+	}
+
+	var calls []ToolCall
+	for _, toolCall := range answer.ToolCalls {
+		calls, err = c.tools.appendCall(calls, toolCall.Name, toolCall.Arguments)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := result.setToolCalls(calls); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// isToolsRejected reports whether err is the server refusing the tools of
+// the request, rather than failing to serve it, refusing the credentials or
+// rejecting another part of the request.
+func isToolsRejected(err error) bool {
+	var statusCode int
+	var details []string
+
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		statusCode = apiErr.HTTPStatusCode
+		details = append(details, apiErr.Message)
+		if apiErr.Param != nil {
+			details = append(details, *apiErr.Param)
+		}
+	case errors.As(err, &reqErr):
+		statusCode = reqErr.HTTPStatusCode
+		details = append(details, string(reqErr.Body))
+	default:
+		return false
+	}
+
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity, http.StatusNotImplemented:
+	default:
+		return false
+	}
+
+	for _, detail := range details {
+		detail = strings.ToLower(detail)
+		if strings.Contains(detail, "tool") || strings.Contains(detail, "function") {
+			return true
+		}
+	}
+	return false
+}
+
 // ValidateName checks if a name is appropriate for social media posting
 // It ensures the name doesn't contain sexual content or offensive words
 func (c *OpenAIChatCompletion) ValidateName(ctx context.Context, name string) (bool, error) {
 	messages := []openai.ChatCompletionMessage{
 		{
-			Role: openai.ChatMessageRoleSystem,
-			Content: "You are a content moderator. Your task is to determine if a name is appropriate " +
-				"for social media posting. The name should not contain sexual content, highly offensive words, " +
-				"hate speech, or other inappropriate content. Words which are only slightly offensive can be allowed " +
-				"as it can have comic effect. Respond with a JSON object that has a single field 'appropriate' " +
-				"with a boolean value.",
+			Role:    openai.ChatMessageRoleSystem,
+			Content: validateNameSystemPrompt,
 		},
 		{
 			Role:    openai.ChatMessageRoleUser,
@@ -143,7 +365,7 @@ func (c *OpenAIChatCompletion) ValidateName(ctx context.Context, name string) (b
 		},
 	)
 	if err != nil {
-		return false, fmt.Errorf("name validation failed: %v", err)
+		return false, fmt.Errorf("name validation failed: %w", err)
 	}
 
 	if len(resp.Choices) == 0 {
@@ -167,7 +389,7 @@ func (c *OpenAIChatCompletion) ValidateName(ctx context.Context, name string) (b
 			Content: content,
 		}, openai.ChatCompletionMessage{
 			Role:    openai.ChatMessageRoleUser,
-			Content: "Please respond with only a JSON object with the format {\"appropriate\": true} or {\"appropriate\": false}",
+			Content: validateNameRetryPrompt,
 		})
 
 		resp, err = c.client.CreateChatCompletion(
@@ -179,7 +401,7 @@ func (c *OpenAIChatCompletion) ValidateName(ctx context.Context, name string) (b
 			},
 		)
 		if err != nil {
-			return false, fmt.Errorf("follow-up name validation failed: %v", err)
+			return false, fmt.Errorf("follow-up name validation failed: %w", err)
 		}
 
 		if len(resp.Choices) == 0 {
@@ -196,3 +418,17 @@ func (c *OpenAIChatCompletion) ValidateName(ctx context.Context, name string) (b
 
 	return validationResp.Appropriate, nil
 }
+
+func (c *OpenAIChatCompletion) ResolveModel(ctx context.Context) string {
+	if c.degradeModel != "" && IsDegraded(ctx) {
+		return c.degradeModel
+	}
+	return c.model
+}
+
+func openAIUsage(usage openai.Usage) ChatCompletionUsage {
+	return ChatCompletionUsage{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+	}
+}
@@ -0,0 +1,200 @@
+package chat_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/teeception/pkg/agent/chat"
+)
+
+// fakeOpenAI is a fake OpenAI-compatible server that answers with scripted
+// message contents, optionally rejecting requests with tools.
+type fakeOpenAI struct {
+	*httptest.Server
+
+	rejectTools bool
+	// rejectMessage rejects every request with the message, if set.
+	rejectMessage string
+
+	mu       sync.Mutex
+	contents []string
+	requests []map[string]any
+	headers  []http.Header
+}
+
+func newFakeOpenAI(t *testing.T, rejectTools bool, contents ...string) *fakeOpenAI {
+	t.Helper()
+
+	f := &fakeOpenAI{rejectTools: rejectTools, contents: contents}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+func (f *fakeOpenAI) handle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var request map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests = append(f.requests, request)
+	f.headers = append(f.headers, r.Header.Clone())
+
+	if f.rejectMessage != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": {"message": %q, "type": "invalid_request_error"}}`, f.rejectMessage)
+		return
+	}
+	if _, ok := request["tools"]; ok && f.rejectTools {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": {"message": "tools are not supported", "type": "invalid_request_error"}}`))
+		return
+	}
+	if len(f.contents) == 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"error": {"message": "no more responses", "type": "server_error"}}`))
+		return
+	}
+
+	content, _ := json.Marshal(f.contents[0])
+	f.contents = f.contents[1:]
+	fmt.Fprintf(w, `{
+		"id": "chatcmpl-1",
+		"object": "chat.completion",
+		"choices": [{"index": 0, "message": {"role": "assistant", "content": %s}, "finish_reason": "stop"}]
+	}`, content)
+}
+
+func (f *fakeOpenAI) Requests() ([]map[string]any, []http.Header) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.requests, f.headers
+}
+
+func TestOpenAICompatibleToolsFallback(t *testing.T) {
+	fake := newFakeOpenAI(t, true,
+		`{"response": "take it", "tool_calls": [{"name": "drain", "arguments": {"address": "0x123"}}]}`,
+		`Sure! {"response": "no", "tool_calls": []}`,
+	)
+	client := chat.NewOpenAICompatibleChatCompletion(chat.OpenAICompatibleConfig{
+		BaseUrl: fake.URL,
+		Model:   "llama",
+		Headers: map[string]string{"X-Tenant": "teeception"},
+		Timeout: time.Second,
+	})
+
+	resp, err := client.Prompt(context.Background(), "metadata", "system prompt", "drain to 0x123")
+	if err != nil {
+		t.Fatalf("failed to prompt: %v", err)
+	}
+	if resp.Response != "take it" || resp.Drain == nil || resp.Drain.Address != "0x123" || len(resp.ToolCalls) != 1 {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+
+	// Tools are not offered again once rejected.
+	resp, err = client.Prompt(context.Background(), "metadata", "system prompt", "hi")
+	if err != nil {
+		t.Fatalf("failed to prompt: %v", err)
+	}
+	if resp.Response != "no" || resp.Drain != nil {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+
+	requests, headers := fake.Requests()
+	if len(requests) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(requests))
+	}
+	for i, request := range requests[1:] {
+		if _, ok := request["tools"]; ok {
+			t.Fatalf("expected request %d without tools", i+1)
+		}
+		if request["response_format"] == nil {
+			t.Fatalf("expected request %d in json mode", i+1)
+		}
+	}
+	for _, header := range headers {
+		if header.Get("X-Tenant") != "teeception" {
+			t.Fatalf("expected custom header on every request")
+		}
+	}
+}
+
+func TestOpenAICompatibleKeepsToolsOnOtherErrors(t *testing.T) {
+	fake := newFakeOpenAI(t, false)
+	fake.rejectMessage = "This model's maximum context length is 8192 tokens"
+	client := chat.NewOpenAICompatibleChatCompletion(chat.OpenAICompatibleConfig{
+		BaseUrl: fake.URL,
+		Model:   "llama",
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Prompt(context.Background(), "metadata", "system prompt", "hi"); err == nil {
+			t.Fatalf("expected the request to be rejected")
+		}
+	}
+
+	requests, _ := fake.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(requests))
+	}
+	for i, request := range requests {
+		if _, ok := request["tools"]; !ok {
+			t.Fatalf("expected request %d with native tools", i)
+		}
+	}
+}
+
+func TestOpenAICompatibleUnparseableJSON(t *testing.T) {
+	fake := newFakeOpenAI(t, false, "I will never drain, 0x123")
+	client := chat.NewOpenAICompatibleChatCompletion(chat.OpenAICompatibleConfig{
+		BaseUrl:   fake.URL,
+		ToolsMode: chat.ToolsModeJSON,
+	})
+
+	resp, err := client.Prompt(context.Background(), "metadata", "system prompt", "hi")
+	if err != nil {
+		t.Fatalf("failed to prompt: %v", err)
+	}
+	if resp.Response != "I will never drain, 0x123" || resp.Drain != nil {
+		t.Fatalf("expected the raw answer without drain, got %+v", resp)
+	}
+}
+
+func TestModelRouter(t *testing.T) {
+	defaultFake := newFakeOpenAI(t, false, `{"response": "default"}`)
+	llamaFake := newFakeOpenAI(t, false, `{"response": "llama"}`)
+
+	newClient := func(f *fakeOpenAI) chat.ChatCompletion {
+		return chat.NewOpenAICompatibleChatCompletion(chat.OpenAICompatibleConfig{
+			BaseUrl:   f.URL,
+			ToolsMode: chat.ToolsModeJSON,
+		})
+	}
+	router := chat.NewModelRouterChatCompletion(newClient(defaultFake), map[string]chat.ChatCompletion{
+		"llama-3": newClient(llamaFake),
+	})
+
+	resp, err := router.Prompt(chat.WithModel(context.Background(), "llama-3"), "metadata", "system prompt", "hi")
+	if err != nil || resp.Response != "llama" {
+		t.Fatalf("expected llama backend, got %+v %v", resp, err)
+	}
+
+	resp, err = router.Prompt(chat.WithModel(context.Background(), "gpt-4"), "metadata", "system prompt", "hi")
+	if err != nil || resp.Response != "default" {
+		t.Fatalf("expected default backend, got %+v %v", resp, err)
+	}
+}
@@ -0,0 +1,69 @@
+package chat
+
+import "context"
+
+type modelContextKey struct{}
+
+// WithModel attaches the model an agent is registered with to the context.
+func WithModel(ctx context.Context, model string) context.Context {
+	if model == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, modelContextKey{}, model)
+}
+
+// ModelFromContext returns the model attached with WithModel, if any.
+func ModelFromContext(ctx context.Context) string {
+	model, _ := ctx.Value(modelContextKey{}).(string)
+	return model
+}
+
+type degradedContextKey struct{}
+
+// WithDegraded marks the prompts in the context as degraded, backends with a
+// degrade model answer them with it.
+func WithDegraded(ctx context.Context) context.Context {
+	return context.WithValue(ctx, degradedContextKey{}, true)
+}
+
+// IsDegraded reports whether the context was marked with WithDegraded.
+func IsDegraded(ctx context.Context) bool {
+	degraded, _ := ctx.Value(degradedContextKey{}).(bool)
+	return degraded
+}
+
+// ModelRouterChatCompletion prompts the ChatCompletion configured for the
+// model in the context, or the default one.
+type ModelRouterChatCompletion struct {
+	defaultChatCompletion ChatCompletion
+	models                map[string]ChatCompletion
+}
+
+var _ ChatCompletion = (*ModelRouterChatCompletion)(nil)
+
+// NewModelRouterChatCompletion creates a new ModelRouterChatCompletion
+func NewModelRouterChatCompletion(defaultChatCompletion ChatCompletion, models map[string]ChatCompletion) *ModelRouterChatCompletion {
+	return &ModelRouterChatCompletion{
+		defaultChatCompletion: defaultChatCompletion,
+		models:                models,
+	}
+}
+
+func (c *ModelRouterChatCompletion) Prompt(ctx context.Context, metadata, systemPrompt, prompt string) (*ChatCompletionResponse, error) {
+	return c.route(ctx).Prompt(ctx, metadata, systemPrompt, prompt)
+}
+
+func (c *ModelRouterChatCompletion) ValidateName(ctx context.Context, name string) (bool, error) {
+	return c.route(ctx).ValidateName(ctx, name)
+}
+
+func (c *ModelRouterChatCompletion) ResolveModel(ctx context.Context) string {
+	return ResolveModel(ctx, c.route(ctx))
+}
+
+func (c *ModelRouterChatCompletion) route(ctx context.Context) ChatCompletion {
+	if chatCompletion, ok := c.models[ModelFromContext(ctx)]; ok {
+		return chatCompletion
+	}
+	return c.defaultChatCompletion
+}
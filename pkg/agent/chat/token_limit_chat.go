@@ -3,49 +3,117 @@ package chat
 import (
 	"context"
 	"fmt"
-
-	"github.com/tiktoken-go/tokenizer"
 )
 
+// TokenLimitChatCompletionConfig is the configuration for the TokenLimitChatCompletion
+type TokenLimitChatCompletionConfig struct {
+	ChatCompletion ChatCompletion
+	// Counters picks the tokenizer of the model answering a prompt, it
+	// defaults to NewTokenCounters().
+	Counters *TokenCounters
+
+	// Limits are in tokens, negative limits are disabled.
+	SystemPromptTokenLimit int
+	PromptTokenLimit       int
+	// TotalTokenLimit bounds the metadata, system prompt, history and prompt together.
+	TotalTokenLimit int
+}
+
+// TokenLimitChatCompletion refuses prompts over its token limits, counted
+// with the tokenizer of the model answering them.
 type TokenLimitChatCompletion struct {
 	ChatCompletion
 
-	tokenizer tokenizer.Codec
+	counters *TokenCounters
 
 	systemPromptTokenLimit int
 	promptTokenLimit       int
+	totalTokenLimit        int
 }
 
 var _ ChatCompletion = (*TokenLimitChatCompletion)(nil)
 
-func NewTokenLimitChatCompletion(chatCompletion ChatCompletion, systemPromptTokenLimit, promptTokenLimit int) (*TokenLimitChatCompletion, error) {
-	tokenizer, err := tokenizer.Get(tokenizer.Cl100kBase)
-	if err != nil {
-		return nil, err
+// TokenLimitError is returned for prompts over a token limit.
+type TokenLimitError struct {
+	// Part is the part of the prompt over its limit: system prompt, prompt or total.
+	Part  string
+	Model string
+	Count int
+	Limit int
+}
+
+func (e *TokenLimitError) Error() string {
+	return fmt.Sprintf("%s token count is greater than the limit for model %q: %d > %d", e.Part, e.Model, e.Count, e.Limit)
+}
+
+// TokenCount is the number of tokens of the parts of a prompt.
+type TokenCount struct {
+	Model        string `json:"model"`
+	Counter      string `json:"counter"`
+	Metadata     int    `json:"metadata"`
+	SystemPrompt int    `json:"system_prompt"`
+	History      int    `json:"history"`
+	Prompt       int    `json:"prompt"`
+	// Total does not include the framing of messages, which depends on the backend.
+	Total int `json:"total"`
+}
+
+// CountTokens counts the tokens of the parts of a prompt for a model.
+func CountTokens(counters *TokenCounters, model, metadata, systemPrompt, prompt string, history []ChatMessage) *TokenCount {
+	counter := counters.ForModel(model)
+
+	count := &TokenCount{
+		Model:        model,
+		Counter:      counter.Name(),
+		Metadata:     counter.CountTokens(metadata),
+		SystemPrompt: counter.CountTokens(systemPrompt),
+		Prompt:       counter.CountTokens(prompt),
+	}
+	for _, message := range history {
+		count.History += counter.CountTokens(message.Content)
+	}
+	count.Total = count.Metadata + count.SystemPrompt + count.History + count.Prompt
+
+	return count
+}
+
+// NewTokenLimitChatCompletion creates a new TokenLimitChatCompletion
+func NewTokenLimitChatCompletion(config TokenLimitChatCompletionConfig) *TokenLimitChatCompletion {
+	if config.Counters == nil {
+		config.Counters = NewTokenCounters()
 	}
 
 	return &TokenLimitChatCompletion{
-		ChatCompletion: chatCompletion,
+		ChatCompletion: config.ChatCompletion,
 
-		tokenizer: tokenizer,
+		counters: config.Counters,
 
-		systemPromptTokenLimit: systemPromptTokenLimit,
-		promptTokenLimit:       promptTokenLimit,
-	}, nil
+		systemPromptTokenLimit: config.SystemPromptTokenLimit,
+		promptTokenLimit:       config.PromptTokenLimit,
+		totalTokenLimit:        config.TotalTokenLimit,
+	}
 }
 
 func (c *TokenLimitChatCompletion) Prompt(ctx context.Context, metadata, systemPrompt, prompt string) (*ChatCompletionResponse, error) {
-	if c.systemPromptTokenLimit >= 0 {
-		systemPromptTokenCount := c.getTokenCount(systemPrompt)
-		if systemPromptTokenCount > c.systemPromptTokenLimit {
-			return nil, fmt.Errorf("system prompt token count is greater than the limit: %d > %d", systemPromptTokenCount, c.systemPromptTokenLimit)
-		}
+	count := c.CountTokens(ctx, metadata, systemPrompt, prompt)
+
+	limits := []struct {
+		part  string
+		count int
+		limit int
+	}{
+		{"system prompt", count.SystemPrompt, c.systemPromptTokenLimit},
+		{"prompt", count.Prompt, c.promptTokenLimit},
+		{"total", count.Total, c.totalTokenLimit},
 	}
-
-	if c.promptTokenLimit >= 0 {
-		promptTokenCount := c.getTokenCount(prompt)
-		if promptTokenCount > c.promptTokenLimit {
-			return nil, fmt.Errorf("prompt token count is greater than the limit: %d > %d", promptTokenCount, c.promptTokenLimit)
+	for _, limit := range limits {
+		if limit.limit >= 0 && limit.count > limit.limit {
+			return nil, &TokenLimitError{
+				Part:  limit.part,
+				Model: count.Model,
+				Count: limit.count,
+				Limit: limit.limit,
+			}
 		}
 	}
 
@@ -61,6 +129,15 @@ func (c *TokenLimitChatCompletion) ValidateName(ctx context.Context, name string
 	return c.ChatCompletion.ValidateName(ctx, name)
 }
 
+func (c *TokenLimitChatCompletion) ResolveModel(ctx context.Context) string {
+	return ResolveModel(ctx, c.ChatCompletion)
+}
+
+// CountTokens counts the tokens of a prompt in the context for the model answering it.
+func (c *TokenLimitChatCompletion) CountTokens(ctx context.Context, metadata, systemPrompt, prompt string) *TokenCount {
+	return CountTokens(c.counters, c.ResolveModel(ctx), metadata, systemPrompt, prompt, HistoryFromContext(ctx))
+}
+
 func (c *TokenLimitChatCompletion) SystemPromptTokenLimit() int {
 	return c.systemPromptTokenLimit
 }
@@ -69,7 +146,6 @@ func (c *TokenLimitChatCompletion) PromptTokenLimit() int {
 	return c.promptTokenLimit
 }
 
-func (c *TokenLimitChatCompletion) getTokenCount(prompt string) int {
-	ids, _, _ := c.tokenizer.Encode(prompt)
-	return len(ids)
+func (c *TokenLimitChatCompletion) TotalTokenLimit() int {
+	return c.totalTokenLimit
 }
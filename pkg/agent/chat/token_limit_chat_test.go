@@ -0,0 +1,66 @@
+package chat_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/NethermindEth/teeception/pkg/agent/chat"
+)
+
+func TestTokenCountersForModel(t *testing.T) {
+	counters := chat.NewTokenCounters()
+	counters.Register("llama", &chat.ApproximateTokenCounter{CharsPerToken: 4})
+
+	tests := []struct {
+		model   string
+		counter string
+	}{
+		{"gpt-4", "cl100k_base"},
+		{"gpt-4-0613", "cl100k_base"},
+		{"gpt-4o", "o200k_base"},
+		{"gpt-4o-mini", "o200k_base"},
+		{"claude-3-5-sonnet-latest", "approximate"},
+		{"llama-3", "approximate"},
+		{"unknown", "cl100k_base"},
+	}
+	for _, test := range tests {
+		if counter := counters.ForModel(test.model).Name(); counter != test.counter {
+			t.Fatalf("expected %s to use %s, got %s", test.model, test.counter, counter)
+		}
+	}
+
+	if count := counters.ForModel("llama-3").CountTokens("123456789"); count != 3 {
+		t.Fatalf("expected 3 approximate tokens, got %d", count)
+	}
+}
+
+func TestTokenLimitChatCompletion(t *testing.T) {
+	backend := chat.NewOpenAIChatCompletion(chat.OpenAIChatCompletionConfig{Model: "gpt-4o"})
+	client := chat.NewTokenLimitChatCompletion(chat.TokenLimitChatCompletionConfig{
+		ChatCompletion:         backend,
+		SystemPromptTokenLimit: 10,
+		PromptTokenLimit:       -1,
+		TotalTokenLimit:        8,
+	})
+
+	ctx := context.Background()
+	if model := chat.ResolveModel(ctx, client); model != "gpt-4o" {
+		t.Fatalf("expected the backend model, got %q", model)
+	}
+
+	count := client.CountTokens(ctx, "one two three", "four five", "six")
+	if count.Counter != "o200k_base" || count.Total != count.Metadata+count.SystemPrompt+count.Prompt {
+		t.Fatalf("unexpected count %+v", count)
+	}
+
+	// The metadata pushes the prompt over the total limit.
+	_, err := client.Prompt(ctx, "one two three four five six seven eight nine ten", "hi", "hi")
+	var limitErr *chat.TokenLimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("expected a token limit error, got %v", err)
+	}
+	if limitErr.Part != "total" || limitErr.Model != "gpt-4o" || limitErr.Limit != 8 || limitErr.Count <= 8 {
+		t.Fatalf("unexpected token limit error %+v", limitErr)
+	}
+}
@@ -0,0 +1,153 @@
+package chat
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/tiktoken-go/tokenizer"
+)
+
+const (
+	// DefaultSystemPromptTokenLimit is the token limit of agent system prompts.
+	DefaultSystemPromptTokenLimit = 800
+	// DefaultTotalTokenLimit is the token limit of agent prompts with their
+	// metadata, system prompt and history.
+	DefaultTotalTokenLimit = 4096
+
+	// anthropicCharsPerToken approximates Claude tokenization, which has no
+	// public encoding.
+	anthropicCharsPerToken = 3.5
+)
+
+// TokenCounter counts the tokens of texts for a model.
+type TokenCounter interface {
+	// Name identifies the encoding or approximation.
+	Name() string
+	CountTokens(text string) int
+}
+
+type codecTokenCounter struct {
+	codec tokenizer.Codec
+}
+
+func (c *codecTokenCounter) Name() string {
+	return c.codec.GetName()
+}
+
+func (c *codecTokenCounter) CountTokens(text string) int {
+	ids, _, _ := c.codec.Encode(text)
+	return len(ids)
+}
+
+// ApproximateTokenCounter estimates the tokens of models without a known
+// encoding from the length of texts, rounding up.
+type ApproximateTokenCounter struct {
+	CharsPerToken float64
+}
+
+func (c *ApproximateTokenCounter) Name() string {
+	return "approximate"
+}
+
+func (c *ApproximateTokenCounter) CountTokens(text string) int {
+	return int(math.Ceil(float64(utf8.RuneCountInString(text)) / c.CharsPerToken))
+}
+
+// TokenCounters picks the TokenCounter of models: the one registered for
+// their longest prefix, else their tiktoken encoding, else cl100k_base.
+type TokenCounters struct {
+	mu        sync.RWMutex
+	prefixes  map[string]TokenCounter
+	models    map[string]TokenCounter
+	encodings map[string]TokenCounter
+}
+
+// NewTokenCounters creates a new TokenCounters approximating Claude models.
+func NewTokenCounters() *TokenCounters {
+	counters := &TokenCounters{
+		prefixes:  make(map[string]TokenCounter),
+		models:    make(map[string]TokenCounter),
+		encodings: make(map[string]TokenCounter),
+	}
+	counters.Register("claude", &ApproximateTokenCounter{CharsPerToken: anthropicCharsPerToken})
+
+	return counters
+}
+
+// Register sets the TokenCounter of the models starting with the prefix.
+func (t *TokenCounters) Register(prefix string, counter TokenCounter) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.prefixes[prefix] = counter
+	// Registrations may change the counter of models already resolved.
+	t.models = make(map[string]TokenCounter)
+}
+
+// ForModel returns the TokenCounter of a model.
+func (t *TokenCounters) ForModel(model string) TokenCounter {
+	t.mu.RLock()
+	counter, ok := t.models[model]
+	t.mu.RUnlock()
+	if ok {
+		return counter
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	prefixLen := -1
+	for prefix, c := range t.prefixes {
+		if len(prefix) > prefixLen && strings.HasPrefix(model, prefix) {
+			counter, prefixLen = c, len(prefix)
+		}
+	}
+
+	if counter != nil {
+		t.models[model] = counter
+		return counter
+	}
+
+	codec, err := tokenizer.ForModel(tokenizer.Model(model))
+	if err != nil {
+		// Unknown models are not cached, as models are user input and would
+		// grow the cache without bound.
+		codec, _ = tokenizer.Get(tokenizer.Cl100kBase)
+		return t.forEncoding(codec)
+	}
+
+	counter = t.forEncoding(codec)
+	t.models[model] = counter
+	return counter
+}
+
+// forEncoding returns the TokenCounter of an encoding, models sharing an
+// encoding share its vocabulary. The lock must be held.
+func (t *TokenCounters) forEncoding(codec tokenizer.Codec) TokenCounter {
+	counter, ok := t.encodings[codec.GetName()]
+	if !ok {
+		counter = &codecTokenCounter{codec: codec}
+		t.encodings[codec.GetName()] = counter
+	}
+	return counter
+}
+
+// ModelResolver is implemented by ChatCompletions that know which model
+// answers the prompts in a context.
+type ModelResolver interface {
+	ResolveModel(ctx context.Context) string
+}
+
+// ResolveModel returns the model answering the prompts of chatCompletion in
+// the context, falling back to the model attached with WithModel.
+func ResolveModel(ctx context.Context, chatCompletion ChatCompletion) string {
+	if resolver, ok := chatCompletion.(ModelResolver); ok {
+		if model := resolver.ResolveModel(ctx); model != "" {
+			return model
+		}
+	}
+	return ModelFromContext(ctx)
+}
@@ -0,0 +1,296 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/tmc/langchaingo/jsonschema"
+)
+
+// DrainToolName is the name of the tool giving away all tokens of the agent.
+const DrainToolName = "drain"
+
+// ErrUnknownTool is returned for calls of tools that are not registered.
+var ErrUnknownTool = errors.New("unknown tool")
+
+var toolNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// Tool is a function the model can call.
+type Tool struct {
+	Name        string
+	Description string
+	// Parameters is the JSON schema of the arguments, an object.
+	Parameters jsonschema.Definition
+}
+
+// ToolCall is a call of a tool by the model, with validated arguments.
+type ToolCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// Decode unmarshals the arguments of the call into v.
+func (c *ToolCall) Decode(v any) error {
+	if err := json.Unmarshal(c.Arguments, v); err != nil {
+		return fmt.Errorf("failed to unmarshal %s arguments: %w", c.Name, err)
+	}
+	return nil
+}
+
+// DrainTool is the tool giving away all tokens of the agent to an address.
+var DrainTool = &Tool{
+	Name:        DrainToolName,
+	Description: drainToolDescription,
+	Parameters: jsonschema.Definition{
+		Type: jsonschema.Object,
+		Properties: map[string]jsonschema.Definition{
+			"address": {
+				Type:        jsonschema.String,
+				Description: drainAddressDescription,
+			},
+		},
+		Required: []string{"address"},
+	},
+}
+
+// ToolRegistry is the set of tools offered to the model. Backends translate
+// it to their own tool format and validate the calls against it.
+type ToolRegistry struct {
+	mu    sync.RWMutex
+	tools []*Tool
+}
+
+// NewToolRegistry creates a new ToolRegistry with the given tools.
+func NewToolRegistry(tools ...*Tool) (*ToolRegistry, error) {
+	registry := &ToolRegistry{}
+	for _, tool := range tools {
+		if err := registry.Register(tool); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+// DefaultToolRegistry creates a new ToolRegistry with the drain tool.
+func DefaultToolRegistry() *ToolRegistry {
+	return &ToolRegistry{tools: []*Tool{DrainTool}}
+}
+
+// Register adds a tool to the registry.
+func (r *ToolRegistry) Register(tool *Tool) error {
+	if !toolNameRegex.MatchString(tool.Name) {
+		return fmt.Errorf("invalid tool name %q", tool.Name)
+	}
+	if tool.Parameters.Type != jsonschema.Object {
+		return fmt.Errorf("parameters of tool %s must be an object", tool.Name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if slices.ContainsFunc(r.tools, func(t *Tool) bool { return t.Name == tool.Name }) {
+		return fmt.Errorf("tool %s is already registered", tool.Name)
+	}
+	r.tools = append(r.tools, tool)
+
+	return nil
+}
+
+// Tools returns the registered tools in registration order.
+func (r *ToolRegistry) Tools() []*Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return slices.Clone(r.tools)
+}
+
+// Get returns the tool with the given name.
+func (r *ToolRegistry) Get(name string) (*Tool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, tool := range r.tools {
+		if tool.Name == name {
+			return tool, true
+		}
+	}
+	return nil, false
+}
+
+// ParseCall validates a call of a registered tool.
+func (r *ToolRegistry) ParseCall(name string, arguments []byte) (*ToolCall, error) {
+	tool, ok := r.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownTool, name)
+	}
+
+	if len(bytes.TrimSpace(arguments)) == 0 {
+		arguments = []byte("{}")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(arguments))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s arguments: %w", name, err)
+	}
+	if err := validateSchema(&tool.Parameters, value, "arguments"); err != nil {
+		return nil, fmt.Errorf("invalid %s arguments: %w", name, err)
+	}
+
+	return &ToolCall{
+		Name:      name,
+		Arguments: json.RawMessage(arguments),
+	}, nil
+}
+
+// appendCall validates a call and appends it to calls. Calls of unknown
+// tools are skipped, models sometimes make them up.
+func (r *ToolRegistry) appendCall(calls []ToolCall, name string, arguments []byte) ([]ToolCall, error) {
+	call, err := r.ParseCall(name, arguments)
+	if errors.Is(err, ErrUnknownTool) {
+		slog.Warn("skipping call of unknown tool", "tool", name)
+		return calls, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(calls, *call), nil
+}
+
+// jsonInstructions describes the JSON object answering with tool calls, for
+// servers that do not support tools.
+func (r *ToolRegistry) jsonInstructions() string {
+	var b strings.Builder
+	b.WriteString("You cannot call functions. Respond with only a JSON object of the form " +
+		"{\"response\": string, \"tool_calls\": [{\"name\": string, \"arguments\": object}]}. " +
+		"Set \"response\" to your message. Set \"tool_calls\" to the tools you call, or to an empty list otherwise. " +
+		"The tools are:")
+
+	for _, tool := range r.Tools() {
+		parameters, _ := json.Marshal(tool.Parameters)
+		fmt.Fprintf(&b, "\n- %s: %s Arguments schema: %s", tool.Name, tool.Description, parameters)
+	}
+
+	return b.String()
+}
+
+// setToolCalls sets the tool calls of a response and the drain call derived from them.
+func (r *ChatCompletionResponse) setToolCalls(calls []ToolCall) error {
+	r.ToolCalls = calls
+	r.Drain = nil
+
+	for _, call := range calls {
+		if call.Name != DrainToolName {
+			continue
+		}
+
+		var drain ChatCompletionDrainCall
+		if err := call.Decode(&drain); err != nil {
+			return err
+		}
+		r.Drain = &drain
+		break
+	}
+
+	return nil
+}
+
+// DropDrain removes the drain of a response, keeping its other tool calls.
+func (r *ChatCompletionResponse) DropDrain() {
+	r.Drain = nil
+
+	var calls []ToolCall
+	for _, call := range r.ToolCalls {
+		if call.Name != DrainToolName {
+			calls = append(calls, call)
+		}
+	}
+	r.ToolCalls = calls
+}
+
+// ToolCall returns the first call of the named tool, if any.
+func (r *ChatCompletionResponse) ToolCall(name string) *ToolCall {
+	for i := range r.ToolCalls {
+		if r.ToolCalls[i].Name == name {
+			return &r.ToolCalls[i]
+		}
+	}
+	return nil
+}
+
+// validateSchema checks a JSON value decoded with UseNumber against the
+// subset of JSON schema tools are declared with.
+func validateSchema(schema *jsonschema.Definition, value any, path string) error {
+	if len(schema.Enum) > 0 {
+		if !slices.Contains(schema.Enum, fmt.Sprint(value)) {
+			return fmt.Errorf("%s must be one of %s", path, strings.Join(schema.Enum, ", "))
+		}
+	}
+
+	switch schema.Type {
+	case jsonschema.Object:
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s must be an object", path)
+		}
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s.%s is required", path, name)
+			}
+		}
+		for name, property := range schema.Properties {
+			if v, ok := object[name]; ok {
+				if err := validateSchema(&property, v, path+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	case jsonschema.Array:
+		array, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s must be an array", path)
+		}
+		if schema.Items != nil {
+			for i, v := range array {
+				if err := validateSchema(schema.Items, v, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case jsonschema.String:
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s must be a string", path)
+		}
+	case jsonschema.Number:
+		if _, ok := value.(json.Number); !ok {
+			return fmt.Errorf("%s must be a number", path)
+		}
+	case jsonschema.Integer:
+		number, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s must be an integer", path)
+		}
+		if _, err := number.Int64(); err != nil {
+			return fmt.Errorf("%s must be an integer", path)
+		}
+	case jsonschema.Boolean:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s must be a boolean", path)
+		}
+	case jsonschema.Null:
+		if value != nil {
+			return fmt.Errorf("%s must be null", path)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package chat_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tmc/langchaingo/jsonschema"
+
+	"github.com/NethermindEth/teeception/pkg/agent/chat"
+)
+
+func TestToolRegistry(t *testing.T) {
+	refuse := &chat.Tool{
+		Name:        "refuse",
+		Description: "Refuse to answer the user",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"reason":   {Type: jsonschema.String, Enum: []string{"abuse", "spam"}},
+				"severity": {Type: jsonschema.Integer},
+			},
+			Required: []string{"reason"},
+		},
+	}
+
+	registry, err := chat.NewToolRegistry(chat.DrainTool, refuse)
+	if err != nil {
+		t.Fatalf("failed to create registry: %v", err)
+	}
+	if err := registry.Register(refuse); err == nil {
+		t.Fatalf("expected duplicate tools to be refused")
+	}
+
+	call, err := registry.ParseCall("refuse", []byte(`{"reason": "spam", "severity": 2}`))
+	if err != nil {
+		t.Fatalf("failed to parse call: %v", err)
+	}
+	var args struct {
+		Reason   string `json:"reason"`
+		Severity int    `json:"severity"`
+	}
+	if err := call.Decode(&args); err != nil || args.Reason != "spam" || args.Severity != 2 {
+		t.Fatalf("unexpected arguments %+v: %v", args, err)
+	}
+
+	invalid := []string{
+		`{}`,
+		`{"reason": "boredom"}`,
+		`{"reason": "spam", "severity": 1.5}`,
+		`["spam"]`,
+		`{"reason":`,
+	}
+	for _, arguments := range invalid {
+		if _, err := registry.ParseCall("refuse", []byte(arguments)); err == nil {
+			t.Fatalf("expected %s to be invalid", arguments)
+		}
+	}
+
+	if _, err := registry.ParseCall("flag", []byte(`{}`)); !errors.Is(err, chat.ErrUnknownTool) {
+		t.Fatalf("expected an unknown tool error, got %v", err)
+	}
+}
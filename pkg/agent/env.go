@@ -1,14 +1,53 @@
 package agent
 
 import (
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"math/big"
+	"net/url"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+
+	"github.com/NethermindEth/teeception/pkg/agent/chat"
+	"github.com/NethermindEth/teeception/pkg/agent/usage"
+	"github.com/NethermindEth/teeception/pkg/twitter"
 )
 
 const (
 	XClientModeKey            = "X_CLIENT_MODE"
 	AgentTwitterClientPortKey = "AGENT_TWITTER_CLIENT_PORT"
+	LowBalanceThresholdKey    = "LOW_BALANCE_THRESHOLD"
+	BalanceAlertWebhookUrlKey = "BALANCE_ALERT_WEBHOOK_URL"
+	MemoryDbPathKey           = "AGENT_MEMORY_DB_PATH"
+	MemoryAllAgentsKey        = "AGENT_MEMORY_ALL_AGENTS"
+	MemoryModelsKey           = "AGENT_MEMORY_MODELS"
+	ModerationBlockedWordsKey = "MODERATION_BLOCKED_WORDS"
+	ModerationUseOpenAIKey    = "MODERATION_USE_OPENAI"
+	MentionPollIntervalKey    = "AGENT_MENTION_POLL_INTERVAL"
+	MentionPaymentUrlKey      = "AGENT_MENTION_PAYMENT_URL"
+	OutboxDbPathKey           = "AGENT_OUTBOX_DB_PATH"
+	RequireLinkedHandleKey    = "AGENT_REQUIRE_LINKED_HANDLE"
+	XFallbackAccountsKey      = "X_FALLBACK_ACCOUNTS"
+	XWriteFailoverKey         = "X_WRITE_FAILOVER"
+	ModelBackendsKey          = "AGENT_MODEL_BACKENDS"
+	ChatFallbacksKey          = "AGENT_CHAT_FALLBACKS"
+	UsageDbPathKey            = "AGENT_USAGE_DB_PATH"
+	UsagePricesKey            = "AGENT_USAGE_PRICES"
+	BudgetDailyCapKey         = "AGENT_BUDGET_DAILY_CAP"
+	BudgetCapsKey             = "AGENT_BUDGET_CAPS"
+	BudgetExceededActionKey   = "AGENT_BUDGET_EXCEEDED_ACTION"
+	BudgetDegradeModelKey     = "AGENT_BUDGET_DEGRADE_MODEL"
+	ChatCassettePathKey       = "AGENT_CHAT_CASSETTE_PATH"
+	ReplyMaxRetriesKey        = "AGENT_REPLY_MAX_RETRIES"
+	GuardModelsKey            = "AGENT_GUARD_MODELS"
+	GuardDbPathKey            = "AGENT_GUARD_DB_PATH"
+	ConsensusModelsKey        = "AGENT_CONSENSUS_MODELS"
 )
 
 func envGetAgentTwitterClientMode() string {
@@ -26,3 +65,446 @@ func envLookupAgentTwitterClientPort() (string, error) {
 	}
 	return port, nil
 }
+
+// EnvGetLowBalanceThreshold returns the fee token balance (in wei) under which the
+// agent switches into degraded mode. It defaults to zero.
+func EnvGetLowBalanceThreshold() *big.Int {
+	threshold, ok := os.LookupEnv(LowBalanceThresholdKey)
+	if !ok || threshold == "" {
+		return big.NewInt(0)
+	}
+
+	thresholdBI, ok := new(big.Int).SetString(threshold, 10)
+	if !ok {
+		slog.Warn(LowBalanceThresholdKey + " environment variable is not a valid integer")
+		return big.NewInt(0)
+	}
+	return thresholdBI
+}
+
+// EnvGetBalanceAlertWebhookUrl returns the webhook balance alerts are posted to.
+func EnvGetBalanceAlertWebhookUrl() string {
+	return os.Getenv(BalanceAlertWebhookUrlKey)
+}
+
+// EnvGetMemoryDbPath returns the path of the conversation memory database.
+func EnvGetMemoryDbPath() string {
+	return os.Getenv(MemoryDbPathKey)
+}
+
+// EnvGetMemoryAllAgents returns whether conversation memory is enabled for every agent.
+func EnvGetMemoryAllAgents() bool {
+	return os.Getenv(MemoryAllAgentsKey) == "true"
+}
+
+// EnvGetMemoryModels returns the models whose agents have conversation memory.
+func EnvGetMemoryModels() []string {
+	models := os.Getenv(MemoryModelsKey)
+	if models == "" {
+		return nil
+	}
+	return strings.Split(models, ",")
+}
+
+// EnvGetModerationBlockedWords returns the words that withhold a reply.
+func EnvGetModerationBlockedWords() []string {
+	words := os.Getenv(ModerationBlockedWordsKey)
+	if words == "" {
+		return nil
+	}
+	return strings.Split(words, ",")
+}
+
+// EnvGetModerationUseOpenAI returns whether replies are classified with the OpenAI moderation endpoint.
+func EnvGetModerationUseOpenAI() bool {
+	return os.Getenv(ModerationUseOpenAIKey) == "true"
+}
+
+// EnvGetMentionPollInterval returns how often mentions are polled, zero disables polling.
+func EnvGetMentionPollInterval() time.Duration {
+	interval, ok := os.LookupEnv(MentionPollIntervalKey)
+	if !ok || interval == "" {
+		return 0
+	}
+
+	duration, err := time.ParseDuration(interval)
+	if err != nil {
+		slog.Warn(MentionPollIntervalKey + " environment variable is not a valid duration")
+		return 0
+	}
+	return duration
+}
+
+// EnvGetMentionPaymentUrl returns the payment page linked in replies to unpaid mentions.
+func EnvGetMentionPaymentUrl() string {
+	return os.Getenv(MentionPaymentUrlKey)
+}
+
+// EnvGetOutboxDbPath returns the path of the outbound tweet queue database.
+func EnvGetOutboxDbPath() string {
+	return os.Getenv(OutboxDbPathKey)
+}
+
+// EnvGetRequireLinkedHandle returns whether prompt tweets must come from the
+// Twitter handle linked to the paying account.
+func EnvGetRequireLinkedHandle() bool {
+	return os.Getenv(RequireLinkedHandleKey) == "true"
+}
+
+// EnvGetTwitterFallbackAccounts returns the API accounts used when the primary
+// Twitter account fails.
+func EnvGetTwitterFallbackAccounts() []*twitter.TwitterClientConfig {
+	accounts := os.Getenv(XFallbackAccountsKey)
+	if accounts == "" {
+		return nil
+	}
+
+	var configs []*twitter.TwitterClientConfig
+	if err := json.Unmarshal([]byte(accounts), &configs); err != nil {
+		slog.Warn(XFallbackAccountsKey+" environment variable is not a valid JSON list of accounts", "error", err)
+		return nil
+	}
+	return configs
+}
+
+// EnvGetTwitterWriteFailover returns which accounts tweets may fail over to.
+func EnvGetTwitterWriteFailover() twitter.WriteFailover {
+	policy := twitter.WriteFailover(os.Getenv(XWriteFailoverKey))
+	switch policy {
+	case "", twitter.WriteFailoverNone, twitter.WriteFailoverSameUsername, twitter.WriteFailoverAny:
+		return policy
+	}
+
+	slog.Warn(XWriteFailoverKey + " environment variable is not a valid policy")
+	return twitter.WriteFailoverNone
+}
+
+// EnvGetModelBackends returns the OpenAI-compatible backends of agents
+// registered with the given models. Agents of other models use OpenAI.
+func EnvGetModelBackends() map[string]chat.OpenAICompatibleConfig {
+	backends := os.Getenv(ModelBackendsKey)
+	if backends == "" {
+		return nil
+	}
+
+	var entries map[string]openAICompatibleEntry
+	if err := json.Unmarshal([]byte(backends), &entries); err != nil {
+		slog.Warn(ModelBackendsKey+" environment variable is not a valid JSON object of backends", "error", err)
+		return nil
+	}
+
+	configs := make(map[string]chat.OpenAICompatibleConfig, len(entries))
+	for model, entry := range entries {
+		if entry.Model == "" {
+			entry.Model = model
+		}
+
+		config, err := entry.config()
+		if err != nil {
+			slog.Warn(ModelBackendsKey+" backend is invalid", "model", model, "error", err)
+			continue
+		}
+		configs[model] = config
+	}
+	return configs
+}
+
+// EnvGetChatFallbacks returns the OpenAI-compatible backends tried in order
+// when OpenAI fails.
+func EnvGetChatFallbacks() []chat.OpenAICompatibleConfig {
+	fallbacks := os.Getenv(ChatFallbacksKey)
+	if fallbacks == "" {
+		return nil
+	}
+
+	var entries []openAICompatibleEntry
+	if err := json.Unmarshal([]byte(fallbacks), &entries); err != nil {
+		slog.Warn(ChatFallbacksKey+" environment variable is not a valid JSON array of backends", "error", err)
+		return nil
+	}
+
+	configs := make([]chat.OpenAICompatibleConfig, 0, len(entries))
+	for i, entry := range entries {
+		if entry.Model == "" {
+			slog.Warn(ChatFallbacksKey+" backend has no model", "index", i)
+			continue
+		}
+
+		config, err := entry.config()
+		if err != nil {
+			slog.Warn(ChatFallbacksKey+" backend is invalid", "model", entry.Model, "error", err)
+			continue
+		}
+		configs = append(configs, config)
+	}
+	return configs
+}
+
+// EnvGetGuardModels returns the guard models of agents registered with the
+// given models, which opt into the guard pipeline. Guards without a base URL
+// are served by OpenAI.
+func EnvGetGuardModels() map[string]chat.OpenAICompatibleConfig {
+	guards := os.Getenv(GuardModelsKey)
+	if guards == "" {
+		return nil
+	}
+
+	var entries map[string]openAICompatibleEntry
+	if err := json.Unmarshal([]byte(guards), &entries); err != nil {
+		slog.Warn(GuardModelsKey+" environment variable is not a valid JSON object of guards", "error", err)
+		return nil
+	}
+
+	configs := make(map[string]chat.OpenAICompatibleConfig, len(entries))
+	for model, entry := range entries {
+		config, err := entry.config()
+		if err != nil {
+			slog.Warn(GuardModelsKey+" guard is invalid", "model", model, "error", err)
+			continue
+		}
+		configs[model] = config
+	}
+	return configs
+}
+
+// EnvGetGuardDbPath returns the path of the guard verdicts database.
+func EnvGetGuardDbPath() string {
+	return os.Getenv(GuardDbPathKey)
+}
+
+// EnvGetConsensusModels returns the consensus of voters answering the
+// prompts of agents registered with the given models.
+func EnvGetConsensusModels() map[string]*ConsensusModel {
+	consensusModels := os.Getenv(ConsensusModelsKey)
+	if consensusModels == "" {
+		return nil
+	}
+
+	var entries map[string]struct {
+		Threshold int                     `json:"threshold"`
+		Voters    []openAICompatibleEntry `json:"voters"`
+	}
+	if err := json.Unmarshal([]byte(consensusModels), &entries); err != nil {
+		slog.Warn(ConsensusModelsKey+" environment variable is not a valid JSON object of consensus", "error", err)
+		return nil
+	}
+
+	configs := make(map[string]*ConsensusModel, len(entries))
+	for model, entry := range entries {
+		consensusModel := &ConsensusModel{
+			Threshold: entry.Threshold,
+		}
+
+		for i, voter := range entry.Voters {
+			if voter.Model == "" {
+				slog.Warn(ConsensusModelsKey+" voter has no model", "model", model, "index", i)
+				continue
+			}
+
+			config, err := voter.config()
+			if err != nil {
+				slog.Warn(ConsensusModelsKey+" voter is invalid", "model", model, "index", i, "error", err)
+				continue
+			}
+			consensusModel.Voters = append(consensusModel.Voters, config)
+		}
+
+		if len(consensusModel.Voters) == 0 {
+			slog.Warn(ConsensusModelsKey+" consensus has no voters", "model", model)
+			continue
+		}
+		configs[model] = consensusModel
+	}
+	return configs
+}
+
+// EnvGetUsageDbPath returns the path of the token usage database.
+func EnvGetUsageDbPath() string {
+	return os.Getenv(UsageDbPathKey)
+}
+
+// EnvGetUsagePrices returns the price table of models, the configured prices
+// overriding the default ones.
+func EnvGetUsagePrices() usage.PriceTable {
+	prices := make(usage.PriceTable, len(usage.DefaultPriceTable))
+	for model, price := range usage.DefaultPriceTable {
+		prices[model] = price
+	}
+
+	overrides := os.Getenv(UsagePricesKey)
+	if overrides == "" {
+		return prices
+	}
+
+	var entries usage.PriceTable
+	if err := json.Unmarshal([]byte(overrides), &entries); err != nil {
+		slog.Warn(UsagePricesKey+" environment variable is not a valid JSON object of prices", "error", err)
+		return prices
+	}
+	for model, price := range entries {
+		prices[model] = price
+	}
+	return prices
+}
+
+// EnvGetBudgetDailyCap returns the daily budget of every agent in USD, zero means no cap.
+func EnvGetBudgetDailyCap() float64 {
+	dailyCap, ok := os.LookupEnv(BudgetDailyCapKey)
+	if !ok || dailyCap == "" {
+		return 0
+	}
+
+	value, err := strconv.ParseFloat(dailyCap, 64)
+	if err != nil || value < 0 {
+		slog.Warn(BudgetDailyCapKey + " environment variable is not a valid amount")
+		return 0
+	}
+	return value
+}
+
+// EnvGetBudgetCaps returns the daily budgets in USD overriding the default
+// one, by agent address.
+func EnvGetBudgetCaps() map[[32]byte]float64 {
+	caps := os.Getenv(BudgetCapsKey)
+	if caps == "" {
+		return nil
+	}
+
+	var entries map[string]float64
+	if err := json.Unmarshal([]byte(caps), &entries); err != nil {
+		slog.Warn(BudgetCapsKey+" environment variable is not a valid JSON object of budgets", "error", err)
+		return nil
+	}
+
+	budgets := make(map[[32]byte]float64, len(entries))
+	for addr, budget := range entries {
+		agentAddr, err := new(felt.Felt).SetString(addr)
+		if err != nil {
+			slog.Warn(BudgetCapsKey+" budget has an invalid agent address", "agent_address", addr)
+			continue
+		}
+		budgets[agentAddr.Bytes()] = budget
+	}
+	return budgets
+}
+
+// EnvGetBudgetExceededAction returns what happens to prompts of agents over their budget.
+func EnvGetBudgetExceededAction() usage.BudgetAction {
+	action := usage.BudgetAction(os.Getenv(BudgetExceededActionKey))
+	switch action {
+	case "", usage.BudgetActionRefuse, usage.BudgetActionDegrade:
+		return action
+	}
+
+	slog.Warn(BudgetExceededActionKey + " environment variable is not a valid action")
+	return usage.BudgetActionRefuse
+}
+
+// EnvGetBudgetDegradeModel returns the OpenAI model answering prompts of
+// agents served by OpenAI over their budget when degraded. Other backends
+// degrade to the degrade_model of their entry.
+func EnvGetBudgetDegradeModel() string {
+	return os.Getenv(BudgetDegradeModelKey)
+}
+
+// EnvGetChatCassettePath returns the cassette the exchanges of the agent
+// backends are recorded to, for regression suites and audits.
+func EnvGetChatCassettePath() string {
+	return os.Getenv(ChatCassettePathKey)
+}
+
+// EnvGetReplyMaxRetries returns the number of times replies violating their
+// constraints are reprompted, zero meaning the default and negative none.
+func EnvGetReplyMaxRetries() int {
+	maxRetries, ok := os.LookupEnv(ReplyMaxRetriesKey)
+	if !ok || maxRetries == "" {
+		return 0
+	}
+
+	value, err := strconv.Atoi(maxRetries)
+	if err != nil {
+		slog.Warn(ReplyMaxRetriesKey + " environment variable is not a valid number")
+		return 0
+	}
+	return value
+}
+
+// openAICompatibleEntry is an OpenAI-compatible backend as configured in the environment.
+// Backends answer prompts and so decide drains. They are restricted to hosts
+// compiled into the agent rather than left to the operator: services of the
+// agent compose file, reached over the compose network, and providers reached
+// over TLS.
+var (
+	composeBackendHosts  = []string{"vllm", "ollama", "llama-cpp"}
+	providerBackendHosts = []string{"api.openai.com"}
+)
+
+// checkBackendUrl returns an error unless baseUrl is served by a trusted
+// host. Backends without a base URL are served by OpenAI.
+func checkBackendUrl(baseUrl string) error {
+	if baseUrl == "" {
+		return nil
+	}
+
+	u, err := url.Parse(baseUrl)
+	if err != nil {
+		return fmt.Errorf("invalid base url %q: %v", baseUrl, err)
+	}
+
+	host := u.Hostname()
+	switch {
+	case slices.Contains(composeBackendHosts, host):
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("invalid scheme %q of backend %s", u.Scheme, host)
+		}
+	case slices.Contains(providerBackendHosts, host):
+		if u.Scheme != "https" {
+			return fmt.Errorf("backend %s must be reached over https", host)
+		}
+	default:
+		return fmt.Errorf("backend host %q is not trusted", host)
+	}
+
+	return nil
+}
+
+type openAICompatibleEntry struct {
+	BaseUrl   string            `json:"base_url"`
+	ApiKey    string            `json:"api_key"`
+	Model     string            `json:"model"`
+	Degrade   string            `json:"degrade_model"`
+	Headers   map[string]string `json:"headers"`
+	Timeout   string            `json:"timeout"`
+	ToolsMode string            `json:"tools_mode"`
+}
+
+func (e *openAICompatibleEntry) config() (chat.OpenAICompatibleConfig, error) {
+	config := chat.OpenAICompatibleConfig{
+		BaseUrl:      e.BaseUrl,
+		ApiKey:       e.ApiKey,
+		Model:        e.Model,
+		DegradeModel: e.Degrade,
+		Headers:      e.Headers,
+		ToolsMode:    chat.ToolsMode(e.ToolsMode),
+	}
+
+	if err := checkBackendUrl(e.BaseUrl); err != nil {
+		return config, err
+	}
+
+	switch config.ToolsMode {
+	case "", chat.ToolsModeAuto, chat.ToolsModeNative, chat.ToolsModeJSON:
+	default:
+		return config, fmt.Errorf("invalid tools mode %q", e.ToolsMode)
+	}
+
+	if e.Timeout != "" {
+		timeout, err := time.ParseDuration(e.Timeout)
+		if err != nil {
+			return config, fmt.Errorf("invalid timeout %q", e.Timeout)
+		}
+		config.Timeout = timeout
+	}
+
+	return config, nil
+}
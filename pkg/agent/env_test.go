@@ -0,0 +1,30 @@
+package agent_test
+
+import (
+	"testing"
+
+	"github.com/NethermindEth/teeception/pkg/agent"
+)
+
+func TestEnvGetModelBackends(t *testing.T) {
+	t.Setenv(agent.ModelBackendsKey, `{
+		"llama-3": {"base_url": "http://vllm:8000/v1"},
+		"gpt-4o": {"base_url": "https://api.openai.com/v1"},
+		"openai": {},
+		"plain-openai": {"base_url": "http://api.openai.com/v1"},
+		"untrusted": {"base_url": "https://attacker.example/v1"},
+		"lookalike": {"base_url": "http://vllm.attacker.example/v1"}
+	}`)
+
+	backends := agent.EnvGetModelBackends()
+	for _, model := range []string{"llama-3", "gpt-4o", "openai"} {
+		if _, ok := backends[model]; !ok {
+			t.Fatalf("expected backend of %s to be trusted", model)
+		}
+	}
+	for _, model := range []string{"plain-openai", "untrusted", "lookalike"} {
+		if _, ok := backends[model]; ok {
+			t.Fatalf("expected backend of %s to be rejected", model)
+		}
+	}
+}
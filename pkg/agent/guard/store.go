@@ -0,0 +1,78 @@
+package guard
+
+import (
+	"sort"
+	"sync"
+)
+
+// Store persists the verdicts of guard models.
+type Store interface {
+	AddVerdict(verdict *Verdict) error
+	// GetVerdicts returns the latest verdicts, newest first.
+	GetVerdicts(limit int) ([]*Verdict, error)
+	// GetStats returns the statistics of the verdicts by registered model.
+	GetStats() ([]*Stats, error)
+}
+
+// StoreInMemory is an in-memory implementation of the Store interface.
+type StoreInMemory struct {
+	mu       sync.RWMutex
+	verdicts []*Verdict
+}
+
+var _ Store = (*StoreInMemory)(nil)
+
+// NewStoreInMemory creates a new StoreInMemory.
+func NewStoreInMemory() *StoreInMemory {
+	return &StoreInMemory{}
+}
+
+func (s *StoreInMemory) AddVerdict(verdict *Verdict) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	verdictCopy := *verdict
+	s.verdicts = append(s.verdicts, &verdictCopy)
+
+	return nil
+}
+
+func (s *StoreInMemory) GetVerdicts(limit int) ([]*Verdict, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	verdicts := make([]*Verdict, 0, min(limit, len(s.verdicts)))
+	for i := len(s.verdicts) - 1; i >= 0 && len(verdicts) < limit; i-- {
+		verdictCopy := *s.verdicts[i]
+		verdicts = append(verdicts, &verdictCopy)
+	}
+
+	return verdicts, nil
+}
+
+func (s *StoreInMemory) GetStats() ([]*Stats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	byModel := make(map[string]*Stats)
+	for _, verdict := range s.verdicts {
+		stats, ok := byModel[verdict.Model]
+		if !ok {
+			stats = &Stats{Model: verdict.Model}
+			byModel[verdict.Model] = stats
+		}
+		stats.add(verdict)
+	}
+
+	statsList := make([]*Stats, 0, len(byModel))
+	for _, stats := range byModel {
+		stats.updateDisagreementRate()
+		statsList = append(statsList, stats)
+	}
+
+	sort.Slice(statsList, func(i, j int) bool {
+		return statsList[i].Model < statsList[j].Model
+	})
+
+	return statsList, nil
+}
@@ -0,0 +1,152 @@
+package guard
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/NethermindEth/juno/core/felt"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// StoreSQLite is a SQLite implementation of the Store interface.
+type StoreSQLite struct {
+	db *sql.DB
+}
+
+var _ Store = (*StoreSQLite)(nil)
+
+// NewStoreSQLite creates a new SQLite-based Store.
+func NewStoreSQLite(dbPath string) (*StoreSQLite, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS guard_verdicts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			agent_addr TEXT NOT NULL,
+			prompt_id INTEGER NOT NULL DEFAULT 0,
+			model TEXT NOT NULL,
+			guard_model TEXT NOT NULL,
+			drain_to TEXT NOT NULL,
+			justified BOOLEAN NOT NULL,
+			reason TEXT NOT NULL,
+			error TEXT NOT NULL,
+			created_at INTEGER NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_guard_verdicts_model ON guard_verdicts(model);
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tables: %w", err)
+	}
+
+	if err := addPromptIDColumn(db); err != nil {
+		return nil, err
+	}
+
+	return &StoreSQLite{
+		db: db,
+	}, nil
+}
+
+// addPromptIDColumn adds the prompt_id column to databases created before
+// verdicts recorded their prompt.
+func addPromptIDColumn(db *sql.DB) error {
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('guard_verdicts') WHERE name = 'prompt_id'`).Scan(&count); err != nil {
+		return fmt.Errorf("failed to get guard_verdicts table info: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	if _, err := db.Exec(`ALTER TABLE guard_verdicts ADD COLUMN prompt_id INTEGER NOT NULL DEFAULT 0`); err != nil {
+		return fmt.Errorf("failed to add prompt_id column: %w", err)
+	}
+	return nil
+}
+
+func (s *StoreSQLite) AddVerdict(verdict *Verdict) error {
+	_, err := s.db.Exec(`
+		INSERT INTO guard_verdicts (agent_addr, prompt_id, model, guard_model, drain_to, justified, reason, error, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, verdict.AgentAddr.String(), verdict.PromptID, verdict.Model, verdict.GuardModel, verdict.DrainTo, verdict.Justified, verdict.Reason, verdict.Error, verdict.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to add verdict: %w", err)
+	}
+
+	return nil
+}
+
+func (s *StoreSQLite) GetVerdicts(limit int) ([]*Verdict, error) {
+	rows, err := s.db.Query(`
+		SELECT agent_addr, prompt_id, model, guard_model, drain_to, justified, reason, error, created_at
+		FROM guard_verdicts
+		ORDER BY id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query verdicts: %w", err)
+	}
+	defer rows.Close()
+
+	verdicts := make([]*Verdict, 0)
+	for rows.Next() {
+		var verdict Verdict
+		var agentAddrStr string
+		if err := rows.Scan(&agentAddrStr, &verdict.PromptID, &verdict.Model, &verdict.GuardModel, &verdict.DrainTo, &verdict.Justified, &verdict.Reason, &verdict.Error, &verdict.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		verdict.AgentAddr, err = new(felt.Felt).SetString(agentAddrStr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse agent address: %w", err)
+		}
+
+		verdicts = append(verdicts, &verdict)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return verdicts, nil
+}
+
+func (s *StoreSQLite) GetStats() ([]*Stats, error) {
+	rows, err := s.db.Query(`
+		SELECT
+			model,
+			COUNT(*),
+			COALESCE(SUM(CASE WHEN justified THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN NOT justified AND error = '' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN error != '' THEN 1 ELSE 0 END), 0)
+		FROM guard_verdicts
+		GROUP BY model
+		ORDER BY model
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stats: %w", err)
+	}
+	defer rows.Close()
+
+	statsList := make([]*Stats, 0)
+	for rows.Next() {
+		var stats Stats
+		if err := rows.Scan(&stats.Model, &stats.Judged, &stats.Confirmed, &stats.Vetoed, &stats.Errors); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		stats.updateDisagreementRate()
+		statsList = append(statsList, &stats)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return statsList, nil
+}
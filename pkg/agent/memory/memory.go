@@ -0,0 +1,141 @@
+package memory
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/tiktoken-go/tokenizer"
+
+	"github.com/NethermindEth/teeception/pkg/agent/chat"
+)
+
+// MemoryConfig is the configuration for a Memory.
+type MemoryConfig struct {
+	Store Store
+
+	// MaxTurns is the number of turns kept per user and agent.
+	MaxTurns int
+	// MaxTokens is the token budget of the history passed to the model.
+	MaxTokens int
+
+	// AllAgents enables memory for every agent.
+	AllAgents bool
+	// Models enables memory for agents registered with one of these models.
+	Models []string
+}
+
+// Memory keeps a bounded history of each user's earlier prompts to an agent
+// and the agent's replies, so that attacks can span several prompts.
+type Memory struct {
+	store     Store
+	tokenizer tokenizer.Codec
+
+	maxTurns  int
+	maxTokens int
+
+	allAgents bool
+	models    map[string]struct{}
+}
+
+// NewMemory creates a new Memory.
+func NewMemory(cfg *MemoryConfig) (*Memory, error) {
+	if cfg.Store == nil {
+		return nil, fmt.Errorf("memory store is required")
+	}
+	if cfg.MaxTurns <= 0 {
+		cfg.MaxTurns = 10
+	}
+	if cfg.MaxTokens <= 0 {
+		cfg.MaxTokens = 2000
+	}
+
+	tokenizer, err := tokenizer.Get(tokenizer.Cl100kBase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tokenizer: %v", err)
+	}
+
+	models := make(map[string]struct{}, len(cfg.Models))
+	for _, model := range cfg.Models {
+		models[model] = struct{}{}
+	}
+
+	return &Memory{
+		store:     cfg.Store,
+		tokenizer: tokenizer,
+		maxTurns:  cfg.MaxTurns,
+		maxTokens: cfg.MaxTokens,
+		allAgents: cfg.AllAgents,
+		models:    models,
+	}, nil
+}
+
+// IsEnabled reports whether memory is enabled for an agent with the given model.
+func (m *Memory) IsEnabled(model *felt.Felt) bool {
+	if m.allAgents {
+		return true
+	}
+	if model == nil {
+		return false
+	}
+
+	_, ok := m.models[feltToShortString(model)]
+	return ok
+}
+
+// History returns the earlier turns of a user with an agent as chat messages,
+// dropping the oldest turns that do not fit the token budget.
+func (m *Memory) History(agentAddr, userAddr *felt.Felt) ([]chat.ChatMessage, error) {
+	turns, err := m.store.GetTurns(agentAddr, userAddr, m.maxTurns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get turns: %v", err)
+	}
+
+	tokens := 0
+	first := len(turns)
+	for i := len(turns) - 1; i >= 0; i-- {
+		turnTokens := m.tokenCount(turns[i].Prompt) + m.tokenCount(turns[i].Response)
+		if tokens+turnTokens > m.maxTokens {
+			break
+		}
+		tokens += turnTokens
+		first = i
+	}
+
+	history := make([]chat.ChatMessage, 0, 2*(len(turns)-first))
+	for _, turn := range turns[first:] {
+		history = append(history, chat.ChatMessage{
+			Role:    chat.ChatMessageRoleUser,
+			Content: turn.Prompt,
+		}, chat.ChatMessage{
+			Role:    chat.ChatMessageRoleAssistant,
+			Content: turn.Response,
+		})
+	}
+
+	return history, nil
+}
+
+// Record stores a prompt and the agent's reply.
+func (m *Memory) Record(agentAddr, userAddr *felt.Felt, promptID uint64, prompt, response string) error {
+	return m.store.AddTurn(agentAddr, userAddr, &Turn{
+		PromptID:  promptID,
+		Prompt:    prompt,
+		Response:  response,
+		CreatedAt: time.Now().Unix(),
+	}, m.maxTurns)
+}
+
+func (m *Memory) tokenCount(text string) int {
+	ids, _, _ := m.tokenizer.Encode(text)
+	return len(ids)
+}
+
+func feltToShortString(f *felt.Felt) string {
+	b := f.Bytes()
+	start := 0
+	for start < len(b) && b[start] == 0 {
+		start++
+	}
+	return string(b[start:])
+}
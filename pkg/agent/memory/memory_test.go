@@ -0,0 +1,96 @@
+package memory_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/NethermindEth/juno/core/felt"
+
+	"github.com/NethermindEth/teeception/pkg/agent/chat"
+	"github.com/NethermindEth/teeception/pkg/agent/memory"
+)
+
+func TestMemoryIsEnabled(t *testing.T) {
+	m, err := memory.NewMemory(&memory.MemoryConfig{
+		Store:  memory.NewStoreInMemory(),
+		Models: []string{"gpt-4o"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create memory: %v", err)
+	}
+
+	if !m.IsEnabled(new(felt.Felt).SetBytes([]byte("gpt-4o"))) {
+		t.Fatalf("expected memory to be enabled for a listed model")
+	}
+	if m.IsEnabled(new(felt.Felt).SetBytes([]byte("gpt-4"))) || m.IsEnabled(nil) {
+		t.Fatalf("expected memory to be disabled for other models")
+	}
+}
+
+func TestMemoryHistory(t *testing.T) {
+	stores := map[string]func(t *testing.T) memory.Store{
+		"in memory": func(t *testing.T) memory.Store {
+			return memory.NewStoreInMemory()
+		},
+		"sqlite": func(t *testing.T) memory.Store {
+			store, err := memory.NewStoreSQLite(filepath.Join(t.TempDir(), "memory.db"))
+			if err != nil {
+				t.Fatalf("failed to create store: %v", err)
+			}
+			return store
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			m, err := memory.NewMemory(&memory.MemoryConfig{
+				Store:     newStore(t),
+				MaxTurns:  3,
+				MaxTokens: 100,
+				AllAgents: true,
+			})
+			if err != nil {
+				t.Fatalf("failed to create memory: %v", err)
+			}
+
+			agentAddr := new(felt.Felt).SetUint64(0xa)
+			user := new(felt.Felt).SetUint64(0xb)
+			other := new(felt.Felt).SetUint64(0xc)
+
+			for i := 0; i < 4; i++ {
+				if err := m.Record(agentAddr, user, uint64(i), fmt.Sprintf("prompt %d", i), fmt.Sprintf("reply %d", i)); err != nil {
+					t.Fatalf("failed to record turn: %v", err)
+				}
+			}
+
+			// Only the last turns are kept, oldest first.
+			history, err := m.History(agentAddr, user)
+			if err != nil {
+				t.Fatalf("failed to get history: %v", err)
+			}
+			if len(history) != 6 || history[0].Content != "prompt 1" || history[0].Role != chat.ChatMessageRoleUser ||
+				history[5].Content != "reply 3" || history[5].Role != chat.ChatMessageRoleAssistant {
+				t.Fatalf("unexpected history %+v", history)
+			}
+
+			// Conversations are per user.
+			if history, err := m.History(agentAddr, other); err != nil || len(history) != 0 {
+				t.Fatalf("expected no history for another user, got %+v: %v", history, err)
+			}
+
+			// Turns past the token budget are dropped, oldest first.
+			if err := m.Record(agentAddr, user, 4, strings.Repeat("long ", 95), "reply 4"); err != nil {
+				t.Fatalf("failed to record turn: %v", err)
+			}
+			history, err = m.History(agentAddr, user)
+			if err != nil {
+				t.Fatalf("failed to get history: %v", err)
+			}
+			if len(history) != 2 || history[1].Content != "reply 4" {
+				t.Fatalf("expected only the latest turn to fit, got %+v", history)
+			}
+		})
+	}
+}
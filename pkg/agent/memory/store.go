@@ -0,0 +1,71 @@
+package memory
+
+import (
+	"sync"
+
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+// Turn is a single prompt of a user together with the agent's reply.
+type Turn struct {
+	PromptID  uint64
+	Prompt    string
+	Response  string
+	CreatedAt int64
+}
+
+// Store persists conversation turns per agent and user.
+type Store interface {
+	// GetTurns returns the most recent turns of a user with an agent, oldest first.
+	GetTurns(agentAddr, userAddr *felt.Felt, limit int) ([]*Turn, error)
+	// AddTurn stores a new turn and drops turns past maxTurns for that user and agent.
+	AddTurn(agentAddr, userAddr *felt.Felt, turn *Turn, maxTurns int) error
+}
+
+type conversationKey struct {
+	agentAddr [32]byte
+	userAddr  [32]byte
+}
+
+// StoreInMemory is an in-memory implementation of the Store interface.
+type StoreInMemory struct {
+	mu            sync.RWMutex
+	conversations map[conversationKey][]*Turn
+}
+
+var _ Store = (*StoreInMemory)(nil)
+
+// NewStoreInMemory creates a new StoreInMemory.
+func NewStoreInMemory() *StoreInMemory {
+	return &StoreInMemory{
+		conversations: make(map[conversationKey][]*Turn),
+	}
+}
+
+func (s *StoreInMemory) GetTurns(agentAddr, userAddr *felt.Felt, limit int) ([]*Turn, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	turns := s.conversations[conversationKey{agentAddr.Bytes(), userAddr.Bytes()}]
+	if limit >= 0 && len(turns) > limit {
+		turns = turns[len(turns)-limit:]
+	}
+
+	result := make([]*Turn, len(turns))
+	copy(result, turns)
+	return result, nil
+}
+
+func (s *StoreInMemory) AddTurn(agentAddr, userAddr *felt.Felt, turn *Turn, maxTurns int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := conversationKey{agentAddr.Bytes(), userAddr.Bytes()}
+	turns := append(s.conversations[key], turn)
+	if maxTurns >= 0 && len(turns) > maxTurns {
+		turns = turns[len(turns)-maxTurns:]
+	}
+	s.conversations[key] = turns
+
+	return nil
+}
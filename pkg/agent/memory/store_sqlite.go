@@ -0,0 +1,119 @@
+package memory
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/NethermindEth/juno/core/felt"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// StoreSQLite is a SQLite implementation of the Store interface.
+type StoreSQLite struct {
+	db *sql.DB
+}
+
+var _ Store = (*StoreSQLite)(nil)
+
+// NewStoreSQLite creates a new SQLite-based Store.
+func NewStoreSQLite(dbPath string) (*StoreSQLite, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS turns (
+			agent_addr TEXT NOT NULL,
+			user_addr TEXT NOT NULL,
+			prompt_id INTEGER NOT NULL,
+			prompt TEXT NOT NULL,
+			response TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			PRIMARY KEY (agent_addr, prompt_id)
+		);
+
+		CREATE INDEX IF NOT EXISTS turns_conversation ON turns (agent_addr, user_addr, prompt_id);
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tables: %w", err)
+	}
+
+	return &StoreSQLite{
+		db: db,
+	}, nil
+}
+
+func (s *StoreSQLite) GetTurns(agentAddr, userAddr *felt.Felt, limit int) ([]*Turn, error) {
+	rows, err := s.db.Query(`
+		SELECT prompt_id, prompt, response, created_at
+		FROM turns
+		WHERE agent_addr = ? AND user_addr = ?
+		ORDER BY prompt_id DESC
+		LIMIT ?
+	`, agentAddr.String(), userAddr.String(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query turns: %w", err)
+	}
+	defer rows.Close()
+
+	turns := make([]*Turn, 0)
+	for rows.Next() {
+		var turn Turn
+		if err := rows.Scan(&turn.PromptID, &turn.Prompt, &turn.Response, &turn.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		turns = append(turns, &turn)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	// Rows are newest first, turns are returned oldest first.
+	for i, j := 0, len(turns)-1; i < j; i, j = i+1, j-1 {
+		turns[i], turns[j] = turns[j], turns[i]
+	}
+
+	return turns, nil
+}
+
+func (s *StoreSQLite) AddTurn(agentAddr, userAddr *felt.Felt, turn *Turn, maxTurns int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT OR REPLACE INTO turns (agent_addr, user_addr, prompt_id, prompt, response, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, agentAddr.String(), userAddr.String(), turn.PromptID, turn.Prompt, turn.Response, turn.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert turn: %w", err)
+	}
+
+	if maxTurns >= 0 {
+		_, err = tx.Exec(`
+			DELETE FROM turns
+			WHERE agent_addr = ? AND user_addr = ? AND prompt_id NOT IN (
+				SELECT prompt_id FROM turns
+				WHERE agent_addr = ? AND user_addr = ?
+				ORDER BY prompt_id DESC
+				LIMIT ?
+			)
+		`, agentAddr.String(), userAddr.String(), agentAddr.String(), userAddr.String(), maxTurns)
+		if err != nil {
+			return fmt.Errorf("failed to prune turns: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,330 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+
+	"github.com/NethermindEth/teeception/pkg/indexer"
+	"github.com/NethermindEth/teeception/pkg/twitter"
+	"github.com/NethermindEth/teeception/pkg/twitter/composer"
+)
+
+// mentionMaxAge is how long a mention may wait for an instruction reply.
+const mentionMaxAge = 2 * time.Hour
+
+var mentionTagRegex = regexp.MustCompile(`:([^:\s]+):`)
+
+// MentionWatcherConfig is the configuration for a MentionWatcher.
+type MentionWatcherConfig struct {
+	Poller       twitter.MentionPoller
+	Reply        func(ctx context.Context, tweetID uint64, reply string) error
+	AgentIndexer *indexer.AgentIndexer
+
+	// PollInterval is the time between mention polls.
+	PollInterval time.Duration
+	// GracePeriod is how long a mention may stay unpaid before instructions are sent.
+	GracePeriod time.Duration
+	// ReplyInterval is the minimum time between two instruction replies.
+	ReplyInterval time.Duration
+	// UserCooldown is the minimum time between two instruction replies to the same user.
+	UserCooldown time.Duration
+	// PaymentUrl links to the payment page of an agent, "{agent}" is replaced by its address.
+	PaymentUrl string
+	// Now returns the current time, it defaults to time.Now.
+	Now func() time.Time
+}
+
+// MentionFunnel counts mentions at each step from tweeting to paying.
+type MentionFunnel struct {
+	Seen           uint64 `json:"seen"`
+	Tagged         uint64 `json:"tagged"`
+	PaidUnprompted uint64 `json:"paid_unprompted"`
+	Replied        uint64 `json:"replied"`
+	RateLimited    uint64 `json:"rate_limited"`
+	PaidAfterReply uint64 `json:"paid_after_reply"`
+	Pending        int    `json:"pending"`
+	LastSeenID     uint64 `json:"last_seen_id"`
+}
+
+type pendingMention struct {
+	mention   twitter.Tweet
+	agent     *indexer.AgentInfo
+	seenAt    time.Time
+	replied   bool
+	repliedAt time.Time
+}
+
+// MentionWatcher polls mentions of the agent account, matches them to paid
+// prompts by tweet ID and replies with payment instructions to mentions that
+// were not paid for within the grace period.
+type MentionWatcher struct {
+	poller       twitter.MentionPoller
+	reply        func(ctx context.Context, tweetID uint64, reply string) error
+	agentIndexer *indexer.AgentIndexer
+
+	pollInterval  time.Duration
+	gracePeriod   time.Duration
+	replyInterval time.Duration
+	userCooldown  time.Duration
+	paymentUrl    string
+	now           func() time.Time
+
+	mu          sync.Mutex
+	initialized bool
+	lastSeenID  uint64
+	paid        map[uint64]time.Time
+	pending     map[uint64]*pendingMention
+	lastReply   time.Time
+	userReplies map[string]time.Time
+	funnel      MentionFunnel
+}
+
+// NewMentionWatcher creates a new MentionWatcher with sensible defaults if none are provided.
+func NewMentionWatcher(cfg *MentionWatcherConfig) *MentionWatcher {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Minute
+	}
+	if cfg.GracePeriod <= 0 {
+		cfg.GracePeriod = 10 * time.Minute
+	}
+	if cfg.ReplyInterval <= 0 {
+		cfg.ReplyInterval = time.Minute
+	}
+	if cfg.UserCooldown <= 0 {
+		cfg.UserCooldown = 24 * time.Hour
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+
+	return &MentionWatcher{
+		poller:        cfg.Poller,
+		reply:         cfg.Reply,
+		agentIndexer:  cfg.AgentIndexer,
+		pollInterval:  cfg.PollInterval,
+		gracePeriod:   cfg.GracePeriod,
+		replyInterval: cfg.ReplyInterval,
+		userCooldown:  cfg.UserCooldown,
+		paymentUrl:    cfg.PaymentUrl,
+		now:           cfg.Now,
+		paid:          make(map[uint64]time.Time),
+		pending:       make(map[uint64]*pendingMention),
+		userReplies:   make(map[string]time.Time),
+	}
+}
+
+// Run polls mentions until the context is cancelled.
+func (w *MentionWatcher) Run(ctx context.Context) error {
+	for {
+		if err := w.Poll(ctx); err != nil {
+			slog.Warn("failed to poll mentions", "error", err)
+		}
+
+		w.ProcessPending(ctx, w.now())
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(w.pollInterval):
+		}
+	}
+}
+
+// MarkPaid records that a prompt was paid for the given tweet.
+func (w *MentionWatcher) MarkPaid(tweetID uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.paid[tweetID] = w.now()
+
+	pending, ok := w.pending[tweetID]
+	if !ok {
+		return
+	}
+
+	if pending.replied {
+		w.funnel.PaidAfterReply++
+	} else {
+		w.funnel.PaidUnprompted++
+	}
+	delete(w.pending, tweetID)
+}
+
+// Poll fetches the mentions since the last seen one. The first poll only
+// moves the cursor so that mentions from before startup are not answered.
+func (w *MentionWatcher) Poll(ctx context.Context) error {
+	w.mu.Lock()
+	sinceID := w.lastSeenID
+	initialized := w.initialized
+	w.mu.Unlock()
+
+	mentions, err := w.poller.GetMentions(ctx, sinceID)
+	if err != nil {
+		return err
+	}
+
+	now := w.now()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.initialized = true
+
+	for _, mention := range mentions {
+		if mention.ID <= w.lastSeenID {
+			continue
+		}
+		w.lastSeenID = mention.ID
+
+		if !initialized {
+			continue
+		}
+
+		w.funnel.Seen++
+
+		agentInfo, ok := w.findTaggedAgent(mention.Text)
+		if !ok {
+			continue
+		}
+
+		w.funnel.Tagged++
+
+		if _, ok := w.paid[mention.ID]; ok {
+			w.funnel.PaidUnprompted++
+			delete(w.paid, mention.ID)
+			continue
+		}
+
+		w.pending[mention.ID] = &pendingMention{
+			mention: mention,
+			agent:   agentInfo,
+			seenAt:  now,
+		}
+	}
+
+	return nil
+}
+
+// ProcessPending replies to the oldest pending mention whose grace period is
+// over, if the reply rate limit allows it. Mentions that wait for longer than
+// mentionMaxAge or whose author was answered recently are dropped, as are
+// payments older than mentionMaxAge whose mention was never seen.
+func (w *MentionWatcher) ProcessPending(ctx context.Context, now time.Time) {
+	w.mu.Lock()
+
+	for tweetID, paidAt := range w.paid {
+		if now.Sub(paidAt) > mentionMaxAge {
+			delete(w.paid, tweetID)
+		}
+	}
+
+	var next *pendingMention
+	for tweetID, pending := range w.pending {
+		if pending.replied {
+			// Replied mentions are kept for a while to count late payments.
+			if now.Sub(pending.repliedAt) > w.userCooldown {
+				delete(w.pending, tweetID)
+			}
+			continue
+		}
+
+		if now.Sub(pending.seenAt) < w.gracePeriod {
+			continue
+		}
+
+		if now.Sub(pending.seenAt) > mentionMaxAge || now.Sub(w.userReplies[pending.mention.AuthorID]) < w.userCooldown {
+			w.funnel.RateLimited++
+			delete(w.pending, tweetID)
+			continue
+		}
+
+		if next == nil || pending.mention.ID < next.mention.ID {
+			next = pending
+		}
+	}
+
+	if next == nil || now.Sub(w.lastReply) < w.replyInterval {
+		w.mu.Unlock()
+		return
+	}
+
+	next.replied = true
+	next.repliedAt = now
+	w.lastReply = now
+	w.userReplies[next.mention.AuthorID] = now
+	w.mu.Unlock()
+
+	tweetID := next.mention.ID
+	if err := w.reply(ctx, tweetID, w.instructions(next.agent)); err != nil {
+		slog.Warn("failed to reply with payment instructions", "tweet_id", tweetID, "error", err)
+
+		w.mu.Lock()
+		delete(w.pending, tweetID)
+		w.mu.Unlock()
+		return
+	}
+
+	slog.Info("replied with payment instructions", "tweet_id", tweetID, "agent_address", next.agent.Address, "author", next.mention.AuthorUsername)
+
+	w.mu.Lock()
+	w.funnel.Replied++
+	w.mu.Unlock()
+}
+
+// Funnel returns the mention counters.
+func (w *MentionWatcher) Funnel() MentionFunnel {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	funnel := w.funnel
+	funnel.LastSeenID = w.lastSeenID
+	for _, pending := range w.pending {
+		if !pending.replied {
+			funnel.Pending++
+		}
+	}
+
+	return funnel
+}
+
+func (w *MentionWatcher) instructions(agentInfo *indexer.AgentInfo) string {
+	text := "To challenge this agent, pay for your prompt on-chain using the ID of this tweet."
+	if w.paymentUrl != "" {
+		text = fmt.Sprintf("To challenge this agent, pay for your prompt using the ID of this tweet at %s", strings.ReplaceAll(w.paymentUrl, "{agent}", agentInfo.Address.String()))
+	}
+
+	return composer.Tagged(agentInfo.Name, text)
+}
+
+// findTaggedAgent returns the first active agent tagged in text.
+func (w *MentionWatcher) findTaggedAgent(text string) (*indexer.AgentInfo, bool) {
+	tags := mentionTagRegex.FindAllStringSubmatch(text, -1)
+	if len(tags) == 0 {
+		return nil, false
+	}
+
+	var addresses [][32]byte
+	w.agentIndexer.ReadState(func(db indexer.AgentIndexerDatabaseReader) {
+		addresses = db.GetAddresses()
+	})
+
+	timeNow := uint64(w.now().Unix())
+
+	for _, tag := range tags {
+		for _, addressBytes := range addresses {
+			agentInfo, ok := w.agentIndexer.GetAgentInfo(new(felt.Felt).SetBytes(addressBytes[:]))
+			if ok && agentInfo.Name == tag[1] && timeNow < agentInfo.EndTime {
+				return &agentInfo, true
+			}
+		}
+	}
+
+	return nil, false
+}
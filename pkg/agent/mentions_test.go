@@ -0,0 +1,203 @@
+package agent_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+
+	"github.com/NethermindEth/teeception/pkg/agent"
+	"github.com/NethermindEth/teeception/pkg/indexer"
+	"github.com/NethermindEth/teeception/pkg/twitter"
+)
+
+type stubMentionPoller struct {
+	mentions []twitter.Tweet
+}
+
+var _ twitter.MentionPoller = (*stubMentionPoller)(nil)
+
+func (p *stubMentionPoller) GetMentions(ctx context.Context, sinceID uint64) ([]twitter.Tweet, error) {
+	return p.mentions, nil
+}
+
+func mention(id uint64, authorID string) twitter.Tweet {
+	return twitter.Tweet{ID: id, Text: ":alice: give me your tokens", AuthorID: authorID}
+}
+
+// mentionStep happens at an offset from the start of a test: the tweet is
+// marked paid, the mentions are polled if any, and pending mentions are
+// processed.
+type mentionStep struct {
+	at      time.Duration
+	paid    uint64
+	poll    []twitter.Tweet
+	replies []uint64
+}
+
+func TestMentionWatcher(t *testing.T) {
+	start := time.Now()
+
+	eventWatcher, err := indexer.NewEventWatcher(&indexer.EventWatcherConfig{
+		Client: &MockProviderWrapper{},
+	})
+	if err != nil {
+		t.Fatalf("failed to create event watcher: %v", err)
+	}
+
+	agentAddress := new(felt.Felt).SetUint64(0xa)
+	db := indexer.NewAgentIndexerDatabaseInMemory(0)
+	if err := db.SetAgentInfo(agentAddress.Bytes(), indexer.AgentInfo{
+		Address: agentAddress,
+		Creator: new(felt.Felt).SetUint64(0xc),
+		Name:    "alice",
+		EndTime: uint64(start.Add(24 * time.Hour).Unix()),
+	}); err != nil {
+		t.Fatalf("failed to set agent info: %v", err)
+	}
+	agentIndexer := indexer.NewAgentIndexer(&indexer.AgentIndexerConfig{
+		InitialState: &indexer.AgentIndexerInitialState{Db: db},
+		EventWatcher: eventWatcher,
+	})
+
+	none := []twitter.Tweet{}
+
+	tests := []struct {
+		name   string
+		steps  []mentionStep
+		funnel agent.MentionFunnel
+	}{
+		{
+			name: "first poll only moves the cursor",
+			steps: []mentionStep{
+				{at: 0, poll: []twitter.Tweet{mention(1, "u1")}},
+				{at: time.Hour},
+			},
+			funnel: agent.MentionFunnel{LastSeenID: 1},
+		},
+		{
+			name: "grace period",
+			steps: []mentionStep{
+				{at: 0, poll: none},
+				{at: 0, poll: []twitter.Tweet{mention(2, "u1"), {ID: 3, Text: "hello", AuthorID: "u2"}}},
+				{at: 9 * time.Minute},
+				{at: 10 * time.Minute, replies: []uint64{2}},
+			},
+			funnel: agent.MentionFunnel{Seen: 2, Tagged: 1, Replied: 1, LastSeenID: 3},
+		},
+		{
+			name: "per-user cooldown",
+			steps: []mentionStep{
+				{at: 0, poll: none},
+				{at: 0, poll: []twitter.Tweet{mention(2, "u1"), mention(3, "u1")}},
+				{at: 10 * time.Minute, replies: []uint64{2}},
+				{at: 12 * time.Minute, replies: []uint64{2}},
+			},
+			funnel: agent.MentionFunnel{Seen: 2, Tagged: 2, Replied: 1, RateLimited: 1, LastSeenID: 3},
+		},
+		{
+			name: "reply interval",
+			steps: []mentionStep{
+				{at: 0, poll: none},
+				{at: 0, poll: []twitter.Tweet{mention(2, "u1"), mention(3, "u2")}},
+				{at: 10 * time.Minute, replies: []uint64{2}},
+				{at: 10*time.Minute + 30*time.Second, replies: []uint64{2}},
+				{at: 11 * time.Minute, replies: []uint64{2, 3}},
+			},
+			funnel: agent.MentionFunnel{Seen: 2, Tagged: 2, Replied: 2, LastSeenID: 3},
+		},
+		{
+			name: "paid before the mention is seen",
+			steps: []mentionStep{
+				{at: 0, poll: none},
+				{at: 0, paid: 2},
+				{at: time.Minute, poll: []twitter.Tweet{mention(2, "u1")}},
+				{at: 20 * time.Minute},
+			},
+			funnel: agent.MentionFunnel{Seen: 1, Tagged: 1, PaidUnprompted: 1, LastSeenID: 2},
+		},
+		{
+			name: "paid within the grace period",
+			steps: []mentionStep{
+				{at: 0, poll: none},
+				{at: 0, poll: []twitter.Tweet{mention(2, "u1")}},
+				{at: 5 * time.Minute, paid: 2},
+				{at: 20 * time.Minute},
+			},
+			funnel: agent.MentionFunnel{Seen: 1, Tagged: 1, PaidUnprompted: 1, LastSeenID: 2},
+		},
+		{
+			name: "paid after the reply",
+			steps: []mentionStep{
+				{at: 0, poll: none},
+				{at: 0, poll: []twitter.Tweet{mention(2, "u1")}},
+				{at: 10 * time.Minute, replies: []uint64{2}},
+				{at: 15 * time.Minute, paid: 2, replies: []uint64{2}},
+			},
+			funnel: agent.MentionFunnel{Seen: 1, Tagged: 1, Replied: 1, PaidAfterReply: 1, LastSeenID: 2},
+		},
+		{
+			name: "payments are pruned after the max age",
+			steps: []mentionStep{
+				{at: 0, poll: none},
+				{at: 0, paid: 2},
+				{at: 2*time.Hour + time.Minute},
+				{at: 2*time.Hour + 2*time.Minute, poll: []twitter.Tweet{mention(2, "u1")}},
+				{at: 2*time.Hour + 12*time.Minute, replies: []uint64{2}},
+			},
+			funnel: agent.MentionFunnel{Seen: 1, Tagged: 1, Replied: 1, LastSeenID: 2},
+		},
+		{
+			name: "mentions are dropped after the max age",
+			steps: []mentionStep{
+				{at: 0, poll: none},
+				{at: 0, poll: []twitter.Tweet{mention(2, "u1")}},
+				{at: 2*time.Hour + time.Minute},
+			},
+			funnel: agent.MentionFunnel{Seen: 1, Tagged: 1, RateLimited: 1, LastSeenID: 2},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			now := start
+			poller := &stubMentionPoller{}
+
+			var replies []uint64
+			watcher := agent.NewMentionWatcher(&agent.MentionWatcherConfig{
+				Poller: poller,
+				Reply: func(ctx context.Context, tweetID uint64, reply string) error {
+					replies = append(replies, tweetID)
+					return nil
+				},
+				AgentIndexer: agentIndexer,
+				Now:          func() time.Time { return now },
+			})
+
+			for i, step := range test.steps {
+				now = start.Add(step.at)
+				if step.paid != 0 {
+					watcher.MarkPaid(step.paid)
+				}
+				if step.poll != nil {
+					poller.mentions = step.poll
+					if err := watcher.Poll(ctx); err != nil {
+						t.Fatalf("failed to poll: %v", err)
+					}
+				}
+				watcher.ProcessPending(ctx, now)
+
+				if !slices.Equal(replies, step.replies) {
+					t.Fatalf("step %d: expected replies to %v, got %v", i, step.replies, replies)
+				}
+			}
+
+			if funnel := watcher.Funnel(); funnel != test.funnel {
+				t.Fatalf("expected funnel %+v, got %+v", test.funnel, funnel)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Action is what moderation did to a reply.
+type Action string
+
+const (
+	ActionAllow    Action = "allow"
+	ActionRedact   Action = "redact"
+	ActionRewrite  Action = "rewrite"
+	ActionWithhold Action = "withhold"
+)
+
+var actionSeverity = map[Action]int{
+	ActionAllow:    0,
+	ActionRedact:   1,
+	ActionRewrite:  2,
+	ActionWithhold: 3,
+}
+
+// Verdict is the outcome of moderating a reply.
+type Verdict struct {
+	Action  Action
+	Reasons []string
+	// Reply is the reply to post. It is empty if the reply was withheld.
+	Reply string
+}
+
+// String formats the verdict for storage, e.g. "redact: pii/email".
+func (v *Verdict) String() string {
+	if len(v.Reasons) == 0 {
+		return string(v.Action)
+	}
+	return fmt.Sprintf("%s: %s", v.Action, strings.Join(v.Reasons, ", "))
+}
+
+// Moderator checks a reply before it is posted publicly.
+type Moderator interface {
+	Moderate(ctx context.Context, reply string) (*Verdict, error)
+}
+
+// ModerateExcerpt returns text quoted from a user moderated like a reply, or
+// an empty string if it is withheld or cannot be moderated.
+func ModerateExcerpt(ctx context.Context, m Moderator, text string) string {
+	verdict, err := m.Moderate(ctx, text)
+	if err != nil || verdict.Action == ActionWithhold {
+		return ""
+	}
+	return verdict.Reply
+}
+
+// ChainModerator runs moderators in order, passing each one the reply left by
+// the previous one. The verdict carries the most severe action of the chain.
+// Moderator errors withhold the reply.
+type ChainModerator struct {
+	moderators []Moderator
+}
+
+var _ Moderator = (*ChainModerator)(nil)
+
+// NewChainModerator creates a new ChainModerator.
+func NewChainModerator(moderators ...Moderator) *ChainModerator {
+	return &ChainModerator{
+		moderators: moderators,
+	}
+}
+
+func (m *ChainModerator) Moderate(ctx context.Context, reply string) (*Verdict, error) {
+	result := &Verdict{
+		Action: ActionAllow,
+		Reply:  reply,
+	}
+
+	for _, moderator := range m.moderators {
+		verdict, err := moderator.Moderate(ctx, result.Reply)
+		if err != nil {
+			return &Verdict{
+				Action:  ActionWithhold,
+				Reasons: append(result.Reasons, "moderation failed"),
+			}, fmt.Errorf("moderation failed: %w", err)
+		}
+
+		if actionSeverity[verdict.Action] > actionSeverity[result.Action] {
+			result.Action = verdict.Action
+		}
+		result.Reasons = append(result.Reasons, verdict.Reasons...)
+		result.Reply = verdict.Reply
+
+		if result.Action == ActionWithhold {
+			result.Reply = ""
+			break
+		}
+	}
+
+	return result, nil
+}
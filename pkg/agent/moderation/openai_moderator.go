@@ -0,0 +1,151 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// OpenAIModeratorConfig is the configuration for an OpenAIModerator.
+type OpenAIModeratorConfig struct {
+	Client *openai.Client
+	// RewriteModel is the chat model used to rewrite mildly flagged replies.
+	// Flagged replies are withheld if it is empty.
+	RewriteModel string
+}
+
+// OpenAIModerator classifies replies with the OpenAI moderation endpoint.
+// Severe categories are withheld, milder ones are rewritten if possible.
+type OpenAIModerator struct {
+	client       *openai.Client
+	rewriteModel string
+}
+
+var _ Moderator = (*OpenAIModerator)(nil)
+
+// NewOpenAIModerator creates a new OpenAIModerator.
+func NewOpenAIModerator(cfg *OpenAIModeratorConfig) *OpenAIModerator {
+	return &OpenAIModerator{
+		client:       cfg.Client,
+		rewriteModel: cfg.RewriteModel,
+	}
+}
+
+func (m *OpenAIModerator) Moderate(ctx context.Context, reply string) (*Verdict, error) {
+	flagged, severe, categories, err := m.classify(ctx, reply)
+	if err != nil {
+		return nil, err
+	}
+
+	if !flagged {
+		return &Verdict{
+			Action: ActionAllow,
+			Reply:  reply,
+		}, nil
+	}
+
+	if severe || m.rewriteModel == "" {
+		return &Verdict{
+			Action:  ActionWithhold,
+			Reasons: categories,
+		}, nil
+	}
+
+	rewritten, err := m.rewrite(ctx, reply)
+	if err != nil {
+		return nil, err
+	}
+
+	flagged, _, _, err = m.classify(ctx, rewritten)
+	if err != nil {
+		return nil, err
+	}
+	if flagged || rewritten == "" {
+		return &Verdict{
+			Action:  ActionWithhold,
+			Reasons: categories,
+		}, nil
+	}
+
+	return &Verdict{
+		Action:  ActionRewrite,
+		Reasons: categories,
+		Reply:   rewritten,
+	}, nil
+}
+
+func (m *OpenAIModerator) classify(ctx context.Context, text string) (bool, bool, []string, error) {
+	resp, err := m.client.Moderations(ctx, openai.ModerationRequest{
+		Input: text,
+		Model: openai.ModerationOmniLatest,
+	})
+	if err != nil {
+		return false, false, nil, fmt.Errorf("moderation request failed: %v", err)
+	}
+
+	if len(resp.Results) == 0 {
+		return false, false, nil, fmt.Errorf("no moderation result received")
+	}
+
+	result := resp.Results[0]
+	if !result.Flagged {
+		return false, false, nil, nil
+	}
+
+	c := result.Categories
+	severe := c.HateThreatening || c.HarassmentThreatening || c.SelfHarm || c.SelfHarmIntent ||
+		c.SelfHarmInstructions || c.SexualMinors || c.ViolenceGraphic
+
+	var categories []string
+	for _, category := range []struct {
+		name    string
+		flagged bool
+	}{
+		{"hate", c.Hate},
+		{"hate/threatening", c.HateThreatening},
+		{"harassment", c.Harassment},
+		{"harassment/threatening", c.HarassmentThreatening},
+		{"self-harm", c.SelfHarm},
+		{"self-harm/intent", c.SelfHarmIntent},
+		{"self-harm/instructions", c.SelfHarmInstructions},
+		{"sexual", c.Sexual},
+		{"sexual/minors", c.SexualMinors},
+		{"violence", c.Violence},
+		{"violence/graphic", c.ViolenceGraphic},
+	} {
+		if category.flagged {
+			categories = append(categories, category.name)
+		}
+	}
+
+	return true, severe, categories, nil
+}
+
+func (m *OpenAIModerator) rewrite(ctx context.Context, reply string) (string, error) {
+	resp, err := m.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: m.rewriteModel,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role: openai.ChatMessageRoleSystem,
+				Content: "You are a content moderator for a public social media account. Rewrite the user's text " +
+					"so it keeps its meaning and tone but contains no offensive, hateful, sexual or violent content. " +
+					"Respond with the rewritten text only.",
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: reply,
+			},
+		},
+		Temperature: 0.0,
+	})
+	if err != nil {
+		return "", fmt.Errorf("reply rewrite failed: %v", err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no response received for reply rewrite")
+	}
+
+	return resp.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,134 @@
+package moderation
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+const redactedText = "[redacted]"
+
+var (
+	emailPattern      = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	phonePattern      = regexp.MustCompile(`(?:\+|\b)\d{1,3}[\s.\-]?\(?\d{3}\)?[\s.\-]?\d{3}[\s.\-]?\d{4}\b`)
+	cardNumberPattern = regexp.MustCompile(`\b\d(?:[ \-]?\d){12,15}\b`)
+	apiKeyPattern     = regexp.MustCompile(`\b(?:sk-[A-Za-z0-9_\-]{20,}|sk-ant-[A-Za-z0-9_\-]{20,}|AKIA[0-9A-Z]{16})\b`)
+)
+
+// RuleModeratorConfig is the configuration for a RuleModerator.
+type RuleModeratorConfig struct {
+	// Secrets are exact strings that must never be posted, e.g. credentials of the agent.
+	Secrets []string
+	// BlockedWords withhold a reply when any of them appears in it, case-insensitively.
+	BlockedWords []string
+}
+
+// RuleModerator is a local rule set that redacts PII and secrets and withholds
+// replies containing blocked words.
+type RuleModerator struct {
+	secrets      []string
+	blockedWords []*regexp.Regexp
+}
+
+var _ Moderator = (*RuleModerator)(nil)
+
+// NewRuleModerator creates a new RuleModerator.
+func NewRuleModerator(cfg *RuleModeratorConfig) *RuleModerator {
+	secrets := make([]string, 0, len(cfg.Secrets))
+	for _, secret := range cfg.Secrets {
+		// Short strings would redact ordinary words.
+		if len(secret) >= 6 {
+			secrets = append(secrets, secret)
+		}
+	}
+
+	blockedWords := make([]*regexp.Regexp, 0, len(cfg.BlockedWords))
+	for _, word := range cfg.BlockedWords {
+		word = strings.TrimSpace(word)
+		if word == "" {
+			continue
+		}
+		blockedWords = append(blockedWords, regexp.MustCompile(`(?i)\b`+regexp.QuoteMeta(word)+`\b`))
+	}
+
+	return &RuleModerator{
+		secrets:      secrets,
+		blockedWords: blockedWords,
+	}
+}
+
+func (m *RuleModerator) Moderate(ctx context.Context, reply string) (*Verdict, error) {
+	for _, word := range m.blockedWords {
+		if word.MatchString(reply) {
+			return &Verdict{
+				Action:  ActionWithhold,
+				Reasons: []string{"blocked word"},
+			}, nil
+		}
+	}
+
+	verdict := &Verdict{
+		Action: ActionAllow,
+		Reply:  reply,
+	}
+
+	redact := func(reason string, found bool) {
+		if found {
+			verdict.Action = ActionRedact
+			verdict.Reasons = append(verdict.Reasons, reason)
+		}
+	}
+
+	for _, secret := range m.secrets {
+		if strings.Contains(verdict.Reply, secret) {
+			verdict.Reply = strings.ReplaceAll(verdict.Reply, secret, redactedText)
+			redact("secret", true)
+		}
+	}
+
+	for _, rule := range []struct {
+		reason  string
+		pattern *regexp.Regexp
+		valid   func(match string) bool
+	}{
+		{"secret/api_key", apiKeyPattern, nil},
+		{"pii/email", emailPattern, nil},
+		{"pii/card_number", cardNumberPattern, isLuhnValid},
+		{"pii/phone", phonePattern, nil},
+	} {
+		found := false
+		verdict.Reply = rule.pattern.ReplaceAllStringFunc(verdict.Reply, func(match string) string {
+			if rule.valid != nil && !rule.valid(match) {
+				return match
+			}
+			found = true
+			return redactedText
+		})
+		redact(rule.reason, found)
+	}
+
+	return verdict, nil
+}
+
+// isLuhnValid reports whether the digits of s pass the Luhn checksum used by
+// card numbers, so that amounts and other long numbers are not redacted.
+func isLuhnValid(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || s[i] > '9' {
+			continue
+		}
+
+		digit := int(s[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+
+	return sum%10 == 0
+}
@@ -3,6 +3,7 @@ package quote
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 
@@ -15,15 +16,24 @@ type ReportData struct {
 	Address         *felt.Felt
 	ContractAddress *felt.Felt
 	TwitterUsername string
+
+	// MigrationKey is the public key a new instance receives migrated
+	// sealed state with. It is only set on migration quotes.
+	MigrationKey []byte
 }
 
 // MarshalJSON marshals the ReportData to JSON.
 func (r *ReportData) MarshalJSON() ([]byte, error) {
-	return json.Marshal(map[string]string{
+	data := map[string]string{
 		"address":         r.Address.String(),
 		"contract":        r.ContractAddress.String(),
 		"twitterUsername": r.TwitterUsername,
-	})
+	}
+	if len(r.MigrationKey) > 0 {
+		data["migrationKey"] = hex.EncodeToString(r.MigrationKey)
+	}
+
+	return json.Marshal(data)
 }
 
 // MarshalBinary marshals the ReportData to binary.
@@ -42,6 +52,12 @@ func (r *ReportData) MarshalBinary() ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to write twitter username: %w", err)
 	}
+	if len(r.MigrationKey) > 0 {
+		err = binary.Write(writer, binary.BigEndian, r.MigrationKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write migration key: %w", err)
+		}
+	}
 
 	return writer.Bytes(), nil
 }
@@ -0,0 +1,106 @@
+package quote
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/edgelesssys/go-tdx-qpl/verification/crypto"
+	"github.com/edgelesssys/go-tdx-qpl/verification/types"
+)
+
+// intelRootCA is the PEM encoded Intel SGX/TDX Root CA certificate, as pinned
+// by github.com/edgelesssys/go-tdx-qpl/verification/pcs.
+const intelRootCA = "-----BEGIN CERTIFICATE-----\nMIICjzCCAjSgAwIBAgIUImUM1lqdNInzg7SVUr9QGzknBqwwCgYIKoZIzj0EAwIw\naDEaMBgGA1UEAwwRSW50ZWwgU0dYIFJvb3QgQ0ExGjAYBgNVBAoMEUludGVsIENv\ncnBvcmF0aW9uMRQwEgYDVQQHDAtTYW50YSBDbGFyYTELMAkGA1UECAwCQ0ExCzAJ\nBgNVBAYTAlVTMB4XDTE4MDUyMTEwNDUxMFoXDTQ5MTIzMTIzNTk1OVowaDEaMBgG\nA1UEAwwRSW50ZWwgU0dYIFJvb3QgQ0ExGjAYBgNVBAoMEUludGVsIENvcnBvcmF0\naW9uMRQwEgYDVQQHDAtTYW50YSBDbGFyYTELMAkGA1UECAwCQ0ExCzAJBgNVBAYT\nAlVTMFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAEC6nEwMDIYZOj/iPWsCzaEKi7\n1OiOSLRFhWGjbnBVJfVnkY4u3IjkDYYL0MxO4mqsyYjlBalTVYxFP2sJBK5zlKOB\nuzCBuDAfBgNVHSMEGDAWgBQiZQzWWp00ifODtJVSv1AbOScGrDBSBgNVHR8ESzBJ\nMEegRaBDhkFodHRwczovL2NlcnRpZmljYXRlcy50cnVzdGVkc2VydmljZXMuaW50\nZWwuY29tL0ludGVsU0dYUm9vdENBLmRlcjAdBgNVHQ4EFgQUImUM1lqdNInzg7SV\nUr9QGzknBqwwDgYDVR0PAQH/BAQDAgEGMBIGA1UdEwEB/wQIMAYBAf8CAQEwCgYI\nKoZIzj0EAwIDSQAwRgIhAOW/5QkR+S9CiSDcNoowLuPRLsWGf/Yi7GSX94BgwTwg\nAiEA4J0lrHoMs+Xo5o/sX6O9QWxHRAvZUGOdRQ7cvqRXaqI=\n-----END CERTIFICATE-----\n"
+
+// Verifier is an interface for verifying a quote produced by a Quoter.
+type Verifier interface {
+	Verify(ctx context.Context, rawQuote []byte) (types.SGXQuote4, error)
+}
+
+// TDXVerifier verifies TDX quotes offline against the pinned Intel Root CA.
+//
+// It checks the PCK certificate chain, the QE report signature and binding,
+// and the quote signature. It does not fetch collateral from Intel's PCS, so
+// CRLs and TCB levels are not checked.
+type TDXVerifier struct {
+	roots *x509.CertPool
+}
+
+var _ Verifier = (*TDXVerifier)(nil)
+
+// NewTDXVerifier creates a new TDXVerifier.
+func NewTDXVerifier() *TDXVerifier {
+	roots := x509.NewCertPool()
+	roots.AddCert(crypto.MustParsePEMCertificate([]byte(intelRootCA)))
+
+	return &TDXVerifier{
+		roots: roots,
+	}
+}
+
+// Verify parses the raw quote and verifies its signature chain.
+func (v *TDXVerifier) Verify(ctx context.Context, rawQuote []byte) (types.SGXQuote4, error) {
+	quote, err := types.ParseQuote(rawQuote)
+	if err != nil {
+		return types.SGXQuote4{}, fmt.Errorf("failed to parse quote: %w", err)
+	}
+
+	if quote.Header.TEEType != types.TEETypeTDX {
+		return types.SGXQuote4{}, fmt.Errorf("not a TDX quote: tee type %x", quote.Header.TEEType)
+	}
+
+	qeReport, ok := quote.Signature.CertificationData.Data.(types.QEReportCertificationData)
+	if !ok {
+		return types.SGXQuote4{}, errors.New("invalid QE report certification data in quote")
+	}
+
+	certChainPEM, ok := qeReport.CertificationData.Data.([]byte)
+	if !ok {
+		return types.SGXQuote4{}, errors.New("invalid PCK certification data in quote")
+	}
+
+	certChain, err := crypto.ParsePEMCertificateChain(certChainPEM)
+	if err != nil {
+		return types.SGXQuote4{}, fmt.Errorf("failed to parse PCK certificate chain: %w", err)
+	}
+	if len(certChain) != 3 {
+		return types.SGXQuote4{}, fmt.Errorf("invalid PCK certificate chain length: got %d, want 3", len(certChain))
+	}
+
+	pckCert := certChain[0]
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(certChain[1])
+
+	if _, err := pckCert.Verify(x509.VerifyOptions{
+		Roots:         v.roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return types.SGXQuote4{}, fmt.Errorf("failed to verify PCK certificate chain: %w", err)
+	}
+
+	enclaveReport := qeReport.EnclaveReport.Marshal()
+	if err := crypto.VerifyECDSASignature(pckCert.PublicKey, enclaveReport[:], qeReport.Signature[:]); err != nil {
+		return types.SGXQuote4{}, fmt.Errorf("failed to verify QE report signature: %w", err)
+	}
+
+	attestKeyHash := sha256.Sum256(append(quote.Signature.PublicKey[:], qeReport.QEAuthData.Data...))
+	if !bytes.Equal(qeReport.EnclaveReport.ReportData[:32], attestKeyHash[:]) {
+		return types.SGXQuote4{}, errors.New("QE report data does not match attestation key")
+	}
+
+	headerBytes := quote.Header.Marshal()
+	bodyBytes := quote.Body.Marshal()
+	signedBytes := append(headerBytes[:], bodyBytes[:]...)
+
+	attestKey := crypto.BuildECDSAPublicKey(quote.Signature.PublicKey)
+	if err := crypto.VerifyECDSASignature(attestKey, signedBytes, quote.Signature.Signature[:]); err != nil {
+		return types.SGXQuote4{}, fmt.Errorf("failed to verify quote signature: %w", err)
+	}
+
+	return quote, nil
+}
@@ -0,0 +1,380 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/starknet.go/rpc"
+	starknetgoutils "github.com/NethermindEth/starknet.go/utils"
+
+	"github.com/NethermindEth/teeception/pkg/indexer"
+	snaccount "github.com/NethermindEth/teeception/pkg/wallet/starknet"
+)
+
+var getNextPromptIdSelector = starknetgoutils.GetSelectorFromNameFelt("get_next_prompt_id")
+
+// DefaultPromptConsumeTimeout is how long a prompt stays tracked after its
+// consume transaction is broadcast, in case the transaction never lands.
+const DefaultPromptConsumeTimeout = 10 * time.Minute
+
+type promptKey struct {
+	agentAddress [32]byte
+	promptID     uint64
+}
+
+// PromptTracker tracks the prompts the agent is processing, from the time
+// they are enqueued until their consumption is confirmed on chain, so that
+// the reconciler never enqueues them a second time.
+type PromptTracker struct {
+	mu sync.Mutex
+	// prompts maps tracked prompts to the time they stop being tracked,
+	// zero while they are being processed.
+	prompts        map[promptKey]time.Time
+	consumeTimeout time.Duration
+}
+
+// NewPromptTracker creates a new PromptTracker. A zero consumeTimeout
+// defaults to DefaultPromptConsumeTimeout.
+func NewPromptTracker(consumeTimeout time.Duration) *PromptTracker {
+	if consumeTimeout <= 0 {
+		consumeTimeout = DefaultPromptConsumeTimeout
+	}
+
+	return &PromptTracker{
+		prompts:        make(map[promptKey]time.Time),
+		consumeTimeout: consumeTimeout,
+	}
+}
+
+// Acquire starts tracking a prompt about to be enqueued. It returns false if
+// the prompt is already tracked.
+func (t *PromptTracker) Acquire(agentAddress *felt.Felt, promptID uint64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for key, until := range t.prompts {
+		if expired(until, now) {
+			delete(t.prompts, key)
+		}
+	}
+
+	key := promptKey{agentAddress: agentAddress.Bytes(), promptID: promptID}
+	if _, ok := t.prompts[key]; ok {
+		return false
+	}
+
+	t.prompts[key] = time.Time{}
+	return true
+}
+
+// Consumed records that the consume transaction of a prompt was broadcast.
+// The prompt stays tracked until Release, or the consume timeout.
+func (t *PromptTracker) Consumed(agentAddress *felt.Felt, promptID uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.prompts[promptKey{agentAddress: agentAddress.Bytes(), promptID: promptID}] = time.Now().Add(t.consumeTimeout)
+}
+
+// Park keeps a prompt which cannot be processed yet tracked until the given
+// time, so that the reconciler does not recover it before then.
+func (t *PromptTracker) Park(agentAddress *felt.Felt, promptID uint64, until time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.prompts[promptKey{agentAddress: agentAddress.Bytes(), promptID: promptID}] = until
+}
+
+// Finish stops tracking a processed prompt unless its consume transaction
+// was broadcast or it was parked, so that prompts which failed to process
+// can be recovered.
+func (t *PromptTracker) Finish(agentAddress *felt.Felt, promptID uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := promptKey{agentAddress: agentAddress.Bytes(), promptID: promptID}
+	if until, ok := t.prompts[key]; ok && until.IsZero() {
+		delete(t.prompts, key)
+	}
+}
+
+// Release stops tracking a prompt, e.g. once it is consumed on chain.
+func (t *PromptTracker) Release(agentAddress *felt.Felt, promptID uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.prompts, promptKey{agentAddress: agentAddress.Bytes(), promptID: promptID})
+}
+
+// IsInFlight reports whether a prompt is tracked.
+func (t *PromptTracker) IsInFlight(agentAddress *felt.Felt, promptID uint64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := promptKey{agentAddress: agentAddress.Bytes(), promptID: promptID}
+	until, ok := t.prompts[key]
+	if ok && expired(until, time.Now()) {
+		delete(t.prompts, key)
+		return false
+	}
+	return ok
+}
+
+func expired(until, now time.Time) bool {
+	return !until.IsZero() && !now.Before(until)
+}
+
+// PromptReconcilerConfig is the configuration for a PromptReconciler.
+type PromptReconcilerConfig struct {
+	Client       snaccount.ProviderWrapper
+	AgentIndexer *indexer.AgentIndexer
+	EventWatcher *indexer.EventWatcher
+
+	// FromBlock is the first block searched for missed PromptPaid events.
+	FromBlock uint64
+	// Interval is the time between reconciliation passes.
+	Interval time.Duration
+
+	// IsInFlight reports whether a prompt is already being processed.
+	IsInFlight func(agentAddress *felt.Felt, promptID uint64) bool
+	// Resolved is called with the prompts found consumed on chain, if set.
+	Resolved func(agentAddress *felt.Felt, promptID uint64)
+	// Enqueue schedules processing of a recovered prompt.
+	Enqueue func(ctx context.Context, ev *indexer.Event) error
+}
+
+// RecoveredPrompt is a pending prompt the reconciler enqueued.
+type RecoveredPrompt struct {
+	AgentAddress string `json:"agent_address"`
+	PromptID     uint64 `json:"prompt_id"`
+	TweetID      uint64 `json:"tweet_id"`
+	Block        uint64 `json:"block"`
+}
+
+// ReconcileReport summarizes a single reconciliation pass.
+type ReconcileReport struct {
+	StartedAt      int64             `json:"started_at"`
+	FinishedAt     int64             `json:"finished_at"`
+	AgentsScanned  int               `json:"agents_scanned"`
+	PromptsScanned int               `json:"prompts_scanned"`
+	Recovered      []RecoveredPrompt `json:"recovered"`
+	Errors         []string          `json:"errors"`
+}
+
+// PromptReconciler periodically walks the prompts of every active agent and
+// enqueues prompts that are still pending on-chain but were never picked up,
+// e.g. because the event watcher skipped a range or the agent was down.
+type PromptReconciler struct {
+	client       snaccount.ProviderWrapper
+	agentIndexer *indexer.AgentIndexer
+	eventWatcher *indexer.EventWatcher
+	fromBlock    uint64
+	interval     time.Duration
+	isInFlight   func(agentAddress *felt.Felt, promptID uint64) bool
+	resolved     func(agentAddress *felt.Felt, promptID uint64)
+	enqueue      func(ctx context.Context, ev *indexer.Event) error
+
+	// scanFrom holds, per agent, the lowest prompt ID that is not known to be resolved.
+	scanFrom map[[32]byte]uint64
+
+	mu         sync.RWMutex
+	lastReport *ReconcileReport
+}
+
+// NewPromptReconciler creates a new PromptReconciler.
+func NewPromptReconciler(cfg *PromptReconcilerConfig) *PromptReconciler {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Minute
+	}
+
+	return &PromptReconciler{
+		client:       cfg.Client,
+		agentIndexer: cfg.AgentIndexer,
+		eventWatcher: cfg.EventWatcher,
+		fromBlock:    cfg.FromBlock,
+		interval:     cfg.Interval,
+		isInFlight:   cfg.IsInFlight,
+		resolved:     cfg.Resolved,
+		enqueue:      cfg.Enqueue,
+		scanFrom:     make(map[[32]byte]uint64),
+	}
+}
+
+// Run reconciles every interval until the context is cancelled. The first pass
+// runs after one interval so that startup processing can finish first.
+func (r *PromptReconciler) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.interval):
+		}
+
+		report := r.Reconcile(ctx)
+		if len(report.Recovered) > 0 || len(report.Errors) > 0 {
+			slog.Warn("reconciled prompts", "agents_scanned", report.AgentsScanned, "prompts_scanned", report.PromptsScanned, "recovered", report.Recovered, "errors", report.Errors)
+		} else {
+			slog.Info("reconciled prompts", "agents_scanned", report.AgentsScanned, "prompts_scanned", report.PromptsScanned)
+		}
+	}
+}
+
+// LastReport returns the report of the last reconciliation pass, if any.
+func (r *PromptReconciler) LastReport() *ReconcileReport {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.lastReport
+}
+
+// Reconcile runs a single reconciliation pass.
+func (r *PromptReconciler) Reconcile(ctx context.Context) *ReconcileReport {
+	report := &ReconcileReport{
+		StartedAt: time.Now().Unix(),
+		Recovered: make([]RecoveredPrompt, 0),
+		Errors:    make([]string, 0),
+	}
+
+	// Events past the watcher's last indexed block may still be delivered the
+	// regular way, so only prompts paid before it are recovered.
+	var lastIndexedBlock uint64
+	r.eventWatcher.ReadState(func(block uint64) {
+		lastIndexedBlock = block
+	})
+
+	var addresses [][32]byte
+	r.agentIndexer.ReadState(func(db indexer.AgentIndexerDatabaseReader) {
+		addresses = db.GetAddresses()
+	})
+
+	timeNow := uint64(time.Now().Unix())
+
+	for _, addressBytes := range addresses {
+		if ctx.Err() != nil {
+			break
+		}
+
+		agentAddress := new(felt.Felt).SetBytes(addressBytes[:])
+
+		agentInfo, ok := r.agentIndexer.GetAgentInfo(agentAddress)
+		if !ok || timeNow >= agentInfo.EndTime {
+			continue
+		}
+
+		report.AgentsScanned++
+
+		if err := r.reconcileAgent(ctx, agentAddress, lastIndexedBlock, report); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", agentAddress, err))
+		}
+	}
+
+	report.FinishedAt = time.Now().Unix()
+
+	r.mu.Lock()
+	r.lastReport = report
+	r.mu.Unlock()
+
+	return report
+}
+
+func (r *PromptReconciler) reconcileAgent(ctx context.Context, agentAddress *felt.Felt, lastIndexedBlock uint64, report *ReconcileReport) error {
+	nextPromptID, err := r.callUint64(ctx, agentAddress, getNextPromptIdSelector)
+	if err != nil {
+		return fmt.Errorf("failed to get next prompt id: %v", err)
+	}
+
+	addressBytes := agentAddress.Bytes()
+	scanFrom := r.scanFrom[addressBytes]
+	resolvedUpTo := scanFrom
+	contiguous := true
+
+	for promptID := scanFrom; promptID < nextPromptID; promptID++ {
+		report.PromptsScanned++
+
+		submitter, err := r.callFelt(ctx, agentAddress, getPendingPromptSubmitterSelector, new(felt.Felt).SetUint64(promptID))
+		if err != nil {
+			return fmt.Errorf("failed to get pending prompt submitter for prompt %d: %v", promptID, err)
+		}
+
+		if submitter.IsZero() {
+			if r.resolved != nil {
+				r.resolved(agentAddress, promptID)
+			}
+			if contiguous {
+				resolvedUpTo = promptID + 1
+			}
+			continue
+		}
+		contiguous = false
+
+		if r.isInFlight(agentAddress, promptID) {
+			continue
+		}
+
+		ev, err := indexer.FetchPromptPaidEvent(ctx, r.client, agentAddress, promptID, r.fromBlock)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s/%d: %v", agentAddress, promptID, err))
+			continue
+		}
+
+		if ev.Raw.BlockNumber == 0 || ev.Raw.BlockNumber > lastIndexedBlock {
+			continue
+		}
+
+		promptPaidEvent, _ := ev.ToPromptPaidEvent()
+
+		if err := r.enqueue(ctx, ev); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s/%d: failed to enqueue: %v", agentAddress, promptID, err))
+			continue
+		}
+
+		report.Recovered = append(report.Recovered, RecoveredPrompt{
+			AgentAddress: agentAddress.String(),
+			PromptID:     promptID,
+			TweetID:      promptPaidEvent.TweetID,
+			Block:        ev.Raw.BlockNumber,
+		})
+	}
+
+	r.scanFrom[addressBytes] = resolvedUpTo
+
+	return nil
+}
+
+func (r *PromptReconciler) callFelt(ctx context.Context, contractAddress, selector *felt.Felt, calldata ...*felt.Felt) (*felt.Felt, error) {
+	fnCall := rpc.FunctionCall{
+		ContractAddress:    contractAddress,
+		EntryPointSelector: selector,
+		Calldata:           calldata,
+	}
+
+	var resp []*felt.Felt
+	var err error
+
+	if err := r.client.Do(func(provider rpc.RpcProvider) error {
+		resp, err = provider.Call(ctx, fnCall, rpc.WithBlockTag("pending"))
+		return err
+	}); err != nil {
+		return nil, snaccount.FormatRpcError(err)
+	}
+
+	if len(resp) < 1 {
+		return nil, fmt.Errorf("invalid response length: got %d, want at least 1", len(resp))
+	}
+
+	return resp[0], nil
+}
+
+func (r *PromptReconciler) callUint64(ctx context.Context, contractAddress, selector *felt.Felt, calldata ...*felt.Felt) (uint64, error) {
+	resp, err := r.callFelt(ctx, contractAddress, selector, calldata...)
+	if err != nil {
+		return 0, err
+	}
+
+	return resp.Uint64(), nil
+}
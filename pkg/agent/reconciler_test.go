@@ -0,0 +1,173 @@
+package agent_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/starknet.go/rpc"
+	starknetgoutils "github.com/NethermindEth/starknet.go/utils"
+
+	"github.com/NethermindEth/teeception/pkg/agent"
+	"github.com/NethermindEth/teeception/pkg/indexer"
+)
+
+// reconcilerNetwork serves the prompts of a single agent. Prompts without a
+// submitter are consumed. It has no events, so prompts the reconciler tries
+// to recover show up as errors of the report.
+type reconcilerNetwork struct {
+	mu         sync.Mutex
+	submitters []*felt.Felt
+}
+
+func (n *reconcilerNetwork) setSubmitter(promptID uint64, submitter *felt.Felt) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.submitters[promptID] = submitter
+}
+
+func (n *reconcilerNetwork) provider() *MockProvider {
+	return &MockProvider{
+		Methods: MockProviderMethods{
+			Call: func(ctx context.Context, call rpc.FunctionCall, block rpc.BlockID) ([]*felt.Felt, error) {
+				n.mu.Lock()
+				defer n.mu.Unlock()
+
+				switch {
+				case call.EntryPointSelector.Equal(starknetgoutils.GetSelectorFromNameFelt("get_next_prompt_id")):
+					return []*felt.Felt{new(felt.Felt).SetUint64(uint64(len(n.submitters)))}, nil
+				case call.EntryPointSelector.Equal(starknetgoutils.GetSelectorFromNameFelt("get_pending_prompt_submitter")):
+					return []*felt.Felt{n.submitters[call.Calldata[0].Uint64()]}, nil
+				default:
+					return nil, fmt.Errorf("unexpected call %s", call.EntryPointSelector)
+				}
+			},
+			Events: func(ctx context.Context, input rpc.EventsInput) (*rpc.EventChunk, error) {
+				return &rpc.EventChunk{}, nil
+			},
+		},
+	}
+}
+
+func newTestReconciler(t *testing.T, network *reconcilerNetwork, agentAddress *felt.Felt, tracker *agent.PromptTracker, enqueued *int) *agent.PromptReconciler {
+	t.Helper()
+
+	client := &MockProviderWrapper{mockProviders: []rpc.RpcProvider{network.provider()}}
+
+	eventWatcher, err := indexer.NewEventWatcher(&indexer.EventWatcherConfig{
+		Client:       client,
+		InitialState: &indexer.EventWatcherInitialState{LastIndexedBlock: 10},
+	})
+	if err != nil {
+		t.Fatalf("failed to create event watcher: %v", err)
+	}
+
+	db := indexer.NewAgentIndexerDatabaseInMemory(0)
+	if err := db.SetAgentInfo(agentAddress.Bytes(), indexer.AgentInfo{
+		Address: agentAddress,
+		Creator: new(felt.Felt).SetUint64(0xc),
+		EndTime: uint64(time.Now().Add(time.Hour).Unix()),
+	}); err != nil {
+		t.Fatalf("failed to set agent info: %v", err)
+	}
+
+	return agent.NewPromptReconciler(&agent.PromptReconcilerConfig{
+		Client: client,
+		AgentIndexer: indexer.NewAgentIndexer(&indexer.AgentIndexerConfig{
+			Client:       client,
+			InitialState: &indexer.AgentIndexerInitialState{Db: db},
+			EventWatcher: eventWatcher,
+		}),
+		EventWatcher: eventWatcher,
+		IsInFlight:   tracker.IsInFlight,
+		Resolved:     tracker.Release,
+		Enqueue: func(ctx context.Context, ev *indexer.Event) error {
+			*enqueued++
+			return nil
+		},
+	})
+}
+
+func TestReconcilerSkipsEnqueuedPrompts(t *testing.T) {
+	agentAddress := new(felt.Felt).SetUint64(0xa)
+	user := new(felt.Felt).SetUint64(0xb)
+	network := &reconcilerNetwork{submitters: []*felt.Felt{user, user}}
+	tracker := agent.NewPromptTracker(0)
+
+	var enqueued int
+	reconciler := newTestReconciler(t, network, agentAddress, tracker, &enqueued)
+
+	// Both prompts are queued and did not run yet.
+	tracker.Acquire(agentAddress, 0)
+	tracker.Acquire(agentAddress, 1)
+
+	report := reconciler.Reconcile(context.Background())
+	if report.PromptsScanned != 2 || len(report.Errors) != 0 || enqueued != 0 {
+		t.Fatalf("expected the queued prompts to be skipped, got %+v", report)
+	}
+
+	// A prompt which failed to process is recovered.
+	tracker.Finish(agentAddress, 1)
+	report = reconciler.Reconcile(context.Background())
+	if len(report.Errors) != 1 {
+		t.Fatalf("expected the failed prompt to be recovered, got %+v", report)
+	}
+}
+
+func TestReconcilerSkipsPromptsBeingConsumed(t *testing.T) {
+	agentAddress := new(felt.Felt).SetUint64(0xa)
+	user := new(felt.Felt).SetUint64(0xb)
+	network := &reconcilerNetwork{submitters: []*felt.Felt{user}}
+	tracker := agent.NewPromptTracker(0)
+
+	var enqueued int
+	reconciler := newTestReconciler(t, network, agentAddress, tracker, &enqueued)
+
+	// The consume transaction is broadcast but not included yet.
+	tracker.Acquire(agentAddress, 0)
+	tracker.Consumed(agentAddress, 0)
+	tracker.Finish(agentAddress, 0)
+
+	report := reconciler.Reconcile(context.Background())
+	if len(report.Errors) != 0 || enqueued != 0 || !tracker.IsInFlight(agentAddress, 0) {
+		t.Fatalf("expected the prompt being consumed to be skipped, got %+v", report)
+	}
+
+	// Once consumed on chain, the prompt is released.
+	network.setSubmitter(0, new(felt.Felt))
+	reconciler.Reconcile(context.Background())
+	if tracker.IsInFlight(agentAddress, 0) {
+		t.Fatalf("expected the consumed prompt to be released")
+	}
+}
+
+func TestPromptTrackerConsumeTimeout(t *testing.T) {
+	agentAddress := new(felt.Felt).SetUint64(0xa)
+	tracker := agent.NewPromptTracker(time.Millisecond)
+
+	if !tracker.Acquire(agentAddress, 0) || tracker.Acquire(agentAddress, 0) {
+		t.Fatalf("expected a prompt to be acquired once")
+	}
+
+	// Consume transactions which never land do not keep prompts forever.
+	tracker.Consumed(agentAddress, 0)
+	time.Sleep(5 * time.Millisecond)
+	if tracker.IsInFlight(agentAddress, 0) {
+		t.Fatalf("expected the prompt to be released after the consume timeout")
+	}
+
+	// Parked prompts stay tracked once processed, until the given time.
+	tracker.Acquire(agentAddress, 1)
+	tracker.Park(agentAddress, 1, time.Now().Add(5*time.Millisecond))
+	tracker.Finish(agentAddress, 1)
+	if !tracker.IsInFlight(agentAddress, 1) {
+		t.Fatalf("expected the parked prompt to stay tracked")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if tracker.IsInFlight(agentAddress, 1) {
+		t.Fatalf("expected the parked prompt to be released")
+	}
+}
@@ -27,6 +27,7 @@ const (
 	UnencumberEncryptionKeyKey      = "UNENCUMBER_ENCRYPTION_KEY"
 	DisableEncumberingKey           = "DISABLE_ENCUMBERING"
 	PromptIndexerEndpointKey        = "PROMPT_INDEXER_ENDPOINT"
+	MigrationSourceUrlKey           = "MIGRATION_SOURCE_URL"
 )
 
 func envLookupSecureFile() (string, error) {
@@ -190,3 +191,8 @@ func envGetPromptIndexerApiKey() string {
 	}
 	return apiKey
 }
+
+func envLookupMigrationSourceUrl() (string, bool) {
+	url, ok := os.LookupEnv(MigrationSourceUrlKey)
+	return url, ok && url != ""
+}
@@ -0,0 +1,351 @@
+package setup
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"golang.org/x/crypto/hkdf"
+
+	"github.com/NethermindEth/teeception/pkg/agent/quote"
+)
+
+const (
+	// migrationQuoteTag is the tag tappd prefixes report data with before hashing.
+	migrationQuoteTag = "app-data"
+	// migrationKeyInfo is the HKDF info used to derive the migration encryption key.
+	migrationKeyInfo = "teeception/migration/v1"
+)
+
+// allowedMigrationMeasurementsJson is the JSON list of MigrationMeasurements
+// allowed to receive the sealed state. It is compiled in so that it is part
+// of the measured image, not of the configuration of the operator.
+//
+//go:embed migration_allowed_measurements.json
+var allowedMigrationMeasurementsJson []byte
+
+// MigrationMeasurements are the TDX measurements of an instance that is
+// allowed to receive migrated sealed state. RTMR3 identifies the app and is
+// required, empty RTMR0-2 are not checked.
+type MigrationMeasurements struct {
+	MRTD  string `json:"mrtd"`
+	RTMR0 string `json:"rtmr0"`
+	RTMR1 string `json:"rtmr1"`
+	RTMR2 string `json:"rtmr2"`
+	RTMR3 string `json:"rtmr3"`
+}
+
+func (m *MigrationMeasurements) matches(mrtd string, rtmrs [4]string) bool {
+	if !strings.EqualFold(m.MRTD, mrtd) {
+		return false
+	}
+
+	for i, expected := range []string{m.RTMR0, m.RTMR1, m.RTMR2} {
+		if expected != "" && !strings.EqualFold(expected, rtmrs[i]) {
+			return false
+		}
+	}
+
+	return m.RTMR3 != "" && strings.EqualFold(m.RTMR3, rtmrs[3])
+}
+
+// MigrationRequest is sent by a new instance to request the sealed state of
+// the current instance.
+type MigrationRequest struct {
+	Quote     string `json:"quote"`
+	PublicKey []byte `json:"public_key"`
+}
+
+// MigrationBundle is the sealed state encrypted to the key of the new instance.
+type MigrationBundle struct {
+	PublicKey  []byte `json:"public_key"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// MigrationExporterConfig is the configuration for a MigrationExporter.
+type MigrationExporterConfig struct {
+	SetupOutput         *SetupOutput
+	Verifier            quote.Verifier
+	AllowedMeasurements []MigrationMeasurements
+}
+
+// MigrationExporter hands the sealed state over to new instances whose quote
+// matches the allow-list of measurements.
+type MigrationExporter struct {
+	setupOutput         *SetupOutput
+	verifier            quote.Verifier
+	allowedMeasurements []MigrationMeasurements
+
+	servedOnce sync.Once
+	served     chan struct{}
+}
+
+// NewMigrationExporter creates a new MigrationExporter.
+func NewMigrationExporter(config *MigrationExporterConfig) (*MigrationExporter, error) {
+	if config.SetupOutput == nil {
+		return nil, fmt.Errorf("setup output is required")
+	}
+	if config.Verifier == nil {
+		return nil, fmt.Errorf("quote verifier is required")
+	}
+	if len(config.AllowedMeasurements) == 0 {
+		return nil, fmt.Errorf("at least one allowed measurement is required")
+	}
+	for i, measurements := range config.AllowedMeasurements {
+		if measurements.MRTD == "" {
+			return nil, fmt.Errorf("allowed measurement %d has no mrtd", i)
+		}
+		if measurements.RTMR3 == "" {
+			return nil, fmt.Errorf("allowed measurement %d has no rtmr3", i)
+		}
+	}
+
+	return &MigrationExporter{
+		setupOutput:         config.SetupOutput,
+		verifier:            config.Verifier,
+		allowedMeasurements: config.AllowedMeasurements,
+		served:              make(chan struct{}),
+	}, nil
+}
+
+// MarkServed records that a bundle was handed over to a new instance, which
+// takes over from this one.
+func (e *MigrationExporter) MarkServed() {
+	e.servedOnce.Do(func() {
+		close(e.served)
+	})
+}
+
+// Served returns a channel closed once a bundle was handed over.
+func (e *MigrationExporter) Served() <-chan struct{} {
+	return e.served
+}
+
+// NewMigrationExporterFromAllowList creates a new MigrationExporter from the
+// compiled-in allow-list. It returns nil if the allow-list is empty.
+func NewMigrationExporterFromAllowList(setupOutput *SetupOutput) (*MigrationExporter, error) {
+	var allowedMeasurements []MigrationMeasurements
+	if err := json.Unmarshal(allowedMigrationMeasurementsJson, &allowedMeasurements); err != nil {
+		return nil, fmt.Errorf("failed to parse allowed migration measurements: %v", err)
+	}
+	if len(allowedMeasurements) == 0 {
+		return nil, nil
+	}
+
+	return NewMigrationExporter(&MigrationExporterConfig{
+		SetupOutput:         setupOutput,
+		Verifier:            quote.NewTDXVerifier(),
+		AllowedMeasurements: allowedMeasurements,
+	})
+}
+
+// Export verifies the quote of the new instance and returns the sealed state
+// encrypted to the key bound to the quote's report data.
+func (e *MigrationExporter) Export(ctx context.Context, req *MigrationRequest) (*MigrationBundle, error) {
+	importerKey, err := ecdh.X25519().NewPublicKey(req.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid migration public key: %v", err)
+	}
+
+	rawQuote, err := hex.DecodeString(strings.TrimPrefix(req.Quote, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode quote: %v", err)
+	}
+
+	parsedQuote, err := e.verifier.Verify(ctx, rawQuote)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify quote: %v", err)
+	}
+
+	mrtd := hex.EncodeToString(parsedQuote.Body.MRTD[:])
+	var rtmrs [4]string
+	for i, rtmr := range parsedQuote.Body.RTMR {
+		rtmrs[i] = hex.EncodeToString(rtmr[:])
+	}
+
+	allowed := false
+	for _, measurements := range e.allowedMeasurements {
+		if measurements.matches(mrtd, rtmrs) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, fmt.Errorf("measurements are not allowed: mrtd %s, rtmrs %v", mrtd, rtmrs)
+	}
+
+	expectedReportData, err := migrationReportData(e.setupOutput.AgentRegistryAddress, e.setupOutput.TwitterUsername, req.PublicKey).ToTappdQuoteField(migrationQuoteTag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build expected report data: %v", err)
+	}
+
+	if !bytes.Equal(parsedQuote.Body.ReportData[:], expectedReportData[:]) {
+		return nil, fmt.Errorf("quote report data does not match migration key")
+	}
+
+	exporterKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate migration key: %v", err)
+	}
+
+	key, err := deriveMigrationKey(exporterKey, importerKey, req.PublicKey, exporterKey.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := json.Marshal(e.setupOutput)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal setup output: %v", err)
+	}
+
+	ciphertext, err := encrypt(plaintext, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt setup output: %v", err)
+	}
+
+	slog.Warn("exported sealed state to new instance", "mrtd", mrtd)
+
+	return &MigrationBundle{
+		PublicKey:  exporterKey.PublicKey().Bytes(),
+		Ciphertext: ciphertext,
+	}, nil
+}
+
+// MigrationImporter requests and decrypts the sealed state of another instance.
+type MigrationImporter struct {
+	quoter     quote.Quoter
+	privateKey *ecdh.PrivateKey
+	reportData *quote.ReportData
+}
+
+// NewMigrationImporter creates a new MigrationImporter with a fresh key pair.
+func NewMigrationImporter(quoter quote.Quoter, agentRegistryAddress *felt.Felt, twitterUsername string) (*MigrationImporter, error) {
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate migration key: %v", err)
+	}
+
+	return &MigrationImporter{
+		quoter:     quoter,
+		privateKey: privateKey,
+		reportData: migrationReportData(agentRegistryAddress, twitterUsername, privateKey.PublicKey().Bytes()),
+	}, nil
+}
+
+// Request builds a migration request with a quote bound to the importer key.
+func (i *MigrationImporter) Request(ctx context.Context) (*MigrationRequest, error) {
+	quote, err := i.quoter.Quote(ctx, i.reportData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get migration quote: %v", err)
+	}
+
+	return &MigrationRequest{
+		Quote:     quote,
+		PublicKey: i.privateKey.PublicKey().Bytes(),
+	}, nil
+}
+
+// Import decrypts a migration bundle into a setup output.
+func (i *MigrationImporter) Import(bundle *MigrationBundle) (*SetupOutput, error) {
+	exporterKey, err := ecdh.X25519().NewPublicKey(bundle.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exporter public key: %v", err)
+	}
+
+	key, err := deriveMigrationKey(i.privateKey, exporterKey, i.privateKey.PublicKey().Bytes(), bundle.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := decrypt(bundle.Ciphertext, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt migration bundle: %v", err)
+	}
+
+	var setupOutput SetupOutput
+	if err := json.Unmarshal(plaintext, &setupOutput); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal setup output: %v", err)
+	}
+
+	return &setupOutput, nil
+}
+
+// RequestMigration requests the sealed state from the instance at sourceUrl.
+func RequestMigration(ctx context.Context, sourceUrl string, importer *MigrationImporter) (*SetupOutput, error) {
+	migrationRequest, err := importer.Request(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(migrationRequest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal migration request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(sourceUrl, "/")+"/migration/export", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send migration request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("migration request failed (status %d): %s", resp.StatusCode, string(respBody))
+	}
+
+	var bundle MigrationBundle
+	if err := json.NewDecoder(resp.Body).Decode(&bundle); err != nil {
+		return nil, fmt.Errorf("failed to decode migration bundle: %v", err)
+	}
+
+	return importer.Import(&bundle)
+}
+
+func migrationReportData(agentRegistryAddress *felt.Felt, twitterUsername string, publicKey []byte) *quote.ReportData {
+	return &quote.ReportData{
+		Address:         new(felt.Felt),
+		ContractAddress: agentRegistryAddress,
+		TwitterUsername: twitterUsername,
+		MigrationKey:    publicKey,
+	}
+}
+
+func deriveMigrationKey(privateKey *ecdh.PrivateKey, publicKey *ecdh.PublicKey, importerPublicKey, exporterPublicKey []byte) ([]byte, error) {
+	sharedSecret, err := privateKey.ECDH(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute shared secret: %v", err)
+	}
+
+	info := append([]byte(migrationKeyInfo), importerPublicKey...)
+	info = append(info, exporterPublicKey...)
+
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, sharedSecret, nil, info), key); err != nil {
+		return nil, fmt.Errorf("failed to derive migration key: %v", err)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,236 @@
+package setup_test
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/edgelesssys/go-tdx-qpl/verification/types"
+
+	"github.com/NethermindEth/teeception/pkg/agent/quote"
+	"github.com/NethermindEth/teeception/pkg/agent/setup"
+)
+
+type MockQuoter struct{}
+
+func (m *MockQuoter) Quote(ctx context.Context, report *quote.ReportData) (string, error) {
+	reportData, err := report.ToTappdQuoteField("app-data")
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(reportData[:]), nil
+}
+
+// MockVerifier treats the raw quote as report data and reports fixed measurements.
+type MockVerifier struct {
+	MRTD [48]byte
+	RTMR [4][48]byte
+}
+
+func (m *MockVerifier) Verify(ctx context.Context, rawQuote []byte) (types.SGXQuote4, error) {
+	var parsedQuote types.SGXQuote4
+	if len(rawQuote) != len(parsedQuote.Body.ReportData) {
+		return parsedQuote, fmt.Errorf("invalid quote length: %d", len(rawQuote))
+	}
+
+	parsedQuote.Header.TEEType = types.TEETypeTDX
+	parsedQuote.Body.MRTD = m.MRTD
+	parsedQuote.Body.RTMR = m.RTMR
+	copy(parsedQuote.Body.ReportData[:], rawQuote)
+
+	return parsedQuote, nil
+}
+
+func newTestSetupOutput() *setup.SetupOutput {
+	return &setup.SetupOutput{
+		TwitterUsername:        "agent",
+		TwitterPassword:        "password",
+		StarknetPrivateKeySeed: []byte("seed"),
+		AgentRegistryAddress:   new(felt.Felt).SetUint64(0x1234),
+	}
+}
+
+func newTestExporter(t *testing.T, output *setup.SetupOutput, verifier *MockVerifier, allowed setup.MigrationMeasurements) *setup.MigrationExporter {
+	exporter, err := setup.NewMigrationExporter(&setup.MigrationExporterConfig{
+		SetupOutput:         output,
+		Verifier:            verifier,
+		AllowedMeasurements: []setup.MigrationMeasurements{allowed},
+	})
+	if err != nil {
+		t.Fatalf("failed to create exporter: %v", err)
+	}
+	return exporter
+}
+
+func TestMigration(t *testing.T) {
+	verifier := &MockVerifier{}
+	verifier.MRTD[0] = 0xaa
+	verifier.RTMR[3][0] = 0xbb
+
+	allowed := setup.MigrationMeasurements{
+		MRTD:  hex.EncodeToString(verifier.MRTD[:]),
+		RTMR3: hex.EncodeToString(verifier.RTMR[3][:]),
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		output := newTestSetupOutput()
+		exporter := newTestExporter(t, output, verifier, allowed)
+
+		importer, err := setup.NewMigrationImporter(&MockQuoter{}, output.AgentRegistryAddress, output.TwitterUsername)
+		if err != nil {
+			t.Fatalf("failed to create importer: %v", err)
+		}
+
+		req, err := importer.Request(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+
+		bundle, err := exporter.Export(context.Background(), req)
+		if err != nil {
+			t.Fatalf("failed to export: %v", err)
+		}
+
+		imported, err := importer.Import(bundle)
+		if err != nil {
+			t.Fatalf("failed to import: %v", err)
+		}
+
+		if imported.TwitterPassword != output.TwitterPassword || string(imported.StarknetPrivateKeySeed) != string(output.StarknetPrivateKeySeed) {
+			t.Fatalf("imported setup output does not match: %+v", imported)
+		}
+	})
+
+	t.Run("over http", func(t *testing.T) {
+		output := newTestSetupOutput()
+		exporter := newTestExporter(t, output, verifier, allowed)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/migration/export" {
+				http.NotFound(w, r)
+				return
+			}
+
+			var req setup.MigrationRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			bundle, err := exporter.Export(r.Context(), &req)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+
+			json.NewEncoder(w).Encode(bundle)
+			exporter.MarkServed()
+		}))
+		defer server.Close()
+
+		importer, err := setup.NewMigrationImporter(&MockQuoter{}, output.AgentRegistryAddress, output.TwitterUsername)
+		if err != nil {
+			t.Fatalf("failed to create importer: %v", err)
+		}
+
+		imported, err := setup.RequestMigration(context.Background(), server.URL, importer)
+		if err != nil {
+			t.Fatalf("failed to migrate: %v", err)
+		}
+
+		if imported.TwitterUsername != output.TwitterUsername {
+			t.Fatalf("expected username %s, got %s", output.TwitterUsername, imported.TwitterUsername)
+		}
+
+		select {
+		case <-exporter.Served():
+		case <-time.After(time.Second):
+			t.Fatalf("expected the exporter to hand over to the new instance")
+		}
+	})
+
+	t.Run("disallowed measurements", func(t *testing.T) {
+		output := newTestSetupOutput()
+		disallowed := allowed
+		disallowed.RTMR3 = hex.EncodeToString(make([]byte, 48))
+		exporter := newTestExporter(t, output, verifier, disallowed)
+
+		importer, err := setup.NewMigrationImporter(&MockQuoter{}, output.AgentRegistryAddress, output.TwitterUsername)
+		if err != nil {
+			t.Fatalf("failed to create importer: %v", err)
+		}
+
+		req, err := importer.Request(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+
+		if _, err := exporter.Export(context.Background(), req); err == nil {
+			t.Fatalf("expected export to fail for disallowed measurements")
+		}
+	})
+
+	t.Run("measurements without rtmr3", func(t *testing.T) {
+		_, err := setup.NewMigrationExporter(&setup.MigrationExporterConfig{
+			SetupOutput:         newTestSetupOutput(),
+			Verifier:            verifier,
+			AllowedMeasurements: []setup.MigrationMeasurements{{MRTD: allowed.MRTD}},
+		})
+		if err == nil {
+			t.Fatalf("expected measurements with only an mrtd to be rejected")
+		}
+	})
+
+	t.Run("key not bound to quote", func(t *testing.T) {
+		output := newTestSetupOutput()
+		exporter := newTestExporter(t, output, verifier, allowed)
+
+		importer, err := setup.NewMigrationImporter(&MockQuoter{}, output.AgentRegistryAddress, output.TwitterUsername)
+		if err != nil {
+			t.Fatalf("failed to create importer: %v", err)
+		}
+		attacker, err := setup.NewMigrationImporter(&MockQuoter{}, output.AgentRegistryAddress, output.TwitterUsername)
+		if err != nil {
+			t.Fatalf("failed to create importer: %v", err)
+		}
+
+		req, err := importer.Request(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		attackerReq, err := attacker.Request(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		req.PublicKey = attackerReq.PublicKey
+
+		if _, err := exporter.Export(context.Background(), req); err == nil {
+			t.Fatalf("expected export to fail for a key not bound to the quote")
+		}
+	})
+
+	t.Run("wrong agent", func(t *testing.T) {
+		output := newTestSetupOutput()
+		exporter := newTestExporter(t, output, verifier, allowed)
+
+		importer, err := setup.NewMigrationImporter(&MockQuoter{}, output.AgentRegistryAddress, "other_agent")
+		if err != nil {
+			t.Fatalf("failed to create importer: %v", err)
+		}
+
+		req, err := importer.Request(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+
+		if _, err := exporter.Export(context.Background(), req); err == nil {
+			t.Fatalf("expected export to fail for a different agent")
+		}
+	})
+}
@@ -8,8 +8,10 @@ import (
 	"os"
 
 	"github.com/Dstack-TEE/dstack/sdk/go/tappd"
+	starknetgoutils "github.com/NethermindEth/starknet.go/utils"
 
 	"github.com/NethermindEth/teeception/pkg/agent/debug"
+	"github.com/NethermindEth/teeception/pkg/agent/quote"
 )
 
 func Setup(ctx context.Context) (*SetupOutput, error) {
@@ -33,6 +35,11 @@ func Setup(ctx context.Context) (*SetupOutput, error) {
 
 	setupOutput, err := loadSetup(ctx, secureFilePath, sealingKey)
 	if err != nil {
+		if migrationSourceUrl, ok := envLookupMigrationSourceUrl(); ok {
+			slog.Warn("failed to load setup, migrating setup", "error", err, "source", migrationSourceUrl)
+			return migrateSetup(ctx, migrationSourceUrl, quote.NewTappdQuoter(dstackTappdClient), secureFilePath, sealingKey)
+		}
+
 		slog.Warn("failed to load setup, initializing new setup", "error", err)
 		return initializeSetup(ctx, secureFilePath, sealingKey)
 	}
@@ -63,6 +70,34 @@ func initializeSetup(ctx context.Context, secureFilePath string, sealingKey []by
 	return setupOutput, nil
 }
 
+func migrateSetup(ctx context.Context, sourceUrl string, quoter quote.Quoter, secureFilePath string, sealingKey []byte) (*SetupOutput, error) {
+	agentRegistryAddress, err := starknetgoutils.HexToFelt(envGetAgentRegistryAddress())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse agent registry address: %v", err)
+	}
+
+	importer, err := NewMigrationImporter(quoter, agentRegistryAddress, envGetTwitterAccount())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migration importer: %v", err)
+	}
+
+	setupOutput, err := RequestMigration(ctx, sourceUrl, importer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate setup: %v", err)
+	}
+
+	if err := writeSetupOutput(setupOutput, secureFilePath, sealingKey); err != nil {
+		return nil, fmt.Errorf("failed to write setup output: %v", err)
+	}
+
+	slog.Info("wrote encrypted migrated setup output")
+	if debug.IsDebugShowSetup() {
+		slog.Info("setup output", "setupOutput", setupOutput)
+	}
+
+	return setupOutput, nil
+}
+
 func loadSetup(ctx context.Context, secureFilePath string, sealingKey []byte) (*SetupOutput, error) {
 	setupOutput, err := readSetupOutput(secureFilePath, sealingKey)
 	if err != nil {
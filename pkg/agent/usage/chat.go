@@ -0,0 +1,97 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/NethermindEth/juno/core/felt"
+
+	"github.com/NethermindEth/teeception/pkg/agent/chat"
+)
+
+// ErrBudgetExceeded is returned for prompts of an agent over its budget.
+var ErrBudgetExceeded = errors.New("agent budget exceeded")
+
+type agentContextKey struct{}
+
+// WithAgent attaches the agent a prompt is accounted to to the context.
+func WithAgent(ctx context.Context, agentAddr *felt.Felt) context.Context {
+	return context.WithValue(ctx, agentContextKey{}, agentAddr)
+}
+
+// AgentFromContext returns the agent attached with WithAgent, if any.
+func AgentFromContext(ctx context.Context) *felt.Felt {
+	agentAddr, _ := ctx.Value(agentContextKey{}).(*felt.Felt)
+	return agentAddr
+}
+
+// AccountingChatCompletionConfig is the configuration for the AccountingChatCompletion
+type AccountingChatCompletionConfig struct {
+	ChatCompletion chat.ChatCompletion
+	Accountant     *Accountant
+}
+
+// AccountingChatCompletion records the usage of the prompts of the agent in
+// the context and enforces its budget. Prompts of agents the accountant
+// degrades are marked with chat.WithDegraded, so that the backend the agent
+// is routed to answers them with its degrade model, and refused if it has none.
+type AccountingChatCompletion struct {
+	chatCompletion chat.ChatCompletion
+	accountant     *Accountant
+}
+
+var _ chat.ChatCompletion = (*AccountingChatCompletion)(nil)
+
+// NewAccountingChatCompletion creates a new AccountingChatCompletion
+func NewAccountingChatCompletion(config *AccountingChatCompletionConfig) *AccountingChatCompletion {
+	return &AccountingChatCompletion{
+		chatCompletion: config.ChatCompletion,
+		accountant:     config.Accountant,
+	}
+}
+
+func (c *AccountingChatCompletion) Prompt(ctx context.Context, metadata, systemPrompt, prompt string) (*chat.ChatCompletionResponse, error) {
+	agentAddr := AgentFromContext(ctx)
+	if agentAddr == nil {
+		return c.chatCompletion.Prompt(ctx, metadata, systemPrompt, prompt)
+	}
+
+	decision, err := c.accountant.Check(agentAddr)
+	if err != nil {
+		// Failing to read the budget must not take agents down.
+		slog.Warn("failed to check agent budget", "agent_address", agentAddr, "error", err)
+	}
+	switch decision {
+	case BudgetDegrade:
+		degradedCtx := chat.WithDegraded(ctx)
+		model, degradeModel := chat.ResolveModel(ctx, c.chatCompletion), chat.ResolveModel(degradedCtx, c.chatCompletion)
+		if degradeModel == model {
+			slog.Info("agent over budget and its backend has no degrade model", "agent_address", agentAddr, "model", model)
+			return nil, ErrBudgetExceeded
+		}
+		slog.Info("agent over budget, using degrade model", "agent_address", agentAddr, "model", model, "degrade_model", degradeModel)
+		ctx = degradedCtx
+	case BudgetRefuse:
+		return nil, ErrBudgetExceeded
+	}
+
+	resp, err := c.chatCompletion.Prompt(ctx, metadata, systemPrompt, prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := c.accountant.RecordResponse(agentAddr, resp); err != nil {
+		slog.Warn("failed to record usage", "agent_address", agentAddr, "model", resp.Model, "error", err)
+	}
+
+	return resp, nil
+}
+
+func (c *AccountingChatCompletion) ResolveModel(ctx context.Context) string {
+	return chat.ResolveModel(ctx, c.chatCompletion)
+}
+
+func (c *AccountingChatCompletion) ValidateName(ctx context.Context, name string) (bool, error) {
+	return c.chatCompletion.ValidateName(ctx, name)
+}
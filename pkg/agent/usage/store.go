@@ -0,0 +1,114 @@
+package usage
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+// Record is the usage of an agent with a model on a day.
+type Record struct {
+	AgentAddr        *felt.Felt `json:"agent_addr"`
+	Model            string     `json:"model"`
+	Day              string     `json:"day"`
+	Prompts          int64      `json:"prompts"`
+	PromptTokens     int64      `json:"prompt_tokens"`
+	CompletionTokens int64      `json:"completion_tokens"`
+	Cost             float64    `json:"cost"`
+}
+
+// Store persists usage per agent, model and day.
+type Store interface {
+	// AddUsage adds a prompt with its tokens and cost to the record of the
+	// agent, model and day.
+	AddUsage(agentAddr *felt.Felt, model, day string, promptTokens, completionTokens int64, cost float64) error
+	// GetCost returns the cost of an agent on a day across models.
+	GetCost(agentAddr *felt.Felt, day string) (float64, error)
+	// GetRecords returns the records from the given day on, oldest first.
+	GetRecords(fromDay string) ([]*Record, error)
+}
+
+type recordKey struct {
+	agentAddr [32]byte
+	model     string
+	day       string
+}
+
+// StoreInMemory is an in-memory implementation of the Store interface.
+type StoreInMemory struct {
+	mu      sync.RWMutex
+	records map[recordKey]*Record
+}
+
+var _ Store = (*StoreInMemory)(nil)
+
+// NewStoreInMemory creates a new StoreInMemory.
+func NewStoreInMemory() *StoreInMemory {
+	return &StoreInMemory{
+		records: make(map[recordKey]*Record),
+	}
+}
+
+func (s *StoreInMemory) AddUsage(agentAddr *felt.Felt, model, day string, promptTokens, completionTokens int64, cost float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := recordKey{agentAddr.Bytes(), model, day}
+	record, ok := s.records[key]
+	if !ok {
+		record = &Record{
+			AgentAddr: agentAddr,
+			Model:     model,
+			Day:       day,
+		}
+		s.records[key] = record
+	}
+
+	record.Prompts++
+	record.PromptTokens += promptTokens
+	record.CompletionTokens += completionTokens
+	record.Cost += cost
+
+	return nil
+}
+
+func (s *StoreInMemory) GetCost(agentAddr *felt.Felt, day string) (float64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	addr := agentAddr.Bytes()
+
+	var cost float64
+	for key, record := range s.records {
+		if key.agentAddr == addr && key.day == day {
+			cost += record.Cost
+		}
+	}
+	return cost, nil
+}
+
+func (s *StoreInMemory) GetRecords(fromDay string) ([]*Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]*Record, 0, len(s.records))
+	for _, record := range s.records {
+		if record.Day >= fromDay {
+			recordCopy := *record
+			records = append(records, &recordCopy)
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Day != records[j].Day {
+			return records[i].Day < records[j].Day
+		}
+		if addrI, addrJ := records[i].AgentAddr.String(), records[j].AgentAddr.String(); addrI != addrJ {
+			return addrI < addrJ
+		}
+		return records[i].Model < records[j].Model
+	})
+
+	return records, nil
+}
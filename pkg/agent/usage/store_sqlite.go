@@ -0,0 +1,113 @@
+package usage
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/NethermindEth/juno/core/felt"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// StoreSQLite is a SQLite implementation of the Store interface.
+type StoreSQLite struct {
+	db *sql.DB
+}
+
+var _ Store = (*StoreSQLite)(nil)
+
+// NewStoreSQLite creates a new SQLite-based Store.
+func NewStoreSQLite(dbPath string) (*StoreSQLite, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS usage (
+			agent_addr TEXT NOT NULL,
+			model TEXT NOT NULL,
+			day TEXT NOT NULL,
+			prompts INTEGER NOT NULL,
+			prompt_tokens INTEGER NOT NULL,
+			completion_tokens INTEGER NOT NULL,
+			cost REAL NOT NULL,
+			PRIMARY KEY (agent_addr, day, model)
+		);
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tables: %w", err)
+	}
+
+	return &StoreSQLite{
+		db: db,
+	}, nil
+}
+
+func (s *StoreSQLite) AddUsage(agentAddr *felt.Felt, model, day string, promptTokens, completionTokens int64, cost float64) error {
+	_, err := s.db.Exec(`
+		INSERT INTO usage (agent_addr, model, day, prompts, prompt_tokens, completion_tokens, cost)
+		VALUES (?, ?, ?, 1, ?, ?, ?)
+		ON CONFLICT (agent_addr, day, model) DO UPDATE SET
+			prompts = prompts + 1,
+			prompt_tokens = prompt_tokens + excluded.prompt_tokens,
+			completion_tokens = completion_tokens + excluded.completion_tokens,
+			cost = cost + excluded.cost
+	`, agentAddr.String(), model, day, promptTokens, completionTokens, cost)
+	if err != nil {
+		return fmt.Errorf("failed to add usage: %w", err)
+	}
+
+	return nil
+}
+
+func (s *StoreSQLite) GetCost(agentAddr *felt.Felt, day string) (float64, error) {
+	var cost float64
+	err := s.db.QueryRow(`
+		SELECT COALESCE(SUM(cost), 0)
+		FROM usage
+		WHERE agent_addr = ? AND day = ?
+	`, agentAddr.String(), day).Scan(&cost)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get cost: %w", err)
+	}
+
+	return cost, nil
+}
+
+func (s *StoreSQLite) GetRecords(fromDay string) ([]*Record, error) {
+	rows, err := s.db.Query(`
+		SELECT agent_addr, model, day, prompts, prompt_tokens, completion_tokens, cost
+		FROM usage
+		WHERE day >= ?
+		ORDER BY day, agent_addr, model
+	`, fromDay)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage: %w", err)
+	}
+	defer rows.Close()
+
+	records := make([]*Record, 0)
+	for rows.Next() {
+		var record Record
+		var agentAddrStr string
+		if err := rows.Scan(&agentAddrStr, &record.Model, &record.Day, &record.Prompts, &record.PromptTokens, &record.CompletionTokens, &record.Cost); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		record.AgentAddr, err = new(felt.Felt).SetString(agentAddrStr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse agent address: %w", err)
+		}
+
+		records = append(records, &record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return records, nil
+}
@@ -0,0 +1,210 @@
+package usage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+
+	"github.com/NethermindEth/teeception/pkg/agent/chat"
+)
+
+// Price is the price of a model in USD per million tokens.
+type Price struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// PriceTable maps models to their price. Models reported with a version
+// suffix, such as gpt-4-0613, use the price of their longest listed prefix.
+type PriceTable map[string]Price
+
+// DefaultPriceTable is the list price of the models agents use by default.
+var DefaultPriceTable = PriceTable{
+	"gpt-4":                    {Prompt: 30, Completion: 60},
+	"gpt-4-turbo":              {Prompt: 10, Completion: 30},
+	"gpt-4o":                   {Prompt: 2.5, Completion: 10},
+	"gpt-4o-mini":              {Prompt: 0.15, Completion: 0.6},
+	"claude-3-5-sonnet-latest": {Prompt: 3, Completion: 15},
+	"claude-3-5-haiku-latest":  {Prompt: 0.8, Completion: 4},
+}
+
+// Cost returns the cost of the usage in USD, zero for unknown models.
+func (t PriceTable) Cost(model string, usage chat.ChatCompletionUsage) float64 {
+	price, ok := t[model]
+	if !ok {
+		prefixLen := 0
+		for name, p := range t {
+			if len(name) > prefixLen && strings.HasPrefix(model, name) {
+				price, prefixLen = p, len(name)
+			}
+		}
+	}
+
+	return (float64(usage.PromptTokens)*price.Prompt + float64(usage.CompletionTokens)*price.Completion) / 1_000_000
+}
+
+// BudgetAction is what happens to prompts of an agent over its budget.
+type BudgetAction string
+
+const (
+	// BudgetActionRefuse fails the prompts.
+	BudgetActionRefuse BudgetAction = "refuse"
+	// BudgetActionDegrade answers the prompts with a cheaper model.
+	BudgetActionDegrade BudgetAction = "degrade"
+)
+
+// BudgetDecision is how a prompt of an agent is answered given its budget.
+type BudgetDecision int
+
+const (
+	BudgetAllow BudgetDecision = iota
+	BudgetDegrade
+	BudgetRefuse
+)
+
+// AccountantConfig is the configuration for an Accountant.
+type AccountantConfig struct {
+	Store  Store
+	Prices PriceTable
+
+	// DailyCap is the daily budget of every agent in USD, zero means no cap.
+	DailyCap float64
+	// Caps overrides DailyCap per agent address.
+	Caps map[[32]byte]float64
+	// ExceededAction applies to agents over their budget, it defaults to refusing.
+	ExceededAction BudgetAction
+}
+
+// Accountant adds up the cost of prompts per agent, model and day, and
+// enforces the daily budget of agents.
+type Accountant struct {
+	store  Store
+	prices PriceTable
+
+	dailyCap       float64
+	caps           map[[32]byte]float64
+	exceededAction BudgetAction
+}
+
+// NewAccountant creates a new Accountant.
+func NewAccountant(cfg *AccountantConfig) (*Accountant, error) {
+	if cfg.Store == nil {
+		return nil, fmt.Errorf("usage store is required")
+	}
+	if cfg.Prices == nil {
+		cfg.Prices = DefaultPriceTable
+	}
+	if cfg.ExceededAction == "" {
+		cfg.ExceededAction = BudgetActionRefuse
+	}
+
+	return &Accountant{
+		store:          cfg.Store,
+		prices:         cfg.Prices,
+		dailyCap:       cfg.DailyCap,
+		caps:           cfg.Caps,
+		exceededAction: cfg.ExceededAction,
+	}, nil
+}
+
+// Cost returns the cost of the usage in USD.
+func (a *Accountant) Cost(model string, usage chat.ChatCompletionUsage) float64 {
+	return a.prices.Cost(model, usage)
+}
+
+// ResponseCost returns the cost of a response in USD, the votes of consensus
+// responses being priced with the model of their voter.
+func (a *Accountant) ResponseCost(resp *chat.ChatCompletionResponse) float64 {
+	var cost float64
+	for _, spent := range responseUsages(resp) {
+		cost += a.Cost(spent.model, spent.usage)
+	}
+	return cost
+}
+
+// RecordResponse adds the usage of a response of an agent, by model, and
+// returns its cost.
+func (a *Accountant) RecordResponse(agentAddr *felt.Felt, resp *chat.ChatCompletionResponse) (float64, error) {
+	var cost float64
+	for _, spent := range responseUsages(resp) {
+		spentCost, err := a.Record(agentAddr, spent.model, spent.usage)
+		if err != nil {
+			return cost, err
+		}
+		cost += spentCost
+	}
+	return cost, nil
+}
+
+type modelUsage struct {
+	model string
+	usage chat.ChatCompletionUsage
+}
+
+func responseUsages(resp *chat.ChatCompletionResponse) []modelUsage {
+	if len(resp.Votes) == 0 {
+		return []modelUsage{{resp.Model, resp.Usage}}
+	}
+
+	usages := make([]modelUsage, 0, len(resp.Votes))
+	for _, vote := range resp.Votes {
+		if vote.Error == "" {
+			usages = append(usages, modelUsage{vote.Model, vote.Usage})
+		}
+	}
+	return usages
+}
+
+// Record adds the usage of a prompt of an agent and returns its cost.
+func (a *Accountant) Record(agentAddr *felt.Felt, model string, usage chat.ChatCompletionUsage) (float64, error) {
+	cost := a.Cost(model, usage)
+
+	err := a.store.AddUsage(agentAddr, model, day(time.Now()), int64(usage.PromptTokens), int64(usage.CompletionTokens), cost)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record usage: %w", err)
+	}
+
+	return cost, nil
+}
+
+// Check returns how the next prompt of an agent is answered given what it
+// spent today.
+func (a *Accountant) Check(agentAddr *felt.Felt) (BudgetDecision, error) {
+	limit, ok := a.caps[agentAddr.Bytes()]
+	if !ok {
+		limit = a.dailyCap
+	}
+	if limit <= 0 {
+		return BudgetAllow, nil
+	}
+
+	cost, err := a.store.GetCost(agentAddr, day(time.Now()))
+	if err != nil {
+		return BudgetAllow, fmt.Errorf("failed to get cost: %w", err)
+	}
+	if cost < limit {
+		return BudgetAllow, nil
+	}
+
+	if a.exceededAction == BudgetActionDegrade {
+		return BudgetDegrade, nil
+	}
+	return BudgetRefuse, nil
+}
+
+// Records returns the usage of the last days, today included.
+func (a *Accountant) Records(days int) ([]*Record, error) {
+	return a.store.GetRecords(day(time.Now().AddDate(0, 0, 1-days)))
+}
+
+// BudgetResetAt returns when the daily budgets of agents reset after t.
+func BudgetResetAt(t time.Time) time.Time {
+	year, month, date := t.UTC().Date()
+	return time.Date(year, month, date+1, 0, 0, 0, 0, time.UTC)
+}
+
+func day(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
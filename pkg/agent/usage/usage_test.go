@@ -0,0 +1,162 @@
+package usage_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/NethermindEth/juno/core/felt"
+
+	"github.com/NethermindEth/teeception/pkg/agent/chat"
+	"github.com/NethermindEth/teeception/pkg/agent/usage"
+)
+
+type stubChat struct {
+	model        string
+	degradeModel string
+	calls        int
+}
+
+func (s *stubChat) Prompt(ctx context.Context, metadata, systemPrompt, prompt string) (*chat.ChatCompletionResponse, error) {
+	s.calls++
+	return &chat.ChatCompletionResponse{
+		Response: "no",
+		Model:    s.ResolveModel(ctx),
+		Usage:    chat.ChatCompletionUsage{PromptTokens: 1000, CompletionTokens: 500},
+	}, nil
+}
+
+func (s *stubChat) ResolveModel(ctx context.Context) string {
+	if s.degradeModel != "" && chat.IsDegraded(ctx) {
+		return s.degradeModel
+	}
+	return s.model
+}
+
+func (s *stubChat) ValidateName(ctx context.Context, name string) (bool, error) {
+	return true, nil
+}
+
+func TestPriceTableCost(t *testing.T) {
+	prices := usage.PriceTable{
+		"gpt-4":  {Prompt: 30, Completion: 60},
+		"gpt-4o": {Prompt: 2.5, Completion: 10},
+	}
+	tokens := chat.ChatCompletionUsage{PromptTokens: 1_000_000, CompletionTokens: 1_000_000}
+
+	tests := []struct {
+		model string
+		cost  float64
+	}{
+		{"gpt-4", 90},
+		{"gpt-4-0613", 90},
+		{"gpt-4o-2024-08-06", 12.5},
+		{"llama-3", 0},
+	}
+	for _, test := range tests {
+		if cost := prices.Cost(test.model, tokens); math.Abs(cost-test.cost) > 1e-9 {
+			t.Fatalf("expected %s to cost %v, got %v", test.model, test.cost, cost)
+		}
+	}
+}
+
+func TestAccountingBudget(t *testing.T) {
+	agentAddr := new(felt.Felt).SetUint64(1)
+	cappedAddr := new(felt.Felt).SetUint64(2)
+
+	tests := []struct {
+		name          string
+		action        usage.BudgetAction
+		degradeModel  string
+		expectedModel string
+		expectedErr   error
+	}{
+		{"refuse", usage.BudgetActionRefuse, "gpt-4o-mini", "", usage.ErrBudgetExceeded},
+		{"degrade", usage.BudgetActionDegrade, "gpt-4o-mini", "gpt-4o-mini", nil},
+		{"degrade without degrade model", usage.BudgetActionDegrade, "", "", usage.ErrBudgetExceeded},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			accountant, err := usage.NewAccountant(&usage.AccountantConfig{
+				Store:          usage.NewStoreInMemory(),
+				DailyCap:       0.05,
+				Caps:           map[[32]byte]float64{cappedAddr.Bytes(): 1},
+				ExceededAction: test.action,
+			})
+			if err != nil {
+				t.Fatalf("failed to create accountant: %v", err)
+			}
+
+			primary := &stubChat{model: "gpt-4", degradeModel: test.degradeModel}
+			client := usage.NewAccountingChatCompletion(&usage.AccountingChatCompletionConfig{
+				ChatCompletion: primary,
+				Accountant:     accountant,
+			})
+
+			// A gpt-4 prompt costs 0.06, over the default cap but not the override.
+			for _, addr := range []*felt.Felt{agentAddr, cappedAddr} {
+				resp, err := client.Prompt(usage.WithAgent(context.Background(), addr), "metadata", "system prompt", "hi")
+				if err != nil || resp.Model != "gpt-4" {
+					t.Fatalf("expected gpt-4 to answer, got %+v %v", resp, err)
+				}
+			}
+
+			resp, err := client.Prompt(usage.WithAgent(context.Background(), agentAddr), "metadata", "system prompt", "hi")
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("expected error %v, got %v", test.expectedErr, err)
+			}
+			if test.expectedErr == nil && resp.Model != test.expectedModel {
+				t.Fatalf("expected %s to answer, got %s", test.expectedModel, resp.Model)
+			}
+
+			resp, err = client.Prompt(usage.WithAgent(context.Background(), cappedAddr), "metadata", "system prompt", "hi")
+			if err != nil || resp.Model != "gpt-4" {
+				t.Fatalf("expected gpt-4 to answer under the override, got %+v %v", resp, err)
+			}
+
+			records, err := accountant.Records(1)
+			if err != nil {
+				t.Fatalf("failed to get records: %v", err)
+			}
+			expectedRecords := 2
+			if test.expectedErr == nil {
+				expectedRecords = 3
+			}
+			if len(records) != expectedRecords {
+				t.Fatalf("expected %d records, got %d", expectedRecords, len(records))
+			}
+		})
+	}
+}
+
+func TestStoreSQLite(t *testing.T) {
+	store, err := usage.NewStoreSQLite(filepath.Join(t.TempDir(), "usage.db"))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	agentAddr := new(felt.Felt).SetUint64(1)
+	for _, model := range []string{"gpt-4", "gpt-4", "gpt-4o"} {
+		if err := store.AddUsage(agentAddr, model, "2026-01-02", 100, 10, 0.5); err != nil {
+			t.Fatalf("failed to add usage: %v", err)
+		}
+	}
+	if err := store.AddUsage(agentAddr, "gpt-4", "2026-01-01", 100, 10, 0.5); err != nil {
+		t.Fatalf("failed to add usage: %v", err)
+	}
+
+	cost, err := store.GetCost(agentAddr, "2026-01-02")
+	if err != nil || cost != 1.5 {
+		t.Fatalf("expected cost 1.5, got %v %v", cost, err)
+	}
+
+	records, err := store.GetRecords("2026-01-02")
+	if err != nil {
+		t.Fatalf("failed to get records: %v", err)
+	}
+	if len(records) != 2 || records[0].Model != "gpt-4" || records[0].Prompts != 2 || records[0].PromptTokens != 200 {
+		t.Fatalf("unexpected records %+v", records)
+	}
+}
@@ -211,12 +211,17 @@ func (i *AgentIndexer) GetOrFetchAgentInfo(ctx context.Context, addr *felt.Felt,
 }
 
 func (i *AgentIndexer) fetchAgentInfo(ctx context.Context, addr *felt.Felt) (AgentInfo, error) {
+	return FetchAgentInfo(ctx, i.client, i.registryAddress, addr)
+}
+
+// FetchAgentInfo fetches the info of an agent registered in the registry from the chain.
+func FetchAgentInfo(ctx context.Context, client starknet.ProviderWrapper, registryAddress, addr *felt.Felt) (AgentInfo, error) {
 	var isAgentRegisteredResp []*felt.Felt
 	var err error
 
-	if err := i.client.Do(func(provider rpc.RpcProvider) error {
+	if err := client.Do(func(provider rpc.RpcProvider) error {
 		isAgentRegisteredResp, err = provider.Call(ctx, rpc.FunctionCall{
-			ContractAddress:    i.registryAddress,
+			ContractAddress:    registryAddress,
 			EntryPointSelector: isAgentRegisteredSelector,
 			Calldata:           []*felt.Felt{addr},
 		}, rpc.WithBlockTag("pending"))
@@ -230,7 +235,7 @@ func (i *AgentIndexer) fetchAgentInfo(ctx context.Context, addr *felt.Felt) (Age
 	}
 
 	var nameResp []*felt.Felt
-	if err := i.client.Do(func(provider rpc.RpcProvider) error {
+	if err := client.Do(func(provider rpc.RpcProvider) error {
 		nameResp, err = provider.Call(ctx, rpc.FunctionCall{
 			ContractAddress:    addr,
 			EntryPointSelector: getNameSelector,
@@ -247,7 +252,7 @@ func (i *AgentIndexer) fetchAgentInfo(ctx context.Context, addr *felt.Felt) (Age
 	}
 
 	var getSystemPromptResp []*felt.Felt
-	if err := i.client.Do(func(provider rpc.RpcProvider) error {
+	if err := client.Do(func(provider rpc.RpcProvider) error {
 		getSystemPromptResp, err = provider.Call(ctx, rpc.FunctionCall{
 			ContractAddress:    addr,
 			EntryPointSelector: getSystemPromptSelector,
@@ -264,7 +269,7 @@ func (i *AgentIndexer) fetchAgentInfo(ctx context.Context, addr *felt.Felt) (Age
 	}
 
 	var getCreatorResp []*felt.Felt
-	if err := i.client.Do(func(provider rpc.RpcProvider) error {
+	if err := client.Do(func(provider rpc.RpcProvider) error {
 		getCreatorResp, err = provider.Call(ctx, rpc.FunctionCall{
 			ContractAddress:    addr,
 			EntryPointSelector: getCreatorSelector,
@@ -276,7 +281,7 @@ func (i *AgentIndexer) fetchAgentInfo(ctx context.Context, addr *felt.Felt) (Age
 	}
 
 	var getPromptPriceResp []*felt.Felt
-	if err := i.client.Do(func(provider rpc.RpcProvider) error {
+	if err := client.Do(func(provider rpc.RpcProvider) error {
 		getPromptPriceResp, err = provider.Call(ctx, rpc.FunctionCall{
 			ContractAddress:    addr,
 			EntryPointSelector: getPromptPriceSelector,
@@ -288,7 +293,7 @@ func (i *AgentIndexer) fetchAgentInfo(ctx context.Context, addr *felt.Felt) (Age
 	}
 
 	var getTokenResp []*felt.Felt
-	if err := i.client.Do(func(provider rpc.RpcProvider) error {
+	if err := client.Do(func(provider rpc.RpcProvider) error {
 		getTokenResp, err = provider.Call(ctx, rpc.FunctionCall{
 			ContractAddress:    addr,
 			EntryPointSelector: getTokenSelector,
@@ -300,7 +305,7 @@ func (i *AgentIndexer) fetchAgentInfo(ctx context.Context, addr *felt.Felt) (Age
 	}
 
 	var getEndTimeResp []*felt.Felt
-	if err := i.client.Do(func(provider rpc.RpcProvider) error {
+	if err := client.Do(func(provider rpc.RpcProvider) error {
 		getEndTimeResp, err = provider.Call(ctx, rpc.FunctionCall{
 			ContractAddress:    addr,
 			EntryPointSelector: getEndTimeSelector,
@@ -311,6 +316,18 @@ func (i *AgentIndexer) fetchAgentInfo(ctx context.Context, addr *felt.Felt) (Age
 		return AgentInfo{}, fmt.Errorf("get_end_time call failed: %w", snaccount.FormatRpcError(err))
 	}
 
+	var getModelResp []*felt.Felt
+	if err := client.Do(func(provider rpc.RpcProvider) error {
+		getModelResp, err = provider.Call(ctx, rpc.FunctionCall{
+			ContractAddress:    addr,
+			EntryPointSelector: getModelSelector,
+			Calldata:           []*felt.Felt{},
+		}, rpc.WithBlockTag("pending"))
+		return err
+	}); err != nil {
+		return AgentInfo{}, fmt.Errorf("get_model call failed: %w", snaccount.FormatRpcError(err))
+	}
+
 	promptPrice := snaccount.Uint256ToBigInt([2]*felt.Felt(getPromptPriceResp[0:2]))
 
 	return AgentInfo{
@@ -321,6 +338,7 @@ func (i *AgentIndexer) fetchAgentInfo(ctx context.Context, addr *felt.Felt) (Age
 		PromptPrice:  promptPrice,
 		TokenAddress: getTokenResp[0],
 		EndTime:      getEndTimeResp[0].Uint64(),
+		Model:        getModelResp[0],
 	}, nil
 }
 
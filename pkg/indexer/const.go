@@ -30,6 +30,7 @@ var (
 	getNameSelector           = starknetgoutils.GetSelectorFromNameFelt("get_name")
 	getCreatorSelector        = starknetgoutils.GetSelectorFromNameFelt("get_creator")
 	getEndTimeSelector        = starknetgoutils.GetSelectorFromNameFelt("get_end_time")
+	getModelSelector          = starknetgoutils.GetSelectorFromNameFelt("get_model")
 
 	getPrizePoolSelector = starknetgoutils.GetSelectorFromNameFelt("get_prize_pool")
 )
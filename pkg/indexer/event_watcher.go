@@ -890,3 +890,48 @@ func eventHash(ev rpc.EmittedEvent, eventIndex int) [32]byte {
 	binary.Write(h, binary.BigEndian, uint64(eventIndex))
 	return [32]byte(h.Sum(nil))
 }
+
+// FetchPromptPaidEvent looks up the PromptPaid event of a single prompt, for
+// prompts whose event was never delivered by the watcher.
+func FetchPromptPaidEvent(ctx context.Context, client starknet.ProviderWrapper, agentAddress *felt.Felt, promptID uint64, fromBlock uint64) (*Event, error) {
+	filter := rpc.EventFilter{
+		FromBlock: rpc.WithBlockNumber(fromBlock),
+		ToBlock:   rpc.WithBlockTag("pending"),
+		Address:   agentAddress,
+		Keys:      [][]*felt.Felt{{promptPaidSelector}, {}, {new(felt.Felt).SetUint64(promptID)}},
+	}
+
+	continuationToken := ""
+	for {
+		var eventsResp *rpc.EventChunk
+		var err error
+
+		if err := client.Do(func(provider rpc.RpcProvider) error {
+			eventsResp, err = provider.Events(ctx, rpc.EventsInput{
+				EventFilter: filter,
+				ResultPageRequest: rpc.ResultPageRequest{
+					ContinuationToken: continuationToken,
+					ChunkSize:         100,
+				},
+			})
+			return err
+		}); err != nil {
+			return nil, fmt.Errorf("failed to get prompt paid event: %w", snaccount.FormatRpcError(err))
+		}
+
+		for _, raw := range eventsResp.Events {
+			ev := &Event{Type: EventPromptPaid, Raw: raw}
+			promptPaidEvent, ok := ev.ToPromptPaidEvent()
+			if ok && promptPaidEvent.PromptID == promptID {
+				return ev, nil
+			}
+		}
+
+		continuationToken = eventsResp.ContinuationToken
+		if continuationToken == "" {
+			break
+		}
+	}
+
+	return nil, fmt.Errorf("prompt paid event not found for prompt %d", promptID)
+}
@@ -157,6 +157,12 @@ func (i *PromptIndexer) registerPromptResponse(data *PromptData, isUpsert bool)
 		existingData.Pending = false
 		existingData.Response = data.Response
 		existingData.Error = data.Error
+		existingData.Moderation = data.Moderation
+		existingData.Model = data.Model
+		existingData.PromptTokens = data.PromptTokens
+		existingData.CompletionTokens = data.CompletionTokens
+		existingData.Cost = data.Cost
+		existingData.Votes = data.Votes
 		return i.db.SetPrompt(existingData)
 	}
 
@@ -2,6 +2,7 @@ package indexer
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"sync"
@@ -21,6 +22,25 @@ type PromptData struct {
 	Error       *string
 	BlockNumber uint64
 	UserAddr    *felt.Felt
+	Moderation  *string
+	// Model is the model that answered the prompt.
+	Model *string
+	// PromptTokens, CompletionTokens and Cost are the usage of the prompt,
+	// the cost being in USD.
+	PromptTokens     *int64
+	CompletionTokens *int64
+	Cost             *float64
+	// Votes are the votes of the models of prompts answered by consensus.
+	Votes []PromptVote
+}
+
+// PromptVote is the vote of a model on a prompt answered by consensus.
+type PromptVote struct {
+	Voter string `json:"voter"`
+	Model string `json:"model,omitempty"`
+	// Drain is the address the model voted to drain to, if any.
+	Drain string `json:"drain,omitempty"`
+	Error string `json:"error,omitempty"`
 }
 
 // PromptIndexerDatabaseReader is the database reader for a PromptIndexer
@@ -77,6 +97,12 @@ func NewPromptIndexerDatabaseSQLite(dbPath string) (*PromptIndexerDatabaseSQLite
 			error TEXT,
 			block_number INTEGER NOT NULL,
 			user_addr TEXT NOT NULL,
+			moderation TEXT,
+			model TEXT,
+			prompt_tokens INTEGER,
+			completion_tokens INTEGER,
+			cost REAL,
+			votes TEXT,
 			PRIMARY KEY (prompt_id, agent_addr)
 		);
 
@@ -89,6 +115,10 @@ func NewPromptIndexerDatabaseSQLite(dbPath string) (*PromptIndexerDatabaseSQLite
 		return nil, fmt.Errorf("failed to create tables: %w", err)
 	}
 
+	if err := addPromptsColumns(db); err != nil {
+		return nil, err
+	}
+
 	return &PromptIndexerDatabaseSQLite{
 		db:          db,
 		agentExists: make(map[[32]byte]interface{}),
@@ -99,10 +129,13 @@ func NewPromptIndexerDatabaseSQLite(dbPath string) (*PromptIndexerDatabaseSQLite
 func (db *PromptIndexerDatabaseSQLite) GetPrompt(promptID uint64, agentAddr *felt.Felt) (*PromptData, bool) {
 	var data PromptData
 	var agentAddrStr, userAddrStr string
-	var response, errMsg sql.NullString
+	var response, errMsg, moderation, model sql.NullString
+	var promptTokens, completionTokens sql.NullInt64
+	var cost sql.NullFloat64
+	var votes sql.NullString
 
 	err := db.db.QueryRow(`
-		SELECT pending, prompt_id, agent_addr, is_drain, prompt, response, error, block_number, user_addr
+		SELECT pending, prompt_id, agent_addr, is_drain, prompt, response, error, block_number, user_addr, moderation, model, prompt_tokens, completion_tokens, cost, votes
 		FROM prompts
 		WHERE prompt_id = ? AND agent_addr = ?
 	`, promptID, agentAddr.String()).Scan(
@@ -115,6 +148,12 @@ func (db *PromptIndexerDatabaseSQLite) GetPrompt(promptID uint64, agentAddr *fel
 		&errMsg,
 		&data.BlockNumber,
 		&userAddrStr,
+		&moderation,
+		&model,
+		&promptTokens,
+		&completionTokens,
+		&cost,
+		&votes,
 	)
 	if err == sql.ErrNoRows {
 		return nil, false
@@ -140,6 +179,22 @@ func (db *PromptIndexerDatabaseSQLite) GetPrompt(promptID uint64, agentAddr *fel
 	if errMsg.Valid {
 		data.Error = &errMsg.String
 	}
+	if moderation.Valid {
+		data.Moderation = &moderation.String
+	}
+	if model.Valid {
+		data.Model = &model.String
+	}
+	if promptTokens.Valid {
+		data.PromptTokens = &promptTokens.Int64
+	}
+	if completionTokens.Valid {
+		data.CompletionTokens = &completionTokens.Int64
+	}
+	if cost.Valid {
+		data.Cost = &cost.Float64
+	}
+	data.Votes = decodePromptVotes(votes)
 
 	return &data, true
 }
@@ -147,7 +202,7 @@ func (db *PromptIndexerDatabaseSQLite) GetPrompt(promptID uint64, agentAddr *fel
 // GetPromptsByAgent returns all prompts for a given agent
 func (db *PromptIndexerDatabaseSQLite) GetPromptsByAgent(agentAddr *felt.Felt, from, to int) ([]*PromptData, error) {
 	query := `
-		SELECT pending, prompt_id, agent_addr, is_drain, prompt, response, error, block_number, user_addr
+		SELECT pending, prompt_id, agent_addr, is_drain, prompt, response, error, block_number, user_addr, moderation, model, prompt_tokens, completion_tokens, cost, votes
 		FROM prompts
 		WHERE agent_addr = ?
 		ORDER BY block_number DESC, prompt_id DESC
@@ -169,7 +224,10 @@ func (db *PromptIndexerDatabaseSQLite) GetPromptsByAgent(agentAddr *felt.Felt, f
 	for rows.Next() {
 		var data PromptData
 		var agentAddrStr, userAddrStr string
-		var response, errMsg sql.NullString
+		var response, errMsg, moderation, model sql.NullString
+		var promptTokens, completionTokens sql.NullInt64
+		var cost sql.NullFloat64
+		var votes sql.NullString
 
 		err := rows.Scan(
 			&data.Pending,
@@ -181,6 +239,12 @@ func (db *PromptIndexerDatabaseSQLite) GetPromptsByAgent(agentAddr *felt.Felt, f
 			&errMsg,
 			&data.BlockNumber,
 			&userAddrStr,
+			&moderation,
+			&model,
+			&promptTokens,
+			&completionTokens,
+			&cost,
+			&votes,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
@@ -202,6 +266,22 @@ func (db *PromptIndexerDatabaseSQLite) GetPromptsByAgent(agentAddr *felt.Felt, f
 		if errMsg.Valid {
 			data.Error = &errMsg.String
 		}
+		if moderation.Valid {
+			data.Moderation = &moderation.String
+		}
+		if model.Valid {
+			data.Model = &model.String
+		}
+		if promptTokens.Valid {
+			data.PromptTokens = &promptTokens.Int64
+		}
+		if completionTokens.Valid {
+			data.CompletionTokens = &completionTokens.Int64
+		}
+		if cost.Valid {
+			data.Cost = &cost.Float64
+		}
+		data.Votes = decodePromptVotes(votes)
 
 		prompts = append(prompts, &data)
 	}
@@ -212,7 +292,7 @@ func (db *PromptIndexerDatabaseSQLite) GetPromptsByAgent(agentAddr *felt.Felt, f
 // GetPromptsByUser returns all prompts for a given user
 func (db *PromptIndexerDatabaseSQLite) GetPromptsByUser(userAddr *felt.Felt, from, to int) ([]*PromptData, error) {
 	query := `
-		SELECT pending, prompt_id, agent_addr, is_drain, prompt, response, error, block_number, user_addr
+		SELECT pending, prompt_id, agent_addr, is_drain, prompt, response, error, block_number, user_addr, moderation, model, prompt_tokens, completion_tokens, cost, votes
 		FROM prompts
 		WHERE user_addr = ?
 		ORDER BY block_number DESC, prompt_id DESC
@@ -234,7 +314,10 @@ func (db *PromptIndexerDatabaseSQLite) GetPromptsByUser(userAddr *felt.Felt, fro
 	for rows.Next() {
 		var data PromptData
 		var agentAddrStr, userAddrStr string
-		var response, errMsg sql.NullString
+		var response, errMsg, moderation, model sql.NullString
+		var promptTokens, completionTokens sql.NullInt64
+		var cost sql.NullFloat64
+		var votes sql.NullString
 
 		err := rows.Scan(
 			&data.Pending,
@@ -246,6 +329,12 @@ func (db *PromptIndexerDatabaseSQLite) GetPromptsByUser(userAddr *felt.Felt, fro
 			&errMsg,
 			&data.BlockNumber,
 			&userAddrStr,
+			&moderation,
+			&model,
+			&promptTokens,
+			&completionTokens,
+			&cost,
+			&votes,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
@@ -267,6 +356,22 @@ func (db *PromptIndexerDatabaseSQLite) GetPromptsByUser(userAddr *felt.Felt, fro
 		if errMsg.Valid {
 			data.Error = &errMsg.String
 		}
+		if moderation.Valid {
+			data.Moderation = &moderation.String
+		}
+		if model.Valid {
+			data.Model = &model.String
+		}
+		if promptTokens.Valid {
+			data.PromptTokens = &promptTokens.Int64
+		}
+		if completionTokens.Valid {
+			data.CompletionTokens = &completionTokens.Int64
+		}
+		if cost.Valid {
+			data.Cost = &cost.Float64
+		}
+		data.Votes = decodePromptVotes(votes)
 
 		prompts = append(prompts, &data)
 	}
@@ -277,7 +382,7 @@ func (db *PromptIndexerDatabaseSQLite) GetPromptsByUser(userAddr *felt.Felt, fro
 // GetPromptsByUserAndAgent returns all prompts for a given user and agent
 func (db *PromptIndexerDatabaseSQLite) GetPromptsByUserAndAgent(userAddr *felt.Felt, agentAddr *felt.Felt, from, to int) ([]*PromptData, error) {
 	query := `
-		SELECT pending, prompt_id, agent_addr, is_drain, prompt, response, error, block_number, user_addr
+		SELECT pending, prompt_id, agent_addr, is_drain, prompt, response, error, block_number, user_addr, moderation, model, prompt_tokens, completion_tokens, cost, votes
 		FROM prompts
 		WHERE user_addr = ? AND agent_addr = ?
 		ORDER BY block_number DESC, prompt_id DESC
@@ -299,7 +404,10 @@ func (db *PromptIndexerDatabaseSQLite) GetPromptsByUserAndAgent(userAddr *felt.F
 	for rows.Next() {
 		var data PromptData
 		var agentAddrStr, userAddrStr string
-		var response, errMsg sql.NullString
+		var response, errMsg, moderation, model sql.NullString
+		var promptTokens, completionTokens sql.NullInt64
+		var cost sql.NullFloat64
+		var votes sql.NullString
 
 		err := rows.Scan(
 			&data.Pending,
@@ -311,6 +419,12 @@ func (db *PromptIndexerDatabaseSQLite) GetPromptsByUserAndAgent(userAddr *felt.F
 			&errMsg,
 			&data.BlockNumber,
 			&userAddrStr,
+			&moderation,
+			&model,
+			&promptTokens,
+			&completionTokens,
+			&cost,
+			&votes,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
@@ -332,6 +446,22 @@ func (db *PromptIndexerDatabaseSQLite) GetPromptsByUserAndAgent(userAddr *felt.F
 		if errMsg.Valid {
 			data.Error = &errMsg.String
 		}
+		if moderation.Valid {
+			data.Moderation = &moderation.String
+		}
+		if model.Valid {
+			data.Model = &model.String
+		}
+		if promptTokens.Valid {
+			data.PromptTokens = &promptTokens.Int64
+		}
+		if completionTokens.Valid {
+			data.CompletionTokens = &completionTokens.Int64
+		}
+		if cost.Valid {
+			data.Cost = &cost.Float64
+		}
+		data.Votes = decodePromptVotes(votes)
 
 		prompts = append(prompts, &data)
 	}
@@ -341,18 +471,24 @@ func (db *PromptIndexerDatabaseSQLite) GetPromptsByUserAndAgent(userAddr *felt.F
 
 // SetPrompt stores a prompt in the database
 func (db *PromptIndexerDatabaseSQLite) SetPrompt(data *PromptData) error {
-	var responseStr, errorStr string
+	var responseStr, errorStr, moderationStr, modelStr string
 	if data.Response != nil {
 		responseStr = *data.Response
 	}
 	if data.Error != nil {
 		errorStr = *data.Error
 	}
+	if data.Moderation != nil {
+		moderationStr = *data.Moderation
+	}
+	if data.Model != nil {
+		modelStr = *data.Model
+	}
 
 	_, err := db.db.Exec(`
 		INSERT OR REPLACE INTO prompts (
-			pending, prompt_id, agent_addr, is_drain, prompt, response, error, block_number, user_addr
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			pending, prompt_id, agent_addr, is_drain, prompt, response, error, block_number, user_addr, moderation, model, prompt_tokens, completion_tokens, cost, votes
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`,
 		data.Pending,
 		data.PromptID,
@@ -363,6 +499,12 @@ func (db *PromptIndexerDatabaseSQLite) SetPrompt(data *PromptData) error {
 		sql.NullString{String: errorStr, Valid: data.Error != nil},
 		data.BlockNumber,
 		data.UserAddr.String(),
+		sql.NullString{String: moderationStr, Valid: data.Moderation != nil},
+		sql.NullString{String: modelStr, Valid: data.Model != nil},
+		data.PromptTokens,
+		data.CompletionTokens,
+		data.Cost,
+		encodePromptVotes(data.Votes),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to insert prompt: %w", err)
@@ -414,3 +556,81 @@ func (db *PromptIndexerDatabaseSQLite) SetAgentExists(addr [32]byte, exists bool
 	}
 	return nil
 }
+
+// addPromptsColumns adds the columns missing from databases created before
+// replies were moderated and the answering model, usage and consensus votes
+// were recorded.
+func addPromptsColumns(db *sql.DB) error {
+	rows, err := db.Query(`PRAGMA table_info(prompts)`)
+	if err != nil {
+		return fmt.Errorf("failed to get prompts table info: %w", err)
+	}
+	defer rows.Close()
+
+	columns := []struct {
+		name string
+		typ  string
+	}{
+		{"moderation", "TEXT"},
+		{"model", "TEXT"},
+		{"prompt_tokens", "INTEGER"},
+		{"completion_tokens", "INTEGER"},
+		{"cost", "REAL"},
+		{"votes", "TEXT"},
+	}
+
+	missing := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		missing[column.name] = true
+	}
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, typ string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &defaultValue, &pk); err != nil {
+			return fmt.Errorf("failed to scan prompts table info: %w", err)
+		}
+		delete(missing, name)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read prompts table info: %w", err)
+	}
+
+	for _, column := range columns {
+		if !missing[column.name] {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE prompts ADD COLUMN %s %s`, column.name, column.typ)); err != nil {
+			return fmt.Errorf("failed to add %s column: %w", column.name, err)
+		}
+	}
+
+	return nil
+}
+
+// encodePromptVotes encodes votes as JSON, NULL when there are none.
+func encodePromptVotes(votes []PromptVote) sql.NullString {
+	if len(votes) == 0 {
+		return sql.NullString{}
+	}
+
+	data, err := json.Marshal(votes)
+	if err != nil {
+		slog.Error("failed to encode prompt votes", "error", err)
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+func decodePromptVotes(votes sql.NullString) []PromptVote {
+	if !votes.Valid {
+		return nil
+	}
+
+	var decoded []PromptVote
+	if err := json.Unmarshal([]byte(votes.String), &decoded); err != nil {
+		slog.Error("failed to decode prompt votes", "error", err)
+		return nil
+	}
+	return decoded
+}
@@ -1,9 +1,12 @@
 package twitter
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"mime/multipart"
 	"net/http"
 	"strconv"
 	"strings"
@@ -12,101 +15,222 @@ import (
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/dghubble/oauth1"
+
+	"github.com/NethermindEth/teeception/pkg/twitter/composer"
 )
 
 const (
-	getTweetURL   = "https://api.x.com/2/tweets/%d?tweet.fields=text"
-	replyTweetURL = "https://api.twitter.com/2/tweets/%d/reply"
-	sendTweetURL  = "https://api.twitter.com/2/tweets"
+	DefaultApiUrl    = "https://api.x.com"
+	DefaultUploadUrl = "https://upload.twitter.com"
+
+	tweetFields     = "tweet.fields=author_id,created_at,conversation_id,reply_settings,entities&expansions=author_id&user.fields=username"
+	getTweetPath    = "/2/tweets/%d?" + tweetFields
+	sendTweetPath   = "/2/tweets"
+	getMePath       = "/2/users/me"
+	uploadMediaPath = "/1.1/media/upload.json"
+	getMentionsPath = "/2/users/%s/mentions?max_results=100&" + tweetFields
 
 	backoffMaxElapsedTime  = 15 * time.Minute
 	backoffInitialInterval = 1 * time.Second
 	backoffMaxInterval     = 5 * time.Minute
-
-	replyMaxSize = 280
-	tweetMaxSize = 280
 )
 
+// TwitterApiClientConfig is the configuration for a TwitterApiClient.
+type TwitterApiClientConfig struct {
+	// ApiUrl and UploadUrl are the base URLs of the v2 API and of media uploads.
+	ApiUrl    string
+	UploadUrl string
+	// HTTPClient is the client OAuth signed requests are sent with.
+	HTTPClient *http.Client
+
+	BackoffInitialInterval time.Duration
+	BackoffMaxInterval     time.Duration
+	BackoffMaxElapsedTime  time.Duration
+
+	// FailOnRateLimit returns ErrRateLimited instead of waiting for exhausted
+	// rate limits to reset, so that callers can use another account.
+	FailOnRateLimit bool
+}
+
 type TwitterApiClient struct {
-	client *http.Client
+	client     *http.Client
+	httpClient *http.Client
+	apiUrl     string
+	uploadUrl  string
+
+	backoffInitialInterval time.Duration
+	backoffMaxInterval     time.Duration
+	backoffMaxElapsedTime  time.Duration
+	failOnRateLimit        bool
+
 	mu     sync.RWMutex
-	reset  time.Time
+	limits map[string]RateLimit
+	userID string
 }
 
 var _ TwitterClient = (*TwitterApiClient)(nil)
+var _ MentionPoller = (*TwitterApiClient)(nil)
+var _ RateLimitReporter = (*TwitterApiClient)(nil)
+
+// NewTwitterApiClient creates a new TwitterApiClient with sensible defaults if none are provided.
+func NewTwitterApiClient(cfg *TwitterApiClientConfig) *TwitterApiClient {
+	if cfg.ApiUrl == "" {
+		cfg.ApiUrl = DefaultApiUrl
+	}
+	if cfg.UploadUrl == "" {
+		cfg.UploadUrl = DefaultUploadUrl
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	if cfg.BackoffInitialInterval <= 0 {
+		cfg.BackoffInitialInterval = backoffInitialInterval
+	}
+	if cfg.BackoffMaxInterval <= 0 {
+		cfg.BackoffMaxInterval = backoffMaxInterval
+	}
+	if cfg.BackoffMaxElapsedTime <= 0 {
+		cfg.BackoffMaxElapsedTime = backoffMaxElapsedTime
+	}
 
-func NewTwitterApiClient() *TwitterApiClient {
 	return &TwitterApiClient{
-		reset: time.Now(),
+		httpClient:             cfg.HTTPClient,
+		apiUrl:                 strings.TrimSuffix(cfg.ApiUrl, "/"),
+		uploadUrl:              strings.TrimSuffix(cfg.UploadUrl, "/"),
+		backoffInitialInterval: cfg.BackoffInitialInterval,
+		backoffMaxInterval:     cfg.BackoffMaxInterval,
+		backoffMaxElapsedTime:  cfg.BackoffMaxElapsedTime,
+		failOnRateLimit:        cfg.FailOnRateLimit,
+		limits:                 make(map[string]RateLimit),
 	}
 }
 
-func (c *TwitterApiClient) Initialize(config *TwitterClientConfig) error {
+func (c *TwitterApiClient) Initialize(ctx context.Context, config *TwitterClientConfig) error {
 	oauthConfig := oauth1.NewConfig(config.ConsumerKey, config.ConsumerSecret)
 	oauthToken := oauth1.NewToken(config.AccessToken, config.AccessTokenSecret)
-	client := oauthConfig.Client(oauth1.NoContext, oauthToken)
+	ctx = context.WithValue(ctx, oauth1.HTTPClient, c.httpClient)
+	client := oauthConfig.Client(ctx, oauthToken)
 
 	c.client = client
 
 	return nil
 }
 
-func (c *TwitterApiClient) waitForRateLimit() {
+func (c *TwitterApiClient) waitForRateLimit(ctx context.Context, endpoint string) error {
 	c.mu.RLock()
-	defer c.mu.RUnlock()
+	limit, ok := c.limits[endpoint]
+	c.mu.RUnlock()
 
-	if time.Now().Before(c.reset) {
-		time.Sleep(time.Until(c.reset))
+	if !ok || !limit.Exhausted(time.Now()) {
+		return nil
+	}
+	if c.failOnRateLimit {
+		return ErrRateLimited
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Until(limit.Reset)):
+		return nil
 	}
 }
 
-func (c *TwitterApiClient) updateRateLimits(resp *http.Response) {
+func (c *TwitterApiClient) updateRateLimits(endpoint string, resp *http.Response) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	slog.Info(
 		"x api rate limits",
+		"endpoint", endpoint,
 		"limit", resp.Header.Get("x-rate-limit-limit"),
 		"remaining", resp.Header.Get("x-rate-limit-remaining"),
 		"reset", resp.Header.Get("x-rate-limit-reset"),
 	)
 
-	if resetStr := resp.Header.Get("x-rate-limit-reset"); resetStr != "" {
-		if resetTime, err := strconv.ParseInt(resetStr, 10, 64); err == nil {
-			c.reset = time.Unix(resetTime, 0)
-		}
+	resetTime, err := strconv.ParseInt(resp.Header.Get("x-rate-limit-reset"), 10, 64)
+	if err != nil {
+		return
 	}
+
+	limit := RateLimit{
+		Reset: time.Unix(resetTime, 0),
+	}
+	limit.Limit, _ = strconv.Atoi(resp.Header.Get("x-rate-limit-limit"))
+	limit.Remaining, _ = strconv.Atoi(resp.Header.Get("x-rate-limit-remaining"))
+	if resp.StatusCode == http.StatusTooManyRequests {
+		limit.Remaining = 0
+	}
+
+	c.limits[endpoint] = limit
+}
+
+func (c *TwitterApiClient) RateLimit(endpoint string) (RateLimit, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	limit, ok := c.limits[endpoint]
+	return limit, ok
+}
+
+func (c *TwitterApiClient) RateLimits() map[string]RateLimit {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	limits := make(map[string]RateLimit, len(c.limits))
+	for endpoint, limit := range c.limits {
+		limits[endpoint] = limit
+	}
+	return limits
 }
 
 func (c *TwitterApiClient) doWithRetry(req *http.Request) (*http.Response, error) {
 	b := backoff.NewExponentialBackOff()
-	b.MaxElapsedTime = backoffMaxElapsedTime
-	b.InitialInterval = backoffInitialInterval
-	b.MaxInterval = backoffMaxInterval
+	b.MaxElapsedTime = c.backoffMaxElapsedTime
+	b.InitialInterval = c.backoffInitialInterval
+	b.MaxInterval = c.backoffMaxInterval
+
+	ctx := req.Context()
 
 	var resp *http.Response
 	var err error
 
+	endpoint := endpointOf(req)
+	attempt := 0
+
 	operation := func() error {
-		c.waitForRateLimit()
+		if err := c.waitForRateLimit(ctx, endpoint); err != nil {
+			return backoff.Permanent(err)
+		}
+
+		// The body of the previous attempt was consumed.
+		if attempt > 0 && req.GetBody != nil {
+			req.Body, err = req.GetBody()
+			if err != nil {
+				return backoff.Permanent(err)
+			}
+		}
+		attempt++
 
 		resp, err = c.client.Do(req)
 		if err != nil {
-			resp.Body.Close()
 			return err
 		}
 
-		c.updateRateLimits(resp)
+		c.updateRateLimits(endpoint, resp)
 
 		if resp.StatusCode == http.StatusTooManyRequests {
 			resp.Body.Close()
+			if c.failOnRateLimit {
+				return backoff.Permanent(ErrRateLimited)
+			}
 			return fmt.Errorf("rate limit exceeded")
 		}
 
 		return nil
 	}
 
-	err = backoff.Retry(operation, b)
+	err = backoff.Retry(operation, backoff.WithContext(b, ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -114,100 +238,372 @@ func (c *TwitterApiClient) doWithRetry(req *http.Request) (*http.Response, error
 	return resp, nil
 }
 
-func (c *TwitterApiClient) GetTweetText(tweetID uint64) (string, error) {
+func (c *TwitterApiClient) GetTweet(ctx context.Context, tweetID uint64) (*Tweet, error) {
 	if tweetID == 0 {
-		return "", fmt.Errorf("tweet ID is 0")
+		return nil, fmt.Errorf("tweet ID is 0")
 	}
 
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf(getTweetURL, tweetID), nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.apiUrl+fmt.Sprintf(getTweetPath, tweetID), nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
+		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
 
 	resp, err := c.doWithRetry(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to get tweet by id: %v", err)
+		return nil, fmt.Errorf("failed to get tweet by id: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to get tweet by id: %v", resp.Status)
+		return nil, fmt.Errorf("failed to get tweet by id: %w", newStatusError(resp))
 	}
 
-	type tweet struct {
-		Data struct {
-			Text string `json:"text"`
-		} `json:"data"`
+	var data struct {
+		Data     apiTweet    `json:"data"`
+		Includes apiIncludes `json:"includes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to decode tweet: %v", err)
 	}
 
-	var data tweet
-	err = json.NewDecoder(resp.Body).Decode(&data)
+	tweet, err := data.Data.toTweet(data.Includes.usernames())
 	if err != nil {
-		return "", fmt.Errorf("failed to decode tweet: %v", err)
+		return nil, err
 	}
 
-	return data.Data.Text, nil
+	return &tweet, nil
 }
 
-func (c *TwitterApiClient) ReplyToTweet(tweetID uint64, reply string) error {
+func (c *TwitterApiClient) ReplyToTweet(ctx context.Context, tweetID uint64, reply string) (uint64, error) {
 	slog.Info("replying to tweet", "tweet_id", tweetID, "reply", reply)
 
-	if len(reply) > replyMaxSize {
-		reply = reply[:replyMaxSize]
+	id, err := c.postThread(ctx, reply, tweetID, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reply to tweet: %w", err)
 	}
 
-	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf(replyTweetURL, tweetID), strings.NewReader(reply))
+	return id, nil
+}
+
+func (c *TwitterApiClient) SendTweet(ctx context.Context, tweet string) (uint64, error) {
+	slog.Info("sending tweet", "tweet", tweet)
+
+	id, err := c.postThread(ctx, tweet, 0, nil)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
+		return 0, fmt.Errorf("failed to send tweet: %w", err)
+	}
+
+	return id, nil
+}
+
+func (c *TwitterApiClient) SendTweetWithImage(ctx context.Context, tweet string, image []byte) (uint64, error) {
+	slog.Info("sending tweet with image", "tweet", tweet, "image_size", len(image))
+
+	mediaID, err := c.uploadMedia(ctx, image)
+	if err != nil {
+		return 0, fmt.Errorf("failed to upload image: %w", err)
+	}
+
+	id, err := c.postThread(ctx, tweet, 0, []string{mediaID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to send tweet: %w", err)
+	}
+
+	return id, nil
+}
+
+// postThread posts text as a thread, optionally replying to inReplyTo, with
+// the media attached to its first part. Each part replies to the previous
+// one. It returns the ID of the first part.
+func (c *TwitterApiClient) postThread(ctx context.Context, text string, inReplyTo uint64, mediaIDs []string) (uint64, error) {
+	var firstID uint64
+	for _, part := range composer.ComposeTagged(text) {
+		id, err := c.postTweet(ctx, part, inReplyTo, mediaIDs...)
+		if err != nil {
+			return 0, err
+		}
+		if firstID == 0 {
+			firstID = id
+		}
+		inReplyTo = id
+		mediaIDs = nil
+	}
+
+	return firstID, nil
+}
+
+// uploadMedia uploads an image and returns its media ID.
+func (c *TwitterApiClient) uploadMedia(ctx context.Context, image []byte) (string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	part, err := writer.CreateFormFile("media", "card.png")
+	if err != nil {
+		return "", fmt.Errorf("failed to create form file: %v", err)
+	}
+	if _, err := part.Write(image); err != nil {
+		return "", fmt.Errorf("failed to write form file: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		return "", fmt.Errorf("failed to close form: %v", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.uploadUrl+uploadMediaPath, bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
 
 	resp, err := c.doWithRetry(req)
 	if err != nil {
-		return fmt.Errorf("failed to r to tweet: %v", err)
+		return "", err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to reply to tweet: %v", resp.Status)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return "", newStatusError(resp)
 	}
 
-	return nil
-}
+	var data struct {
+		MediaID string `json:"media_id_string"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return "", fmt.Errorf("failed to decode media: %v", err)
+	}
+	if data.MediaID == "" {
+		return "", fmt.Errorf("no media id in response")
+	}
 
-func (c *TwitterApiClient) SendTweet(tweet string) error {
-	slog.Info("sending tweet", "tweet", tweet)
+	return data.MediaID, nil
+}
 
-	if len(tweet) > tweetMaxSize {
-		tweet = tweet[:tweetMaxSize]
+// postTweet posts a single tweet, optionally as a reply and with media, and returns its ID.
+func (c *TwitterApiClient) postTweet(ctx context.Context, text string, inReplyTo uint64, mediaIDs ...string) (uint64, error) {
+	type replySettings struct {
+		InReplyToTweetID string `json:"in_reply_to_tweet_id"`
+	}
+	type mediaSettings struct {
+		MediaIDs []string `json:"media_ids"`
 	}
 
 	payload := struct {
-		Text string `json:"text"`
+		Text  string         `json:"text"`
+		Reply *replySettings `json:"reply,omitempty"`
+		Media *mediaSettings `json:"media,omitempty"`
 	}{
-		Text: tweet,
+		Text: text,
+	}
+	if len(mediaIDs) > 0 {
+		payload.Media = &mediaSettings{
+			MediaIDs: mediaIDs,
+		}
+	}
+	if inReplyTo != 0 {
+		payload.Reply = &replySettings{
+			InReplyToTweetID: strconv.FormatUint(inReplyTo, 10),
+		}
 	}
 
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("failed to marshal tweet payload: %v", err)
+		return 0, fmt.Errorf("failed to marshal tweet payload: %v", err)
 	}
 
-	req, err := http.NewRequest(http.MethodPost, sendTweetURL, strings.NewReader(string(payloadBytes)))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.apiUrl+sendTweetPath, bytes.NewReader(payloadBytes))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
+		return 0, fmt.Errorf("failed to create request: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.doWithRetry(req)
 	if err != nil {
-		return fmt.Errorf("failed to send tweet: %v", err)
+		return 0, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("failed to send tweet: %v", resp.Status)
+		return 0, newStatusError(resp)
 	}
 
-	return nil
+	var data struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return 0, fmt.Errorf("failed to decode tweet: %v", err)
+	}
+
+	id, err := strconv.ParseUint(data.Data.ID, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid tweet id %q: %v", data.Data.ID, err)
+	}
+
+	return id, nil
+}
+
+func (c *TwitterApiClient) GetMentions(ctx context.Context, sinceID uint64) ([]Tweet, error) {
+	userID, err := c.getUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	url := c.apiUrl + fmt.Sprintf(getMentionsPath, userID)
+	if sinceID != 0 {
+		url += fmt.Sprintf("&since_id=%d", sinceID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	resp, err := c.doWithRetry(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mentions: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get mentions: %w", newStatusError(resp))
+	}
+
+	var data struct {
+		Data     []apiTweet  `json:"data"`
+		Includes apiIncludes `json:"includes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to decode mentions: %v", err)
+	}
+
+	usernames := data.Includes.usernames()
+
+	// The API returns the newest mentions first.
+	mentions := make([]Tweet, 0, len(data.Data))
+	for i := len(data.Data) - 1; i >= 0; i-- {
+		tweet, err := data.Data[i].toTweet(usernames)
+		if err != nil {
+			return nil, err
+		}
+
+		mentions = append(mentions, tweet)
+	}
+
+	return mentions, nil
+}
+
+// getUserID returns the ID of the authenticated user, fetching it on first use.
+func (c *TwitterApiClient) getUserID(ctx context.Context) (string, error) {
+	c.mu.RLock()
+	userID := c.userID
+	c.mu.RUnlock()
+
+	if userID != "" {
+		return userID, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.apiUrl+getMePath, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %v", err)
+	}
+
+	resp, err := c.doWithRetry(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get user: %w", newStatusError(resp))
+	}
+
+	var data struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return "", fmt.Errorf("failed to decode user: %v", err)
+	}
+
+	c.mu.Lock()
+	c.userID = data.Data.ID
+	c.mu.Unlock()
+
+	return data.Data.ID, nil
+}
+
+// apiTweet is a tweet object of the v2 API.
+type apiTweet struct {
+	ID             string    `json:"id"`
+	Text           string    `json:"text"`
+	AuthorID       string    `json:"author_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	ConversationID string    `json:"conversation_id"`
+	ReplySettings  string    `json:"reply_settings"`
+	Entities       struct {
+		Mentions []struct {
+			Username string `json:"username"`
+		} `json:"mentions"`
+		Hashtags []struct {
+			Tag string `json:"tag"`
+		} `json:"hashtags"`
+		URLs []struct {
+			URL         string `json:"url"`
+			ExpandedURL string `json:"expanded_url"`
+		} `json:"urls"`
+	} `json:"entities"`
+}
+
+// apiIncludes are the objects expanded in a v2 API response.
+type apiIncludes struct {
+	Users []struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	} `json:"users"`
+}
+
+func (i apiIncludes) usernames() map[string]string {
+	usernames := make(map[string]string, len(i.Users))
+	for _, user := range i.Users {
+		usernames[user.ID] = user.Username
+	}
+	return usernames
+}
+
+func (t apiTweet) toTweet(usernames map[string]string) (Tweet, error) {
+	id, err := strconv.ParseUint(t.ID, 10, 64)
+	if err != nil {
+		return Tweet{}, fmt.Errorf("invalid tweet id %q: %v", t.ID, err)
+	}
+
+	tweet := Tweet{
+		ID:             id,
+		Text:           t.Text,
+		AuthorID:       t.AuthorID,
+		AuthorUsername: usernames[t.AuthorID],
+		CreatedAt:      t.CreatedAt,
+		ReplySettings:  t.ReplySettings,
+	}
+	if t.ConversationID != "" {
+		tweet.ConversationID, err = strconv.ParseUint(t.ConversationID, 10, 64)
+		if err != nil {
+			return Tweet{}, fmt.Errorf("invalid conversation id %q: %v", t.ConversationID, err)
+		}
+	}
+	for _, mention := range t.Entities.Mentions {
+		tweet.Entities.Mentions = append(tweet.Entities.Mentions, mention.Username)
+	}
+	for _, hashtag := range t.Entities.Hashtags {
+		tweet.Entities.Hashtags = append(tweet.Entities.Hashtags, hashtag.Tag)
+	}
+	for _, url := range t.Entities.URLs {
+		if url.ExpandedURL != "" {
+			tweet.Entities.URLs = append(tweet.Entities.URLs, url.ExpandedURL)
+		} else {
+			tweet.Entities.URLs = append(tweet.Entities.URLs, url.URL)
+		}
+	}
+
+	return tweet, nil
 }
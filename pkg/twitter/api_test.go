@@ -0,0 +1,268 @@
+package twitter_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/teeception/pkg/twitter"
+	"github.com/NethermindEth/teeception/pkg/twitter/twittertest"
+)
+
+const testConsumerKey = "consumer-key"
+
+func newTestClient(t *testing.T, cfg *twittertest.ServerConfig) (*twitter.TwitterApiClient, *twittertest.Server) {
+	t.Helper()
+
+	if cfg.ConsumerKey == "" {
+		cfg.ConsumerKey = testConsumerKey
+	}
+	server := twittertest.NewServer(cfg)
+	t.Cleanup(server.Close)
+
+	client := twitter.NewTwitterApiClient(&twitter.TwitterApiClientConfig{
+		ApiUrl:                 server.URL,
+		UploadUrl:              server.URL,
+		BackoffInitialInterval: time.Millisecond,
+		BackoffMaxInterval:     10 * time.Millisecond,
+		BackoffMaxElapsedTime:  time.Second,
+	})
+	err := client.Initialize(context.Background(), &twitter.TwitterClientConfig{
+		ConsumerKey:       testConsumerKey,
+		ConsumerSecret:    "consumer-secret",
+		AccessToken:       "access-token",
+		AccessTokenSecret: "access-token-secret",
+	})
+	if err != nil {
+		t.Fatalf("failed to initialize client: %v", err)
+	}
+
+	return client, server
+}
+
+func TestTwitterApiClientGetTweet(t *testing.T) {
+	client, server := newTestClient(t, &twittertest.ServerConfig{})
+	createdAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	server.AddTweet(&twittertest.Tweet{ID: 41, AuthorID: "8", Username: "bob", Text: "first"})
+	server.AddTweet(&twittertest.Tweet{
+		ID:             42,
+		AuthorID:       "7",
+		Username:       "alice",
+		Text:           "hello :agent: @agent #teeception https://example.com",
+		CreatedAt:      createdAt,
+		ConversationID: 41,
+	})
+
+	tweet, err := client.GetTweet(context.Background(), 42)
+	if err != nil {
+		t.Fatalf("failed to get tweet: %v", err)
+	}
+	if tweet.ID != 42 || tweet.Text != "hello :agent: @agent #teeception https://example.com" {
+		t.Fatalf("unexpected tweet %+v", tweet)
+	}
+	if tweet.AuthorID != "7" || tweet.AuthorUsername != "alice" {
+		t.Fatalf("expected author 7/alice, got %s/%s", tweet.AuthorID, tweet.AuthorUsername)
+	}
+	if !tweet.CreatedAt.Equal(createdAt) {
+		t.Fatalf("expected created at %v, got %v", createdAt, tweet.CreatedAt)
+	}
+	if tweet.ConversationID != 41 || tweet.ReplySettings != "everyone" {
+		t.Fatalf("expected conversation 41 open to everyone, got %d %q", tweet.ConversationID, tweet.ReplySettings)
+	}
+	entities := tweet.Entities
+	if len(entities.Mentions) != 1 || entities.Mentions[0] != "agent" ||
+		len(entities.Hashtags) != 1 || entities.Hashtags[0] != "teeception" ||
+		len(entities.URLs) != 1 || entities.URLs[0] != "https://example.com" {
+		t.Fatalf("unexpected entities %+v", entities)
+	}
+
+	if _, err := client.GetTweet(context.Background(), 43); err == nil {
+		t.Fatalf("expected error for unknown tweet")
+	}
+	if server.AuthFailures() != 0 {
+		t.Fatalf("expected requests to be signed, got %d auth failures", server.AuthFailures())
+	}
+}
+
+func TestTwitterApiClientUnsigned(t *testing.T) {
+	client, server := newTestClient(t, &twittertest.ServerConfig{ConsumerKey: "other-key"})
+	server.AddTweet(&twittertest.Tweet{ID: 42, Text: "hello"})
+
+	if _, err := client.GetTweet(context.Background(), 42); err == nil {
+		t.Fatalf("expected error for request signed with the wrong consumer key")
+	}
+	if server.AuthFailures() != 1 {
+		t.Fatalf("expected 1 auth failure, got %d", server.AuthFailures())
+	}
+}
+
+func TestTwitterApiClientReplyThread(t *testing.T) {
+	client, server := newTestClient(t, &twittertest.ServerConfig{})
+	server.AddTweet(&twittertest.Tweet{ID: 42, AuthorID: "7", Username: "alice", Text: "hello"})
+
+	reply := ":agent: " + strings.Repeat("This sentence is long enough to need a thread. ", 10)
+	id, err := client.ReplyToTweet(context.Background(), 42, reply)
+	if err != nil {
+		t.Fatalf("failed to reply to tweet: %v", err)
+	}
+
+	posted := server.Posted()
+	if len(posted) < 2 {
+		t.Fatalf("expected a thread, got %d tweets", len(posted))
+	}
+	if id != posted[0].ID {
+		t.Fatalf("expected the id of the first part %d, got %d", posted[0].ID, id)
+	}
+
+	inReplyTo := uint64(42)
+	for i, tweet := range posted {
+		if tweet.InReplyTo != inReplyTo {
+			t.Fatalf("expected part %d to reply to %d, got %d", i, inReplyTo, tweet.InReplyTo)
+		}
+		if !strings.HasPrefix(tweet.Text, ":agent:") {
+			t.Fatalf("expected part %d to be tagged, got %q", i, tweet.Text)
+		}
+		inReplyTo = tweet.ID
+	}
+}
+
+func TestTwitterApiClientSendTweetWithImage(t *testing.T) {
+	client, server := newTestClient(t, &twittertest.ServerConfig{})
+
+	image := []byte("\x89PNG\r\n\x1a\nimage")
+	if _, err := client.SendTweetWithImage(context.Background(), ":agent: drained", image); err != nil {
+		t.Fatalf("failed to send tweet: %v", err)
+	}
+
+	posted := server.Posted()
+	if len(posted) != 1 {
+		t.Fatalf("expected 1 tweet, got %d", len(posted))
+	}
+	if len(posted[0].MediaIDs) != 1 {
+		t.Fatalf("expected 1 media attachment, got %d", len(posted[0].MediaIDs))
+	}
+
+	media, ok := server.Media(posted[0].MediaIDs[0])
+	if !ok || !bytes.Equal(media, image) {
+		t.Fatalf("expected uploaded media to match the image")
+	}
+}
+
+func TestTwitterApiClientRetry(t *testing.T) {
+	client, server := newTestClient(t, &twittertest.ServerConfig{})
+	server.FailNext(twittertest.EndpointPostTweet, http.StatusTooManyRequests, http.StatusTooManyRequests)
+
+	if _, err := client.SendTweet(context.Background(), ":agent: hello"); err != nil {
+		t.Fatalf("failed to send tweet: %v", err)
+	}
+
+	if requests := server.Requests(twittertest.EndpointPostTweet); requests != 3 {
+		t.Fatalf("expected 3 requests, got %d", requests)
+	}
+
+	// The retried request must carry the same body as the first attempt.
+	posted := server.Posted()
+	if len(posted) != 1 || posted[0].Text != ":agent: hello" {
+		t.Fatalf("expected the tweet to be posted once after retrying, got %+v", posted)
+	}
+}
+
+func TestTwitterApiClientCancel(t *testing.T) {
+	client, server := newTestClient(t, &twittertest.ServerConfig{
+		RateLimit:       1,
+		RateLimitWindow: time.Hour,
+	})
+
+	if _, err := client.SendTweet(context.Background(), ":agent: hello"); err != nil {
+		t.Fatalf("failed to send tweet: %v", err)
+	}
+
+	// The window is exhausted, so the client waits for its reset unless cancelled.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := client.SendTweet(ctx, ":agent: hello again"); err == nil {
+		t.Fatalf("expected error for cancelled context")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected cancellation to abort the retries, took %v", elapsed)
+	}
+	if len(server.Posted()) != 1 {
+		t.Fatalf("expected only the first tweet to be posted")
+	}
+}
+
+func TestTwitterApiClientStatusError(t *testing.T) {
+	client, server := newTestClient(t, &twittertest.ServerConfig{})
+	server.FailNext(twittertest.EndpointPostTweet, http.StatusForbidden)
+
+	if _, err := client.SendTweet(context.Background(), ":agent: hello"); err == nil {
+		t.Fatalf("expected error for forbidden response")
+	}
+	if requests := server.Requests(twittertest.EndpointPostTweet); requests != 1 {
+		t.Fatalf("expected non-429 errors not to be retried, got %d requests", requests)
+	}
+	if len(server.Posted()) != 0 {
+		t.Fatalf("expected no tweet to be posted")
+	}
+}
+
+func TestTwitterApiClientRateLimits(t *testing.T) {
+	client, _ := newTestClient(t, &twittertest.ServerConfig{
+		RateLimit:       5,
+		RateLimitWindow: time.Hour,
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.SendTweet(context.Background(), ":agent: hello"); err != nil {
+			t.Fatalf("failed to send tweet: %v", err)
+		}
+	}
+
+	limit, ok := client.RateLimit(twitter.EndpointPostTweet)
+	if !ok {
+		t.Fatalf("expected rate limit for %s", twitter.EndpointPostTweet)
+	}
+	if limit.Limit != 5 || limit.Remaining != 3 {
+		t.Fatalf("expected 3/5 remaining, got %d/%d", limit.Remaining, limit.Limit)
+	}
+	if limit.Exhausted(time.Now()) {
+		t.Fatalf("expected rate limit not to be exhausted")
+	}
+	if time.Until(limit.Reset) < 50*time.Minute {
+		t.Fatalf("expected reset about an hour from now, got %v", limit.Reset)
+	}
+}
+
+func TestTwitterApiClientGetMentions(t *testing.T) {
+	client, server := newTestClient(t, &twittertest.ServerConfig{UserID: "1000", Username: "agent"})
+	server.AddTweet(&twittertest.Tweet{ID: 10, AuthorID: "7", Username: "alice", Text: "@agent first"})
+	server.AddTweet(&twittertest.Tweet{ID: 11, AuthorID: "8", Username: "bob", Text: "unrelated"})
+	server.AddTweet(&twittertest.Tweet{ID: 12, AuthorID: "8", Username: "bob", Text: "@agent second"})
+
+	mentions, err := client.GetMentions(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("failed to get mentions: %v", err)
+	}
+	if len(mentions) != 2 {
+		t.Fatalf("expected 2 mentions, got %d", len(mentions))
+	}
+	if mentions[0].ID != 10 || mentions[0].AuthorUsername != "alice" {
+		t.Fatalf("expected oldest mention first, got %+v", mentions[0])
+	}
+	if mentions[1].ID != 12 || mentions[1].AuthorUsername != "bob" {
+		t.Fatalf("expected newest mention last, got %+v", mentions[1])
+	}
+
+	mentions, err = client.GetMentions(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("failed to get mentions: %v", err)
+	}
+	if len(mentions) != 1 || mentions[0].ID != 12 {
+		t.Fatalf("expected only mentions after the cursor, got %+v", mentions)
+	}
+}
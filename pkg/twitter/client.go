@@ -1,18 +1,119 @@
 package twitter
 
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
 type TwitterClientConfig struct {
-	Username          string
-	Password          string
-	Email             string
-	ConsumerKey       string
-	ConsumerSecret    string
-	AccessToken       string
-	AccessTokenSecret string
+	Username          string `json:"username"`
+	Password          string `json:"password,omitempty"`
+	Email             string `json:"email,omitempty"`
+	ConsumerKey       string `json:"consumer_key"`
+	ConsumerSecret    string `json:"consumer_secret"`
+	AccessToken       string `json:"access_token"`
+	AccessTokenSecret string `json:"access_token_secret"`
+}
+
+// Tweet is a tweet with its author and metadata.
+type Tweet struct {
+	ID             uint64        `json:"id"`
+	Text           string        `json:"text"`
+	AuthorID       string        `json:"author_id"`
+	AuthorUsername string        `json:"author_username"`
+	CreatedAt      time.Time     `json:"created_at"`
+	ConversationID uint64        `json:"conversation_id,omitempty"`
+	ReplySettings  string        `json:"reply_settings,omitempty"`
+	Entities       TweetEntities `json:"entities"`
+}
+
+// TweetEntities are the entities parsed from the text of a tweet.
+type TweetEntities struct {
+	// Mentions are the mentioned usernames, without the "@".
+	Mentions []string `json:"mentions,omitempty"`
+	// Hashtags are the tags, without the "#".
+	Hashtags []string `json:"hashtags,omitempty"`
+	// URLs are the expanded URLs.
+	URLs []string `json:"urls,omitempty"`
 }
 
 type TwitterClient interface {
-	Initialize(config *TwitterClientConfig) error
-	GetTweetText(tweetID uint64) (string, error)
-	ReplyToTweet(tweetID uint64, reply string) error
-	SendTweet(tweet string) error
+	Initialize(ctx context.Context, config *TwitterClientConfig) error
+	GetTweet(ctx context.Context, tweetID uint64) (*Tweet, error)
+	// ReplyToTweet replies to a tweet, threading long replies, and returns the
+	// ID of the first created tweet.
+	ReplyToTweet(ctx context.Context, tweetID uint64, reply string) (uint64, error)
+	// SendTweet sends a tweet, threading long tweets, and returns the ID of the
+	// first created tweet.
+	SendTweet(ctx context.Context, tweet string) (uint64, error)
+	// SendTweetWithImage sends a tweet with a PNG image attached to its first part.
+	SendTweetWithImage(ctx context.Context, tweet string, image []byte) (uint64, error)
+}
+
+// MentionPoller is implemented by clients that can list mentions of the
+// authenticated user. It is optional, agents without it only react to paid prompts.
+type MentionPoller interface {
+	// GetMentions returns the mentions newer than sinceID, oldest first.
+	GetMentions(ctx context.Context, sinceID uint64) ([]Tweet, error)
+}
+
+const (
+	// EndpointPostTweet is the endpoint tweets and replies are posted to.
+	EndpointPostTweet   = "POST /2/tweets"
+	EndpointGetTweet    = "GET /2/tweets/:id"
+	EndpointGetMentions = "GET /2/users/:id/mentions"
+)
+
+// ErrRateLimited is returned by clients that do not wait for exhausted rate limits.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// StatusError is returned when the API responds with an unexpected status.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func newStatusError(resp *http.Response) *StatusError {
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+	}
+}
+
+func (e *StatusError) Error() string {
+	return "unexpected status: " + e.Status
+}
+
+// RateLimit is the rate limit of an endpoint as reported by the x-rate-limit-* headers.
+type RateLimit struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+}
+
+// Exhausted reports whether no requests are left until the limit resets.
+func (l RateLimit) Exhausted(now time.Time) bool {
+	return l.Remaining <= 0 && now.Before(l.Reset)
+}
+
+// RateLimitReporter is implemented by clients that track rate limits per endpoint.
+type RateLimitReporter interface {
+	RateLimit(endpoint string) (RateLimit, bool)
+	RateLimits() map[string]RateLimit
+}
+
+// endpointOf returns the endpoint of a request with IDs in its path replaced,
+// e.g. "GET /2/tweets/:id".
+func endpointOf(req *http.Request) string {
+	segments := strings.Split(req.URL.Path, "/")
+	for i, segment := range segments {
+		// Skip the API version, IDs are much longer.
+		if len(segment) > 2 && strings.Trim(segment, "0123456789") == "" {
+			segments[i] = ":id"
+		}
+	}
+	return req.Method + " " + strings.Join(segments, "/")
 }
@@ -0,0 +1,328 @@
+// Package composer counts tweet length the way Twitter does and splits long
+// texts into numbered threads.
+//
+// Counting follows twitter-text v3: text is NFC normalized, code points in the
+// Latin and general punctuation ranges weigh 1, everything else weighs 2, every
+// URL weighs 23 and an emoji sequence weighs 2 regardless of its length.
+package composer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// MaxTweetLength is the maximum weighted length of a tweet.
+	MaxTweetLength = 280
+	// URLLength is the weighted length of any URL after t.co shortening.
+	URLLength = 23
+
+	defaultWeight = 2
+)
+
+// weightRange is a code point range with a custom weight.
+type weightRange struct {
+	start, end rune
+	weight     int
+}
+
+var weightRanges = []weightRange{
+	{0x0000, 0x10FF, 1},
+	{0x2000, 0x200D, 1},
+	{0x2010, 0x201F, 1},
+	{0x2032, 0x2037, 1},
+}
+
+var (
+	urlRegex = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"]*[^\s<>".,!?;:'")\]]`)
+	tagRegex = regexp.MustCompile(`^:([^:\s]+):\s*`)
+)
+
+// Tag returns the agent tag prefixed to every tweet sent on behalf of an agent.
+func Tag(agentName string) string {
+	return fmt.Sprintf(":%s:", agentName)
+}
+
+// Tagged prefixes text with the tag of the given agent.
+func Tagged(agentName, text string) string {
+	return Tag(agentName) + " " + text
+}
+
+// SplitTag splits a leading agent tag off text. The tag is empty if text is not tagged.
+func SplitTag(text string) (tag, body string) {
+	loc := tagRegex.FindStringSubmatchIndex(text)
+	if loc == nil {
+		return "", text
+	}
+
+	return text[loc[2]-1 : loc[3]+1], text[loc[1]:]
+}
+
+// Length returns the weighted length of text as counted by Twitter.
+func Length(text string) int {
+	text = norm.NFC.String(text)
+
+	length := 0
+	last := 0
+	for _, loc := range urlRegex.FindAllStringIndex(text, -1) {
+		length += runesLength(text[last:loc[0]]) + URLLength
+		last = loc[1]
+	}
+
+	return length + runesLength(text[last:])
+}
+
+// IsValid reports whether text fits in a single tweet.
+func IsValid(text string) bool {
+	return Length(text) <= MaxTweetLength
+}
+
+func runesLength(text string) int {
+	length := 0
+	for len(text) > 0 {
+		size, weight := characterSize(text)
+		length += weight
+		text = text[size:]
+	}
+	return length
+}
+
+// characterSize returns the byte size and the weight of the character text
+// starts with, emoji sequences being a single character.
+func characterSize(text string) (int, int) {
+	r, size := utf8.DecodeRuneInString(text)
+	if isEmoji(r) {
+		return emojiSequenceSize(text), defaultWeight
+	}
+	return size, runeWeight(r)
+}
+
+func runeWeight(r rune) int {
+	for _, wr := range weightRanges {
+		if r >= wr.start && r <= wr.end {
+			return wr.weight
+		}
+	}
+	return defaultWeight
+}
+
+func isEmoji(r rune) bool {
+	return (r >= 0x1F000 && r <= 0x1FAFF) || (r >= 0x2600 && r <= 0x27BF)
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+// emojiSequenceSize returns the byte size of the emoji sequence text starts
+// with, including variation selectors, skin tone modifiers, keycaps, tags and
+// zero width joined emoji.
+func emojiSequenceSize(text string) int {
+	first, size := utf8.DecodeRuneInString(text)
+	if isRegionalIndicator(first) {
+		// Regional indicators pair up into a single flag.
+		if next, n := utf8.DecodeRuneInString(text[size:]); isRegionalIndicator(next) {
+			size += n
+		}
+		return size
+	}
+
+	for size < len(text) {
+		r, n := utf8.DecodeRuneInString(text[size:])
+		switch {
+		case r == 0xFE0F || r == 0x20E3 || (r >= 0x1F3FB && r <= 0x1F3FF) || (r >= 0xE0020 && r <= 0xE007F):
+			size += n
+		case r == 0x200D:
+			next, m := utf8.DecodeRuneInString(text[size+n:])
+			if !isEmoji(next) {
+				return size
+			}
+			size += n + m
+		default:
+			return size
+		}
+	}
+	return size
+}
+
+// Compose splits text into tweets of at most MaxTweetLength each, breaking at
+// sentence boundaries where possible. Every tweet is prefixed with tag, and
+// tweets of a thread are suffixed with their position, e.g. " (1/3)".
+func Compose(tag, text string) []string {
+	text = strings.TrimSpace(norm.NFC.String(text))
+
+	prefix := ""
+	if tag != "" {
+		prefix = tag + " "
+	}
+
+	if IsValid(prefix + text) {
+		return []string{prefix + text}
+	}
+
+	// The space left for the text depends on the width of the numbering, so
+	// retry with wider numbering until the thread fits.
+	for digits := 1; ; digits++ {
+		suffixLength := Length(fmt.Sprintf(" (%s/%s)", strings.Repeat("9", digits), strings.Repeat("9", digits)))
+		budget := MaxTweetLength - Length(prefix) - suffixLength
+		if budget <= 0 {
+			return []string{truncate(prefix+text, MaxTweetLength)}
+		}
+
+		parts := pack(text, budget)
+		if len(fmt.Sprint(len(parts))) > digits {
+			continue
+		}
+
+		tweets := make([]string, len(parts))
+		for i, part := range parts {
+			tweets[i] = fmt.Sprintf("%s%s (%d/%d)", prefix, part, i+1, len(parts))
+		}
+		return tweets
+	}
+}
+
+// ComposeTagged is like Compose but reuses the agent tag text starts with, if any.
+func ComposeTagged(text string) []string {
+	tag, body := SplitTag(strings.TrimSpace(text))
+	return Compose(tag, body)
+}
+
+// pack greedily fills parts of at most budget with whole sentences, falling
+// back to words and then to single characters for overlong pieces.
+func pack(text string, budget int) []string {
+	var parts []string
+	current := ""
+
+	flush := func() {
+		if trimmed := strings.TrimSpace(current); trimmed != "" {
+			parts = append(parts, trimmed)
+		}
+		current = ""
+	}
+
+	add := func(piece string) {
+		if Length(strings.TrimSpace(current+piece)) <= budget {
+			current += piece
+			return
+		}
+		flush()
+		current = strings.TrimLeftFunc(piece, unicode.IsSpace)
+	}
+
+	for _, sentence := range splitSentences(text) {
+		if Length(strings.TrimSpace(sentence)) <= budget {
+			add(sentence)
+			continue
+		}
+
+		for _, word := range splitWords(sentence) {
+			if Length(strings.TrimSpace(word)) <= budget {
+				add(word)
+				continue
+			}
+
+			for len(word) > 0 {
+				size, _ := characterSize(word)
+				add(word[:size])
+				word = word[size:]
+			}
+		}
+	}
+	flush()
+
+	return parts
+}
+
+// splitSentences splits text after sentence terminators and line breaks,
+// keeping the trailing whitespace with the sentence it follows.
+func splitSentences(text string) []string {
+	var sentences []string
+	start := 0
+	terminated := false
+	for i, r := range text {
+		if i < start {
+			continue
+		}
+
+		switch {
+		case r == '.' || r == '!' || r == '?':
+			terminated = true
+		case terminated && strings.ContainsRune(`"')]`, r):
+		case unicode.IsSpace(r):
+			if terminated || r == '\n' {
+				end := i + utf8.RuneLen(r)
+				for end < len(text) {
+					next, size := utf8.DecodeRuneInString(text[end:])
+					if !unicode.IsSpace(next) {
+						break
+					}
+					end += size
+				}
+				if end > start {
+					sentences = append(sentences, text[start:end])
+				}
+				start = end
+			}
+			terminated = false
+		default:
+			terminated = false
+		}
+	}
+	if start < len(text) {
+		sentences = append(sentences, text[start:])
+	}
+	return sentences
+}
+
+func splitWords(text string) []string {
+	var words []string
+	start := 0
+	inSpace := false
+	for i, r := range text {
+		space := unicode.IsSpace(r)
+		if space && !inSpace && i > start {
+			words = append(words, text[start:i])
+			start = i
+		}
+		inSpace = space
+	}
+	if start < len(text) {
+		words = append(words, text[start:])
+	}
+	return words
+}
+
+// truncate cuts text to at most maxLength, between characters and outside URLs.
+func truncate(text string, maxLength int) string {
+	text = norm.NFC.String(text)
+	urls := urlRegex.FindAllStringIndex(text, -1)
+
+	length := 0
+	end := 0
+	for end < len(text) {
+		if len(urls) > 0 && end == urls[0][0] {
+			if length+URLLength > maxLength {
+				break
+			}
+			length += URLLength
+			end = urls[0][1]
+			urls = urls[1:]
+			continue
+		}
+
+		size, weight := characterSize(text[end:])
+		if length+weight > maxLength {
+			break
+		}
+		length += weight
+		end += size
+	}
+
+	return text[:end]
+}
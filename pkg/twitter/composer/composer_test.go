@@ -0,0 +1,139 @@
+package composer_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/NethermindEth/teeception/pkg/twitter/composer"
+)
+
+func TestLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected int
+	}{
+		{"ascii", "hello world", 11},
+		{"latin accents", "café", 4},
+		{"decomposed accents are normalized", "café", 4},
+		{"cjk counts double", "你好", 4},
+		{"url", "see https://sepolia.voyager.online/tx/0x1234567890abcdef1234567890abcdef", 4 + composer.URLLength},
+		{"url trailing punctuation", "https://example.com.", composer.URLLength + 1},
+		{"emoji", "👍", 2},
+		{"emoji with skin tone", "👍🏽", 2},
+		{"zwj sequence", "👩‍💻", 2},
+		{"flag", "🇫🇷", 2},
+		{"general punctuation", "“quoted”", 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := composer.Length(tt.text); got != tt.expected {
+				t.Fatalf("expected length %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSplitTag(t *testing.T) {
+	tag, body := composer.SplitTag(":agent: hello")
+	if tag != ":agent:" || body != "hello" {
+		t.Fatalf("unexpected split: %q, %q", tag, body)
+	}
+
+	tag, body = composer.SplitTag("hello :agent:")
+	if tag != "" || body != "hello :agent:" {
+		t.Fatalf("unexpected split: %q, %q", tag, body)
+	}
+}
+
+func TestCompose(t *testing.T) {
+	t.Run("short text is a single tweet", func(t *testing.T) {
+		tweets := composer.Compose(composer.Tag("agent"), "hello")
+		if len(tweets) != 1 || tweets[0] != ":agent: hello" {
+			t.Fatalf("unexpected tweets: %q", tweets)
+		}
+	})
+
+	t.Run("long text is threaded at sentence boundaries", func(t *testing.T) {
+		sentence := "This sentence is one of many in a long reply ok. "
+		text := strings.Repeat(sentence, 12)
+
+		tweets := composer.Compose(composer.Tag("agent"), text)
+		if len(tweets) < 2 {
+			t.Fatalf("expected a thread, got %d tweets", len(tweets))
+		}
+
+		var rebuilt []string
+		for i, tweet := range tweets {
+			if !composer.IsValid(tweet) {
+				t.Fatalf("tweet %d is too long: %d", i, composer.Length(tweet))
+			}
+			if !strings.HasPrefix(tweet, ":agent: ") {
+				t.Fatalf("tweet %d is not tagged: %q", i, tweet)
+			}
+
+			suffix := " (" + string(rune('1'+i)) + "/" + string(rune('0'+len(tweets))) + ")"
+			if !strings.HasSuffix(tweet, suffix) {
+				t.Fatalf("tweet %d is not numbered: %q", i, tweet)
+			}
+
+			body := strings.TrimSuffix(strings.TrimPrefix(tweet, ":agent: "), suffix)
+			if !strings.HasSuffix(body, "ok.") {
+				t.Fatalf("tweet %d is not split at a sentence boundary: %q", i, body)
+			}
+			rebuilt = append(rebuilt, body)
+		}
+
+		if strings.Join(rebuilt, " ") != strings.TrimSpace(text) {
+			t.Fatalf("thread lost text")
+		}
+	})
+
+	t.Run("overlong tags are truncated between emoji sequences", func(t *testing.T) {
+		tag := composer.Tag(strings.Repeat("a", 272))
+		family := "👨\u200d👩\u200d👧"
+
+		tweets := composer.Compose(tag, strings.Repeat(family, 3))
+		if len(tweets) != 1 || tweets[0] != tag+" "+family+family {
+			t.Fatalf("expected the tweet to be truncated after the second family, got %q", tweets)
+		}
+	})
+
+	t.Run("emoji sequences are not split across tweets", func(t *testing.T) {
+		family := "👨\u200d👩\u200d👧"
+
+		tweets := composer.Compose(composer.Tag("agent"), strings.Repeat(family, 200))
+		if len(tweets) < 2 {
+			t.Fatalf("expected a thread, got %d tweets", len(tweets))
+		}
+		for i, tweet := range tweets {
+			body := strings.TrimPrefix(tweet, ":agent: ")
+			body = body[:strings.LastIndex(body, " (")]
+			if strings.ReplaceAll(body, family, "") != "" {
+				t.Fatalf("tweet %d splits an emoji sequence: %q", i, body)
+			}
+		}
+	})
+
+	t.Run("multi-byte text is not cut mid rune", func(t *testing.T) {
+		text := strings.Repeat("你好世界", 60)
+
+		tweets := composer.ComposeTagged(":agent: " + text)
+		var rebuilt string
+		for i, tweet := range tweets {
+			if !composer.IsValid(tweet) {
+				t.Fatalf("tweet %d is too long: %d", i, composer.Length(tweet))
+			}
+			if !strings.HasPrefix(tweet, ":agent: ") {
+				t.Fatalf("tweet %d is not tagged: %q", i, tweet)
+			}
+			body := strings.TrimPrefix(tweet, ":agent: ")
+			rebuilt += body[:strings.LastIndex(body, " (")]
+		}
+
+		if rebuilt != text {
+			t.Fatalf("thread lost text")
+		}
+	})
+}
@@ -0,0 +1,291 @@
+// Package link ties Starknet accounts to Twitter handles. The account signs a
+// typed data message naming the handle and the handle posts a verification
+// tweet naming the account, so that both sides agree to the link.
+package link
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/starknet.go/typed"
+	"github.com/NethermindEth/starknet.go/utils"
+
+	"github.com/NethermindEth/teeception/pkg/twitter"
+)
+
+const (
+	DomainName    = "Teeception"
+	DomainVersion = "1"
+	PrimaryType   = "TwitterLink"
+
+	// maxClockSkew is how far in the future a message timestamp may be.
+	maxClockSkew = 5 * time.Minute
+)
+
+var (
+	// ErrVerification is wrapped by the errors of links that fail verification.
+	ErrVerification = errors.New("link verification failed")
+
+	handleRegex  = regexp.MustCompile(`^[a-z0-9_]{1,15}$`)
+	hexRegex     = regexp.MustCompile(`^0x[0-9a-fA-F]+$`)
+	decimalRegex = regexp.MustCompile(`^[0-9]+$`)
+	addressRegex = regexp.MustCompile(`0x[0-9a-fA-F]{1,64}`)
+)
+
+// Link ties an account address to a Twitter handle.
+type Link struct {
+	Address   string    `json:"address"`
+	Handle    string    `json:"handle"`
+	TweetID   uint64    `json:"tweet_id,string"`
+	Timestamp uint64    `json:"timestamp"`
+	LinkedAt  time.Time `json:"linked_at"`
+}
+
+// Message is the typed data message signed by the account.
+type Message struct {
+	Handle    string
+	Timestamp uint64
+}
+
+var _ typed.TypedMessage = Message{}
+
+// FmtDefinitionEncoding encodes the fields of the message as felts.
+func (m Message) FmtDefinitionEncoding(field string) []*big.Int {
+	switch field {
+	case "handle":
+		return []*big.Int{encodeFelt(m.Handle)}
+	case "timestamp":
+		return []*big.Int{new(big.Int).SetUint64(m.Timestamp)}
+	}
+	return nil
+}
+
+// encodeFelt encodes a felt string like starknet.js does for revision 0 typed
+// data: hex and decimal strings are numbers, anything else is a short string.
+func encodeFelt(s string) *big.Int {
+	if hexRegex.MatchString(s) {
+		return utils.HexToBN(s)
+	}
+	if decimalRegex.MatchString(s) {
+		n, _ := new(big.Int).SetString(s, 10)
+		return n
+	}
+	return utils.UTF8StrToBig(s)
+}
+
+// NormalizeHandle lowercases a handle and strips its "@".
+func NormalizeHandle(handle string) (string, error) {
+	handle = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(handle), "@"))
+	if !handleRegex.MatchString(handle) {
+		return "", fmt.Errorf("invalid handle %q", handle)
+	}
+	return handle, nil
+}
+
+func newTypedData(chainID string) (typed.TypedData, error) {
+	types := map[string]typed.TypeDef{
+		"StarkNetDomain": {Definitions: []typed.Definition{
+			{Name: "name", Type: "felt"},
+			{Name: "version", Type: "felt"},
+			{Name: "chainId", Type: "felt"},
+		}},
+		PrimaryType: {Definitions: []typed.Definition{
+			{Name: "handle", Type: "felt"},
+			{Name: "timestamp", Type: "felt"},
+		}},
+	}
+
+	return typed.NewTypedData(types, PrimaryType, typed.Domain{
+		Name:    DomainName,
+		Version: DomainVersion,
+		ChainId: chainID,
+	})
+}
+
+// MessageHash returns the hash of msg signed by account on chainID.
+func MessageHash(chainID string, account *felt.Felt, msg Message) (*felt.Felt, error) {
+	td, err := newTypedData(chainID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create typed data: %v", err)
+	}
+
+	hash := td.GetMessageHash(account.BigInt(new(big.Int)), msg)
+	return new(felt.Felt).SetBytes(hash.Bytes()), nil
+}
+
+// TypedData returns msg as the typed data JSON wallets sign.
+func TypedData(chainID string, msg Message) map[string]any {
+	return map[string]any{
+		"types": map[string]any{
+			"StarkNetDomain": []map[string]string{
+				{"name": "name", "type": "felt"},
+				{"name": "version", "type": "felt"},
+				{"name": "chainId", "type": "felt"},
+			},
+			PrimaryType: []map[string]string{
+				{"name": "handle", "type": "felt"},
+				{"name": "timestamp", "type": "felt"},
+			},
+		},
+		"primaryType": PrimaryType,
+		"domain": map[string]string{
+			"name":    DomainName,
+			"version": DomainVersion,
+			"chainId": chainID,
+		},
+		"message": map[string]string{
+			"handle":    msg.Handle,
+			"timestamp": fmt.Sprintf("%d", msg.Timestamp),
+		},
+	}
+}
+
+// VerificationText returns the text of a verification tweet for address.
+// Any tweet from the handle containing the address is accepted.
+func VerificationText(address *felt.Felt) string {
+	return fmt.Sprintf("Linking my Starknet account %s to Teeception", address)
+}
+
+// TweetGetter fetches tweets.
+type TweetGetter interface {
+	GetTweet(ctx context.Context, tweetID uint64) (*twitter.Tweet, error)
+}
+
+// SignatureChecker reports whether signature is a valid signature of hash by account.
+type SignatureChecker func(ctx context.Context, account, hash *felt.Felt, signature []*felt.Felt) (bool, error)
+
+// VerifierConfig is the configuration for a Verifier.
+type VerifierConfig struct {
+	Tweets         TweetGetter
+	CheckSignature SignatureChecker
+	Store          Store
+	ChainID        string
+	// MaxAge is how old a signed message may be.
+	MaxAge time.Duration
+}
+
+// Verifier verifies and stores links.
+type Verifier struct {
+	tweets         TweetGetter
+	checkSignature SignatureChecker
+	store          Store
+	chainID        string
+	maxAge         time.Duration
+}
+
+// NewVerifier creates a new Verifier with sensible defaults if none are provided.
+func NewVerifier(cfg *VerifierConfig) *Verifier {
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = time.Hour
+	}
+
+	return &Verifier{
+		tweets:         cfg.Tweets,
+		checkSignature: cfg.CheckSignature,
+		store:          cfg.Store,
+		chainID:        cfg.ChainID,
+		maxAge:         cfg.MaxAge,
+	}
+}
+
+// ChainID returns the chain ID of the signed messages.
+func (v *Verifier) ChainID() string {
+	return v.chainID
+}
+
+// Request is a request to link an account to a handle.
+type Request struct {
+	Address   *felt.Felt
+	Handle    string
+	Timestamp uint64
+	TweetID   uint64
+	Signature []*felt.Felt
+}
+
+// Link verifies the signature and the verification tweet of req and stores
+// the link, replacing earlier links of the account or of the handle.
+func (v *Verifier) Link(ctx context.Context, req *Request) (*Link, error) {
+	handle, err := NormalizeHandle(req.Handle)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+
+	now := time.Now()
+	signedAt := time.Unix(int64(req.Timestamp), 0)
+	if signedAt.Before(now.Add(-v.maxAge)) || signedAt.After(now.Add(maxClockSkew)) {
+		return nil, fmt.Errorf("%w: message timestamp is expired or in the future", ErrVerification)
+	}
+
+	existing, ok, err := v.store.GetByAddress(req.Address)
+	if err != nil {
+		return nil, err
+	}
+	if ok && existing.Timestamp >= req.Timestamp {
+		return nil, fmt.Errorf("%w: message is older than the current link", ErrVerification)
+	}
+
+	// The signature is checked first, so that only account owners can make
+	// the verifier fetch tweets.
+	hash, err := MessageHash(v.chainID, req.Address, Message{
+		Handle:    handle,
+		Timestamp: req.Timestamp,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	valid, err := v.checkSignature(ctx, req.Address, hash, req.Signature)
+	if err != nil {
+		// Some accounts revert on invalid signatures instead of returning false.
+		slog.Warn("failed to check link signature", "address", req.Address, "error", err)
+		return nil, fmt.Errorf("%w: could not verify signature", ErrVerification)
+	}
+	if !valid {
+		return nil, fmt.Errorf("%w: invalid signature", ErrVerification)
+	}
+
+	tweet, err := v.tweets.GetTweet(ctx, req.TweetID)
+	if err != nil {
+		slog.Warn("failed to fetch verification tweet", "tweet_id", req.TweetID, "error", err)
+		return nil, fmt.Errorf("%w: failed to fetch verification tweet", ErrVerification)
+	}
+	if !strings.EqualFold(tweet.AuthorUsername, handle) {
+		return nil, fmt.Errorf("%w: verification tweet is not from @%s", ErrVerification, handle)
+	}
+	if !mentionsAddress(tweet.Text, req.Address) {
+		return nil, fmt.Errorf("%w: verification tweet does not contain the account address", ErrVerification)
+	}
+
+	link := &Link{
+		Address:   req.Address.String(),
+		Handle:    handle,
+		TweetID:   req.TweetID,
+		Timestamp: req.Timestamp,
+		LinkedAt:  now,
+	}
+	if err := v.store.Put(link); err != nil {
+		return nil, err
+	}
+
+	slog.Info("linked account to twitter handle", "address", link.Address, "handle", link.Handle, "tweet_id", link.TweetID)
+
+	return link, nil
+}
+
+// mentionsAddress reports whether text contains address in hex, with or without leading zeros.
+func mentionsAddress(text string, address *felt.Felt) bool {
+	for _, match := range addressRegex.FindAllString(text, -1) {
+		candidate, err := new(felt.Felt).SetString(match)
+		if err == nil && candidate.Equal(address) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,213 @@
+package link_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/starknet.go/curve"
+
+	"github.com/NethermindEth/teeception/pkg/twitter"
+	"github.com/NethermindEth/teeception/pkg/twitter/link"
+)
+
+const testChainID = "SN_SEPOLIA"
+
+type mockTweetGetter map[uint64]*twitter.Tweet
+
+func (m mockTweetGetter) GetTweet(ctx context.Context, tweetID uint64) (*twitter.Tweet, error) {
+	tweet, ok := m[tweetID]
+	if !ok {
+		return nil, fmt.Errorf("tweet not found")
+	}
+	return tweet, nil
+}
+
+// failingTweetGetter fails the test when a tweet is fetched.
+type failingTweetGetter struct {
+	t *testing.T
+}
+
+func (g failingTweetGetter) GetTweet(ctx context.Context, tweetID uint64) (*twitter.Tweet, error) {
+	g.t.Fatalf("unexpected fetch of tweet %d", tweetID)
+	return nil, nil
+}
+
+// account is a Stark key pair standing in for an account contract that
+// validates signatures of its own key.
+type account struct {
+	address *felt.Felt
+	privKey *big.Int
+	pubX    *big.Int
+	pubY    *big.Int
+}
+
+func newAccount(t *testing.T, address, privKey uint64) *account {
+	t.Helper()
+
+	priv := new(big.Int).SetUint64(privKey)
+	x, y, err := curve.Curve.PrivateToPoint(priv)
+	if err != nil {
+		t.Fatalf("failed to derive public key: %v", err)
+	}
+
+	return &account{
+		address: new(felt.Felt).SetUint64(address),
+		privKey: priv,
+		pubX:    x,
+		pubY:    y,
+	}
+}
+
+func (a *account) sign(t *testing.T, msg link.Message) []*felt.Felt {
+	t.Helper()
+
+	hash, err := link.MessageHash(testChainID, a.address, msg)
+	if err != nil {
+		t.Fatalf("failed to hash message: %v", err)
+	}
+
+	r, s, err := curve.Curve.Sign(hash.BigInt(new(big.Int)), a.privKey)
+	if err != nil {
+		t.Fatalf("failed to sign message: %v", err)
+	}
+
+	return []*felt.Felt{new(felt.Felt).SetBigInt(r), new(felt.Felt).SetBigInt(s)}
+}
+
+func newVerifier(tweets link.TweetGetter, store link.Store, accounts ...*account) *link.Verifier {
+	return link.NewVerifier(&link.VerifierConfig{
+		Tweets: tweets,
+		CheckSignature: func(ctx context.Context, address, hash *felt.Felt, signature []*felt.Felt) (bool, error) {
+			for _, a := range accounts {
+				if a.address.Equal(address) {
+					if len(signature) != 2 {
+						return false, nil
+					}
+					r, s := signature[0].BigInt(new(big.Int)), signature[1].BigInt(new(big.Int))
+					return curve.Curve.Verify(hash.BigInt(new(big.Int)), r, s, a.pubX, a.pubY), nil
+				}
+			}
+			return false, fmt.Errorf("contract not found")
+		},
+		Store:   store,
+		ChainID: testChainID,
+	})
+}
+
+func TestVerifierLink(t *testing.T) {
+	alice := newAccount(t, 0x1234, 0xa11ce)
+	mallory := newAccount(t, 0x5678, 0xbad)
+
+	tweets := mockTweetGetter{
+		1: {ID: 1, AuthorUsername: "Alice", Text: link.VerificationText(alice.address)},
+		2: {ID: 2, AuthorUsername: "mallory", Text: link.VerificationText(alice.address)},
+		3: {ID: 3, AuthorUsername: "alice", Text: "hello"},
+		// Addresses may be written with leading zeros.
+		4: {ID: 4, AuthorUsername: "alice", Text: "linking 0x0000000000000000000000000000000000000000000000000000000000001234"},
+	}
+	store := link.NewStoreInMemory()
+	verifier := newVerifier(tweets, store, alice, mallory)
+
+	now := uint64(time.Now().Unix())
+	msg := link.Message{Handle: "alice", Timestamp: now}
+
+	tests := []struct {
+		name string
+		req  *link.Request
+	}{
+		{"wrong author", &link.Request{Address: alice.address, Handle: "alice", Timestamp: now, TweetID: 2, Signature: alice.sign(t, msg)}},
+		{"tweet without address", &link.Request{Address: alice.address, Handle: "alice", Timestamp: now, TweetID: 3, Signature: alice.sign(t, msg)}},
+		{"unknown tweet", &link.Request{Address: alice.address, Handle: "alice", Timestamp: now, TweetID: 5, Signature: alice.sign(t, msg)}},
+		{"signature of another account", &link.Request{Address: alice.address, Handle: "alice", Timestamp: now, TweetID: 1, Signature: mallory.sign(t, msg)}},
+		{"signature of another handle", &link.Request{Address: alice.address, Handle: "alice", Timestamp: now, TweetID: 1, Signature: alice.sign(t, link.Message{Handle: "bob", Timestamp: now})}},
+		{"expired message", &link.Request{Address: alice.address, Handle: "alice", Timestamp: now - 2*3600, TweetID: 1, Signature: alice.sign(t, link.Message{Handle: "alice", Timestamp: now - 2*3600})}},
+		{"invalid handle", &link.Request{Address: alice.address, Handle: "not a handle", Timestamp: now, TweetID: 1, Signature: alice.sign(t, msg)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := verifier.Link(context.Background(), tt.req); !errors.Is(err, link.ErrVerification) {
+				t.Fatalf("expected verification error, got %v", err)
+			}
+		})
+	}
+
+	if _, ok, _ := store.GetByAddress(alice.address); ok {
+		t.Fatalf("expected no link after failed verifications")
+	}
+
+	linked, err := verifier.Link(context.Background(), &link.Request{Address: alice.address, Handle: "@Alice", Timestamp: now, TweetID: 1, Signature: alice.sign(t, msg)})
+	if err != nil {
+		t.Fatalf("failed to link: %v", err)
+	}
+	if linked.Handle != "alice" || linked.Address != alice.address.String() {
+		t.Fatalf("unexpected link %+v", linked)
+	}
+
+	// Replaying the same message must not succeed.
+	if _, err := verifier.Link(context.Background(), &link.Request{Address: alice.address, Handle: "alice", Timestamp: now, TweetID: 4, Signature: alice.sign(t, msg)}); !errors.Is(err, link.ErrVerification) {
+		t.Fatalf("expected replayed message to be rejected, got %v", err)
+	}
+
+	newer := link.Message{Handle: "alice", Timestamp: now + 1}
+	if _, err := verifier.Link(context.Background(), &link.Request{Address: alice.address, Handle: "alice", Timestamp: now + 1, TweetID: 4, Signature: alice.sign(t, newer)}); err != nil {
+		t.Fatalf("failed to relink: %v", err)
+	}
+
+	stored, ok, err := store.GetByHandle("alice")
+	if err != nil || !ok {
+		t.Fatalf("expected link for handle, got %v %v", ok, err)
+	}
+	if stored.TweetID != 4 {
+		t.Fatalf("expected the newer link to be stored, got tweet %d", stored.TweetID)
+	}
+}
+
+func TestVerifierChecksSignatureFirst(t *testing.T) {
+	alice := newAccount(t, 0x1234, 0xa11ce)
+	mallory := newAccount(t, 0x5678, 0xbad)
+	verifier := newVerifier(failingTweetGetter{t: t}, link.NewStoreInMemory(), alice, mallory)
+
+	now := uint64(time.Now().Unix())
+	msg := link.Message{Handle: "alice", Timestamp: now}
+
+	// Invalid signatures are rejected without fetching the verification tweet.
+	if _, err := verifier.Link(context.Background(), &link.Request{Address: alice.address, Handle: "alice", Timestamp: now, TweetID: 1, Signature: mallory.sign(t, msg)}); !errors.Is(err, link.ErrVerification) {
+		t.Fatalf("expected verification error, got %v", err)
+	}
+}
+
+func TestStoreSQLite(t *testing.T) {
+	store, err := link.NewStoreSQLite(t.TempDir() + "/links.db")
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	first := new(felt.Felt).SetUint64(1)
+	second := new(felt.Felt).SetUint64(2)
+
+	if err := store.Put(&link.Link{Address: first.String(), Handle: "alice", TweetID: 1, Timestamp: 1, LinkedAt: time.Now()}); err != nil {
+		t.Fatalf("failed to put link: %v", err)
+	}
+
+	// Linking the handle to another account unlinks the first one.
+	if err := store.Put(&link.Link{Address: second.String(), Handle: "alice", TweetID: 2, Timestamp: 2, LinkedAt: time.Now()}); err != nil {
+		t.Fatalf("failed to put link: %v", err)
+	}
+
+	if _, ok, err := store.GetByAddress(first); err != nil || ok {
+		t.Fatalf("expected first account to be unlinked, got %v %v", ok, err)
+	}
+
+	linked, ok, err := store.GetByHandle("alice")
+	if err != nil || !ok {
+		t.Fatalf("expected link for handle, got %v %v", ok, err)
+	}
+	if linked.Address != second.String() || linked.TweetID != 2 {
+		t.Fatalf("unexpected link %+v", linked)
+	}
+}
@@ -0,0 +1,79 @@
+package link
+
+import (
+	"sync"
+
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+// Store persists links. An account is linked to at most one handle and a
+// handle to at most one account.
+type Store interface {
+	// Put stores a link, replacing any link of its account or of its handle.
+	Put(link *Link) error
+	// GetByAddress returns the link of an account.
+	GetByAddress(address *felt.Felt) (*Link, bool, error)
+	// GetByHandle returns the link of a normalized handle.
+	GetByHandle(handle string) (*Link, bool, error)
+}
+
+// StoreInMemory is an in-memory implementation of the Store interface.
+type StoreInMemory struct {
+	mu        sync.RWMutex
+	byAddress map[string]*Link
+	byHandle  map[string]*Link
+}
+
+var _ Store = (*StoreInMemory)(nil)
+
+// NewStoreInMemory creates a new StoreInMemory.
+func NewStoreInMemory() *StoreInMemory {
+	return &StoreInMemory{
+		byAddress: make(map[string]*Link),
+		byHandle:  make(map[string]*Link),
+	}
+}
+
+func (s *StoreInMemory) Put(link *Link) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if old, ok := s.byAddress[link.Address]; ok {
+		delete(s.byHandle, old.Handle)
+	}
+	if old, ok := s.byHandle[link.Handle]; ok {
+		delete(s.byAddress, old.Address)
+	}
+
+	stored := *link
+	s.byAddress[link.Address] = &stored
+	s.byHandle[link.Handle] = &stored
+
+	return nil
+}
+
+func (s *StoreInMemory) GetByAddress(address *felt.Felt) (*Link, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	link, ok := s.byAddress[address.String()]
+	if !ok {
+		return nil, false, nil
+	}
+
+	copied := *link
+	return &copied, true, nil
+}
+
+func (s *StoreInMemory) GetByHandle(handle string) (*Link, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	link, ok := s.byHandle[handle]
+	if !ok {
+		return nil, false, nil
+	}
+
+	copied := *link
+	return &copied, true, nil
+}
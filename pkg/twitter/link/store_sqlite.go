@@ -0,0 +1,106 @@
+package link
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// StoreSQLite is a SQLite implementation of the Store interface.
+type StoreSQLite struct {
+	db *sql.DB
+}
+
+var _ Store = (*StoreSQLite)(nil)
+
+// NewStoreSQLite creates a new SQLite-based Store.
+func NewStoreSQLite(dbPath string) (*StoreSQLite, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS twitter_links (
+			address TEXT PRIMARY KEY,
+			handle TEXT NOT NULL UNIQUE,
+			tweet_id INTEGER NOT NULL,
+			timestamp INTEGER NOT NULL,
+			linked_at INTEGER NOT NULL
+		);
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tables: %w", err)
+	}
+
+	return &StoreSQLite{
+		db: db,
+	}, nil
+}
+
+func (s *StoreSQLite) Put(link *Link) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM twitter_links WHERE address = ? OR handle = ?`, link.Address, link.Handle); err != nil {
+		return fmt.Errorf("failed to delete previous links: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO twitter_links (address, handle, tweet_id, timestamp, linked_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, link.Address, link.Handle, link.TweetID, link.Timestamp, link.LinkedAt.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to insert link: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (s *StoreSQLite) GetByAddress(address *felt.Felt) (*Link, bool, error) {
+	return s.get(`
+		SELECT address, handle, tweet_id, timestamp, linked_at
+		FROM twitter_links
+		WHERE address = ?
+	`, address.String())
+}
+
+func (s *StoreSQLite) GetByHandle(handle string) (*Link, bool, error) {
+	return s.get(`
+		SELECT address, handle, tweet_id, timestamp, linked_at
+		FROM twitter_links
+		WHERE handle = ?
+	`, handle)
+}
+
+func (s *StoreSQLite) get(query string, args ...any) (*Link, bool, error) {
+	var link Link
+	var linkedAt int64
+
+	err := s.db.QueryRow(query, args...).Scan(&link.Address, &link.Handle, &link.TweetID, &link.Timestamp, &linkedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query link: %w", err)
+	}
+
+	link.LinkedAt = time.UnixMilli(linkedAt)
+
+	return &link, true, nil
+}
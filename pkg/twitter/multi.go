@@ -0,0 +1,540 @@
+package twitter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WriteFailover decides which accounts tweets and replies may be sent from
+// when the primary account fails. Prompts must mention the account the agent
+// replies from, so failing over to another username changes who users talk to.
+type WriteFailover string
+
+const (
+	// WriteFailoverNone only writes from the primary account.
+	WriteFailoverNone WriteFailover = "none"
+	// WriteFailoverSameUsername writes from any account with the username of
+	// the primary account, i.e. from other apps of the same account.
+	WriteFailoverSameUsername WriteFailover = "same_username"
+	// WriteFailoverAny writes from any account.
+	WriteFailoverAny WriteFailover = "any"
+)
+
+const (
+	defaultFailureThreshold = 3
+	defaultCooldown         = 5 * time.Minute
+	defaultMaxRateLimitWait = 15 * time.Minute
+	minRateLimitWait        = time.Second
+)
+
+// MultiAccount is an account of a MultiClient.
+type MultiAccount struct {
+	// Name identifies the account in logs and status reports.
+	Name   string
+	Client TwitterClient
+	// Config initializes Client. If nil, the config passed to Initialize is used.
+	Config *TwitterClientConfig
+}
+
+// MultiClientConfig is the configuration for a MultiClient.
+type MultiClientConfig struct {
+	// Accounts are tried in order, the first one is the primary account.
+	Accounts      []MultiAccount
+	WriteFailover WriteFailover
+	// FailureThreshold is the number of consecutive failures after which an
+	// account is unhealthy for Cooldown. Unhealthy accounts are tried last.
+	FailureThreshold int
+	Cooldown         time.Duration
+	// MaxRateLimitWait is how long to wait for rate limits to reset when
+	// every account is rate limited.
+	MaxRateLimitWait time.Duration
+}
+
+// AccountStatus is the health and quota of an account of a MultiClient.
+type AccountStatus struct {
+	Name                string               `json:"name"`
+	Username            string               `json:"username"`
+	Primary             bool                 `json:"primary"`
+	Healthy             bool                 `json:"healthy"`
+	CanWrite            bool                 `json:"can_write"`
+	ConsecutiveFailures int                  `json:"consecutive_failures"`
+	UnhealthyUntil      time.Time            `json:"unhealthy_until,omitempty"`
+	LastError           string               `json:"last_error,omitempty"`
+	LastErrorAt         time.Time            `json:"last_error_at,omitempty"`
+	RateLimits          map[string]RateLimit `json:"rate_limits,omitempty"`
+}
+
+type multiAccount struct {
+	name   string
+	client TwitterClient
+	config *TwitterClientConfig
+
+	username            string
+	consecutiveFailures int
+	unhealthyUntil      time.Time
+	lastError           string
+	lastErrorAt         time.Time
+}
+
+// MultiClient is a TwitterClient over an ordered set of accounts. Reads fail
+// over to any account, writes fail over according to its WriteFailover policy.
+// A failed write is retried from the next account as a whole, only if it
+// failed in a way proving it was not posted.
+type MultiClient struct {
+	writeFailover    WriteFailover
+	failureThreshold int
+	cooldown         time.Duration
+	maxRateLimitWait time.Duration
+
+	mu       sync.RWMutex
+	accounts []*multiAccount
+}
+
+var _ TwitterClient = (*MultiClient)(nil)
+var _ MentionPoller = (*MultiClient)(nil)
+var _ RateLimitReporter = (*MultiClient)(nil)
+
+// NewMultiClient creates a new MultiClient with sensible defaults if none are provided.
+func NewMultiClient(cfg *MultiClientConfig) *MultiClient {
+	if cfg.WriteFailover == "" {
+		cfg.WriteFailover = WriteFailoverSameUsername
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = defaultFailureThreshold
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = defaultCooldown
+	}
+	if cfg.MaxRateLimitWait <= 0 {
+		cfg.MaxRateLimitWait = defaultMaxRateLimitWait
+	}
+
+	accounts := make([]*multiAccount, 0, len(cfg.Accounts))
+	for i, account := range cfg.Accounts {
+		if account.Name == "" {
+			account.Name = fmt.Sprintf("account-%d", i)
+		}
+		accounts = append(accounts, &multiAccount{
+			name:   account.Name,
+			client: account.Client,
+			config: account.Config,
+		})
+	}
+
+	return &MultiClient{
+		writeFailover:    cfg.WriteFailover,
+		failureThreshold: cfg.FailureThreshold,
+		cooldown:         cfg.Cooldown,
+		maxRateLimitWait: cfg.MaxRateLimitWait,
+		accounts:         accounts,
+	}
+}
+
+// Initialize initializes every account. Accounts that fail to initialize are
+// unhealthy, it only fails if no account could be initialized.
+func (m *MultiClient) Initialize(ctx context.Context, config *TwitterClientConfig) error {
+	if len(m.accounts) == 0 {
+		return fmt.Errorf("no twitter accounts configured")
+	}
+
+	var errs []error
+	for _, account := range m.accounts {
+		accountConfig := account.config
+		if accountConfig == nil {
+			accountConfig = config
+		}
+
+		m.mu.Lock()
+		account.username = accountConfig.Username
+		m.mu.Unlock()
+
+		if err := account.client.Initialize(ctx, accountConfig); err != nil {
+			slog.Warn("failed to initialize twitter account", "account", account.name, "error", err)
+			m.markFailed(account, err)
+			errs = append(errs, fmt.Errorf("%s: %w", account.name, err))
+		}
+	}
+
+	if len(errs) == len(m.accounts) {
+		return fmt.Errorf("failed to initialize twitter accounts: %w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+func (m *MultiClient) GetTweet(ctx context.Context, tweetID uint64) (*Tweet, error) {
+	var tweet *Tweet
+	err := m.do(ctx, EndpointGetTweet, m.accounts, func(client TwitterClient) error {
+		var err error
+		tweet, err = client.GetTweet(ctx, tweetID)
+		return err
+	})
+	return tweet, err
+}
+
+func (m *MultiClient) ReplyToTweet(ctx context.Context, tweetID uint64, reply string) (uint64, error) {
+	var id uint64
+	err := m.do(ctx, EndpointPostTweet, m.writeAccounts(), func(client TwitterClient) error {
+		var err error
+		id, err = client.ReplyToTweet(ctx, tweetID, reply)
+		return err
+	})
+	return id, err
+}
+
+func (m *MultiClient) SendTweet(ctx context.Context, tweet string) (uint64, error) {
+	var id uint64
+	err := m.do(ctx, EndpointPostTweet, m.writeAccounts(), func(client TwitterClient) error {
+		var err error
+		id, err = client.SendTweet(ctx, tweet)
+		return err
+	})
+	return id, err
+}
+
+func (m *MultiClient) SendTweetWithImage(ctx context.Context, tweet string, image []byte) (uint64, error) {
+	var id uint64
+	err := m.do(ctx, EndpointPostTweet, m.writeAccounts(), func(client TwitterClient) error {
+		var err error
+		id, err = client.SendTweetWithImage(ctx, tweet, image)
+		return err
+	})
+	return id, err
+}
+
+// GetMentions lists mentions of the primary username. Mentions are those of
+// the authenticated user, so it only fails over to accounts with that username.
+func (m *MultiClient) GetMentions(ctx context.Context, sinceID uint64) ([]Tweet, error) {
+	var pollers []*multiAccount
+	for _, account := range m.sameUsernameAccounts() {
+		if _, ok := account.client.(MentionPoller); ok {
+			pollers = append(pollers, account)
+		}
+	}
+	if len(pollers) == 0 {
+		return nil, fmt.Errorf("no twitter account can poll mentions")
+	}
+
+	var mentions []Tweet
+	err := m.do(ctx, EndpointGetMentions, pollers, func(client TwitterClient) error {
+		var err error
+		mentions, err = client.(MentionPoller).GetMentions(ctx, sinceID)
+		return err
+	})
+	return mentions, err
+}
+
+// WriteUsernames returns the usernames tweets and replies may be sent from.
+func (m *MultiClient) WriteUsernames() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var usernames []string
+	for _, account := range m.writeAccountsLocked() {
+		if account.username != "" && !slices.Contains(usernames, account.username) {
+			usernames = append(usernames, account.username)
+		}
+	}
+	return usernames
+}
+
+// RateLimit returns the limit of the first account usable for endpoint. It is
+// only exhausted if the limits of every such account are, and then resets
+// when the first of them does.
+func (m *MultiClient) RateLimit(endpoint string) (RateLimit, bool) {
+	m.mu.RLock()
+	accounts := m.accounts
+	if endpoint == EndpointPostTweet {
+		accounts = m.writeAccountsLocked()
+	}
+	m.mu.RUnlock()
+
+	now := time.Now()
+
+	var earliest RateLimit
+	found := false
+	for _, account := range accounts {
+		limit, ok := rateLimitOf(account, endpoint)
+		if !ok {
+			return RateLimit{}, false
+		}
+		if !limit.Exhausted(now) {
+			return limit, true
+		}
+		if !found || limit.Reset.Before(earliest.Reset) {
+			earliest = limit
+			found = true
+		}
+	}
+
+	return earliest, found
+}
+
+// RateLimits returns the combined limits of every endpoint, see RateLimit.
+func (m *MultiClient) RateLimits() map[string]RateLimit {
+	m.mu.RLock()
+	accounts := m.accounts
+	m.mu.RUnlock()
+
+	limits := make(map[string]RateLimit)
+	for _, account := range accounts {
+		reporter, ok := account.client.(RateLimitReporter)
+		if !ok {
+			continue
+		}
+		for endpoint := range reporter.RateLimits() {
+			if _, ok := limits[endpoint]; ok {
+				continue
+			}
+			if limit, ok := m.RateLimit(endpoint); ok {
+				limits[endpoint] = limit
+			}
+		}
+	}
+	return limits
+}
+
+// Accounts returns the health and rate limits of every account.
+func (m *MultiClient) Accounts() []AccountStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	writers := m.writeAccountsLocked()
+
+	statuses := make([]AccountStatus, 0, len(m.accounts))
+	for i, account := range m.accounts {
+		status := AccountStatus{
+			Name:                account.name,
+			Username:            account.username,
+			Primary:             i == 0,
+			Healthy:             account.healthy(now),
+			CanWrite:            slices.Contains(writers, account),
+			ConsecutiveFailures: account.consecutiveFailures,
+			UnhealthyUntil:      account.unhealthyUntil,
+			LastError:           account.lastError,
+			LastErrorAt:         account.lastErrorAt,
+		}
+		if reporter, ok := account.client.(RateLimitReporter); ok {
+			status.RateLimits = reporter.RateLimits()
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+// do runs op on accounts, healthy ones first, until it succeeds or fails with
+// an error that is not specific to the account. If every account is rate
+// limited, it waits for the first limit to reset.
+func (m *MultiClient) do(ctx context.Context, endpoint string, accounts []*multiAccount, op func(client TwitterClient) error) error {
+	deadline := time.Now().Add(m.maxRateLimitWait)
+
+	// Writes which may have been posted are not retried from another account,
+	// as that could post them twice.
+	failsOver := isAccountError
+	if endpoint == EndpointPostTweet {
+		failsOver = isUnpostedError
+	}
+
+	for {
+		var errs []error
+		var reset time.Time
+		rateLimited := false
+
+		for _, account := range m.byHealth(accounts) {
+			if limit, ok := rateLimitOf(account, endpoint); ok && limit.Exhausted(time.Now()) {
+				if !rateLimited || limit.Reset.Before(reset) {
+					reset = limit.Reset
+				}
+				rateLimited = true
+				continue
+			}
+
+			err := op(account.client)
+			if err == nil {
+				m.markSucceeded(account)
+				return nil
+			}
+			if ctx.Err() != nil {
+				return err
+			}
+			if errors.Is(err, ErrRateLimited) {
+				slog.Info("twitter account is rate limited", "account", account.name, "endpoint", endpoint)
+				limit, ok := rateLimitOf(account, endpoint)
+				if !ok || limit.Reset.Before(time.Now()) {
+					limit.Reset = time.Now()
+				}
+				if !rateLimited || limit.Reset.Before(reset) {
+					reset = limit.Reset
+				}
+				rateLimited = true
+				continue
+			}
+			if !failsOver(err) {
+				if isAccountError(err) {
+					m.markFailed(account, err)
+				}
+				return err
+			}
+
+			slog.Warn("twitter account failed, failing over", "account", account.name, "endpoint", endpoint, "error", err)
+			m.markFailed(account, err)
+			errs = append(errs, fmt.Errorf("%s: %w", account.name, err))
+		}
+
+		if !rateLimited {
+			if len(errs) == 0 {
+				return fmt.Errorf("no twitter account available for %s", endpoint)
+			}
+			return fmt.Errorf("all twitter accounts failed: %w", errors.Join(errs...))
+		}
+
+		wait := max(time.Until(reset), minRateLimitWait)
+		if time.Now().Add(wait).After(deadline) {
+			errs = append(errs, ErrRateLimited)
+			return fmt.Errorf("all twitter accounts failed: %w", errors.Join(errs...))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// byHealth returns accounts with the healthy ones first, keeping their order.
+func (m *MultiClient) byHealth(accounts []*multiAccount) []*multiAccount {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	ordered := make([]*multiAccount, 0, len(accounts))
+	for _, account := range accounts {
+		if account.healthy(now) {
+			ordered = append(ordered, account)
+		}
+	}
+	for _, account := range accounts {
+		if !account.healthy(now) {
+			ordered = append(ordered, account)
+		}
+	}
+	return ordered
+}
+
+func (m *MultiClient) writeAccounts() []*multiAccount {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.writeAccountsLocked()
+}
+
+func (m *MultiClient) writeAccountsLocked() []*multiAccount {
+	switch m.writeFailover {
+	case WriteFailoverAny:
+		return m.accounts
+	case WriteFailoverSameUsername:
+		return m.sameUsernameAccountsLocked()
+	default:
+		return m.accounts[:min(1, len(m.accounts))]
+	}
+}
+
+func (m *MultiClient) sameUsernameAccounts() []*multiAccount {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.sameUsernameAccountsLocked()
+}
+
+func (m *MultiClient) sameUsernameAccountsLocked() []*multiAccount {
+	if len(m.accounts) == 0 {
+		return nil
+	}
+
+	primary := m.accounts[0]
+	accounts := []*multiAccount{primary}
+	for _, account := range m.accounts[1:] {
+		if primary.username != "" && strings.EqualFold(account.username, primary.username) {
+			accounts = append(accounts, account)
+		}
+	}
+	return accounts
+}
+
+func (m *MultiClient) markSucceeded(account *multiAccount) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if account.consecutiveFailures >= m.failureThreshold {
+		slog.Info("twitter account recovered", "account", account.name)
+	}
+	account.consecutiveFailures = 0
+	account.unhealthyUntil = time.Time{}
+}
+
+func (m *MultiClient) markFailed(account *multiAccount, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	account.consecutiveFailures++
+	account.lastError = err.Error()
+	account.lastErrorAt = now
+	if account.consecutiveFailures >= m.failureThreshold {
+		account.unhealthyUntil = now.Add(m.cooldown)
+		slog.Warn("twitter account is unhealthy", "account", account.name, "until", account.unhealthyUntil)
+	}
+}
+
+func (a *multiAccount) healthy(now time.Time) bool {
+	return !now.Before(a.unhealthyUntil)
+}
+
+func rateLimitOf(account *multiAccount, endpoint string) (RateLimit, bool) {
+	reporter, ok := account.client.(RateLimitReporter)
+	if !ok {
+		return RateLimit{}, false
+	}
+	return reporter.RateLimit(endpoint)
+}
+
+// isAccountError reports whether err may not happen with another account,
+// e.g. a suspended account or an outage, unlike a missing tweet.
+func isAccountError(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusUnauthorized ||
+			statusErr.StatusCode == http.StatusForbidden ||
+			statusErr.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// isUnpostedError reports whether err is an account error proving that the
+// write was not accepted, i.e. the request was refused or never sent.
+func isUnpostedError(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusUnauthorized ||
+			statusErr.StatusCode == http.StatusForbidden ||
+			statusErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,201 @@
+package twitter_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/teeception/pkg/twitter"
+	"github.com/NethermindEth/teeception/pkg/twitter/twittertest"
+)
+
+type testAccount struct {
+	server *twittertest.Server
+	client *twitter.TwitterApiClient
+	config *twitter.TwitterClientConfig
+}
+
+func newTestAccount(t *testing.T, cfg *twittertest.ServerConfig) *testAccount {
+	t.Helper()
+
+	cfg.ConsumerKey = testConsumerKey
+	server := twittertest.NewServer(cfg)
+	t.Cleanup(server.Close)
+
+	return &testAccount{
+		server: server,
+		client: twitter.NewTwitterApiClient(&twitter.TwitterApiClientConfig{
+			ApiUrl:                 server.URL,
+			UploadUrl:              server.URL,
+			BackoffInitialInterval: time.Millisecond,
+			BackoffMaxInterval:     10 * time.Millisecond,
+			BackoffMaxElapsedTime:  time.Second,
+			FailOnRateLimit:        true,
+		}),
+		config: &twitter.TwitterClientConfig{
+			Username:          cfg.Username,
+			ConsumerKey:       testConsumerKey,
+			ConsumerSecret:    "consumer-secret",
+			AccessToken:       "access-token",
+			AccessTokenSecret: "access-token-secret",
+		},
+	}
+}
+
+func newTestMultiClient(t *testing.T, policy twitter.WriteFailover, accounts ...*testAccount) *twitter.MultiClient {
+	t.Helper()
+
+	multiAccounts := make([]twitter.MultiAccount, 0, len(accounts))
+	for _, account := range accounts {
+		multiAccounts = append(multiAccounts, twitter.MultiAccount{
+			Client: account.client,
+			Config: account.config,
+		})
+	}
+
+	client := twitter.NewMultiClient(&twitter.MultiClientConfig{
+		Accounts:         multiAccounts,
+		WriteFailover:    policy,
+		FailureThreshold: 1,
+		Cooldown:         time.Hour,
+		MaxRateLimitWait: time.Second,
+	})
+	if err := client.Initialize(context.Background(), nil); err != nil {
+		t.Fatalf("failed to initialize client: %v", err)
+	}
+
+	return client
+}
+
+func TestMultiClientReadFailover(t *testing.T) {
+	primary := newTestAccount(t, &twittertest.ServerConfig{Username: "agent"})
+	backup := newTestAccount(t, &twittertest.ServerConfig{Username: "backup"})
+	for _, account := range []*testAccount{primary, backup} {
+		account.server.AddTweet(&twittertest.Tweet{ID: 42, Username: "alice", Text: "@agent :agent: hi"})
+	}
+
+	client := newTestMultiClient(t, twitter.WriteFailoverNone, primary, backup)
+
+	primary.server.FailNext(twittertest.EndpointGetTweet, http.StatusForbidden)
+	tweet, err := client.GetTweet(context.Background(), 42)
+	if err != nil {
+		t.Fatalf("failed to get tweet: %v", err)
+	}
+	if tweet.AuthorUsername != "alice" {
+		t.Fatalf("unexpected tweet %+v", tweet)
+	}
+
+	// The primary account is unhealthy now and is tried last.
+	if _, err := client.GetTweet(context.Background(), 42); err != nil {
+		t.Fatalf("failed to get tweet: %v", err)
+	}
+	if requests := primary.server.Requests(twittertest.EndpointGetTweet); requests != 1 {
+		t.Fatalf("expected unhealthy account to be skipped, got %d requests", requests)
+	}
+
+	statuses := client.Accounts()
+	if statuses[0].Healthy || !statuses[1].Healthy {
+		t.Fatalf("unexpected account health %+v", statuses)
+	}
+
+	// Missing tweets are not the fault of the account.
+	if _, err := client.GetTweet(context.Background(), 43); err == nil {
+		t.Fatalf("expected error for missing tweet")
+	}
+	if requests := primary.server.Requests(twittertest.EndpointGetTweet); requests != 1 {
+		t.Fatalf("expected missing tweet not to fail over, got %d requests", requests)
+	}
+}
+
+func TestMultiClientWriteFailover(t *testing.T) {
+	tests := []struct {
+		name           string
+		policy         twitter.WriteFailover
+		backupUsername string
+		failsOver      bool
+	}{
+		{"none", twitter.WriteFailoverNone, "agent", false},
+		{"same username", twitter.WriteFailoverSameUsername, "agent", true},
+		{"same username with other account", twitter.WriteFailoverSameUsername, "backup", false},
+		{"any", twitter.WriteFailoverAny, "backup", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := newTestAccount(t, &twittertest.ServerConfig{Username: "agent"})
+			backup := newTestAccount(t, &twittertest.ServerConfig{Username: tt.backupUsername})
+			for _, account := range []*testAccount{primary, backup} {
+				account.server.AddTweet(&twittertest.Tweet{ID: 42, Username: "alice", Text: "@agent :agent: hi"})
+			}
+			client := newTestMultiClient(t, tt.policy, primary, backup)
+
+			primary.server.FailNext(twittertest.EndpointPostTweet, http.StatusForbidden)
+			_, err := client.ReplyToTweet(context.Background(), 42, ":agent: hello")
+			if tt.failsOver {
+				if err != nil {
+					t.Fatalf("failed to reply: %v", err)
+				}
+				if len(backup.server.Posted()) != 1 {
+					t.Fatalf("expected reply from backup account")
+				}
+			} else {
+				if err == nil {
+					t.Fatalf("expected reply to fail")
+				}
+				if len(backup.server.Posted()) != 0 {
+					t.Fatalf("expected no reply from backup account")
+				}
+			}
+		})
+	}
+}
+
+func TestMultiClientWriteDoesNotFailOverWhenPossiblyPosted(t *testing.T) {
+	primary := newTestAccount(t, &twittertest.ServerConfig{Username: "agent"})
+	backup := newTestAccount(t, &twittertest.ServerConfig{Username: "agent"})
+	client := newTestMultiClient(t, twitter.WriteFailoverSameUsername, primary, backup)
+
+	// The tweet may have been posted before the server failed.
+	primary.server.FailNext(twittertest.EndpointPostTweet, http.StatusServiceUnavailable)
+	if _, err := client.SendTweet(context.Background(), ":agent: hello"); err == nil {
+		t.Fatalf("expected the tweet to fail")
+	}
+	if len(backup.server.Posted()) != 0 {
+		t.Fatalf("expected no tweet from backup account")
+	}
+	if client.Accounts()[0].Healthy {
+		t.Fatalf("expected the primary account to be unhealthy")
+	}
+}
+
+func TestMultiClientRateLimits(t *testing.T) {
+	primary := newTestAccount(t, &twittertest.ServerConfig{Username: "agent", RateLimit: 1, RateLimitWindow: time.Hour})
+	backup := newTestAccount(t, &twittertest.ServerConfig{Username: "agent", RateLimit: 1, RateLimitWindow: time.Hour})
+	client := newTestMultiClient(t, twitter.WriteFailoverSameUsername, primary, backup)
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.SendTweet(context.Background(), ":agent: hello"); err != nil {
+			t.Fatalf("failed to send tweet: %v", err)
+		}
+	}
+	if len(primary.server.Posted()) != 1 || len(backup.server.Posted()) != 1 {
+		t.Fatalf("expected one tweet per account, got %d and %d", len(primary.server.Posted()), len(backup.server.Posted()))
+	}
+
+	limit, ok := client.RateLimit(twitter.EndpointPostTweet)
+	if !ok || !limit.Exhausted(time.Now()) {
+		t.Fatalf("expected combined limit to be exhausted, got %+v", limit)
+	}
+
+	// Rate limits are not failures.
+	for _, status := range client.Accounts() {
+		if !status.Healthy || status.RateLimits[twitter.EndpointPostTweet].Remaining != 0 {
+			t.Fatalf("unexpected account status %+v", status)
+		}
+	}
+
+	if _, err := client.SendTweet(context.Background(), ":agent: hello"); err == nil {
+		t.Fatalf("expected error when every account is rate limited")
+	}
+}
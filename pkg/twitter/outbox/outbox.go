@@ -0,0 +1,318 @@
+// Package outbox queues outbound tweets and replies so that they are posted
+// in the background, survive restarts and respect the X API rate limits.
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/NethermindEth/teeception/pkg/twitter"
+	"github.com/NethermindEth/teeception/pkg/twitter/composer"
+)
+
+// OutboxConfig is the configuration for an Outbox.
+type OutboxConfig struct {
+	Store  Store
+	Client twitter.TwitterClient
+
+	// PollInterval is the time between scans for due messages.
+	PollInterval time.Duration
+	// MaxAttempts is the number of attempts after which a message is marked failed.
+	MaxAttempts int
+	// MinBackoff and MaxBackoff bound the delay between attempts of a message.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Now returns the current time, it defaults to time.Now.
+	Now func() time.Time
+}
+
+// Backlog describes the state of the queue.
+type Backlog struct {
+	Stats
+	FailedMessages []*Message                   `json:"failed_messages"`
+	RateLimits     map[string]twitter.RateLimit `json:"rate_limits,omitempty"`
+}
+
+// Outbox posts queued tweets and replies in order, deferring them while the
+// post endpoint is rate limited and retrying failures with backoff. Long
+// messages are posted as threads one part at a time, resuming after the
+// last posted part.
+type Outbox struct {
+	store  Store
+	client twitter.TwitterClient
+
+	pollInterval time.Duration
+	maxAttempts  int
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	now          func() time.Time
+
+	notifyCh chan struct{}
+}
+
+// NewOutbox creates a new Outbox with sensible defaults if none are provided.
+func NewOutbox(cfg *OutboxConfig) *Outbox {
+	if cfg.Store == nil {
+		cfg.Store = NewStoreInMemory()
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 5 * time.Second
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 10
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = 5 * time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 15 * time.Minute
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+
+	return &Outbox{
+		store:        cfg.Store,
+		client:       cfg.Client,
+		pollInterval: cfg.PollInterval,
+		maxAttempts:  cfg.MaxAttempts,
+		minBackoff:   cfg.MinBackoff,
+		maxBackoff:   cfg.MaxBackoff,
+		now:          cfg.Now,
+		notifyCh:     make(chan struct{}, 1),
+	}
+}
+
+// Key builds the idempotency key of a message about a prompt.
+func Key(agentAddress string, promptID uint64, kind string) string {
+	return fmt.Sprintf("%s/%d/%s", agentAddress, promptID, kind)
+}
+
+// Reply queues a reply to a tweet. It returns false if a message with the
+// same key was queued before.
+func (o *Outbox) Reply(key, kind string, tweetID uint64, text string) (bool, error) {
+	return o.enqueue(&Message{
+		Key:       key,
+		Kind:      kind,
+		InReplyTo: tweetID,
+		Text:      text,
+	})
+}
+
+// Tweet queues a tweet. It returns false if a message with the same key was
+// queued before.
+func (o *Outbox) Tweet(key, kind string, text string) (bool, error) {
+	return o.enqueue(&Message{
+		Key:  key,
+		Kind: kind,
+		Text: text,
+	})
+}
+
+// TweetWithImage queues a tweet with a PNG image attached. It returns false if
+// a message with the same key was queued before.
+func (o *Outbox) TweetWithImage(key, kind string, text string, image []byte) (bool, error) {
+	return o.enqueue(&Message{
+		Key:   key,
+		Kind:  kind,
+		Text:  text,
+		Image: image,
+	})
+}
+
+func (o *Outbox) enqueue(msg *Message) (bool, error) {
+	now := o.now()
+	msg.Status = StatusPending
+	msg.CreatedAt = now
+	msg.NextAttemptAt = now
+
+	added, err := o.store.Add(msg)
+	if err != nil {
+		return false, fmt.Errorf("failed to queue message: %v", err)
+	}
+
+	if added {
+		select {
+		case o.notifyCh <- struct{}{}:
+		default:
+		}
+	}
+
+	return added, nil
+}
+
+// Run posts due messages until the context is cancelled.
+func (o *Outbox) Run(ctx context.Context) error {
+	for {
+		if err := o.Flush(ctx); err != nil {
+			slog.Warn("failed to flush outbox", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-o.notifyCh:
+		case <-time.After(o.pollInterval):
+		}
+	}
+}
+
+// Flush posts due messages in order until none are left or the post
+// endpoint runs out of requests.
+func (o *Outbox) Flush(ctx context.Context) error {
+	for ctx.Err() == nil {
+		if reset, limited := o.rateLimited(); limited {
+			slog.Info("outbox is waiting for rate limit reset", "reset", reset)
+			return nil
+		}
+
+		due, err := o.store.Due(o.now(), 1)
+		if err != nil {
+			return err
+		}
+		if len(due) == 0 {
+			return nil
+		}
+
+		o.send(ctx, due[0])
+	}
+
+	return ctx.Err()
+}
+
+// send posts the parts of the message not posted yet, storing the progress
+// after each part so that a retry or a restart does not post a part twice.
+func (o *Outbox) send(ctx context.Context, msg *Message) {
+	parts := composer.ComposeTagged(msg.Text)
+
+	var err error
+	for len(msg.PostedIDs) < len(parts) {
+		// The thread is finished once the rate limit resets, without counting an attempt.
+		if reset, limited := o.rateLimited(); limited && len(msg.PostedIDs) > 0 {
+			msg.NextAttemptAt = reset
+			slog.Info("deferring rest of queued thread until rate limit reset", "key", msg.Key, "posted_parts", len(msg.PostedIDs), "parts", len(parts), "reset", reset)
+			o.update(msg)
+			return
+		}
+
+		var id uint64
+		id, err = o.sendPart(ctx, msg, parts[len(msg.PostedIDs)])
+		if err != nil {
+			break
+		}
+
+		msg.PostedIDs = append(msg.PostedIDs, id)
+		if len(msg.PostedIDs) < len(parts) {
+			o.update(msg)
+		}
+	}
+
+	// An attempt interrupted by shutdown does not count, the message stays due.
+	if err != nil && ctx.Err() != nil {
+		o.update(msg)
+		return
+	}
+
+	now := o.now()
+	msg.Attempts++
+
+	if err == nil {
+		msg.Status = StatusSent
+		msg.SentAt = now
+		msg.LastError = ""
+		slog.Info("posted queued message", "key", msg.Key, "kind", msg.Kind, "attempts", msg.Attempts, "tweet_id", msg.PostedIDs[0], "parts", len(parts))
+	} else {
+		msg.LastError = err.Error()
+		if msg.Attempts >= o.maxAttempts {
+			msg.Status = StatusFailed
+			slog.Error("giving up on queued message", "key", msg.Key, "kind", msg.Kind, "attempts", msg.Attempts, "error", err)
+		} else {
+			msg.NextAttemptAt = now.Add(o.backoff(msg.Attempts))
+			if reset, limited := o.rateLimited(); limited && reset.After(msg.NextAttemptAt) {
+				msg.NextAttemptAt = reset
+			}
+			slog.Warn("failed to post queued message", "key", msg.Key, "kind", msg.Kind, "attempts", msg.Attempts, "posted_parts", len(msg.PostedIDs), "next_attempt_at", msg.NextAttemptAt, "error", err)
+		}
+	}
+
+	o.update(msg)
+}
+
+// sendPart posts a part of the message, as a reply to the last posted part,
+// or as the message itself if it is the first part.
+func (o *Outbox) sendPart(ctx context.Context, msg *Message, part string) (uint64, error) {
+	inReplyTo := msg.InReplyTo
+	for _, id := range msg.PostedIDs {
+		// Clients which do not report the ID of posted parts thread onto
+		// the last known tweet.
+		if id != 0 {
+			inReplyTo = id
+		}
+	}
+
+	switch {
+	case inReplyTo != 0:
+		return o.client.ReplyToTweet(ctx, inReplyTo, part)
+	case len(msg.PostedIDs) > 0:
+		return 0, fmt.Errorf("client did not return the id needed to thread the remaining parts")
+	case msg.Image != nil:
+		return o.client.SendTweetWithImage(ctx, part, msg.Image)
+	default:
+		return o.client.SendTweet(ctx, part)
+	}
+}
+
+func (o *Outbox) update(msg *Message) {
+	if err := o.store.Update(msg); err != nil {
+		slog.Error("failed to update queued message", "key", msg.Key, "error", err)
+	}
+}
+
+func (o *Outbox) backoff(attempts int) time.Duration {
+	backoff := o.minBackoff
+	for i := 1; i < attempts && backoff < o.maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, o.maxBackoff)
+}
+
+// rateLimited reports whether the post endpoint is out of requests and when it resets.
+func (o *Outbox) rateLimited() (time.Time, bool) {
+	reporter, ok := o.client.(twitter.RateLimitReporter)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	limit, ok := reporter.RateLimit(twitter.EndpointPostTweet)
+	if !ok || !limit.Exhausted(o.now()) {
+		return time.Time{}, false
+	}
+
+	return limit.Reset, true
+}
+
+// Backlog returns the queue counters, the latest failed messages and the
+// known rate limits.
+func (o *Outbox) Backlog() (*Backlog, error) {
+	stats, err := o.store.Stats()
+	if err != nil {
+		return nil, err
+	}
+
+	failed, err := o.store.List(StatusFailed, 20)
+	if err != nil {
+		return nil, err
+	}
+
+	backlog := &Backlog{
+		Stats:          *stats,
+		FailedMessages: failed,
+	}
+	if reporter, ok := o.client.(twitter.RateLimitReporter); ok {
+		backlog.RateLimits = reporter.RateLimits()
+	}
+
+	return backlog, nil
+}
@@ -0,0 +1,241 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/teeception/pkg/twitter"
+	"github.com/NethermindEth/teeception/pkg/twitter/outbox"
+)
+
+type post struct {
+	inReplyTo uint64
+	text      string
+}
+
+// stubClient records posts, failing the calls in failures and reporting the
+// post endpoint as exhausted after limit posts.
+type stubClient struct {
+	mu       sync.Mutex
+	posts    []post
+	calls    int
+	failures map[int]bool
+	limit    int
+	reset    time.Time
+}
+
+var _ twitter.TwitterClient = (*stubClient)(nil)
+var _ twitter.RateLimitReporter = (*stubClient)(nil)
+
+func (c *stubClient) Initialize(ctx context.Context, config *twitter.TwitterClientConfig) error {
+	return nil
+}
+
+func (c *stubClient) GetTweet(ctx context.Context, tweetID uint64) (*twitter.Tweet, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *stubClient) ReplyToTweet(ctx context.Context, tweetID uint64, reply string) (uint64, error) {
+	return c.post(tweetID, reply)
+}
+
+func (c *stubClient) SendTweet(ctx context.Context, tweet string) (uint64, error) {
+	return c.post(0, tweet)
+}
+
+func (c *stubClient) SendTweetWithImage(ctx context.Context, tweet string, image []byte) (uint64, error) {
+	return c.post(0, tweet)
+}
+
+func (c *stubClient) post(inReplyTo uint64, text string) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls++
+	if c.failures[c.calls] {
+		return 0, errors.New("service unavailable")
+	}
+
+	c.posts = append(c.posts, post{inReplyTo: inReplyTo, text: text})
+	return uint64(100 + len(c.posts)), nil
+}
+
+func (c *stubClient) RateLimit(endpoint string) (twitter.RateLimit, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.limit == 0 {
+		return twitter.RateLimit{}, false
+	}
+	return twitter.RateLimit{Limit: c.limit, Remaining: c.limit - len(c.posts), Reset: c.reset}, true
+}
+
+func (c *stubClient) RateLimits() map[string]twitter.RateLimit {
+	limit, _ := c.RateLimit(twitter.EndpointPostTweet)
+	return map[string]twitter.RateLimit{twitter.EndpointPostTweet: limit}
+}
+
+// longReply is posted as a thread of three parts.
+var longReply = strings.Repeat("This reply is long enough to be split. ", 18)
+
+// testClock is advanced by the tests past the backoff of failed messages.
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Now()}
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+const testBackoff = time.Hour
+
+func newTestOutbox(store outbox.Store, client *stubClient, clock *testClock) *outbox.Outbox {
+	return outbox.NewOutbox(&outbox.OutboxConfig{
+		Store:      store,
+		Client:     client,
+		MinBackoff: testBackoff,
+		MaxBackoff: testBackoff,
+		Now:        clock.Now,
+	})
+}
+
+func flush(t *testing.T, o *outbox.Outbox) {
+	t.Helper()
+	if err := o.Flush(context.Background()); err != nil {
+		t.Fatalf("failed to flush: %v", err)
+	}
+}
+
+func TestOutboxRetriesFromLastPostedPart(t *testing.T) {
+	client := &stubClient{failures: map[int]bool{2: true}}
+	store := outbox.NewStoreInMemory()
+	clock := newTestClock()
+	o := newTestOutbox(store, client, clock)
+
+	if _, err := o.Reply("reply", "reply", 1, longReply); err != nil {
+		t.Fatalf("failed to queue reply: %v", err)
+	}
+
+	flush(t, o)
+	if len(client.posts) != 1 {
+		t.Fatalf("expected the first part to be posted, got %+v", client.posts)
+	}
+
+	// Nothing is posted until the backoff elapses.
+	flush(t, o)
+	if len(client.posts) != 1 {
+		t.Fatalf("expected no post during the backoff, got %+v", client.posts)
+	}
+
+	clock.Advance(testBackoff)
+	flush(t, o)
+
+	if len(client.posts) != 3 || client.posts[0].inReplyTo != 1 || client.posts[1].inReplyTo != 101 || client.posts[2].inReplyTo != 102 {
+		t.Fatalf("expected the retry to thread the remaining parts, got %+v", client.posts)
+	}
+
+	sent, err := store.List(outbox.StatusSent, 10)
+	if err != nil {
+		t.Fatalf("failed to list messages: %v", err)
+	}
+	if len(sent) != 1 || sent[0].Attempts != 2 || len(sent[0].PostedIDs) != 3 {
+		t.Fatalf("expected the reply to be sent in two attempts, got %+v", sent)
+	}
+}
+
+func TestOutboxDefersRateLimitedThreads(t *testing.T) {
+	clock := newTestClock()
+	client := &stubClient{limit: 2, reset: clock.Now().Add(time.Hour)}
+	store := outbox.NewStoreInMemory()
+	o := newTestOutbox(store, client, clock)
+
+	if _, err := o.Tweet("tweet", "tweet", longReply); err != nil {
+		t.Fatalf("failed to queue tweet: %v", err)
+	}
+
+	flush(t, o)
+	if len(client.posts) != 2 {
+		t.Fatalf("expected posting to stop at the rate limit, got %+v", client.posts)
+	}
+
+	pending, err := store.List(outbox.StatusPending, 10)
+	if err != nil {
+		t.Fatalf("failed to list messages: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Attempts != 0 || !pending[0].NextAttemptAt.Equal(client.reset) {
+		t.Fatalf("expected the thread to be deferred until the reset, got %+v", pending)
+	}
+
+	// Nothing is posted until the limit resets.
+	flush(t, o)
+	if len(client.posts) != 2 {
+		t.Fatalf("expected no post while rate limited, got %+v", client.posts)
+	}
+}
+
+func TestOutboxResumesAfterRestart(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "outbox.db")
+
+	store, err := outbox.NewStoreSQLite(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	// The agent stops while the second part fails.
+	client := &stubClient{failures: map[int]bool{2: true}}
+	clock := newTestClock()
+	o := newTestOutbox(store, client, clock)
+	if _, err := o.Reply("reply", "reply", 1, longReply); err != nil {
+		t.Fatalf("failed to queue reply: %v", err)
+	}
+	flush(t, o)
+	if err := store.Close(); err != nil {
+		t.Fatalf("failed to close store: %v", err)
+	}
+
+	store, err = outbox.NewStoreSQLite(dbPath)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+
+	defer store.Close()
+
+	restarted := &stubClient{}
+	o = newTestOutbox(store, restarted, clock)
+	if added, err := o.Reply("reply", "reply", 1, longReply); err != nil || added {
+		t.Fatalf("expected the reply to be queued already, got %v: %v", added, err)
+	}
+
+	clock.Advance(testBackoff)
+	flush(t, o)
+
+	if len(restarted.posts) != 2 || restarted.posts[0].inReplyTo != 101 {
+		t.Fatalf("expected the restarted outbox to post the remaining parts, got %+v", restarted.posts)
+	}
+
+	stats, err := store.Stats()
+	if err != nil {
+		t.Fatalf("failed to get stats: %v", err)
+	}
+	if stats.Sent != 1 || stats.Pending != 0 {
+		t.Fatalf("expected the reply to be sent, got %+v", stats)
+	}
+}
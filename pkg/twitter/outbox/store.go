@@ -0,0 +1,170 @@
+package outbox
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Status is the delivery status of a message.
+type Status string
+
+const (
+	StatusPending Status = "pending"
+	StatusSent    Status = "sent"
+	StatusFailed  Status = "failed"
+)
+
+// Message is a queued tweet, or a reply if InReplyTo is set.
+type Message struct {
+	// Key identifies the message, enqueueing a message with a known key is a no-op.
+	Key       string `json:"key"`
+	Kind      string `json:"kind"`
+	InReplyTo uint64 `json:"in_reply_to,omitempty"`
+	Text      string `json:"text"`
+	// Image is a PNG attached to the tweet.
+	Image []byte `json:"-"`
+	// PostedIDs are the IDs of the parts of the thread posted so far, so that
+	// delivery resumes after the last posted part.
+	PostedIDs []uint64 `json:"posted_ids,omitempty"`
+
+	Status        Status    `json:"status"`
+	Attempts      int       `json:"attempts"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	LastError     string    `json:"last_error,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	SentAt        time.Time `json:"sent_at,omitempty"`
+}
+
+// Stats counts messages per status.
+type Stats struct {
+	Pending       int        `json:"pending"`
+	Sent          int        `json:"sent"`
+	Failed        int        `json:"failed"`
+	OldestPending *time.Time `json:"oldest_pending,omitempty"`
+}
+
+// Store persists outbound messages.
+type Store interface {
+	// Add stores a pending message and reports false if its key already exists.
+	Add(msg *Message) (bool, error)
+	// Due returns up to limit pending messages due at now, oldest first.
+	Due(now time.Time, limit int) ([]*Message, error)
+	// Update stores the delivery state of a message.
+	Update(msg *Message) error
+	// List returns up to limit messages with the given status, newest first.
+	List(status Status, limit int) ([]*Message, error)
+	// Stats counts messages per status.
+	Stats() (*Stats, error)
+}
+
+// StoreInMemory is an in-memory implementation of the Store interface.
+type StoreInMemory struct {
+	mu       sync.RWMutex
+	messages map[string]*Message
+}
+
+var _ Store = (*StoreInMemory)(nil)
+
+// NewStoreInMemory creates a new StoreInMemory.
+func NewStoreInMemory() *StoreInMemory {
+	return &StoreInMemory{
+		messages: make(map[string]*Message),
+	}
+}
+
+func (s *StoreInMemory) Add(msg *Message) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.messages[msg.Key]; ok {
+		return false, nil
+	}
+
+	stored := copyMessage(msg)
+	s.messages[msg.Key] = stored
+
+	return true, nil
+}
+
+func (s *StoreInMemory) Due(now time.Time, limit int) ([]*Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	due := make([]*Message, 0)
+	for _, msg := range s.messages {
+		if msg.Status == StatusPending && !msg.NextAttemptAt.After(now) {
+			due = append(due, copyMessage(msg))
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].CreatedAt.Before(due[j].CreatedAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	return due, nil
+}
+
+func (s *StoreInMemory) Update(msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := copyMessage(msg)
+	s.messages[msg.Key] = stored
+
+	return nil
+}
+
+func (s *StoreInMemory) List(status Status, limit int) ([]*Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	messages := make([]*Message, 0)
+	for _, msg := range s.messages {
+		if msg.Status == status {
+			messages = append(messages, copyMessage(msg))
+		}
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].CreatedAt.After(messages[j].CreatedAt)
+	})
+	if len(messages) > limit {
+		messages = messages[:limit]
+	}
+
+	return messages, nil
+}
+
+func (s *StoreInMemory) Stats() (*Stats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := &Stats{}
+	for _, msg := range s.messages {
+		switch msg.Status {
+		case StatusPending:
+			stats.Pending++
+			if stats.OldestPending == nil || msg.CreatedAt.Before(*stats.OldestPending) {
+				createdAt := msg.CreatedAt
+				stats.OldestPending = &createdAt
+			}
+		case StatusSent:
+			stats.Sent++
+		case StatusFailed:
+			stats.Failed++
+		}
+	}
+
+	return stats, nil
+}
+
+// copyMessage copies msg, so that callers do not share its posted IDs with the store.
+func copyMessage(msg *Message) *Message {
+	copied := *msg
+	copied.PostedIDs = append([]uint64(nil), msg.PostedIDs...)
+	return &copied
+}
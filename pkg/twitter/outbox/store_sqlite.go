@@ -0,0 +1,254 @@
+package outbox
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// StoreSQLite is a SQLite implementation of the Store interface.
+type StoreSQLite struct {
+	db *sql.DB
+}
+
+var _ Store = (*StoreSQLite)(nil)
+
+// NewStoreSQLite creates a new SQLite-based Store.
+func NewStoreSQLite(dbPath string) (*StoreSQLite, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS outbox (
+			key TEXT PRIMARY KEY,
+			kind TEXT NOT NULL,
+			in_reply_to INTEGER NOT NULL,
+			text TEXT NOT NULL,
+			image BLOB,
+			posted_ids TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL,
+			next_attempt_at INTEGER NOT NULL,
+			last_error TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			sent_at INTEGER NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS outbox_due ON outbox (status, next_attempt_at);
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tables: %w", err)
+	}
+
+	if err := addOutboxColumn(db, "image", "BLOB"); err != nil {
+		return nil, err
+	}
+	if err := addOutboxColumn(db, "posted_ids", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return nil, err
+	}
+
+	return &StoreSQLite{
+		db: db,
+	}, nil
+}
+
+// Close closes the database.
+func (s *StoreSQLite) Close() error {
+	return s.db.Close()
+}
+
+func (s *StoreSQLite) Add(msg *Message) (bool, error) {
+	res, err := s.db.Exec(`
+		INSERT OR IGNORE INTO outbox (key, kind, in_reply_to, text, image, posted_ids, status, attempts, next_attempt_at, last_error, created_at, sent_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, msg.Key, msg.Kind, msg.InReplyTo, msg.Text, msg.Image, encodePostedIDs(msg.PostedIDs), msg.Status, msg.Attempts, msg.NextAttemptAt.UnixMilli(), msg.LastError, msg.CreatedAt.UnixMilli(), unixMilliOrZero(msg.SentAt))
+	if err != nil {
+		return false, fmt.Errorf("failed to insert message: %w", err)
+	}
+
+	added, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	return added > 0, nil
+}
+
+func (s *StoreSQLite) Due(now time.Time, limit int) ([]*Message, error) {
+	return s.query(`
+		SELECT key, kind, in_reply_to, text, image, posted_ids, status, attempts, next_attempt_at, last_error, created_at, sent_at
+		FROM outbox
+		WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY created_at ASC
+		LIMIT ?
+	`, StatusPending, now.UnixMilli(), limit)
+}
+
+func (s *StoreSQLite) Update(msg *Message) error {
+	_, err := s.db.Exec(`
+		UPDATE outbox
+		SET posted_ids = ?, status = ?, attempts = ?, next_attempt_at = ?, last_error = ?, sent_at = ?
+		WHERE key = ?
+	`, encodePostedIDs(msg.PostedIDs), msg.Status, msg.Attempts, msg.NextAttemptAt.UnixMilli(), msg.LastError, unixMilliOrZero(msg.SentAt), msg.Key)
+	if err != nil {
+		return fmt.Errorf("failed to update message: %w", err)
+	}
+
+	return nil
+}
+
+func (s *StoreSQLite) List(status Status, limit int) ([]*Message, error) {
+	return s.query(`
+		SELECT key, kind, in_reply_to, text, image, posted_ids, status, attempts, next_attempt_at, last_error, created_at, sent_at
+		FROM outbox
+		WHERE status = ?
+		ORDER BY created_at DESC
+		LIMIT ?
+	`, status, limit)
+}
+
+func (s *StoreSQLite) Stats() (*Stats, error) {
+	rows, err := s.db.Query(`
+		SELECT status, COUNT(*), MIN(created_at)
+		FROM outbox
+		GROUP BY status
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats := &Stats{}
+	for rows.Next() {
+		var status Status
+		var count int
+		var oldest int64
+		if err := rows.Scan(&status, &count, &oldest); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		switch status {
+		case StatusPending:
+			stats.Pending = count
+			oldestPending := time.UnixMilli(oldest)
+			stats.OldestPending = &oldestPending
+		case StatusSent:
+			stats.Sent = count
+		case StatusFailed:
+			stats.Failed = count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return stats, nil
+}
+
+func (s *StoreSQLite) query(query string, args ...any) ([]*Message, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := make([]*Message, 0)
+	for rows.Next() {
+		var msg Message
+		var postedIDs string
+		var nextAttemptAt, createdAt, sentAt int64
+		if err := rows.Scan(&msg.Key, &msg.Kind, &msg.InReplyTo, &msg.Text, &msg.Image, &postedIDs, &msg.Status, &msg.Attempts, &nextAttemptAt, &msg.LastError, &createdAt, &sentAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		msg.PostedIDs, err = decodePostedIDs(postedIDs)
+		if err != nil {
+			return nil, err
+		}
+		msg.NextAttemptAt = time.UnixMilli(nextAttemptAt)
+		msg.CreatedAt = time.UnixMilli(createdAt)
+		if sentAt != 0 {
+			msg.SentAt = time.UnixMilli(sentAt)
+		}
+
+		messages = append(messages, &msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return messages, nil
+}
+
+// addOutboxColumn adds a column to outbox tables created before it was introduced.
+func addOutboxColumn(db *sql.DB, column, definition string) error {
+	rows, err := db.Query(`PRAGMA table_info(outbox)`)
+	if err != nil {
+		return fmt.Errorf("failed to query table info: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			return fmt.Errorf("failed to scan table info: %w", err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate table info: %w", err)
+	}
+
+	if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE outbox ADD COLUMN %s %s`, column, definition)); err != nil {
+		return fmt.Errorf("failed to add %s column: %w", column, err)
+	}
+
+	return nil
+}
+
+// encodePostedIDs stores posted IDs as a comma separated list.
+func encodePostedIDs(ids []uint64) string {
+	encoded := make([]string, len(ids))
+	for i, id := range ids {
+		encoded[i] = strconv.FormatUint(id, 10)
+	}
+	return strings.Join(encoded, ",")
+}
+
+func decodePostedIDs(encoded string) ([]uint64, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(encoded, ",")
+	ids := make([]uint64, len(parts))
+	for i, part := range parts {
+		id, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse posted id %q: %w", part, err)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+func unixMilliOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
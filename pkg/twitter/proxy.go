@@ -2,11 +2,17 @@ package twitter
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NethermindEth/teeception/pkg/twitter/composer"
 )
 
 type TwitterProxy struct {
@@ -15,6 +21,7 @@ type TwitterProxy struct {
 }
 
 var _ TwitterClient = (*TwitterProxy)(nil)
+var _ MentionPoller = (*TwitterProxy)(nil)
 
 func NewTwitterProxy(url string, client *http.Client) *TwitterProxy {
 	return &TwitterProxy{
@@ -23,7 +30,7 @@ func NewTwitterProxy(url string, client *http.Client) *TwitterProxy {
 	}
 }
 
-func (p *TwitterProxy) Initialize(config *TwitterClientConfig) error {
+func (p *TwitterProxy) Initialize(ctx context.Context, config *TwitterClientConfig) error {
 	body := map[string]string{
 		"username":          config.Username,
 		"password":          config.Password,
@@ -34,14 +41,9 @@ func (p *TwitterProxy) Initialize(config *TwitterClientConfig) error {
 		"accessTokenSecret": config.AccessTokenSecret,
 	}
 
-	jsonBody, err := json.Marshal(body)
+	resp, err := p.do(ctx, http.MethodPost, fmt.Sprintf("%s/initialize", p.url), body)
 	if err != nil {
-		return fmt.Errorf("failed to marshal body: %w", err)
-	}
-
-	resp, err := p.httpClient.Post(fmt.Sprintf("%s/initialize", p.url), "application/json", bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return err
 	}
 	defer resp.Body.Close()
 
@@ -56,83 +58,223 @@ func (p *TwitterProxy) Initialize(config *TwitterClientConfig) error {
 	return nil
 }
 
-func (p *TwitterProxy) GetTweetText(tweetID uint64) (string, error) {
+func (p *TwitterProxy) GetTweet(ctx context.Context, tweetID uint64) (*Tweet, error) {
 	if tweetID == 0 {
-		return "", fmt.Errorf("tweet ID is 0")
+		return nil, fmt.Errorf("tweet ID is 0")
 	}
 
-	resp, err := p.httpClient.Get(fmt.Sprintf("%s/tweet/%d", p.url, tweetID))
+	resp, err := p.do(ctx, http.MethodGet, fmt.Sprintf("%s/tweet/%d", p.url, tweetID), nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to get tweet: %d", resp.StatusCode)
+		return nil, fmt.Errorf("failed to get tweet: %d", resp.StatusCode)
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	var data proxyTweet
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to decode tweet: %w", err)
+	}
+
+	tweet, err := data.toTweet()
 	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %w", err)
+		return nil, err
 	}
 
-	return string(body), nil
+	return &tweet, nil
 }
 
-func (p *TwitterProxy) ReplyToTweet(tweetID uint64, reply string) error {
+func (p *TwitterProxy) ReplyToTweet(ctx context.Context, tweetID uint64, reply string) (uint64, error) {
 	slog.Info("replying to tweet", "tweet_id", tweetID, "reply", reply)
 
-	if len(reply) > replyMaxSize {
-		reply = reply[:replyMaxSize]
+	// Each part of a thread replies to the previous one, or to the original
+	// tweet if the proxy does not report the ID of the posted part.
+	var firstID uint64
+	inReplyTo := tweetID
+	for _, part := range composer.ComposeTagged(reply) {
+		id, err := p.post(ctx, fmt.Sprintf("%s/reply/%d", p.url, inReplyTo), map[string]string{"reply": part})
+		if err != nil {
+			return 0, fmt.Errorf("failed to reply to tweet: %w", err)
+		}
+		if firstID == 0 {
+			firstID = id
+		}
+		if id != 0 {
+			inReplyTo = id
+		}
 	}
 
-	body := map[string]string{
-		"reply": reply,
+	return firstID, nil
+}
+
+func (p *TwitterProxy) SendTweet(ctx context.Context, tweet string) (uint64, error) {
+	slog.Info("sending tweet", "tweet", tweet)
+
+	return p.sendThread(ctx, tweet, nil)
+}
+
+func (p *TwitterProxy) SendTweetWithImage(ctx context.Context, tweet string, image []byte) (uint64, error) {
+	slog.Info("sending tweet with image", "tweet", tweet, "image_size", len(image))
+
+	return p.sendThread(ctx, tweet, image)
+}
+
+// sendThread posts tweet as a thread with the image attached to its first
+// part and returns the ID of the first part.
+func (p *TwitterProxy) sendThread(ctx context.Context, tweet string, image []byte) (uint64, error) {
+	parts := composer.ComposeTagged(tweet)
+
+	body := map[string]string{"tweet": parts[0]}
+	if image != nil {
+		body["image"] = base64.StdEncoding.EncodeToString(image)
+		body["imageType"] = "image/png"
 	}
 
-	jsonBody, err := json.Marshal(body)
+	firstID, err := p.post(ctx, fmt.Sprintf("%s/tweet", p.url), body)
 	if err != nil {
-		return fmt.Errorf("failed to marshal body: %w", err)
+		return 0, fmt.Errorf("failed to send tweet: %w", err)
 	}
 
-	resp, err := p.httpClient.Post(fmt.Sprintf("%s/reply/%d", p.url, tweetID), "application/json", bytes.NewBuffer(jsonBody))
+	id := firstID
+	for _, part := range parts[1:] {
+		if id == 0 {
+			return 0, fmt.Errorf("failed to send tweet: proxy did not return the id needed to thread the remaining parts")
+		}
+
+		id, err = p.post(ctx, fmt.Sprintf("%s/reply/%d", p.url, id), map[string]string{"reply": part})
+		if err != nil {
+			return 0, fmt.Errorf("failed to send tweet: %w", err)
+		}
+	}
+
+	return firstID, nil
+}
+
+func (p *TwitterProxy) GetMentions(ctx context.Context, sinceID uint64) ([]Tweet, error) {
+	resp, err := p.do(ctx, http.MethodGet, fmt.Sprintf("%s/mentions?sinceId=%d", p.url, sinceID), nil)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to reply to tweet: %d", resp.StatusCode)
+		return nil, fmt.Errorf("failed to get mentions: %d", resp.StatusCode)
 	}
 
-	return nil
+	var data []proxyTweet
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to decode mentions: %w", err)
+	}
+
+	mentions := make([]Tweet, 0, len(data))
+	for _, tweet := range data {
+		mention, err := tweet.toTweet()
+		if err != nil {
+			return nil, err
+		}
+
+		mentions = append(mentions, mention)
+	}
+
+	return mentions, nil
 }
 
-func (p *TwitterProxy) SendTweet(tweet string) error {
-	slog.Info("sending tweet", "tweet", tweet)
+// post sends body to the proxy and returns the ID of the posted tweet, or 0
+// if the proxy did not report it.
+func (p *TwitterProxy) post(ctx context.Context, url string, body map[string]string) (uint64, error) {
+	resp, err := p.do(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
 
-	if len(tweet) > tweetMaxSize {
-		tweet = tweet[:tweetMaxSize]
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status: %d", resp.StatusCode)
 	}
 
-	body := map[string]string{
-		"tweet": tweet,
+	var data struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil || data.ID == "" {
+		return 0, nil
 	}
 
-	jsonBody, err := json.Marshal(body)
+	id, err := strconv.ParseUint(data.ID, 10, 64)
 	if err != nil {
-		return fmt.Errorf("failed to marshal body: %w", err)
+		return 0, nil
+	}
+
+	return id, nil
+}
+
+// do sends a request to the proxy with body, if any, encoded as JSON.
+func (p *TwitterProxy) do(ctx context.Context, method, url string, body map[string]string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		jsonBody, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal body: %w", err)
+		}
+		reader = bytes.NewReader(jsonBody)
 	}
 
-	resp, err := p.httpClient.Post(fmt.Sprintf("%s/tweet", p.url), "application/json", bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to send tweet: %d", resp.StatusCode)
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 
-	return nil
+	return resp, nil
+}
+
+// proxyTweet is a tweet as returned by the proxy.
+type proxyTweet struct {
+	ID             string   `json:"id"`
+	Text           string   `json:"text"`
+	UserID         string   `json:"userId"`
+	Username       string   `json:"username"`
+	Timestamp      int64    `json:"timestamp"`
+	ConversationID string   `json:"conversationId"`
+	Mentions       []string `json:"mentions"`
+	Hashtags       []string `json:"hashtags"`
+	URLs           []string `json:"urls"`
+}
+
+func (t proxyTweet) toTweet() (Tweet, error) {
+	id, err := strconv.ParseUint(t.ID, 10, 64)
+	if err != nil {
+		return Tweet{}, fmt.Errorf("invalid tweet id %q: %w", t.ID, err)
+	}
+
+	tweet := Tweet{
+		ID:             id,
+		Text:           t.Text,
+		AuthorID:       t.UserID,
+		AuthorUsername: t.Username,
+		Entities: TweetEntities{
+			Mentions: t.Mentions,
+			Hashtags: t.Hashtags,
+			URLs:     t.URLs,
+		},
+	}
+	if t.Timestamp != 0 {
+		tweet.CreatedAt = time.Unix(t.Timestamp, 0)
+	}
+	if t.ConversationID != "" {
+		tweet.ConversationID, err = strconv.ParseUint(t.ConversationID, 10, 64)
+		if err != nil {
+			return Tweet{}, fmt.Errorf("invalid conversation id %q: %w", t.ConversationID, err)
+		}
+	}
+
+	return tweet, nil
 }
@@ -0,0 +1,490 @@
+// Package twittertest provides an in-process fake of the X API endpoints used
+// by the twitter package, for tests that must not reach the network.
+package twittertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Endpoints served by the fake, as reported in rate limit keys.
+const (
+	EndpointGetTweet    = "GET /2/tweets/:id"
+	EndpointPostTweet   = "POST /2/tweets"
+	EndpointGetMe       = "GET /2/users/me"
+	EndpointGetMentions = "GET /2/users/:id/mentions"
+	EndpointUploadMedia = "POST /1.1/media/upload.json"
+)
+
+var (
+	tweetPathRegex    = regexp.MustCompile(`^/2/tweets/(\d+)$`)
+	mentionsPathRegex = regexp.MustCompile(`^/2/users/(\d+)/mentions$`)
+	mentionRegex      = regexp.MustCompile(`@(\w+)`)
+	hashtagRegex      = regexp.MustCompile(`#(\w+)`)
+	urlRegex          = regexp.MustCompile(`https?://\S+`)
+)
+
+// ServerConfig is the configuration for a Server.
+type ServerConfig struct {
+	// UserID and Username identify the authenticated user.
+	UserID   string
+	Username string
+	// ConsumerKey, if set, must be present in the OAuth header of every request.
+	ConsumerKey string
+
+	// RateLimit is the number of requests per endpoint and window, zero disables limiting.
+	RateLimit       int
+	RateLimitWindow time.Duration
+	// Latency is added to every response.
+	Latency time.Duration
+}
+
+// Tweet is a tweet known to the fake. Its entities are parsed from its text.
+type Tweet struct {
+	ID        uint64
+	AuthorID  string
+	Username  string
+	Text      string
+	CreatedAt time.Time
+	// ConversationID defaults to the conversation of the replied tweet, or to ID.
+	ConversationID uint64
+	InReplyTo      uint64
+	MediaIDs       []string
+}
+
+type rateWindow struct {
+	remaining int
+	reset     time.Time
+}
+
+// Server is a fake X API server.
+type Server struct {
+	*httptest.Server
+
+	userID          string
+	username        string
+	consumerKey     string
+	rateLimit       int
+	rateLimitWindow time.Duration
+	latency         time.Duration
+
+	mu        sync.Mutex
+	nextID    uint64
+	tweets    map[uint64]*Tweet
+	posted    []*Tweet
+	media     map[string][]byte
+	windows   map[string]*rateWindow
+	failures  map[string][]int
+	requests  map[string]int
+	authFails int
+}
+
+// NewServer starts a new fake X API server. It must be closed after use.
+func NewServer(cfg *ServerConfig) *Server {
+	if cfg.UserID == "" {
+		cfg.UserID = "1000"
+	}
+	if cfg.Username == "" {
+		cfg.Username = "agent"
+	}
+	if cfg.RateLimitWindow <= 0 {
+		cfg.RateLimitWindow = 15 * time.Minute
+	}
+
+	s := &Server{
+		userID:          cfg.UserID,
+		username:        cfg.Username,
+		consumerKey:     cfg.ConsumerKey,
+		rateLimit:       cfg.RateLimit,
+		rateLimitWindow: cfg.RateLimitWindow,
+		latency:         cfg.Latency,
+		nextID:          1_000_000,
+		tweets:          make(map[uint64]*Tweet),
+		media:           make(map[string][]byte),
+		windows:         make(map[string]*rateWindow),
+		failures:        make(map[string][]int),
+		requests:        make(map[string]int),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	return s
+}
+
+// AddTweet adds a tweet fixture.
+func (s *Server) AddTweet(tweet *Tweet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if tweet.CreatedAt.IsZero() {
+		tweet.CreatedAt = time.Now()
+	}
+	if tweet.ConversationID == 0 {
+		tweet.ConversationID = tweet.ID
+	}
+
+	s.tweets[tweet.ID] = tweet
+	if tweet.ID >= s.nextID {
+		s.nextID = tweet.ID + 1
+	}
+}
+
+// FailNext makes the next requests to endpoint fail with the given status codes, in order.
+func (s *Server) FailNext(endpoint string, statusCodes ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[endpoint] = append(s.failures[endpoint], statusCodes...)
+}
+
+// Posted returns the tweets posted through the fake, in order.
+func (s *Server) Posted() []*Tweet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	posted := make([]*Tweet, len(s.posted))
+	copy(posted, s.posted)
+	return posted
+}
+
+// Media returns an uploaded media file.
+func (s *Server) Media(mediaID string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	media, ok := s.media[mediaID]
+	return media, ok
+}
+
+// Requests returns the number of requests received by endpoint.
+func (s *Server) Requests(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[endpoint]
+}
+
+// AuthFailures returns the number of requests rejected for missing OAuth credentials.
+func (s *Server) AuthFailures() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.authFails
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if s.latency > 0 {
+		time.Sleep(s.latency)
+	}
+
+	endpoint, handler := s.route(r)
+	if handler == nil {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	s.mu.Lock()
+	s.requests[endpoint]++
+
+	if !s.authorized(r) {
+		s.authFails++
+		s.mu.Unlock()
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	limited := s.applyRateLimit(w, endpoint)
+
+	var failure int
+	if failures := s.failures[endpoint]; len(failures) > 0 {
+		failure = failures[0]
+		s.failures[endpoint] = failures[1:]
+	}
+	s.mu.Unlock()
+
+	switch {
+	case limited:
+		writeError(w, http.StatusTooManyRequests, "too many requests")
+	case failure == http.StatusTooManyRequests:
+		// An injected 429 behaves like an exhausted window that resets right away.
+		w.Header().Set("x-rate-limit-remaining", "0")
+		w.Header().Set("x-rate-limit-reset", strconv.FormatInt(time.Now().Unix(), 10))
+		writeError(w, failure, "too many requests")
+	case failure != 0:
+		writeError(w, failure, http.StatusText(failure))
+	default:
+		handler(w, r)
+	}
+}
+
+func (s *Server) route(r *http.Request) (string, http.HandlerFunc) {
+	path := r.URL.Path
+
+	switch {
+	case r.Method == http.MethodGet && tweetPathRegex.MatchString(path):
+		return EndpointGetTweet, s.handleGetTweet
+	case r.Method == http.MethodPost && path == "/2/tweets":
+		return EndpointPostTweet, s.handlePostTweet
+	case r.Method == http.MethodGet && path == "/2/users/me":
+		return EndpointGetMe, s.handleGetMe
+	case r.Method == http.MethodGet && mentionsPathRegex.MatchString(path):
+		return EndpointGetMentions, s.handleGetMentions
+	case r.Method == http.MethodPost && path == "/1.1/media/upload.json":
+		return EndpointUploadMedia, s.handleUploadMedia
+	}
+
+	return "", nil
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "OAuth ") || !strings.Contains(auth, "oauth_signature=") {
+		return false
+	}
+	return s.consumerKey == "" || strings.Contains(auth, fmt.Sprintf(`oauth_consumer_key="%s"`, s.consumerKey))
+}
+
+// applyRateLimit sets the rate limit headers and reports whether the window is exhausted.
+func (s *Server) applyRateLimit(w http.ResponseWriter, endpoint string) bool {
+	if s.rateLimit <= 0 {
+		return false
+	}
+
+	now := time.Now()
+	window, ok := s.windows[endpoint]
+	if !ok || !now.Before(window.reset) {
+		window = &rateWindow{
+			remaining: s.rateLimit,
+			reset:     now.Add(s.rateLimitWindow),
+		}
+		s.windows[endpoint] = window
+	}
+
+	limited := window.remaining <= 0
+	if !limited {
+		window.remaining--
+	}
+
+	w.Header().Set("x-rate-limit-limit", strconv.Itoa(s.rateLimit))
+	w.Header().Set("x-rate-limit-remaining", strconv.Itoa(window.remaining))
+	w.Header().Set("x-rate-limit-reset", strconv.FormatInt(window.reset.Unix(), 10))
+
+	return limited
+}
+
+func (s *Server) handleGetTweet(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseUint(tweetPathRegex.FindStringSubmatch(r.URL.Path)[1], 10, 64)
+
+	s.mu.Lock()
+	tweet, ok := s.tweets[id]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "tweet not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"data": tweetJSON(tweet),
+		"includes": map[string]any{
+			"users": []map[string]any{
+				{"id": tweet.AuthorID, "username": tweet.Username},
+			},
+		},
+	})
+}
+
+func (s *Server) handlePostTweet(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Text  string `json:"text"`
+		Reply *struct {
+			InReplyToTweetID string `json:"in_reply_to_tweet_id"`
+		} `json:"reply"`
+		Media *struct {
+			MediaIDs []string `json:"media_ids"`
+		} `json:"media"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tweet := &Tweet{
+		AuthorID:  s.userID,
+		Username:  s.username,
+		Text:      req.Text,
+		CreatedAt: time.Now(),
+	}
+	if req.Reply != nil {
+		tweet.InReplyTo, _ = strconv.ParseUint(req.Reply.InReplyToTweetID, 10, 64)
+	}
+	if req.Media != nil {
+		tweet.MediaIDs = req.Media.MediaIDs
+	}
+
+	s.mu.Lock()
+	if tweet.InReplyTo != 0 {
+		replied, ok := s.tweets[tweet.InReplyTo]
+		if !ok {
+			s.mu.Unlock()
+			writeError(w, http.StatusBadRequest, "replied tweet not found")
+			return
+		}
+		tweet.ConversationID = replied.ConversationID
+	}
+	for _, mediaID := range tweet.MediaIDs {
+		if _, ok := s.media[mediaID]; !ok {
+			s.mu.Unlock()
+			writeError(w, http.StatusBadRequest, "media not found")
+			return
+		}
+	}
+
+	tweet.ID = s.nextID
+	s.nextID++
+	if tweet.ConversationID == 0 {
+		tweet.ConversationID = tweet.ID
+	}
+	s.tweets[tweet.ID] = tweet
+	s.posted = append(s.posted, tweet)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"data": map[string]any{
+			"id":   strconv.FormatUint(tweet.ID, 10),
+			"text": tweet.Text,
+		},
+	})
+}
+
+func (s *Server) handleGetMe(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"data": map[string]any{
+			"id":       s.userID,
+			"username": s.username,
+		},
+	})
+}
+
+func (s *Server) handleGetMentions(w http.ResponseWriter, r *http.Request) {
+	if mentionsPathRegex.FindStringSubmatch(r.URL.Path)[1] != s.userID {
+		writeError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	sinceID, _ := strconv.ParseUint(r.URL.Query().Get("since_id"), 10, 64)
+
+	s.mu.Lock()
+	mentions := make([]*Tweet, 0)
+	users := make(map[string]string)
+	for _, tweet := range s.tweets {
+		if tweet.ID > sinceID && tweet.AuthorID != s.userID && strings.Contains(tweet.Text, "@"+s.username) {
+			mentions = append(mentions, tweet)
+			users[tweet.AuthorID] = tweet.Username
+		}
+	}
+	s.mu.Unlock()
+
+	// Mentions are returned newest first, like the real API.
+	sort.Slice(mentions, func(i, j int) bool {
+		return mentions[i].ID > mentions[j].ID
+	})
+
+	data := make([]map[string]any, 0, len(mentions))
+	for _, tweet := range mentions {
+		data = append(data, tweetJSON(tweet))
+	}
+
+	includedUsers := make([]map[string]any, 0, len(users))
+	for id, username := range users {
+		includedUsers = append(includedUsers, map[string]any{
+			"id":       id,
+			"username": username,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"data": data,
+		"includes": map[string]any{
+			"users": includedUsers,
+		},
+	})
+}
+
+func (s *Server) handleUploadMedia(w http.ResponseWriter, r *http.Request) {
+	file, _, err := r.FormFile("media")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer file.Close()
+
+	media, err := io.ReadAll(file)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	mediaID := strconv.FormatUint(s.nextID, 10)
+	s.nextID++
+	s.media[mediaID] = media
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"media_id_string": mediaID,
+		"size":            len(media),
+	})
+}
+
+// tweetJSON encodes a tweet like the v2 API with the fields requested by the client.
+func tweetJSON(tweet *Tweet) map[string]any {
+	mentions := make([]map[string]any, 0)
+	for _, match := range mentionRegex.FindAllStringSubmatch(tweet.Text, -1) {
+		mentions = append(mentions, map[string]any{"username": match[1]})
+	}
+	hashtags := make([]map[string]any, 0)
+	for _, match := range hashtagRegex.FindAllStringSubmatch(tweet.Text, -1) {
+		hashtags = append(hashtags, map[string]any{"tag": match[1]})
+	}
+	urls := make([]map[string]any, 0)
+	for _, match := range urlRegex.FindAllString(tweet.Text, -1) {
+		urls = append(urls, map[string]any{"url": match, "expanded_url": match})
+	}
+
+	return map[string]any{
+		"id":              strconv.FormatUint(tweet.ID, 10),
+		"text":            tweet.Text,
+		"author_id":       tweet.AuthorID,
+		"created_at":      tweet.CreatedAt.UTC().Format(time.RFC3339),
+		"conversation_id": strconv.FormatUint(tweet.ConversationID, 10),
+		"reply_settings":  "everyone",
+		"entities": map[string]any{
+			"mentions": mentions,
+			"hashtags": hashtags,
+			"urls":     urls,
+		},
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, detail string) {
+	writeJSON(w, status, map[string]any{
+		"title":  http.StatusText(status),
+		"detail": detail,
+		"status": status,
+	})
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// keyedRateLimiter limits the rate of requests per key, such as an address
+// or an IP.
+type keyedRateLimiter struct {
+	interval time.Duration
+	burst    int
+
+	mu        sync.Mutex
+	limiters  map[string]*keyedLimiter
+	lastPrune time.Time
+}
+
+type keyedLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newKeyedRateLimiter creates a keyedRateLimiter allowing a request per
+// interval for each key, after a burst.
+func newKeyedRateLimiter(interval time.Duration, burst int) *keyedRateLimiter {
+	return &keyedRateLimiter{
+		interval: interval,
+		burst:    burst,
+		limiters: make(map[string]*keyedLimiter),
+	}
+}
+
+// Allow reports whether a request of key may happen now.
+func (l *keyedRateLimiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	// Limiters idle for long enough to be refilled are dropped.
+	idle := l.interval * time.Duration(l.burst)
+	if now.Sub(l.lastPrune) > idle {
+		for k, limiter := range l.limiters {
+			if now.Sub(limiter.lastSeen) > idle {
+				delete(l.limiters, k)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	limiter, ok := l.limiters[key]
+	if !ok {
+		limiter = &keyedLimiter{limiter: rate.NewLimiter(rate.Every(l.interval), l.burst)}
+		l.limiters[key] = limiter
+	}
+	limiter.lastSeen = now
+
+	return limiter.limiter.AllowN(now, 1)
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math/big"
@@ -10,14 +11,27 @@ import (
 	"time"
 
 	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/teeception/pkg/agent/chat"
 	"github.com/NethermindEth/teeception/pkg/indexer"
 	"github.com/NethermindEth/teeception/pkg/indexer/price"
+	"github.com/NethermindEth/teeception/pkg/twitter"
+	"github.com/NethermindEth/teeception/pkg/twitter/link"
 	"github.com/NethermindEth/teeception/pkg/wallet/starknet"
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/sync/errgroup"
 )
 
+const (
+	// linkRateBurst is the number of link requests an address or an IP may make at once.
+	linkRateBurst = 5
+
+	// tokenCountAddress stands for the addresses of the metadata of counted
+	// prompts. It has the length of an address and no repeated digits, which
+	// tokenizers would merge.
+	tokenCountAddress = "0x04c1d9e7a3b5f2860d7e1a9c3b5f7082e4a6c8b0d2f4e6a8c0b2d4f6e8a0c2b4"
+)
+
 type UIServiceConfig struct {
 	Client               starknet.ProviderWrapper
 	MaxPageSize          int
@@ -32,6 +46,25 @@ type UIServiceConfig struct {
 	AgentBalanceTickRate time.Duration
 	PromptIndexerDBPath  string
 	PromptIndexerApiKey  string
+
+	// TwitterClient fetches verification tweets, linking is disabled without it.
+	TwitterClient twitter.TwitterClient
+	LinkDBPath    string
+	ChainID       string
+	// LinkRateInterval is the time between link requests of an address or
+	// an IP, after a burst of linkRateBurst.
+	LinkRateInterval time.Duration
+
+	// SystemPromptTokenLimit is the token limit agents enforce on system
+	// prompts, it defaults to chat.DefaultSystemPromptTokenLimit.
+	SystemPromptTokenLimit int
+	// TotalTokenLimit is the token limit agents enforce on prompts with their
+	// metadata and system prompt, it defaults to chat.DefaultTotalTokenLimit.
+	TotalTokenLimit int
+	// BackendModels maps the models agents are registered with to the models
+	// answering them, as configured in agents with AGENT_MODEL_BACKENDS, so
+	// that tokens are counted for the model the agent prompts.
+	BackendModels map[string]string
 }
 
 type UIService struct {
@@ -51,9 +84,29 @@ type UIService struct {
 	serverAddr  string
 
 	promptIndexerApiKey string
+
+	linkStore          link.Store
+	linkVerifier       *link.Verifier
+	linkAddressLimiter *keyedRateLimiter
+	linkIPLimiter      *keyedRateLimiter
+
+	tokenCounters          *chat.TokenCounters
+	systemPromptTokenLimit int
+	totalTokenLimit        int
+	backendModels          map[string]string
 }
 
 func NewUIService(config *UIServiceConfig) (*UIService, error) {
+	if config.SystemPromptTokenLimit == 0 {
+		config.SystemPromptTokenLimit = chat.DefaultSystemPromptTokenLimit
+	}
+	if config.TotalTokenLimit == 0 {
+		config.TotalTokenLimit = chat.DefaultTotalTokenLimit
+	}
+	if config.LinkRateInterval <= 0 {
+		config.LinkRateInterval = time.Minute
+	}
+
 	lastIndexedBlock := config.StartingBlock - 1
 
 	eventWatcher, err := indexer.NewEventWatcher(&indexer.EventWatcherConfig{
@@ -137,6 +190,24 @@ func NewUIService(config *UIServiceConfig) (*UIService, error) {
 		},
 	})
 
+	var linkStore link.Store
+	var linkVerifier *link.Verifier
+	if config.TwitterClient != nil {
+		linkStore, err = link.NewStoreSQLite(config.LinkDBPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create link database: %v", err)
+		}
+
+		linkVerifier = link.NewVerifier(&link.VerifierConfig{
+			Tweets: config.TwitterClient,
+			CheckSignature: func(ctx context.Context, account, hash *felt.Felt, signature []*felt.Felt) (bool, error) {
+				return starknet.IsValidSignature(ctx, config.Client, account, hash, signature)
+			},
+			Store:   linkStore,
+			ChainID: config.ChainID,
+		})
+	}
+
 	return &UIService{
 		eventWatcher:        eventWatcher,
 		agentIndexer:        agentIndexer,
@@ -152,6 +223,15 @@ func NewUIService(config *UIServiceConfig) (*UIService, error) {
 		maxPageSize:         config.MaxPageSize,
 		serverAddr:          config.ServerAddr,
 		promptIndexerApiKey: config.PromptIndexerApiKey,
+		linkStore:           linkStore,
+		linkVerifier:        linkVerifier,
+		linkAddressLimiter:  newKeyedRateLimiter(config.LinkRateInterval, linkRateBurst),
+		linkIPLimiter:       newKeyedRateLimiter(config.LinkRateInterval, linkRateBurst),
+
+		tokenCounters:          chat.NewTokenCounters(),
+		systemPromptTokenLimit: config.SystemPromptTokenLimit,
+		totalTokenLimit:        config.TotalTokenLimit,
+		backendModels:          config.BackendModels,
 	}, nil
 }
 
@@ -197,6 +277,10 @@ func (s *UIService) startServer(ctx context.Context) error {
 	router.GET("/usage", s.HandleGetUsage)
 	router.GET("/prompt", s.HandleGetPromptResponse)
 	router.POST("/prompt", s.HandleRegisterPromptResponse)
+	router.POST("/tokens", s.HandleCountTokens)
+	router.GET("/link", s.HandleGetLink)
+	router.GET("/link/typed_data", s.HandleGetLinkTypedData)
+	router.POST("/link", s.HandleCreateLink)
 
 	server := &http.Server{
 		Addr:    s.serverAddr,
@@ -494,6 +578,46 @@ func (s *UIService) HandleGetUsage(c *gin.Context) {
 	})
 }
 
+// CountTokensRequest represents the request body for counting the tokens of a system prompt
+type CountTokensRequest struct {
+	Model        *string `json:"model" binding:"required"`
+	SystemPrompt string  `json:"system_prompt"`
+	Prompt       string  `json:"prompt"`
+}
+
+type CountTokensResponse struct {
+	*chat.TokenCount
+	SystemPromptTokenLimit int  `json:"system_prompt_token_limit"`
+	TotalTokenLimit        int  `json:"total_token_limit"`
+	WithinLimit            bool `json:"within_limit"`
+}
+
+// HandleCountTokens counts tokens the way agents do, with the metadata
+// agents are prompted with, so that system prompts can be checked before
+// registering an agent.
+func (s *UIService) HandleCountTokens(c *gin.Context) {
+	var req CountTokensRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	model := *req.Model
+	if backendModel, ok := s.backendModels[model]; ok {
+		model = backendModel
+	}
+
+	metadata := chat.BuildMetadata(tokenCountAddress, tokenCountAddress, tokenCountAddress)
+	count := chat.CountTokens(s.tokenCounters, model, metadata, req.SystemPrompt, req.Prompt, nil)
+
+	c.JSON(http.StatusOK, &CountTokensResponse{
+		TokenCount:             count,
+		SystemPromptTokenLimit: s.systemPromptTokenLimit,
+		TotalTokenLimit:        s.totalTokenLimit,
+		WithinLimit:            count.SystemPrompt <= s.systemPromptTokenLimit && count.Total <= s.totalTokenLimit,
+	})
+}
+
 func (s *UIService) HandleGetUserLeaderboard(c *gin.Context) {
 	page, err := strconv.Atoi(c.Query("page"))
 	if err != nil {
@@ -630,6 +754,15 @@ type RegisterPromptResponseRequest struct {
 	Error       *string `json:"error"`
 	BlockNumber *uint64 `json:"block_number" binding:"required"`
 	UserAddr    *string `json:"user_addr" binding:"required"`
+	Moderation  *string `json:"moderation"`
+	Model       *string `json:"model"`
+	// PromptTokens, CompletionTokens and Cost are the usage of the prompt,
+	// the cost being in USD.
+	PromptTokens     *int64   `json:"prompt_tokens"`
+	CompletionTokens *int64   `json:"completion_tokens"`
+	Cost             *float64 `json:"cost"`
+	// Votes are the votes of the models of prompts answered by consensus.
+	Votes []indexer.PromptVote `json:"votes"`
 }
 
 func (s *UIService) HandleRegisterPromptResponse(c *gin.Context) {
@@ -670,6 +803,13 @@ func (s *UIService) HandleRegisterPromptResponse(c *gin.Context) {
 		Error:       req.Error,
 		BlockNumber: *req.BlockNumber,
 		UserAddr:    userAddr,
+		Moderation:  req.Moderation,
+		Model:       req.Model,
+
+		PromptTokens:     req.PromptTokens,
+		CompletionTokens: req.CompletionTokens,
+		Cost:             req.Cost,
+		Votes:            req.Votes,
 	}
 
 	if err := s.promptIndexer.RegisterPromptResponse(data, true); err != nil {
@@ -691,6 +831,13 @@ type PromptData struct {
 	Error       string `json:"error,omitempty"`
 	BlockNumber string `json:"block_number"`
 	UserAddr    string `json:"user_addr"`
+	Moderation  string `json:"moderation,omitempty"`
+	Model       string `json:"model,omitempty"`
+
+	PromptTokens     *int64               `json:"prompt_tokens,omitempty"`
+	CompletionTokens *int64               `json:"completion_tokens,omitempty"`
+	Cost             *float64             `json:"cost,omitempty"`
+	Votes            []indexer.PromptVote `json:"votes,omitempty"`
 }
 
 type PromptPageResponse struct {
@@ -746,6 +893,14 @@ func (s *UIService) HandleGetUserPrompts(c *gin.Context) {
 		if prompt.Error != nil {
 			errorMsg = *prompt.Error
 		}
+		moderation := ""
+		if prompt.Moderation != nil {
+			moderation = *prompt.Moderation
+		}
+		model := ""
+		if prompt.Model != nil {
+			model = *prompt.Model
+		}
 
 		promptDatas = append(promptDatas, &PromptData{
 			Pending:     prompt.Pending,
@@ -757,6 +912,13 @@ func (s *UIService) HandleGetUserPrompts(c *gin.Context) {
 			Error:       errorMsg,
 			BlockNumber: strconv.FormatUint(prompt.BlockNumber, 10),
 			UserAddr:    prompt.UserAddr.String(),
+			Moderation:  moderation,
+			Model:       model,
+
+			PromptTokens:     prompt.PromptTokens,
+			CompletionTokens: prompt.CompletionTokens,
+			Cost:             prompt.Cost,
+			Votes:            prompt.Votes,
 		})
 	}
 
@@ -808,6 +970,14 @@ func (s *UIService) HandleGetPromptResponse(c *gin.Context) {
 	if prompt.Error != nil {
 		errorMsg = *prompt.Error
 	}
+	moderation := ""
+	if prompt.Moderation != nil {
+		moderation = *prompt.Moderation
+	}
+	model := ""
+	if prompt.Model != nil {
+		model = *prompt.Model
+	}
 
 	c.JSON(http.StatusOK, &PromptData{
 		Pending:     prompt.Pending,
@@ -819,5 +989,166 @@ func (s *UIService) HandleGetPromptResponse(c *gin.Context) {
 		Error:       errorMsg,
 		BlockNumber: strconv.FormatUint(prompt.BlockNumber, 10),
 		UserAddr:    prompt.UserAddr.String(),
+		Moderation:  moderation,
+		Model:       model,
+
+		PromptTokens:     prompt.PromptTokens,
+		CompletionTokens: prompt.CompletionTokens,
+		Cost:             prompt.Cost,
+		Votes:            prompt.Votes,
+	})
+}
+
+type LinkTypedDataResponse struct {
+	TypedData        map[string]any `json:"typed_data"`
+	Timestamp        uint64         `json:"timestamp"`
+	VerificationText string         `json:"verification_text"`
+}
+
+// HandleGetLinkTypedData returns the message an account signs to link a handle
+// and the text of the verification tweet.
+func (s *UIService) HandleGetLinkTypedData(c *gin.Context) {
+	if s.linkVerifier == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "linking is disabled"})
+		return
+	}
+
+	address, err := new(felt.Felt).SetString(c.Query("address"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Errorf("invalid address: %w", err).Error()})
+		return
+	}
+
+	handle, err := link.NormalizeHandle(c.Query("handle"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	timestamp := uint64(time.Now().Unix())
+
+	c.JSON(http.StatusOK, &LinkTypedDataResponse{
+		TypedData:        link.TypedData(s.linkVerifier.ChainID(), link.Message{Handle: handle, Timestamp: timestamp}),
+		Timestamp:        timestamp,
+		VerificationText: link.VerificationText(address),
+	})
+}
+
+// CreateLinkRequest represents the request body for linking an account to a handle
+type CreateLinkRequest struct {
+	Address   *string  `json:"address" binding:"required"`
+	Handle    *string  `json:"handle" binding:"required"`
+	Timestamp *uint64  `json:"timestamp" binding:"required"`
+	TweetID   *string  `json:"tweet_id" binding:"required"`
+	Signature []string `json:"signature" binding:"required"`
+}
+
+func (s *UIService) HandleCreateLink(c *gin.Context) {
+	if s.linkVerifier == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "linking is disabled"})
+		return
+	}
+
+	// Linking checks a signature on chain and fetches a tweet from X, so
+	// requests are limited per IP and per address.
+	if !s.linkIPLimiter.Allow(c.ClientIP()) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many link requests"})
+		return
+	}
+
+	var req CreateLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+
+	address, err := new(felt.Felt).SetString(*req.Address)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid address: %v", err)})
+		return
+	}
+
+	if !s.linkAddressLimiter.Allow(address.String()) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many link requests"})
+		return
+	}
+
+	tweetID, err := strconv.ParseUint(*req.TweetID, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tweet_id"})
+		return
+	}
+
+	signature := make([]*felt.Felt, 0, len(req.Signature))
+	for _, part := range req.Signature {
+		f, err := new(felt.Felt).SetString(part)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid signature: %v", err)})
+			return
+		}
+		signature = append(signature, f)
+	}
+
+	linked, err := s.linkVerifier.Link(c.Request.Context(), &link.Request{
+		Address:   address,
+		Handle:    *req.Handle,
+		Timestamp: *req.Timestamp,
+		TweetID:   tweetID,
+		Signature: signature,
 	})
+	if errors.Is(err, link.ErrVerification) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		slog.Error("failed to link account", "address", address, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to link account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, linked)
+}
+
+// HandleGetLink returns the link of an account or of a handle.
+func (s *UIService) HandleGetLink(c *gin.Context) {
+	if s.linkStore == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "linking is disabled"})
+		return
+	}
+
+	var linked *link.Link
+	var ok bool
+	var err error
+
+	switch {
+	case c.Query("address") != "":
+		address, parseErr := new(felt.Felt).SetString(c.Query("address"))
+		if parseErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Errorf("invalid address: %w", parseErr).Error()})
+			return
+		}
+		linked, ok, err = s.linkStore.GetByAddress(address)
+	case c.Query("handle") != "":
+		handle, parseErr := link.NormalizeHandle(c.Query("handle"))
+		if parseErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": parseErr.Error()})
+			return
+		}
+		linked, ok, err = s.linkStore.GetByHandle(handle)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "address or handle required"})
+		return
+	}
+
+	if err != nil {
+		slog.Error("error fetching link", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get link"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "link not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, linked)
 }
@@ -0,0 +1,378 @@
+package starknet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/starknet.go/rpc"
+	starknetgoutils "github.com/NethermindEth/starknet.go/utils"
+)
+
+var balanceOfSelector = starknetgoutils.GetSelectorFromNameFelt("balance_of")
+
+// FetchTokenBalance returns the ERC20 balance of address for the given token.
+func FetchTokenBalance(ctx context.Context, client ProviderWrapper, tokenAddress, address *felt.Felt) (*big.Int, error) {
+	fnCall := rpc.FunctionCall{
+		ContractAddress:    tokenAddress,
+		EntryPointSelector: balanceOfSelector,
+		Calldata:           []*felt.Felt{address},
+	}
+
+	var resp []*felt.Felt
+	var err error
+
+	if err := client.Do(func(provider rpc.RpcProvider) error {
+		resp, err = provider.Call(ctx, fnCall, rpc.WithBlockTag("pending"))
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("failed to call balance_of: %w", FormatRpcError(err))
+	}
+
+	if len(resp) < 2 {
+		return nil, fmt.Errorf("invalid response length: got %d, want at least 2", len(resp))
+	}
+
+	return Uint256ToBigInt([2]*felt.Felt(resp[0:2])), nil
+}
+
+// BalanceReader reads the balance of the monitored account.
+type BalanceReader interface {
+	ReadBalance(ctx context.Context) (*big.Int, error)
+}
+
+// TokenBalanceReader reads the ERC20 balance of an address.
+type TokenBalanceReader struct {
+	Client       ProviderWrapper
+	TokenAddress *felt.Felt
+	Address      *felt.Felt
+}
+
+var _ BalanceReader = (*TokenBalanceReader)(nil)
+
+func (r *TokenBalanceReader) ReadBalance(ctx context.Context) (*big.Int, error) {
+	return FetchTokenBalance(ctx, r.Client, r.TokenAddress, r.Address)
+}
+
+// BalanceAlert is emitted when the monitored balance crosses the low balance threshold.
+type BalanceAlert struct {
+	Address   string         `json:"address"`
+	Balance   string         `json:"balance"`
+	Threshold string         `json:"threshold"`
+	Runway    *time.Duration `json:"runway,omitempty"`
+	Degraded  bool           `json:"degraded"`
+	Timestamp int64          `json:"timestamp"`
+}
+
+// AlertSink receives balance alerts.
+type AlertSink interface {
+	Alert(ctx context.Context, alert *BalanceAlert) error
+}
+
+// LogAlertSink writes balance alerts to the log.
+type LogAlertSink struct{}
+
+var _ AlertSink = (*LogAlertSink)(nil)
+
+func (s *LogAlertSink) Alert(ctx context.Context, alert *BalanceAlert) error {
+	if alert.Degraded {
+		slog.Error("account balance is low", "address", alert.Address, "balance", alert.Balance, "threshold", alert.Threshold, "runway", alert.Runway)
+	} else {
+		slog.Info("account balance recovered", "address", alert.Address, "balance", alert.Balance, "threshold", alert.Threshold)
+	}
+	return nil
+}
+
+// WebhookAlertSink posts balance alerts as JSON to a webhook.
+type WebhookAlertSink struct {
+	url    string
+	client *http.Client
+}
+
+var _ AlertSink = (*WebhookAlertSink)(nil)
+
+// NewWebhookAlertSink creates a new WebhookAlertSink.
+func NewWebhookAlertSink(url string, client *http.Client) *WebhookAlertSink {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &WebhookAlertSink{
+		url:    url,
+		client: client,
+	}
+}
+
+func (s *WebhookAlertSink) Alert(ctx context.Context, alert *BalanceAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send alert: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// BalanceMonitorConfig is the configuration for a BalanceMonitor.
+type BalanceMonitorConfig struct {
+	Client       ProviderWrapper
+	TokenAddress *felt.Felt
+	Address      *felt.Felt
+	// Reader reads the monitored balance, defaults to the token balance of Address.
+	Reader BalanceReader
+
+	// PollInterval is how often the balance is refreshed.
+	PollInterval time.Duration
+	// LowBalanceThreshold is the balance under which the monitor is degraded.
+	LowBalanceThreshold *big.Int
+	// SpendWindow is how far back fee spend is considered for runway estimates.
+	SpendWindow time.Duration
+
+	AlertSink AlertSink
+	// OnDegradedChange is called whenever the monitor enters or leaves degraded mode.
+	OnDegradedChange func(degraded bool)
+}
+
+// BalanceStatus is a snapshot of the monitored balance.
+type BalanceStatus struct {
+	Balance   *big.Int
+	UpdatedAt time.Time
+	// SpendRate is the fee spend per hour over the spend window.
+	SpendRate *big.Int
+	// Runway is the estimated time until the balance runs out, nil if nothing was spent.
+	Runway   *time.Duration
+	Degraded bool
+}
+
+type balanceSample struct {
+	at      time.Time
+	balance *big.Int
+}
+
+// BalanceMonitor watches the fee token balance of an account, estimates its runway
+// from recent spend and switches into degraded mode when it runs low.
+type BalanceMonitor struct {
+	reader  BalanceReader
+	address *felt.Felt
+
+	pollInterval        time.Duration
+	lowBalanceThreshold *big.Int
+	spendWindow         time.Duration
+
+	alertSink        AlertSink
+	onDegradedChange func(degraded bool)
+
+	mu                  sync.RWMutex
+	samples             []balanceSample
+	degraded            bool
+	insufficientPending bool
+	insufficientBalance *big.Int
+	checkCh             chan struct{}
+}
+
+// NewBalanceMonitor creates a new BalanceMonitor with sensible defaults if none are provided.
+func NewBalanceMonitor(cfg *BalanceMonitorConfig) *BalanceMonitor {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Minute
+	}
+	if cfg.LowBalanceThreshold == nil {
+		cfg.LowBalanceThreshold = big.NewInt(0)
+	}
+	if cfg.SpendWindow <= 0 {
+		cfg.SpendWindow = 24 * time.Hour
+	}
+	if cfg.AlertSink == nil {
+		cfg.AlertSink = &LogAlertSink{}
+	}
+	if cfg.Reader == nil {
+		cfg.Reader = &TokenBalanceReader{
+			Client:       cfg.Client,
+			TokenAddress: cfg.TokenAddress,
+			Address:      cfg.Address,
+		}
+	}
+
+	return &BalanceMonitor{
+		reader:              cfg.Reader,
+		address:             cfg.Address,
+		pollInterval:        cfg.PollInterval,
+		lowBalanceThreshold: cfg.LowBalanceThreshold,
+		spendWindow:         cfg.SpendWindow,
+		alertSink:           cfg.AlertSink,
+		onDegradedChange:    cfg.OnDegradedChange,
+		checkCh:             make(chan struct{}, 1),
+	}
+}
+
+// Run polls the balance until the context is cancelled.
+func (m *BalanceMonitor) Run(ctx context.Context) error {
+	for {
+		if err := m.Check(ctx); err != nil {
+			slog.Warn("failed to check account balance", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-m.checkCh:
+		case <-time.After(m.pollInterval):
+		}
+	}
+}
+
+// MarkInsufficient records that a submission failed for lack of funds. The
+// monitor stays degraded until the balance grows past the balance at the time
+// of the failure, even if it is above the low balance threshold.
+func (m *BalanceMonitor) MarkInsufficient() {
+	m.mu.Lock()
+	m.insufficientPending = true
+	m.mu.Unlock()
+
+	select {
+	case m.checkCh <- struct{}{}:
+	default:
+	}
+}
+
+// Check refreshes the balance and updates the degraded state.
+func (m *BalanceMonitor) Check(ctx context.Context) error {
+	balance, err := m.reader.ReadBalance(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.Record(time.Now(), balance)
+
+	m.mu.Lock()
+	if m.insufficientPending {
+		m.insufficientBalance = balance
+		m.insufficientPending = false
+	}
+
+	degraded := balance.Cmp(m.lowBalanceThreshold) <= 0
+	if m.insufficientBalance != nil {
+		if balance.Cmp(m.insufficientBalance) <= 0 {
+			degraded = true
+		} else {
+			m.insufficientBalance = nil
+		}
+	}
+
+	changed := degraded != m.degraded
+	m.degraded = degraded
+	m.mu.Unlock()
+
+	status := m.Status()
+
+	if !changed {
+		return nil
+	}
+
+	if m.onDegradedChange != nil {
+		m.onDegradedChange(status.Degraded)
+	}
+
+	alert := &BalanceAlert{
+		Address:   m.address.String(),
+		Balance:   status.Balance.String(),
+		Threshold: m.lowBalanceThreshold.String(),
+		Runway:    status.Runway,
+		Degraded:  status.Degraded,
+		Timestamp: status.UpdatedAt.Unix(),
+	}
+	if err := m.alertSink.Alert(ctx, alert); err != nil {
+		slog.Warn("failed to send balance alert", "error", err)
+	}
+
+	return nil
+}
+
+// Record adds a balance sample and drops samples outside of the spend window.
+func (m *BalanceMonitor) Record(at time.Time, balance *big.Int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.samples = append(m.samples, balanceSample{at: at, balance: new(big.Int).Set(balance)})
+
+	cutoff := at.Add(-m.spendWindow)
+	for len(m.samples) > 1 && m.samples[0].at.Before(cutoff) {
+		m.samples = m.samples[1:]
+	}
+}
+
+// Status returns the latest balance with its runway estimate. Top-ups are not
+// counted as spend, so the estimate only reflects decreases between samples.
+func (m *BalanceMonitor) Status() *BalanceStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.samples) == 0 {
+		return &BalanceStatus{
+			Balance:   big.NewInt(0),
+			SpendRate: big.NewInt(0),
+			Degraded:  m.degraded,
+		}
+	}
+
+	latest := m.samples[len(m.samples)-1]
+
+	spent := big.NewInt(0)
+	for i := 1; i < len(m.samples); i++ {
+		delta := new(big.Int).Sub(m.samples[i-1].balance, m.samples[i].balance)
+		if delta.Sign() > 0 {
+			spent.Add(spent, delta)
+		}
+	}
+
+	elapsed := latest.at.Sub(m.samples[0].at)
+
+	status := &BalanceStatus{
+		Balance:   new(big.Int).Set(latest.balance),
+		UpdatedAt: latest.at,
+		SpendRate: big.NewInt(0),
+		Degraded:  m.degraded,
+	}
+
+	if spent.Sign() > 0 && elapsed > 0 {
+		status.SpendRate = new(big.Int).Div(new(big.Int).Mul(spent, big.NewInt(int64(time.Hour))), big.NewInt(int64(elapsed)))
+
+		runwayNs := new(big.Int).Div(new(big.Int).Mul(latest.balance, big.NewInt(int64(elapsed))), spent)
+		runway := time.Duration(runwayNs.Int64())
+		if !runwayNs.IsInt64() {
+			runway = time.Duration(1<<63 - 1)
+		}
+		status.Runway = &runway
+	}
+
+	return status
+}
+
+// IsDegraded reports whether the balance is too low to submit transactions.
+func (m *BalanceMonitor) IsDegraded() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.degraded
+}
@@ -0,0 +1,128 @@
+package starknet_test
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+
+	"github.com/NethermindEth/teeception/pkg/wallet/starknet"
+)
+
+type stubBalanceReader struct {
+	balance *big.Int
+}
+
+var _ starknet.BalanceReader = (*stubBalanceReader)(nil)
+
+func (r *stubBalanceReader) ReadBalance(ctx context.Context) (*big.Int, error) {
+	return r.balance, nil
+}
+
+type stubAlertSink struct {
+	mu     sync.Mutex
+	alerts []*starknet.BalanceAlert
+}
+
+var _ starknet.AlertSink = (*stubAlertSink)(nil)
+
+func (s *stubAlertSink) Alert(ctx context.Context, alert *starknet.BalanceAlert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.alerts = append(s.alerts, alert)
+	return nil
+}
+
+func TestBalanceMonitorCheck(t *testing.T) {
+	reader := &stubBalanceReader{}
+	sink := &stubAlertSink{}
+	queue := starknet.NewTxQueue(nil, nil, nil)
+
+	monitor := starknet.NewBalanceMonitor(&starknet.BalanceMonitorConfig{
+		Address:             new(felt.Felt).SetUint64(0xa),
+		Reader:              reader,
+		LowBalanceThreshold: big.NewInt(100),
+		AlertSink:           sink,
+		OnDegradedChange:    queue.SetPaused,
+	})
+
+	steps := []struct {
+		name         string
+		balance      int64
+		insufficient bool
+		degraded     bool
+		alerts       int
+	}{
+		{name: "above threshold", balance: 500, degraded: false, alerts: 0},
+		{name: "below threshold", balance: 50, degraded: true, alerts: 1},
+		{name: "topped up", balance: 200, degraded: false, alerts: 2},
+		{name: "insufficient above threshold", balance: 200, insufficient: true, degraded: true, alerts: 3},
+		{name: "balance unchanged", balance: 200, degraded: true, alerts: 3},
+		{name: "topped up after insufficient", balance: 300, degraded: false, alerts: 4},
+	}
+
+	for _, step := range steps {
+		if step.insufficient {
+			monitor.MarkInsufficient()
+		}
+
+		reader.balance = big.NewInt(step.balance)
+		if err := monitor.Check(context.Background()); err != nil {
+			t.Fatalf("%s: failed to check balance: %v", step.name, err)
+		}
+
+		if monitor.IsDegraded() != step.degraded {
+			t.Fatalf("%s: expected degraded %v", step.name, step.degraded)
+		}
+		if queue.IsPaused() != step.degraded {
+			t.Fatalf("%s: expected the queue to be paused %v", step.name, step.degraded)
+		}
+		if len(sink.alerts) != step.alerts {
+			t.Fatalf("%s: expected %d alerts, got %d", step.name, step.alerts, len(sink.alerts))
+		}
+		if step.alerts > 0 && sink.alerts[step.alerts-1].Degraded != step.degraded {
+			t.Fatalf("%s: expected the last alert to be degraded %v", step.name, step.degraded)
+		}
+	}
+}
+
+func TestBalanceMonitorRunway(t *testing.T) {
+	monitor := starknet.NewBalanceMonitor(&starknet.BalanceMonitorConfig{
+		Reader:      &stubBalanceReader{},
+		SpendWindow: 3 * time.Hour,
+	})
+
+	start := time.Unix(1700000000, 0)
+
+	if status := monitor.Status(); status.Balance.Sign() != 0 || status.Runway != nil {
+		t.Fatalf("expected no runway without samples, got %+v", status)
+	}
+
+	monitor.Record(start, big.NewInt(1000))
+	monitor.Record(start.Add(time.Hour), big.NewInt(900))
+
+	status := monitor.Status()
+	if status.SpendRate.Int64() != 100 || status.Runway == nil || *status.Runway != 9*time.Hour {
+		t.Fatalf("expected 100 per hour for 9 hours, got %v for %v", status.SpendRate, status.Runway)
+	}
+
+	// Top-ups are not counted as spend.
+	monitor.Record(start.Add(2*time.Hour), big.NewInt(2000))
+
+	status = monitor.Status()
+	if status.SpendRate.Int64() != 50 || status.Runway == nil || *status.Runway != 40*time.Hour {
+		t.Fatalf("expected 50 per hour for 40 hours, got %v for %v", status.SpendRate, status.Runway)
+	}
+
+	// Samples outside of the spend window are dropped.
+	monitor.Record(start.Add(5*time.Hour), big.NewInt(2000))
+
+	status = monitor.Status()
+	if status.SpendRate.Sign() != 0 || status.Runway != nil {
+		t.Fatalf("expected no spend within the window, got %v for %v", status.SpendRate, status.Runway)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"math/big"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/NethermindEth/juno/core/felt"
@@ -23,6 +24,10 @@ type TxQueueConfig struct {
 	// Time interval after which a batch submission is triggered when
 	// at least one function call is queued.
 	SubmissionInterval time.Duration
+
+	// OnInsufficientBalance is called when a batch is returned to the queue
+	// because the account cannot cover its fee.
+	OnInsufficientBalance func()
 }
 
 // TxQueueItem represents a single Starknet function call along with
@@ -50,6 +55,7 @@ type TxQueue struct {
 	nonceMu  sync.Mutex
 	nonce    *felt.Felt
 	running  bool
+	paused   atomic.Bool
 	submitCh chan struct{}
 }
 
@@ -147,10 +153,46 @@ func (q *TxQueue) Enqueue(ctx context.Context, calls []rpc.FunctionCall) (chan *
 	return resultCh, nil
 }
 
+// SetPaused pauses or resumes batch submission. Paused queues keep accepting
+// items and submit them once resumed.
+func (q *TxQueue) SetPaused(paused bool) {
+	if q.paused.Swap(paused) == paused {
+		return
+	}
+
+	if paused {
+		slog.Warn("pausing transaction queue")
+		return
+	}
+
+	slog.Info("resuming transaction queue")
+	select {
+	case q.submitCh <- struct{}{}:
+	default:
+	}
+}
+
+// IsPaused reports whether batch submission is paused.
+func (q *TxQueue) IsPaused() bool {
+	return q.paused.Load()
+}
+
+// Len returns the number of items waiting for submission.
+func (q *TxQueue) Len() int {
+	q.itemsMu.Lock()
+	defer q.itemsMu.Unlock()
+
+	return len(q.items)
+}
+
 // submitIfDue checks if we have a non-empty queue and tries to submit a batch.
 // It ensures that only one submission can happen at a time and no new submission
 // is triggered if another submission is still in progress.
 func (q *TxQueue) submitIfDue(ctx context.Context) {
+	if q.paused.Load() {
+		return
+	}
+
 	q.itemsMu.Lock()
 	numItems := len(q.items)
 	if numItems == 0 {
@@ -198,6 +240,11 @@ func (q *TxQueue) submitBatch(ctx context.Context, items []*TxQueueItem) {
 			q.itemsMu.Lock()
 			q.items = append(items, q.items...)
 			q.itemsMu.Unlock()
+
+			q.SetPaused(true)
+			if q.cfg.OnInsufficientBalance != nil {
+				q.cfg.OnInsufficientBalance()
+			}
 			return
 		}
 
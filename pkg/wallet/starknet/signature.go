@@ -0,0 +1,49 @@
+package starknet
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/starknet.go/rpc"
+	starknetgoutils "github.com/NethermindEth/starknet.go/utils"
+)
+
+var (
+	isValidSignatureSelector = starknetgoutils.GetSelectorFromNameFelt("is_valid_signature")
+
+	// validSignatureMagic is the short string 'VALID' returned by SRC-6 accounts,
+	// older accounts return 1 instead.
+	validSignatureMagic = new(felt.Felt).SetBytes([]byte("VALID"))
+	validSignatureOne   = new(felt.Felt).SetUint64(1)
+)
+
+// IsValidSignature asks the account contract whether signature is a valid
+// signature of hash.
+func IsValidSignature(ctx context.Context, client ProviderWrapper, accountAddress, hash *felt.Felt, signature []*felt.Felt) (bool, error) {
+	calldata := make([]*felt.Felt, 0, len(signature)+2)
+	calldata = append(calldata, hash, new(felt.Felt).SetUint64(uint64(len(signature))))
+	calldata = append(calldata, signature...)
+
+	fnCall := rpc.FunctionCall{
+		ContractAddress:    accountAddress,
+		EntryPointSelector: isValidSignatureSelector,
+		Calldata:           calldata,
+	}
+
+	var resp []*felt.Felt
+	var err error
+
+	if err := client.Do(func(provider rpc.RpcProvider) error {
+		resp, err = provider.Call(ctx, fnCall, rpc.WithBlockTag("latest"))
+		return err
+	}); err != nil {
+		return false, fmt.Errorf("failed to call is_valid_signature: %w", FormatRpcError(err))
+	}
+
+	if len(resp) < 1 {
+		return false, fmt.Errorf("invalid response length: got %d, want at least 1", len(resp))
+	}
+
+	return resp[0].Equal(validSignatureMagic) || resp[0].Equal(validSignatureOne), nil
+}
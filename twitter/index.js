@@ -3,15 +3,17 @@
  * Twitter client API wrapper around agent-twitter-client
  */
 const express = require('express')
-const { Scraper } = require('agent-twitter-client')
+const { Scraper, SearchMode } = require('agent-twitter-client')
 
 class TwitterClientApi {
     constructor() {
         /** @type {express.Express} */
         this.app = express()
-        this.app.use(express.json())
+        this.app.use(express.json({ limit: '10mb' }))
         /** @type {Scraper|null} */
         this.scraper = null
+        /** @type {string|null} */
+        this.username = null
     }
 
     /**
@@ -53,6 +55,8 @@ class TwitterClientApi {
                 undefined
             )
             
+            this.username = initializeRequest.username
+
             res.sendStatus(200)
         } catch (err) {
             console.error('Failed to initialize:', err)
@@ -72,7 +76,11 @@ class TwitterClientApi {
 
             const tweetId = req.params.id
             const tweet = await this.scraper.getTweet(tweetId)
-            res.send(tweet.text)
+            if (!tweet) {
+                res.status(404).send('tweet not found')
+                return
+            }
+            res.json(tweetJson(tweet))
         } catch (err) {
             console.error('Failed to get tweet:', err)
             res.status(500).send(`${err}`)
@@ -91,8 +99,8 @@ class TwitterClientApi {
 
             const tweetId = req.params.id
             const { reply } = req.body
-            await this.scraper.sendTweet(reply, tweetId)
-            res.sendStatus(200)
+            const response = await this.scraper.sendTweet(reply, tweetId)
+            res.json({ id: await createdTweetId(response) })
         } catch (err) {
             console.error('Failed to reply to tweet:', err)
             res.status(500).send(`${err}`)
@@ -100,23 +108,49 @@ class TwitterClientApi {
     }
 
     /**
-     * Send a tweet
-     * @param {express.Request} req - Express request object containing tweet text
+     * Send a tweet, optionally with a base64 encoded image
+     * @param {express.Request} req - Express request object containing tweet text and image
      * @param {express.Response} res - Express response object
      * @returns {Promise<void>}
      */
     async sendTweet(req, res) {
         try {
-            console.log('sendTweet', req.body)
+            console.log('sendTweet', req.body.tweet)
 
-            const { tweet } = req.body
-            await this.scraper.sendTweet(tweet)
-            res.sendStatus(200)
+            const { tweet, image, imageType } = req.body
+            const media = image ? [{ data: Buffer.from(image, 'base64'), mediaType: imageType || 'image/png' }] : undefined
+            const response = await this.scraper.sendTweet(tweet, undefined, media)
+            res.json({ id: await createdTweetId(response) })
         } catch (err) {
             console.error('Failed to send tweet:', err)
             res.status(500).send(`${err}`)
         }
     }
+    /**
+     * Get the latest mentions of the logged in user, oldest first
+     * @param {express.Request} req - Express request object containing the sinceId query parameter
+     * @param {express.Response} res - Express response object
+     * @returns {Promise<void>}
+     */
+    async getMentions(req, res) {
+        try {
+            const sinceId = BigInt(req.query.sinceId || 0)
+
+            const mentions = []
+            for await (const tweet of this.scraper.searchTweets(`@${this.username}`, 100, SearchMode.Latest)) {
+                if (BigInt(tweet.id) <= sinceId) {
+                    break
+                }
+                mentions.push(tweetJson(tweet))
+            }
+
+            res.json(mentions.reverse())
+        } catch (err) {
+            console.error('Failed to get mentions:', err)
+            res.status(500).send(`${err}`)
+        }
+    }
+
     /**
      * Start the API server
      * @param {number} port - Port number to listen on
@@ -127,6 +161,7 @@ class TwitterClientApi {
         this.app.get('/tweet/:id', this.getTweet.bind(this))
         this.app.post('/reply/:id', this.replyToTweet.bind(this))
         this.app.post('/tweet', this.sendTweet.bind(this))
+        this.app.get('/mentions', this.getMentions.bind(this))
 
         return new Promise((resolve) => {
             this.app.listen(port, () => {
@@ -137,6 +172,40 @@ class TwitterClientApi {
     }
 }
 
+/**
+ * Serialize a tweet with its author and metadata
+ * @param {Tweet} tweet - Tweet returned by the scraper
+ * @returns {object}
+ */
+function tweetJson(tweet) {
+    return {
+        id: tweet.id,
+        text: tweet.text,
+        userId: tweet.userId,
+        username: tweet.username,
+        timestamp: tweet.timestamp,
+        conversationId: tweet.conversationId,
+        mentions: (tweet.mentions || []).map((mention) => mention.username),
+        hashtags: tweet.hashtags || [],
+        urls: tweet.urls || [],
+    }
+}
+
+/**
+ * Extract the ID of a created tweet so that callers can thread replies to it
+ * @param {Response} response - Response of the create tweet request
+ * @returns {Promise<string|null>}
+ */
+async function createdTweetId(response) {
+    try {
+        const body = await response.json()
+        return body?.data?.create_tweet?.tweet_results?.result?.rest_id ?? null
+    } catch (err) {
+        console.error('Failed to read created tweet id:', err)
+        return null
+    }
+}
+
 /**
  * Main entry point
  * @returns {Promise<void>}